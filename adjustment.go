@@ -0,0 +1,123 @@
+package card
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrReasonRequired is returned when an adjustment has no reason.
+var ErrReasonRequired = newError("REASON_REQUIRED", "adjustment reason is required")
+
+// Adjust applies a manual correction to the available balance held in the
+// given currency: positive amounts credit the account and negative amounts
+// debit it, up to the spendable balance. The reason is recorded as the
+// description of the resulting Adjustment transaction. Unlike spending,
+// adjustments are permitted on frozen accounts.
+func (a *Account) Adjust(ctx context.Context, amount *apd.Decimal, currency, reason string, opts ...TransactionOption) error {
+	err := ctx.Err()
+
+	if err != nil {
+		return err
+	}
+
+	o := newTransactionOptions(opts)
+	_, replayed, err := a.replay(o.idempotencyKey, Adjustment)
+
+	if err != nil || replayed {
+		return err
+	}
+
+	err = a.checkStatus(Adjustment)
+
+	if err != nil {
+		return err
+	}
+
+	reason = strings.TrimSpace(reason)
+
+	if reason == "" {
+		return ErrReasonRequired
+	}
+
+	if amount == nil {
+		return ErrInvalidAmount
+	}
+
+	if amount.Form != apd.Finite || amount.IsZero() {
+		return amountError(ErrInvalidAmount, amount, nil)
+	}
+
+	p, exists := a.pocket(currency)
+
+	if !exists {
+		return errors.Wrapf(ErrCurrencyMismatch, "%s", currency)
+	}
+
+	if amount.Sign() < 0 {
+		spendable, err := a.spendable(p, currency)
+
+		if err != nil {
+			return err
+		}
+
+		debit := new(apd.Decimal).Neg(amount)
+
+		if spendable.Cmp(debit) < 0 {
+			return amountError(ErrUnderflow, debit, spendable)
+		}
+	}
+
+	_, err = a.decimalContext().Add(p.Available, p.Available, amount)
+
+	if err != nil {
+		return err
+	}
+
+	t := Transaction{
+		Type:     Adjustment,
+		Amount:   apd.New(0, 0).Set(amount),
+		Currency: currency,
+	}
+	o.annotate(&t)
+	t.Description = reason
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+	a.notify(t)
+
+	return nil
+}
+
+// ReleaseAuthorization reverses the remaining amount of the given
+// authorization, returning the amount released. It's intended for support
+// staff releasing holds merchants will never capture; authorizations without
+// a remaining amount are left untouched.
+func (a *Account) ReleaseAuthorization(ctx context.Context, id int, opts ...TransactionOption) (*apd.Decimal, error) {
+	au, err := a.Authorization(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := au.remaining(a.decimalContext())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining.Sign() <= 0 {
+		return apd.New(0, 0), nil
+	}
+
+	err = a.Reverse(ctx, id, remaining, au.Currency, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return remaining, nil
+}
@@ -0,0 +1,81 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjust(t *testing.T) {
+	account := NewAccount(0, WithInitialBalance(apd.New(100, 0)))
+
+	require.NoError(t, account.Adjust(ctx, apd.New(15, 0), DefaultCurrency, " goodwill credit "))
+	require.NoError(t, account.Adjust(ctx, apd.New(-5, 0), DefaultCurrency, "duplicate load"))
+	require.Equal(t, "110", account.Available.String())
+	require.NoError(t, account.Validate())
+
+	credit, debit := account.Transactions[1], account.Transactions[2]
+
+	require.Equal(t, Adjustment, credit.Type)
+	require.Equal(t, "goodwill credit", credit.Description)
+	require.Equal(t, "15", credit.Amount.String())
+	require.Equal(t, "-5", debit.Amount.String())
+
+	for _, v := range []struct {
+		amount   *apd.Decimal
+		currency string
+		reason   string
+		err      error
+	}{
+		{apd.New(1, 0), DefaultCurrency, " ", ErrReasonRequired},
+		{nil, DefaultCurrency, "reason", ErrInvalidAmount},
+		{apd.New(0, 0), DefaultCurrency, "reason", ErrInvalidAmount},
+		{apd.New(1, 0), "EUR", "reason", ErrCurrencyMismatch},
+		{apd.New(-111, 0), DefaultCurrency, "reason", ErrUnderflow},
+	} {
+		require.Equal(t, v.err, errors.Cause(account.Adjust(ctx, v.amount, v.currency, v.reason)))
+	}
+
+	require.Equal(t, "110", account.Available.String())
+
+	t.Run("Frozen", func(t *testing.T) {
+		require.NoError(t, account.Freeze())
+		require.NoError(t, account.Adjust(ctx, apd.New(-10, 0), DefaultCurrency, "chargeback"))
+		require.Equal(t, "100", account.Available.String())
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.Adjust(ctx, apd.New(1, 0), DefaultCurrency, "reason"))
+	})
+}
+
+func TestReleaseAuthorization(t *testing.T) {
+	account := NewAccount(0, WithInitialBalance(apd.New(100, 0)))
+	au, err := account.Authorize(ctx, merchantID, apd.New(40, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(15, 0), DefaultCurrency))
+	require.NoError(t, account.Freeze())
+
+	released, err := account.ReleaseAuthorization(ctx, au.ID, WithDescription("merchant unresponsive"))
+
+	require.NoError(t, err)
+	require.Equal(t, "25", released.String())
+	require.Equal(t, "85", account.Available.String())
+	require.Equal(t, "0", account.Blocked.String())
+	require.Equal(t, AuthorizationCaptured, au.Status)
+	require.Equal(t, "merchant unresponsive", account.Transactions[len(account.Transactions)-1].Description)
+
+	released, err = account.ReleaseAuthorization(ctx, au.ID)
+
+	require.NoError(t, err)
+	require.True(t, released.IsZero())
+
+	_, err = account.ReleaseAuthorization(ctx, 99)
+
+	require.Equal(t, ErrAuthorizationNotFound, errors.Cause(err))
+}
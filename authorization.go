@@ -0,0 +1,236 @@
+package card
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Authorization statuses.
+const (
+	AuthorizationOpen AuthorizationStatus = iota
+	AuthorizationPartiallyCaptured
+	AuthorizationCaptured
+	AuthorizationReversed
+)
+
+// DefaultAuthorizationTTL is the validity period of authorizations for
+// accounts without an explicit AuthorizationTTL.
+const DefaultAuthorizationTTL = 7 * 24 * time.Hour
+
+// Authorization errors.
+var (
+	ErrAuthorizationNotFound = newError("AUTHORIZATION_NOT_FOUND", "authorization record not found")
+	ErrAuthorizationExpired  = newError("AUTHORIZATION_EXPIRED", "authorization has expired")
+)
+
+// AuthorizationStatus represents the state of an authorization.
+type AuthorizationStatus uint8
+
+func (s AuthorizationStatus) String() string {
+	switch s {
+	case AuthorizationOpen:
+		return "OPEN"
+	case AuthorizationPartiallyCaptured:
+		return "PARTIALLY_CAPTURED"
+	case AuthorizationCaptured:
+		return "CAPTURED"
+	case AuthorizationReversed:
+		return "REVERSED"
+	}
+
+	return "UNKNOWN"
+}
+
+// Authorization represents an amount held for a merchant. Captures,
+// reversals and refunds are applied against the originating authorization.
+// The authorization ID is the ID of the AUTHORIZE transaction.
+type Authorization struct {
+	ID         int                 `json:"id"`
+	MerchantID int                 `json:"merchantID"`
+	Amount     *apd.Decimal        `json:"amount"`
+	Currency   string              `json:"currency"`
+	Captured   *apd.Decimal        `json:"captured"`
+	Reversed   *apd.Decimal        `json:"reversed"`
+	Refunded   *apd.Decimal        `json:"refunded"`
+	Status     AuthorizationStatus `json:"status"`
+	ExpiresAt  time.Time           `json:"expiresAt"`
+}
+
+// Remaining returns the authorized amount neither captured nor reversed,
+// computed with the context set by SetDecimalContext.
+func (au *Authorization) Remaining() (*apd.Decimal, error) {
+	return au.remaining(getContext())
+}
+
+// remaining returns the authorized amount neither captured nor reversed,
+// computed with the given context.
+func (au *Authorization) remaining(dctx *apd.Context) (*apd.Decimal, error) {
+	remaining := apd.New(0, 0)
+	_, err := dctx.Sub(remaining, au.Amount, au.Captured)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dctx.Sub(remaining, remaining, au.Reversed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return remaining, nil
+}
+
+// Refundable returns the captured amount not yet refunded, computed with the
+// context set by SetDecimalContext.
+func (au *Authorization) Refundable() (*apd.Decimal, error) {
+	return au.refundable(getContext())
+}
+
+// refundable returns the captured amount not yet refunded, computed with the
+// given context.
+func (au *Authorization) refundable(dctx *apd.Context) (*apd.Decimal, error) {
+	refundable := apd.New(0, 0)
+	_, err := dctx.Sub(refundable, au.Captured, au.Refunded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return refundable, nil
+}
+
+// updateStatus derives the authorization status from its amounts.
+func (au *Authorization) updateStatus(dctx *apd.Context) error {
+	remaining, err := au.remaining(dctx)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case remaining.Sign() > 0 && au.Captured.IsZero():
+		au.Status = AuthorizationOpen
+	case remaining.Sign() > 0:
+		au.Status = AuthorizationPartiallyCaptured
+	case au.Captured.IsZero():
+		au.Status = AuthorizationReversed
+	default:
+		au.Status = AuthorizationCaptured
+	}
+
+	return nil
+}
+
+// Expired reports whether the authorization has expired at the given time.
+// Authorizations without an expiry time never expire.
+func (au *Authorization) Expired(now time.Time) bool {
+	return !au.ExpiresAt.IsZero() && !now.Before(au.ExpiresAt)
+}
+
+// authorizationTTL returns the validity period of new authorizations.
+func (a *Account) authorizationTTL() time.Duration {
+	if a.AuthorizationTTL > 0 {
+		return a.AuthorizationTTL
+	}
+
+	return DefaultAuthorizationTTL
+}
+
+// ExpireAuthorizations reverses the remaining amount of every authorization
+// expired at the given time, returning the total amount released in each
+// authorization currency; currencies without released holds are omitted.
+// Holds on closed accounts are never released.
+func (a *Account) ExpireAuthorizations(now time.Time) (map[string]*apd.Decimal, error) {
+	if a.Status == Closed {
+		return map[string]*apd.Decimal{}, nil
+	}
+
+	ids := make([]int, 0, len(a.Authorizations))
+
+	for id, au := range a.Authorizations {
+		if au.Expired(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+
+	var (
+		freed = map[string]*apd.Decimal{}
+		dctx  = a.decimalContext()
+	)
+
+	for _, id := range ids {
+		au := a.Authorizations[id]
+		remaining, err := au.remaining(dctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if remaining.Sign() <= 0 {
+			continue
+		}
+
+		err = a.Reverse(context.Background(), id, remaining, au.Currency, WithDescription("authorization expired"), WithOrigin(OriginSystem))
+
+		if err != nil {
+			return nil, err
+		}
+
+		total, exists := freed[au.Currency]
+
+		if !exists {
+			total = apd.New(0, 0)
+			freed[au.Currency] = total
+		}
+
+		_, err = dctx.Add(total, total, remaining)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return freed, nil
+}
+
+// Authorization returns the authorization for the given ID.
+func (a *Account) Authorization(id int) (*Authorization, error) {
+	au, exists := a.Authorizations[id]
+
+	if !exists {
+		return nil, errors.Wrapf(ErrAuthorizationNotFound, "ID: %d", id)
+	}
+
+	return au, nil
+}
+
+// authorizationPocket returns the authorization, currency pocket and merchant
+// records for the given authorization ID.
+func (a *Account) authorizationPocket(id int) (*Authorization, *Pocket, *Merchant, error) {
+	au, err := a.Authorization(id)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p, exists := a.pocket(au.Currency)
+
+	if !exists {
+		return nil, nil, nil, errors.Wrapf(ErrCurrencyMismatch, "%s (authorization: %d)", au.Currency, id)
+	}
+
+	m, exists := p.Merchants[au.MerchantID]
+
+	if !exists {
+		return nil, nil, nil, errors.Wrapf(ErrMerchantNotFound, "ID: %d", au.MerchantID)
+	}
+
+	return au, p, m, nil
+}
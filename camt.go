@@ -0,0 +1,258 @@
+package card
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/cockroachdb/apd"
+)
+
+// camt053Namespace is the XML namespace of camt.053.001.02 documents.
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+// camtTimeFormat is the ISO 20022 date and time layout.
+const camtTimeFormat = "2006-01-02T15:04:05Z"
+
+// camtDocument is an ISO 20022 camt.053 bank-to-customer statement message.
+type camtDocument struct {
+	XMLName   xml.Name      `xml:"Document"`
+	Namespace string        `xml:"xmlns,attr"`
+	Message   camtStatement `xml:"BkToCstmrStmt"`
+}
+
+type camtStatement struct {
+	MessageID  string                 `xml:"GrpHdr>MsgId"`
+	Created    string                 `xml:"GrpHdr>CreDtTm"`
+	Statements []camtAccountStatement `xml:"Stmt"`
+}
+
+type camtAccountStatement struct {
+	ID       string        `xml:"Id"`
+	Created  string        `xml:"CreDtTm"`
+	Period   *camtPeriod   `xml:"FrToDt,omitempty"`
+	Account  string        `xml:"Acct>Id>Othr>Id"`
+	Currency string        `xml:"Acct>Ccy"`
+	Balances []camtBalance `xml:"Bal"`
+	Summary  camtSummary   `xml:"TxsSummry"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtPeriod struct {
+	From string `xml:"FrDtTm"`
+	To   string `xml:"ToDtTm"`
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>DtTm"`
+}
+
+type camtSummary struct {
+	Entries      string `xml:"TtlNtries>NbOfNtries"`
+	CreditCount  string `xml:"TtlCdtNtries>NbOfNtries"`
+	CreditAmount string `xml:"TtlCdtNtries>Sum"`
+	DebitCount   string `xml:"TtlDbtNtries>NbOfNtries"`
+	DebitAmount  string `xml:"TtlDbtNtries>Sum"`
+}
+
+type camtEntry struct {
+	Reference         string       `xml:"NtryRef"`
+	Amount            camtAmount   `xml:"Amt"`
+	Indicator         string       `xml:"CdtDbtInd"`
+	Status            string       `xml:"Sts"`
+	Booked            string       `xml:"BookgDt>DtTm"`
+	Value             string       `xml:"ValDt>DtTm"`
+	ServicerReference string       `xml:"AcctSvcrRef"`
+	Code              string       `xml:"BkTxCd>Prtry>Cd"`
+	Details           *camtDetails `xml:"NtryDtls>TxDtls,omitempty"`
+}
+
+type camtDetails struct {
+	EndToEndID *string      `xml:"Refs>EndToEndId,omitempty"`
+	Parties    *camtParties `xml:"RltdPties,omitempty"`
+	Remittance *string      `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+type camtParties struct {
+	Debtor   *string `xml:"Dbtr>Nm,omitempty"`
+	Creditor *string `xml:"Cdtr>Nm,omitempty"`
+}
+
+// ExportCAMT053 writes the posted transactions as an ISO 20022 camt.053
+// bank-to-customer statement with a statement per held currency, for import
+// into treasury systems. Loads and refunds are credits, captures are debits
+// and adjustments are either, according to their sign, each booked entry carrying the operation as its proprietary bank
+// transaction code and the merchant as its counterparty; authorizations and
+// reversals only hold funds and are omitted. The closing booked and available
+// balances are reported.
+func (a *Account) ExportCAMT053(w io.Writer, opts ...StatementOption) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	balances, err := a.Balances(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		o           = newStatementOptions(opts)
+		now         = a.now().UTC()
+		created     = now.Format(camtTimeFormat)
+		messageID   = "CARD-" + strconv.Itoa(a.ID) + "-" + now.Format("20060102150405")
+		selected, _ = a.page(o)
+		doc         = camtDocument{
+			Namespace: camt053Namespace,
+			Message:   camtStatement{MessageID: messageID, Created: created},
+		}
+	)
+
+	for _, currency := range a.Currencies() {
+		var (
+			transactions = postedTransactions(selected, currency)
+			balance      = balances[currency]
+			credits      = apd.New(0, 0)
+			debits       = apd.New(0, 0)
+			creditCount  int
+			stmt         = camtAccountStatement{
+				ID:       messageID + "-" + currency,
+				Created:  created,
+				Account:  strconv.Itoa(a.ID),
+				Currency: currency,
+				Balances: []camtBalance{
+					newCAMTBalance("CLBD", balance.Total, currency, created),
+					newCAMTBalance("CLAV", balance.Available, currency, created),
+				},
+			}
+		)
+
+		for i, v := range transactions {
+			ts := v.Timestamp.UTC().Format(camtTimeFormat)
+
+			if i == 0 {
+				stmt.Period = &camtPeriod{ts, ts}
+			}
+
+			// The layout sorts lexically in time order
+			if ts < stmt.Period.From {
+				stmt.Period.From = ts
+			}
+
+			if ts > stmt.Period.To {
+				stmt.Period.To = ts
+			}
+
+			var (
+				indicator, sum = "CRDT", credits
+				amount         = new(apd.Decimal).Abs(v.Amount)
+			)
+
+			// Adjustments and chargebacks are debits when negative
+			if v.Type == Capture || v.Amount.Sign() < 0 {
+				indicator, sum = "DBIT", debits
+			} else {
+				creditCount++
+			}
+
+			_, err = a.decimalContext().Add(sum, sum, amount)
+
+			if err != nil {
+				return err
+			}
+
+			entry := camtEntry{
+				Reference:         strconv.Itoa(v.ID),
+				Amount:            camtAmount{currency, amount.Text('f')},
+				Indicator:         indicator,
+				Status:            "BOOK",
+				Booked:            ts,
+				Value:             ts,
+				ServicerReference: strconv.Itoa(v.ID),
+				Code:              v.Type.String(),
+			}
+
+			if v.MerchantID != nil || v.Reference != "" || v.Description != "" {
+				entry.Details = &camtDetails{
+					EndToEndID: optionalString(v.Reference),
+					Remittance: optionalString(v.Description),
+				}
+
+				// Merchants are paid by captures and pay refunds
+				if v.MerchantID != nil {
+					name := o.payee(v)
+					entry.Details.Parties = &camtParties{Debtor: &name}
+
+					if v.Type == Capture {
+						entry.Details.Parties = &camtParties{Creditor: &name}
+					}
+				}
+			}
+
+			stmt.Entries = append(stmt.Entries, entry)
+		}
+
+		stmt.Summary = camtSummary{
+			Entries:      strconv.Itoa(len(transactions)),
+			CreditCount:  strconv.Itoa(creditCount),
+			CreditAmount: credits.Text('f'),
+			DebitCount:   strconv.Itoa(len(transactions) - creditCount),
+			DebitAmount:  debits.Text('f'),
+		}
+		doc.Message.Statements = append(doc.Message.Statements, stmt)
+	}
+
+	_, err = io.WriteString(w, xml.Header)
+
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(doc)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// newCAMTBalance returns a camt.053 balance of the given type. Negative
+// balances, e.g. overdrafts, are reported as debits.
+func newCAMTBalance(code string, amount *apd.Decimal, currency, date string) camtBalance {
+	indicator := "CRDT"
+
+	if amount.Sign() < 0 {
+		indicator = "DBIT"
+	}
+
+	return camtBalance{
+		Type:      code,
+		Amount:    camtAmount{currency, new(apd.Decimal).Abs(amount).Text('f')},
+		Indicator: indicator,
+		Date:      date,
+	}
+}
+
+// optionalString returns a pointer to the given string, or nil if it's empty.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
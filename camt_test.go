@@ -0,0 +1,93 @@
+package card_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCAMT053(t *testing.T) {
+	account := newExportAccount(t)
+	merchants := NewMerchantRegistry(MerchantInfo{ID: 1, Name: "Fish & Chips", MCC: "5814", Country: "GB"})
+
+	var sb strings.Builder
+
+	require.NoError(t, account.ExportCAMT053(&sb, WithMerchantRegistry(merchants)))
+
+	camt := sb.String()
+
+	require.True(t, strings.HasPrefix(camt, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"))
+	require.Contains(t, camt, `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">`)
+	require.Contains(t, camt, "<Nm>Fish &amp; Chips</Nm>")
+
+	var doc struct {
+		Statements []struct {
+			ID       string `xml:"Id"`
+			Account  string `xml:"Acct>Id>Othr>Id"`
+			Currency string `xml:"Acct>Ccy"`
+			Balances []struct {
+				Type      string `xml:"Tp>CdOrPrtry>Cd"`
+				Amount    string `xml:"Amt"`
+				Indicator string `xml:"CdtDbtInd"`
+			} `xml:"Bal"`
+			Credits string `xml:"TxsSummry>TtlCdtNtries>Sum"`
+			Debits  string `xml:"TxsSummry>TtlDbtNtries>Sum"`
+			Entries []struct {
+				Reference string `xml:"NtryRef"`
+				Amount    struct {
+					Value    string `xml:",chardata"`
+					Currency string `xml:"Ccy,attr"`
+				} `xml:"Amt"`
+				Indicator   string `xml:"CdtDbtInd"`
+				Code        string `xml:"BkTxCd>Prtry>Cd"`
+				Debtor      string `xml:"NtryDtls>TxDtls>RltdPties>Dbtr>Nm"`
+				Creditor    string `xml:"NtryDtls>TxDtls>RltdPties>Cdtr>Nm"`
+				Remittance  string `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+				BookingDate string `xml:"BookgDt>DtTm"`
+			} `xml:"Ntry"`
+		} `xml:"BkToCstmrStmt>Stmt"`
+	}
+
+	require.NoError(t, xml.Unmarshal([]byte(camt), &doc))
+	require.Len(t, doc.Statements, 1)
+
+	stmt := doc.Statements[0]
+
+	require.Equal(t, "CARD-7-20180601093000-GBP", stmt.ID)
+	require.Equal(t, "7", stmt.Account)
+	require.Equal(t, "GBP", stmt.Currency)
+	require.Len(t, stmt.Balances, 2)
+	require.Equal(t, "CLBD", stmt.Balances[0].Type)
+	require.Equal(t, "909.75", stmt.Balances[0].Amount)
+	require.Equal(t, "CLAV", stmt.Balances[1].Type)
+	require.Equal(t, "907.25", stmt.Balances[1].Amount)
+	require.Equal(t, "CRDT", stmt.Balances[1].Indicator)
+	require.Equal(t, "919.75", stmt.Credits)
+	require.Equal(t, "10", stmt.Debits)
+	require.Len(t, stmt.Entries, 3)
+
+	load, capture, refund := stmt.Entries[0], stmt.Entries[1], stmt.Entries[2]
+
+	require.Equal(t, "1", load.Reference)
+	require.Equal(t, "915.75", load.Amount.Value)
+	require.Equal(t, "GBP", load.Amount.Currency)
+	require.Equal(t, "CRDT", load.Indicator)
+	require.Equal(t, "LOAD", load.Code)
+	require.Equal(t, "Top up", load.Remittance)
+	require.Equal(t, "2018-06-01T09:30:00Z", load.BookingDate)
+	require.Equal(t, "3", capture.Reference)
+	require.Equal(t, "DBIT", capture.Indicator)
+	require.Equal(t, "CAPTURE", capture.Code)
+	require.Equal(t, "Fish & Chips", capture.Creditor)
+	require.Equal(t, "5", refund.Reference)
+	require.Equal(t, "CRDT", refund.Indicator)
+	require.Equal(t, "Fish & Chips", refund.Debtor)
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.ExportCAMT053(&sb))
+	})
+}
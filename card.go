@@ -1,6 +1,13 @@
 package card
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/cockroachdb/apd"
 	"github.com/pkg/errors"
 )
@@ -12,15 +19,24 @@ const (
 	Capture
 	Reverse
 	Refund
+	Adjustment
+	Chargeback
 )
 
 // Compile-time verification of Card interface implementation for the Account struct.
 var _ Card = (*Account)(nil)
 
+// DefaultCurrency is the ISO 4217 currency code assigned to new accounts.
+const DefaultCurrency = "GBP"
+
 // Account method errors.
 var (
-	ErrUnderflow        = errors.New("requested amount exceeds available amount")
-	ErrMerchantNotFound = errors.New("merchant record not found")
+	ErrUnderflow           = newError("UNDERFLOW", "requested amount exceeds available amount")
+	ErrMerchantNotFound    = newError("MERCHANT_NOT_FOUND", "merchant record not found")
+	ErrCurrencyMismatch    = newError("CURRENCY_MISMATCH", "amount currency is not held by the account")
+	ErrTransactionNotFound = newError("TRANSACTION_NOT_FOUND", "transaction record not found")
+	ErrInvalidAmount       = newError("INVALID_AMOUNT", "amount must be greater than zero")
+	ErrInvalidOperation    = newError("INVALID_OPERATION", "invalid operation")
 )
 
 // Operation represents a transaction operation.
@@ -38,11 +54,70 @@ func (op Operation) String() string {
 		return "REVERSE"
 	case Refund:
 		return "REFUND"
+	case Adjustment:
+		return "ADJUSTMENT"
+	case Chargeback:
+		return "CHARGEBACK"
 	}
 
 	return "UNKNOWN"
 }
 
+// ParseOperation returns the operation for the given name.
+func ParseOperation(s string) (Operation, error) {
+	for op := Load; op <= Chargeback; op++ {
+		if strings.EqualFold(s, op.String()) {
+			return op, nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidOperation, "%q", s)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (op Operation) MarshalText() ([]byte, error) {
+	if op > Chargeback {
+		return nil, errors.Wrapf(ErrInvalidOperation, "%d", op)
+	}
+
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (op *Operation) UnmarshalText(text []byte) error {
+	v, err := ParseOperation(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*op = v
+
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, accepting
+// operation names and the numeric values persisted by earlier versions.
+func (op *Operation) UnmarshalJSON(data []byte) error {
+	var s string
+
+	err := json.Unmarshal(data, &s)
+
+	if err == nil {
+		return op.UnmarshalText([]byte(s))
+	}
+
+	v, err := strconv.ParseUint(string(data), 10, 8)
+
+	if err != nil || Operation(v) > Chargeback {
+		return errors.Wrapf(ErrInvalidOperation, "%s", data)
+	}
+
+	*op = Operation(v)
+
+	return nil
+}
+
 // Card represents the prepaid card account interface.
 type Card interface {
 	Loader
@@ -55,245 +130,735 @@ type Card interface {
 
 // Loader defines the account loader interface.
 type Loader interface {
-	Load(amount *apd.Decimal) error
+	Load(ctx context.Context, amount *apd.Decimal, currency string, opts ...TransactionOption) error
 }
 
 // Authorizer defines the account authorization request interface.
 type Authorizer interface {
-	Authorize(merchantID int, amount *apd.Decimal) error
+	Authorize(ctx context.Context, merchantID int, amount *apd.Decimal, currency string, opts ...TransactionOption) (*Authorization, error)
 }
 
 // Capturer defines the account loader interface.
 type Capturer interface {
-	Capture(merchantID int, amount *apd.Decimal) error
+	Capture(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error
 }
 
 // Reverser defines the reverse authorization interface.
 type Reverser interface {
-	Reverse(merchantID int, amount *apd.Decimal) error
+	Reverse(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error
 }
 
 // Refunder defines the refund interface.
 type Refunder interface {
-	Refund(merchantID int, amount *apd.Decimal) error
+	Refund(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error
 }
 
 // Balancer defines the account balance interface.
 type Balancer interface {
-	Balance() (*Balance, error)
+	Balance(ctx context.Context) (*Balance, error)
 }
 
 // Account represents a prepaid card account.
 type Account struct {
-	ID           int               `json:"id"`
-	Available    *apd.Decimal      `json:"available"`
-	Blocked      *apd.Decimal      `json:"blocked"`
-	Merchants    map[int]*Merchant `json:"merchants,omitempty"`
-	Transactions []Transaction     `json:"transactions,omitempty"`
+	ID                   int                          `json:"id"`
+	Status               Status                       `json:"status"`
+	Currency             string                       `json:"currency"`
+	Available            *apd.Decimal                 `json:"available"`
+	Blocked              *apd.Decimal                 `json:"blocked"`
+	Overdraft            *apd.Decimal                 `json:"overdraft,omitempty"`
+	TopUp                *TopUp                       `json:"topUp,omitempty"`
+	Merchants            map[int]*Merchant            `json:"merchants,omitempty"`
+	Pockets              map[string]*Pocket           `json:"pockets,omitempty"`
+	Authorizations       map[int]*Authorization       `json:"authorizations,omitempty"`
+	Transactions         []Transaction                `json:"transactions,omitempty"`
+	LastTransactionID    int                          `json:"lastTransactionID"`
+	AuthorizationTTL     time.Duration                `json:"authorizationTTL,omitempty"`
+	Limits               []Limit                      `json:"limits,omitempty"`
+	CategoryRules        *CategoryRules               `json:"categoryRules,omitempty"`
+	IdempotencyKeys      map[string]IdempotencyRecord `json:"idempotencyKeys,omitempty"`
+	IdempotencyRetention time.Duration                `json:"idempotencyRetention,omitempty"`
+	Schedules            map[int]*Schedule            `json:"schedules,omitempty"`
+	LastScheduleID       int                          `json:"lastScheduleID,omitempty"`
+	Mandates             map[int]*Mandate             `json:"mandates,omitempty"`
+	LastMandateID        int                          `json:"lastMandateID,omitempty"`
+	Disputes             map[int]*Dispute             `json:"disputes,omitempty"`
+	LastDisputeID        int                          `json:"lastDisputeID,omitempty"`
+
+	// Version is incremented by every mutation, letting clients detect
+	// concurrent updates.
+	Version int `json:"version"`
+
+	// Registry provides merchant categories for category rules.
+	Registry *MerchantRegistry `json:"-"`
+
+	// Rates converts amounts in currencies the account doesn't hold.
+	Rates RateProvider `json:"-"`
+
+	// Clock returns the current time for transaction timestamps,
+	// defaulting to time.Now when nil.
+	Clock func() time.Time `json:"-"`
+
+	// DecimalContext is the context of the account's decimal arithmetic,
+	// defaulting to the context set by SetDecimalContext when nil. Its
+	// precision and rounding mode are persisted as the decimal field; its
+	// other settings are those of apd.BaseContext once decoded.
+	DecimalContext *apd.Context `json:"-"`
+
+	// observers are notified of each successful operation.
+	observers []func(Transaction)
+
+	// topUpObservers are notified of each failed automatic top-up.
+	topUpObservers []func(error)
 }
 
 // Merchant represents a merchant.
 type Merchant struct {
 	Available *apd.Decimal `json:"available"`
 	Captured  *apd.Decimal `json:"captured"`
+	Limit     *apd.Decimal `json:"limit,omitempty"`
+
+	// Settled is the total captured amount settled to the merchant.
+	Settled *apd.Decimal `json:"settled,omitempty"`
 }
 
 // Transaction represents a prepaid card transaction.
 type Transaction struct {
-	Type       Operation    `json:"type"`
-	MerchantID *int         `json:"merchantID,omitempty"`
-	Amount     *apd.Decimal `json:"amount"`
+	ID              int          `json:"id"`
+	Type            Operation    `json:"type"`
+	MerchantID      *int         `json:"merchantID,omitempty"`
+	AuthorizationID *int         `json:"authorizationID,omitempty"`
+	Amount          *apd.Decimal `json:"amount"`
+	Currency        string       `json:"currency"`
+	Timestamp       time.Time    `json:"timestamp"`
+
+	// OriginalTransactionID links reversals and refunds to the authorization
+	// or capture they relate to.
+	OriginalTransactionID *int `json:"originalTransactionID,omitempty"`
+
+	// MandateID links payments pulled by a merchant to their mandate.
+	MandateID *int `json:"mandateID,omitempty"`
+
+	// DisputeID links chargebacks and refunds to the dispute they resolve.
+	DisputeID *int `json:"disputeID,omitempty"`
+
+	// Original amount and currency of converted amounts.
+	OriginalAmount   *apd.Decimal `json:"originalAmount,omitempty"`
+	OriginalCurrency string       `json:"originalCurrency,omitempty"`
+
+	// Metadata tying the transaction to upstream systems.
+	Description string `json:"description,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Origin      Origin `json:"origin,omitempty"`
 }
 
 // Balance represents a prepaid card balance.
 type Balance struct {
-	Total     *apd.Decimal
-	Available *apd.Decimal
-	Blocked   *apd.Decimal
+	Total     *apd.Decimal `json:"total"`
+	Available *apd.Decimal `json:"available"`
+	Blocked   *apd.Decimal `json:"blocked"`
+
+	// Overdraft used and remaining, nil without an overdraft.
+	OverdraftUsed     *apd.Decimal `json:"overdraftUsed,omitempty"`
+	OverdraftHeadroom *apd.Decimal `json:"overdraftHeadroom,omitempty"`
 }
 
-// NewAccount returns a new account instance.
-func NewAccount(id int) *Account {
-	return &Account{
-		ID:        id,
-		Available: apd.New(0, 0),
-		Blocked:   apd.New(0, 0),
+// NewAccount returns a new account instance configured by the given options.
+// Options aren't validated; use the corresponding setters for untrusted
+// input.
+func NewAccount(id int, opts ...Option) *Account {
+	o := newAccountOptions(opts)
+	a := &Account{
+		ID:             id,
+		Currency:       o.currency,
+		Available:      apd.New(0, 0),
+		Blocked:        apd.New(0, 0),
+		Overdraft:      o.overdraft,
+		Merchants:      map[int]*Merchant{},
+		Limits:         o.limits,
+		Registry:       o.registry,
+		Rates:          o.rates,
+		Clock:          o.clock,
+		DecimalContext: o.decimalContext,
 	}
+
+	if o.initialBalance != nil && o.initialBalance.Form == apd.Finite && o.initialBalance.Sign() > 0 {
+		// Can't fail: the account is active and the amount is positive
+		a.Load(context.Background(), o.initialBalance, a.Currency)
+	}
+
+	return a
 }
 
-func getContext() *apd.Context {
-	// Comply with GAAP decimal precision
-	return apd.BaseContext.WithPrecision(16)
+// now returns the current time according to the account clock.
+func (a *Account) now() time.Time {
+	if a.Clock != nil {
+		return a.Clock()
+	}
+
+	return time.Now()
 }
 
-// Load loads the given amount to the account.
-func (a *Account) Load(amount *apd.Decimal) error {
-	_, err := getContext().Add(a.Available, a.Available, amount)
+// exchange records the original amount and currency of the transaction when
+// they differ from the applied amount and currency.
+func (t *Transaction) exchange(amount *apd.Decimal, currency string) {
+	if currency != t.Currency {
+		t.OriginalAmount = amount
+		t.OriginalCurrency = currency
+	}
+}
+
+// addTransaction assigns the next transaction ID and timestamp to the given
+// transaction and appends it to the account log, returning the result.
+func (a *Account) addTransaction(t Transaction) Transaction {
+	a.LastTransactionID++
+	t.ID = a.LastTransactionID
+	t.Timestamp = a.now()
+	a.Transactions = append(a.Transactions, t)
+	a.bump()
+
+	return t
+}
+
+// bump increments the account version, recording a mutation.
+func (a *Account) bump() {
+	a.Version++
+}
+
+// checkRequest verifies the account status permits the given operation and
+// the amount is a positive, finite decimal.
+func (a *Account) checkRequest(op Operation, amount *apd.Decimal) error {
+	err := a.checkStatus(op)
 
 	if err != nil {
 		return err
 	}
 
-	a.Transactions = append(a.Transactions, Transaction{Load, nil, amount})
+	if amount == nil {
+		return ErrInvalidAmount
+	}
+
+	if amount.Form != apd.Finite || amount.Sign() <= 0 {
+		return amountError(ErrInvalidAmount, amount, nil)
+	}
 
-	return err
+	return nil
 }
 
-// Authorize authorizes the given amount to the given merchant.
-func (a *Account) Authorize(merchantID int, amount *apd.Decimal) error {
-	if a.Available.Cmp(amount) < 0 {
-		return ErrUnderflow
+// Load loads the given amount to the account. Amounts in currencies the
+// account doesn't hold are converted to the account currency.
+func (a *Account) Load(ctx context.Context, amount *apd.Decimal, currency string, opts ...TransactionOption) error {
+	err := ctx.Err()
+
+	if err != nil {
+		return err
 	}
 
-	ctx := getContext()
-	_, err := ctx.Sub(a.Available, a.Available, amount)
+	o := newTransactionOptions(opts)
+	_, replayed, err := a.replay(o.idempotencyKey, Load)
+
+	if err != nil || replayed {
+		return err
+	}
+
+	err = a.checkRequest(Load, amount)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Add(a.Blocked, a.Blocked, amount)
+	p, converted, target, err := a.fund(amount, currency)
 
 	if err != nil {
 		return err
 	}
 
-	m, exists := a.Merchants[merchantID]
+	_, err = a.decimalContext().Add(p.Available, p.Available, converted)
+
+	if err != nil {
+		return err
+	}
+
+	t := Transaction{
+		Type:     Load,
+		Amount:   converted,
+		Currency: target,
+	}
+	t.exchange(amount, currency)
+	o.annotate(&t)
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+	a.notify(t)
+
+	return nil
+}
+
+// Authorize authorizes the given amount to the given merchant, returning the
+// authorization against which the amount can be captured or reversed. Amounts
+// in currencies the account doesn't hold are converted to the account
+// currency.
+func (a *Account) Authorize(ctx context.Context, merchantID int, amount *apd.Decimal, currency string, opts ...TransactionOption) (*Authorization, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := newTransactionOptions(opts)
+	id, replayed, err := a.replay(o.idempotencyKey, Authorize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		return a.Authorization(id)
+	}
+
+	err = a.checkRequest(Authorize, amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p, converted, target, err := a.fund(amount, currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spendable, err := a.spendable(p, target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if spendable.Cmp(converted) < 0 {
+		return nil, amountError(ErrUnderflow, converted, spendable)
+	}
+
+	err = a.checkCategory(merchantID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if target == a.Currency {
+		// Spending limits are expressed in the account currency
+		err = a.checkLimits(converted)
 
-	if !exists {
-		if a.Merchants == nil {
-			a.Merchants = map[int]*Merchant{}
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	m, exists := p.Merchants[merchantID]
+
+	if exists {
+		err = m.checkLimit(a.decimalContext(), merchantID, converted)
 
-		a.Merchants[merchantID] = &Merchant{apd.New(0, 0), apd.New(0, 0)}
-		m = a.Merchants[merchantID]
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		m = p.merchant(merchantID)
 	}
 
-	_, err = ctx.Add(m.Available, m.Available, amount)
+	dctx := a.decimalContext()
+	_, err = dctx.Sub(p.Available, p.Available, converted)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	_, err = dctx.Add(p.Blocked, p.Blocked, converted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dctx.Add(m.Available, m.Available, converted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := Transaction{
+		Type:       Authorize,
+		MerchantID: &merchantID,
+		Amount:     converted,
+		Currency:   target,
 	}
+	t.exchange(amount, currency)
+	o.annotate(&t)
+	t = a.addTransaction(t)
 
-	a.Transactions = append(a.Transactions, Transaction{Authorize, &merchantID, amount})
+	a.remember(o.idempotencyKey, t)
+
+	if a.Authorizations == nil {
+		a.Authorizations = map[int]*Authorization{}
+	}
 
-	return err
+	au := &Authorization{
+		ID:         t.ID,
+		MerchantID: merchantID,
+		Amount:     apd.New(0, 0).Set(converted),
+		Currency:   target,
+		Captured:   apd.New(0, 0),
+		Reversed:   apd.New(0, 0),
+		Refunded:   apd.New(0, 0),
+		Status:     AuthorizationOpen,
+		ExpiresAt:  t.Timestamp.Add(a.authorizationTTL()),
+	}
+	a.Authorizations[t.ID] = au
+
+	a.notify(t)
+	a.topUp(ctx)
+
+	return au, nil
 }
 
-// Capture captures the given amount for the given merchant.
-func (a *Account) Capture(merchantID int, amount *apd.Decimal) error {
-	m, exists := a.Merchants[merchantID]
+// Capture captures the given amount against the given authorization. Amounts
+// in a currency other than the authorization currency are converted.
+// Authorizations can't be captured once they've expired.
+func (a *Account) Capture(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error {
+	err := ctx.Err()
 
-	if !exists {
-		return errors.Wrapf(ErrMerchantNotFound, "ID: %d", merchantID)
+	if err != nil {
+		return err
 	}
 
-	if m.Available.Cmp(amount) < 0 {
-		return ErrUnderflow
+	o := newTransactionOptions(opts)
+	_, replayed, err := a.replay(o.idempotencyKey, Capture)
+
+	if err != nil || replayed {
+		return err
 	}
 
-	ctx := getContext()
-	_, err := ctx.Sub(m.Available, m.Available, amount)
+	err = a.checkRequest(Capture, amount)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Add(m.Captured, m.Captured, amount)
+	au, p, m, err := a.authorizationPocket(authorizationID)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Sub(a.Blocked, a.Blocked, amount)
+	// Expired holds may still be reversed and captured amounts refunded
+	if au.Expired(a.now()) {
+		return errors.Wrapf(ErrAuthorizationExpired, "ID: %d", authorizationID)
+	}
+
+	converted, err := a.convert(amount, currency, au.Currency)
 
 	if err != nil {
 		return err
 	}
 
-	a.Transactions = append(a.Transactions, Transaction{Capture, &merchantID, amount})
+	remaining, err := au.remaining(a.decimalContext())
+
+	if err != nil {
+		return err
+	}
+
+	if remaining.Cmp(converted) < 0 {
+		return amountError(ErrUnderflow, converted, remaining)
+	}
+
+	dctx := a.decimalContext()
+	_, err = dctx.Add(au.Captured, au.Captured, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Sub(m.Available, m.Available, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Add(m.Captured, m.Captured, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Sub(p.Blocked, p.Blocked, converted)
+
+	if err != nil {
+		return err
+	}
+
+	merchantID := au.MerchantID
+	t := Transaction{
+		Type:            Capture,
+		MerchantID:      &merchantID,
+		AuthorizationID: &authorizationID,
+		Amount:          converted,
+		Currency:        au.Currency,
+	}
+	t.exchange(amount, currency)
+	o.annotate(&t)
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+
+	err = au.updateStatus(dctx)
+
+	if err != nil {
+		return err
+	}
+
+	a.notify(t)
+	a.topUp(ctx)
 
 	return nil
 }
 
-// Reverse reverses the given amount from the given merchant.
-func (a *Account) Reverse(merchantID int, amount *apd.Decimal) error {
-	m, exists := a.Merchants[merchantID]
+// Reverse reverses the given amount from the given authorization. Amounts in a
+// currency other than the authorization currency are converted.
+func (a *Account) Reverse(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error {
+	err := ctx.Err()
+
+	if err != nil {
+		return err
+	}
+
+	o := newTransactionOptions(opts)
+	_, replayed, err := a.replay(o.idempotencyKey, Reverse)
+
+	if err != nil || replayed {
+		return err
+	}
+
+	err = a.checkRequest(Reverse, amount)
+
+	if err != nil {
+		return err
+	}
+
+	au, p, m, err := a.authorizationPocket(authorizationID)
+
+	if err != nil {
+		return err
+	}
 
-	if !exists {
-		return errors.Wrapf(ErrMerchantNotFound, "ID: %d", merchantID)
+	converted, err := a.convert(amount, currency, au.Currency)
+
+	if err != nil {
+		return err
 	}
 
-	if m.Available.Cmp(amount) < 0 {
-		return ErrUnderflow
+	remaining, err := au.remaining(a.decimalContext())
+
+	if err != nil {
+		return err
+	}
+
+	if remaining.Cmp(converted) < 0 {
+		return amountError(ErrUnderflow, converted, remaining)
 	}
 
-	ctx := getContext()
-	_, err := ctx.Sub(m.Available, m.Available, amount)
+	err = a.checkLink(Reverse, au, o, converted)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Sub(a.Blocked, a.Blocked, amount)
+	dctx := a.decimalContext()
+	_, err = dctx.Add(au.Reversed, au.Reversed, converted)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Add(a.Available, a.Available, amount)
+	_, err = dctx.Sub(m.Available, m.Available, converted)
 
 	if err != nil {
 		return err
 	}
 
-	a.Transactions = append(a.Transactions, Transaction{Reverse, &merchantID, amount})
+	_, err = dctx.Sub(p.Blocked, p.Blocked, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Add(p.Available, p.Available, converted)
+
+	if err != nil {
+		return err
+	}
+
+	merchantID := au.MerchantID
+	t := Transaction{
+		Type:                  Reverse,
+		MerchantID:            &merchantID,
+		AuthorizationID:       &authorizationID,
+		OriginalTransactionID: o.originalTransaction(),
+		Amount:                converted,
+		Currency:              au.Currency,
+	}
+	t.exchange(amount, currency)
+	o.annotate(&t)
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+
+	err = au.updateStatus(dctx)
+
+	if err != nil {
+		return err
+	}
+
+	a.notify(t)
 
 	return nil
 }
 
-// Refund refunds the given amount from the given merchant.
-func (a *Account) Refund(merchantID int, amount *apd.Decimal) error {
-	m, exists := a.Merchants[merchantID]
+// Refund refunds the given amount captured against the given authorization.
+// Amounts in a currency other than the authorization currency are converted.
+func (a *Account) Refund(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...TransactionOption) error {
+	err := ctx.Err()
+
+	if err != nil {
+		return err
+	}
+
+	o := newTransactionOptions(opts)
+	_, replayed, err := a.replay(o.idempotencyKey, Refund)
+
+	if err != nil || replayed {
+		return err
+	}
+
+	err = a.checkRequest(Refund, amount)
 
-	if !exists {
-		return errors.Wrapf(ErrMerchantNotFound, "ID: %d", merchantID)
+	if err != nil {
+		return err
 	}
 
-	if m.Captured.Cmp(amount) < 0 {
-		return ErrUnderflow
+	au, p, m, err := a.authorizationPocket(authorizationID)
+
+	if err != nil {
+		return err
 	}
 
-	ctx := getContext()
-	_, err := ctx.Sub(m.Captured, m.Captured, amount)
+	converted, err := a.convert(amount, currency, au.Currency)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = ctx.Add(a.Available, a.Available, amount)
+	refundable, err := au.refundable(a.decimalContext())
 
 	if err != nil {
 		return err
 	}
 
-	a.Transactions = append(a.Transactions, Transaction{Refund, &merchantID, amount})
+	if refundable.Cmp(converted) < 0 {
+		return amountError(ErrUnderflow, converted, refundable)
+	}
+
+	err = a.checkLink(Refund, au, o, converted)
+
+	if err != nil {
+		return err
+	}
+
+	dctx := a.decimalContext()
+	_, err = dctx.Add(au.Refunded, au.Refunded, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Sub(m.Captured, m.Captured, converted)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dctx.Add(p.Available, p.Available, converted)
+
+	if err != nil {
+		return err
+	}
+
+	merchantID := au.MerchantID
+	t := Transaction{
+		Type:                  Refund,
+		MerchantID:            &merchantID,
+		AuthorizationID:       &authorizationID,
+		OriginalTransactionID: o.originalTransaction(),
+		Amount:                converted,
+		Currency:              au.Currency,
+	}
+	t.exchange(amount, currency)
+	o.annotate(&t)
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+	a.notify(t)
 
 	return nil
 }
 
-// Balance returns the account balance.
-func (a *Account) Balance() (*Balance, error) {
+// Transaction returns the transaction for the given ID.
+func (a *Account) Transaction(id int) (*Transaction, error) {
+	// Transaction IDs are assigned in ascending order
+	i := sort.Search(len(a.Transactions), func(i int) bool {
+		return a.Transactions[i].ID >= id
+	})
+
+	if i == len(a.Transactions) || a.Transactions[i].ID != id {
+		return nil, errors.Wrapf(ErrTransactionNotFound, "ID: %d", id)
+	}
+
+	return &a.Transactions[i], nil
+}
+
+// Balance returns the account balance in the account currency.
+func (a *Account) Balance(ctx context.Context) (*Balance, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status == Closed {
+		return nil, ErrAccountClosed
+	}
+
 	total := apd.New(0, 0)
-	_, err := getContext().Add(total, a.Available, a.Blocked)
+	_, err = a.decimalContext().Add(total, a.Available, a.Blocked)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Balance{
+	balance := &Balance{
 		Total:     total,
 		Available: a.Available,
 		Blocked:   a.Blocked,
-	}, nil
+	}
+
+	if a.Overdraft != nil {
+		balance.OverdraftUsed = a.OverdraftUsed()
+		balance.OverdraftHeadroom, err = a.OverdraftHeadroom()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return balance, nil
 }
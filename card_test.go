@@ -1,7 +1,10 @@
 package card_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/apd"
 	. "github.com/martingallagher/card"
@@ -11,6 +14,8 @@ import (
 
 const merchantID = 1
 
+var ctx = context.Background()
+
 func decimalFromString(s string) *apd.Decimal {
 	d, _, err := apd.NewFromString(s)
 
@@ -34,10 +39,10 @@ func TestLoad(t *testing.T) {
 	}
 
 	for i, v := range tests {
-		require.NoError(t, account.Load(v.amount))
+		require.NoError(t, account.Load(ctx, v.amount, DefaultCurrency))
 		require.Len(t, account.Transactions, i+1)
 
-		balance, err := account.Balance()
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, v.total, balance.Total)
@@ -50,16 +55,18 @@ func TestAuthorize(t *testing.T) {
 	account := NewAccount(0)
 
 	t.Run("Load amount", func(t *testing.T) {
-		require.NoError(t, account.Load(decimalFromString("112.34")))
+		require.NoError(t, account.Load(ctx, decimalFromString("112.34"), DefaultCurrency))
 		require.Len(t, account.Transactions, 1)
 	})
 
 	t.Run("Authorize £25.33", func(t *testing.T) {
 		amount := decimalFromString("25.33")
 
-		require.NoError(t, account.Authorize(merchantID, amount))
+		_, err := account.Authorize(ctx, merchantID, amount, DefaultCurrency)
+
+		require.NoError(t, err)
 
-		balance, err := account.Balance()
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, decimalFromString("87.01"), balance.Available)
@@ -69,9 +76,11 @@ func TestAuthorize(t *testing.T) {
 	})
 
 	t.Run("Authorize £5", func(t *testing.T) {
-		require.NoError(t, account.Authorize(merchantID, apd.New(5, 0)))
+		_, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
 
-		balance, err := account.Balance()
+		require.NoError(t, err)
+
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, decimalFromString("82.01"), balance.Available)
@@ -84,7 +93,9 @@ func TestAuthorize(t *testing.T) {
 	})
 
 	t.Run("Attempt to load amount exceeding available amount", func(t *testing.T) {
-		require.Equal(t, ErrUnderflow, account.Authorize(merchantID, decimalFromString("82.02")))
+		_, err := account.Authorize(ctx, merchantID, decimalFromString("82.02"), DefaultCurrency)
+
+		require.Equal(t, ErrUnderflow, errors.Cause(err))
 		require.Len(t, account.Transactions, 3)
 	})
 }
@@ -92,62 +103,70 @@ func TestAuthorize(t *testing.T) {
 func TestCapture(t *testing.T) {
 	account := NewAccount(0)
 
-	require.NoError(t, account.Load(apd.New(10, 0)))
-	require.NoError(t, account.Authorize(merchantID, apd.New(2, 0)))
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(2, 0), DefaultCurrency)
+
+	require.NoError(t, err)
 
 	t.Run("Capture £1", func(t *testing.T) {
-		require.NoError(t, account.Capture(merchantID, apd.New(1, 0)))
+		require.NoError(t, account.Capture(ctx, au.ID, apd.New(1, 0), DefaultCurrency))
 
-		balance, err := account.Balance()
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, apd.New(8, 0), balance.Available)
 		require.Equal(t, apd.New(1, 0), balance.Blocked)
 		require.Equal(t, apd.New(9, 0), balance.Total)
+		require.Equal(t, AuthorizationPartiallyCaptured, au.Status)
 	})
 
-	t.Run("Invalid merchant ID", func(t *testing.T) {
-		require.Equal(t, ErrMerchantNotFound, errors.Cause(account.Capture(0, nil)))
+	t.Run("Invalid authorization ID", func(t *testing.T) {
+		require.Equal(t, ErrAuthorizationNotFound, errors.Cause(account.Capture(ctx, 0, apd.New(1, 0), DefaultCurrency)))
 	})
 
-	t.Run("Attempt to capture amount exceeding merchant available amount", func(t *testing.T) {
-		require.Equal(t, ErrUnderflow, account.Capture(merchantID, apd.New(2, 0)))
+	t.Run("Attempt to capture amount exceeding authorization remaining amount", func(t *testing.T) {
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Capture(ctx, au.ID, apd.New(2, 0), DefaultCurrency)))
 	})
 
 	require.Len(t, account.Transactions, 3)
 }
 
-func loadAndAuthorize(t *testing.T, account *Account) {
+func loadAndAuthorize(t *testing.T, account *Account) *Authorization {
 	amount := decimalFromString("9999.99")
 
-	require.NoError(t, account.Load(amount))
+	require.NoError(t, account.Load(ctx, amount, DefaultCurrency))
 
 	authorize := decimalFromString("333.33")
 
-	require.NoError(t, account.Authorize(merchantID, authorize))
+	au, err := account.Authorize(ctx, merchantID, authorize, DefaultCurrency)
+
+	require.NoError(t, err)
 	require.Equal(t, authorize, account.Merchants[merchantID].Available)
 
-	balance, err := account.Balance()
+	balance, err := account.Balance(ctx)
 
 	require.NoError(t, err)
 	require.Equal(t, decimalFromString("9666.66"), balance.Available)
 	require.Equal(t, authorize, balance.Blocked)
 	require.Equal(t, amount, balance.Total)
+
+	return au
 }
 
 func TestReverse(t *testing.T) {
 	account := NewAccount(0)
 
-	loadAndAuthorize(t, account)
+	au := loadAndAuthorize(t, account)
 
-	t.Run("Invalid merchant ID", func(t *testing.T) {
-		require.Equal(t, ErrMerchantNotFound, errors.Cause(account.Reverse(0, nil)))
+	t.Run("Invalid authorization ID", func(t *testing.T) {
+		require.Equal(t, ErrAuthorizationNotFound, errors.Cause(account.Reverse(ctx, 0, apd.New(1, 0), DefaultCurrency)))
 	})
 
 	t.Run("Reverse £66.66", func(t *testing.T) {
-		require.NoError(t, account.Reverse(merchantID, decimalFromString("66.66")))
+		require.NoError(t, account.Reverse(ctx, au.ID, decimalFromString("66.66"), DefaultCurrency))
 
-		balance, err := account.Balance()
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, decimalFromString("9733.32"), balance.Available)
@@ -155,7 +174,7 @@ func TestReverse(t *testing.T) {
 	})
 
 	t.Run("Attempt to reverse invalid sum", func(t *testing.T) {
-		require.Equal(t, ErrUnderflow, account.Reverse(merchantID, decimalFromString("500.50")))
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Reverse(ctx, au.ID, decimalFromString("500.50"), DefaultCurrency)))
 	})
 
 	require.Len(t, account.Transactions, 3)
@@ -164,27 +183,27 @@ func TestReverse(t *testing.T) {
 func TestRefund(t *testing.T) {
 	account := NewAccount(0)
 
-	loadAndAuthorize(t, account)
+	au := loadAndAuthorize(t, account)
 
-	t.Run("Invalid merchant ID", func(t *testing.T) {
-		require.Equal(t, ErrMerchantNotFound, errors.Cause(account.Refund(0, nil)))
+	t.Run("Invalid authorization ID", func(t *testing.T) {
+		require.Equal(t, ErrAuthorizationNotFound, errors.Cause(account.Refund(ctx, 0, apd.New(1, 0), DefaultCurrency)))
 	})
 
 	t.Run("Capture and refund", func(t *testing.T) {
 		capture := decimalFromString("100.00")
 
-		require.NoError(t, account.Capture(merchantID, capture))
+		require.NoError(t, account.Capture(ctx, au.ID, capture, DefaultCurrency))
 		require.Equal(t, decimalFromString("233.33"), account.Merchants[merchantID].Available)
 		require.Equal(t, capture, account.Merchants[merchantID].Captured)
 
-		balance, err := account.Balance()
+		balance, err := account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, decimalFromString("9666.66"), balance.Available)
 		require.Equal(t, decimalFromString("233.33"), balance.Blocked)
-		require.NoError(t, account.Refund(merchantID, decimalFromString("50")))
+		require.NoError(t, account.Refund(ctx, au.ID, decimalFromString("50"), DefaultCurrency))
 
-		balance, err = account.Balance()
+		balance, err = account.Balance(ctx)
 
 		require.NoError(t, err)
 		require.Equal(t, decimalFromString("9716.66"), balance.Available)
@@ -192,8 +211,409 @@ func TestRefund(t *testing.T) {
 	})
 
 	t.Run("Attempt to refund invalid amount", func(t *testing.T) {
-		require.Equal(t, ErrUnderflow, account.Capture(merchantID, decimalFromString("233.34")))
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Refund(ctx, au.ID, decimalFromString("50.01"), DefaultCurrency)))
 	})
 
 	require.Len(t, account.Transactions, 4)
 }
+
+func TestCurrencyMismatch(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, DefaultCurrency, account.Currency)
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Equal(t, DefaultCurrency, account.Transactions[0].Currency)
+
+	t.Run("Load", func(t *testing.T) {
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Load(ctx, apd.New(1, 0), "EUR")))
+	})
+
+	t.Run("Authorize", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(1, 0), "EUR")
+
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Capture(ctx, au.ID, apd.New(1, 0), "USD")))
+	})
+
+	t.Run("Reverse", func(t *testing.T) {
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Reverse(ctx, au.ID, apd.New(1, 0), "USD")))
+	})
+
+	t.Run("Refund", func(t *testing.T) {
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Refund(ctx, au.ID, apd.New(1, 0), "JPY")))
+	})
+
+	require.Len(t, account.Transactions, 2)
+}
+
+func TestTimestamp(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	now = now.Add(time.Minute)
+
+	_, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Len(t, account.Transactions, 2)
+	require.Equal(t, now.Add(-time.Minute), account.Transactions[0].Timestamp)
+	require.Equal(t, now, account.Transactions[1].Timestamp)
+}
+
+func TestTransactionIDs(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(2, 0), DefaultCurrency))
+	require.Equal(t, 3, account.LastTransactionID)
+
+	for i, v := range account.Transactions {
+		require.Equal(t, i+1, v.ID)
+	}
+
+	t.Run("Lookup", func(t *testing.T) {
+		txn, err := account.Transaction(2)
+
+		require.NoError(t, err)
+		require.Equal(t, Authorize, txn.Type)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		_, err := account.Transaction(4)
+
+		require.Equal(t, ErrTransactionNotFound, errors.Cause(err))
+	})
+}
+
+func TestAuthorizations(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	first, err := account.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	second, err := account.Authorize(ctx, merchantID, apd.New(20, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Equal(t, apd.New(30, 0), account.Merchants[merchantID].Available)
+
+	t.Run("Lookup", func(t *testing.T) {
+		au, err := account.Authorization(first.ID)
+
+		require.NoError(t, err)
+		require.Equal(t, first, au)
+
+		_, err = account.Authorization(1)
+
+		require.Equal(t, ErrAuthorizationNotFound, errors.Cause(err))
+	})
+
+	t.Run("Capture cannot consume funds from another authorization", func(t *testing.T) {
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Capture(ctx, first.ID, apd.New(15, 0), DefaultCurrency)))
+	})
+
+	t.Run("Multiple partial captures", func(t *testing.T) {
+		require.NoError(t, account.Capture(ctx, first.ID, apd.New(4, 0), DefaultCurrency))
+		require.Equal(t, AuthorizationPartiallyCaptured, first.Status)
+		require.NoError(t, account.Capture(ctx, first.ID, apd.New(6, 0), DefaultCurrency))
+		require.Equal(t, AuthorizationCaptured, first.Status)
+		require.Equal(t, apd.New(20, 0), account.Merchants[merchantID].Available)
+		require.Equal(t, apd.New(10, 0), account.Merchants[merchantID].Captured)
+	})
+
+	t.Run("Reverse", func(t *testing.T) {
+		require.NoError(t, account.Reverse(ctx, second.ID, apd.New(20, 0), DefaultCurrency))
+		require.Equal(t, AuthorizationReversed, second.Status)
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Capture(ctx, second.ID, apd.New(1, 0), DefaultCurrency)))
+	})
+
+	t.Run("Refund against captured amount", func(t *testing.T) {
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Refund(ctx, second.ID, apd.New(1, 0), DefaultCurrency)))
+		require.NoError(t, account.Refund(ctx, first.ID, apd.New(10, 0), DefaultCurrency))
+		require.Equal(t, apd.New(10, 0), first.Refunded)
+	})
+
+	for _, v := range account.Transactions[3:] {
+		require.NotNil(t, v.AuthorizationID)
+	}
+
+	balance, err := account.Balance(ctx)
+
+	require.NoError(t, err)
+	require.Zero(t, balance.Available.Cmp(apd.New(100, 0)))
+	require.True(t, balance.Blocked.IsZero())
+}
+
+func TestExpireAuthorizations(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.AuthorizationTTL = time.Hour
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	first, err := account.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), first.ExpiresAt)
+	require.NoError(t, account.Capture(ctx, first.ID, apd.New(4, 0), DefaultCurrency))
+
+	now = now.Add(30 * time.Minute)
+
+	second, err := account.Authorize(ctx, merchantID, apd.New(20, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	t.Run("Nothing expired", func(t *testing.T) {
+		freed, err := account.ExpireAuthorizations(now)
+
+		require.NoError(t, err)
+		require.Empty(t, freed)
+	})
+
+	t.Run("First authorization expired", func(t *testing.T) {
+		freed, err := account.ExpireAuthorizations(now.Add(30 * time.Minute))
+
+		require.NoError(t, err)
+		require.Len(t, freed, 1)
+		require.Zero(t, freed[DefaultCurrency].Cmp(apd.New(6, 0)))
+		require.Equal(t, AuthorizationCaptured, first.Status)
+		require.Equal(t, AuthorizationOpen, second.Status)
+		require.Equal(t, Reverse, account.Transactions[len(account.Transactions)-1].Type)
+	})
+
+	t.Run("All expired", func(t *testing.T) {
+		freed, err := account.ExpireAuthorizations(now.Add(time.Hour))
+
+		require.NoError(t, err)
+		require.Len(t, freed, 1)
+		require.Zero(t, freed[DefaultCurrency].Cmp(apd.New(20, 0)))
+		require.Equal(t, AuthorizationReversed, second.Status)
+
+		balance, err := account.Balance(ctx)
+
+		require.NoError(t, err)
+		require.Zero(t, balance.Available.Cmp(apd.New(96, 0)))
+		require.True(t, balance.Blocked.IsZero())
+	})
+}
+
+func TestExpireAuthorizationsCurrencies(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.AuthorizationTTL = time.Hour
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), "EUR"))
+
+	for _, v := range []struct {
+		amount   int64
+		currency string
+	}{{10, DefaultCurrency}, {20, "EUR"}, {5, "EUR"}} {
+		_, err := account.Authorize(ctx, merchantID, apd.New(v.amount, 0), v.currency)
+
+		require.NoError(t, err)
+	}
+
+	freed, err := account.ExpireAuthorizations(now.Add(time.Hour))
+
+	require.NoError(t, err)
+	require.Len(t, freed, 2, "totalled by currency")
+	require.Zero(t, freed[DefaultCurrency].Cmp(apd.New(10, 0)))
+	require.Zero(t, freed["EUR"].Cmp(apd.New(25, 0)))
+
+	// Closed accounts release nothing
+	account.Status = Closed
+	freed, err = account.ExpireAuthorizations(now.Add(time.Hour))
+
+	require.NoError(t, err)
+	require.Empty(t, freed)
+}
+
+func TestCaptureExpired(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.AuthorizationTTL = time.Hour
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(4, 0), DefaultCurrency))
+
+	// Expired by the account clock, before the hold is swept
+	now = now.Add(time.Hour)
+
+	require.Equal(t, ErrAuthorizationExpired, errors.Cause(account.Capture(ctx, au.ID, apd.New(1, 0), DefaultCurrency)))
+	require.Zero(t, au.Captured.Cmp(apd.New(4, 0)))
+	require.Len(t, account.Transactions, 3)
+
+	// Reversals and refunds are still accepted
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(6, 0), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(4, 0), DefaultCurrency))
+	require.Zero(t, account.Available.Cmp(apd.New(100, 0)))
+	require.NoError(t, account.Validate())
+}
+
+func TestVersion(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, 0, account.Version)
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+	require.Equal(t, 1, account.Version)
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+	require.NoError(t, account.SetLimits([]Limit{{Daily, apd.New(100, 0)}}))
+	require.NoError(t, account.Freeze())
+	require.Equal(t, 5, account.Version)
+
+	// Rejected operations leave the version unchanged
+	_, err = account.Authorize(ctx, merchantID, apd.New(1, 0), DefaultCurrency)
+
+	require.Equal(t, ErrAccountFrozen, errors.Cause(err))
+	require.Error(t, account.SetOverdraft(apd.New(-1, 0)))
+	require.Equal(t, 5, account.Version)
+
+	snapshot := account.Snapshot()
+
+	require.NoError(t, account.Unfreeze())
+	require.Equal(t, 5, RestoreAccount(snapshot).Version)
+}
+
+func TestInvalidAmount(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	for _, amount := range []*apd.Decimal{nil, apd.New(0, 0), apd.New(-100, 0), decimalFromString("NaN"), decimalFromString("Infinity")} {
+		require.Equal(t, ErrInvalidAmount, errors.Cause(account.Load(ctx, amount, DefaultCurrency)))
+
+		_, err := account.Authorize(ctx, merchantID, amount, DefaultCurrency)
+
+		require.Equal(t, ErrInvalidAmount, errors.Cause(err))
+		require.Equal(t, ErrInvalidAmount, errors.Cause(account.Capture(ctx, au.ID, amount, DefaultCurrency)))
+		require.Equal(t, ErrInvalidAmount, errors.Cause(account.Reverse(ctx, au.ID, amount, DefaultCurrency)))
+		require.Equal(t, ErrInvalidAmount, errors.Cause(account.Refund(ctx, au.ID, amount, DefaultCurrency)))
+	}
+
+	require.Len(t, account.Transactions, 2)
+}
+
+func TestContext(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+
+	cancel()
+
+	require.Equal(t, context.Canceled, account.Load(cancelled, apd.New(1, 0), DefaultCurrency))
+
+	_, err = account.Authorize(cancelled, merchantID, apd.New(1, 0), DefaultCurrency)
+
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, context.Canceled, account.Capture(cancelled, au.ID, apd.New(1, 0), DefaultCurrency))
+	require.Equal(t, context.Canceled, account.Reverse(cancelled, au.ID, apd.New(1, 0), DefaultCurrency))
+	require.Equal(t, context.Canceled, account.Refund(cancelled, au.ID, apd.New(1, 0), DefaultCurrency))
+
+	_, err = account.Balance(cancelled)
+
+	require.Equal(t, context.Canceled, err)
+	require.Len(t, account.Transactions, 2)
+}
+
+func TestTransactionMetadata(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency, WithDescription("top-up"), WithReference("pay_123"), WithOrigin(OriginImport)))
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	v := account.Transactions[0]
+
+	require.Equal(t, "top-up", v.Description)
+	require.Equal(t, "pay_123", v.Reference)
+	require.Equal(t, OriginImport, v.Origin)
+
+	v = account.Transactions[1]
+
+	require.Empty(t, v.Description)
+	require.Empty(t, v.Reference)
+	require.Equal(t, OriginUnknown, v.Origin)
+
+	t.Run("Parse origin", func(t *testing.T) {
+		origin, err := ParseOrigin("system")
+
+		require.NoError(t, err)
+		require.Equal(t, OriginSystem, origin)
+
+		_, err = ParseOrigin("batch")
+
+		require.Equal(t, ErrInvalidOrigin, errors.Cause(err))
+	})
+}
+
+func TestOperationJSON(t *testing.T) {
+	b, err := json.Marshal(Transaction{Type: Authorize, Amount: apd.New(1, 0)})
+
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"type":"AUTHORIZE"`)
+
+	var v Transaction
+
+	require.NoError(t, json.Unmarshal(b, &v))
+	require.Equal(t, Authorize, v.Type)
+
+	t.Run("Numeric", func(t *testing.T) {
+		var v Transaction
+
+		require.NoError(t, json.Unmarshal([]byte(`{"type":2}`), &v))
+		require.Equal(t, Capture, v.Type)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var v Transaction
+
+		require.Equal(t, ErrInvalidOperation, errors.Cause(json.Unmarshal([]byte(`{"type":"CHARGE"}`), &v)))
+		require.Equal(t, ErrInvalidOperation, errors.Cause(json.Unmarshal([]byte(`{"type":9}`), &v)))
+	})
+}
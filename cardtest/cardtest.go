@@ -0,0 +1,226 @@
+// Package cardtest provides a card.Card test double for services depending
+// on the interface, recording calls and returning scripted results without
+// constructing real accounts.
+package cardtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+)
+
+// Compile-time verification of Card interface implementation for the Card
+// struct.
+var _ card.Card = (*Card)(nil)
+
+// Method identifies a card.Card method.
+type Method string
+
+// card.Card methods.
+const (
+	Load      Method = "Load"
+	Authorize Method = "Authorize"
+	Capture   Method = "Capture"
+	Reverse   Method = "Reverse"
+	Refund    Method = "Refund"
+	Balance   Method = "Balance"
+)
+
+// Call records a card.Card method call. Fields not taken by the method are
+// zero.
+type Call struct {
+	Method          Method
+	MerchantID      int
+	AuthorizationID int
+	Amount          *apd.Decimal
+	Currency        string
+	Options         []card.TransactionOption
+}
+
+// Card is a configurable card.Card test double. Each call is recorded, then
+// answered by the first of:
+//
+//   - an error queued for the method with FailNext
+//   - the method's function field, if set
+//   - the default result: success, with authorizations numbered from 1 and
+//     a zero balance
+//
+// The zero value is ready to use. It's safe for concurrent use.
+type Card struct {
+	LoadFunc      func(ctx context.Context, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error
+	AuthorizeFunc func(ctx context.Context, merchantID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) (*card.Authorization, error)
+	CaptureFunc   func(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error
+	ReverseFunc   func(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error
+	RefundFunc    func(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error
+	BalanceFunc   func(ctx context.Context) (*card.Balance, error)
+
+	mu                sync.Mutex
+	calls             []Call
+	failures          map[Method][]error
+	lastAuthorization int
+}
+
+// FailNext queues errors returned by the next calls of the method, one per
+// call, before its function field or default result is used again.
+func (c *Card) FailNext(m Method, errs ...error) {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if c.failures == nil {
+		c.failures = map[Method][]error{}
+	}
+
+	c.failures[m] = append(c.failures[m], errs...)
+}
+
+// Calls returns the recorded calls in call order.
+func (c *Card) Calls() []Call {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// CallsTo returns the recorded calls of the method in call order.
+func (c *Card) CallsTo(m Method) []Call {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	var res []Call
+
+	for _, v := range c.calls {
+		if v.Method == m {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// Reset clears the recorded calls and queued errors.
+func (c *Card) Reset() {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	c.calls = nil
+	c.failures = nil
+}
+
+// record records the call, returning the error queued for its method, if
+// any.
+func (c *Card) record(call Call) error {
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, call)
+	errs := c.failures[call.Method]
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	c.failures[call.Method] = errs[1:]
+
+	return errs[0]
+}
+
+// Load implements the card.Loader interface.
+func (c *Card) Load(ctx context.Context, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error {
+	err := c.record(Call{Method: Load, Amount: amount, Currency: currency, Options: opts})
+
+	if err != nil || c.LoadFunc == nil {
+		return err
+	}
+
+	return c.LoadFunc(ctx, amount, currency, opts...)
+}
+
+// Authorize implements the card.Authorizer interface. By default it returns
+// an open authorization of the amount.
+func (c *Card) Authorize(ctx context.Context, merchantID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) (*card.Authorization, error) {
+	err := c.record(Call{Method: Authorize, MerchantID: merchantID, Amount: amount, Currency: currency, Options: opts})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AuthorizeFunc != nil {
+		return c.AuthorizeFunc(ctx, merchantID, amount, currency, opts...)
+	}
+
+	c.mu.Lock()
+	c.lastAuthorization++
+	id := c.lastAuthorization
+	c.mu.Unlock()
+
+	return &card.Authorization{
+		ID:         id,
+		MerchantID: merchantID,
+		Amount:     apd.New(0, 0).Set(amount),
+		Currency:   currency,
+		Captured:   apd.New(0, 0),
+		Reversed:   apd.New(0, 0),
+		Refunded:   apd.New(0, 0),
+		Status:     card.AuthorizationOpen,
+	}, nil
+}
+
+// Capture implements the card.Capturer interface.
+func (c *Card) Capture(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error {
+	err := c.record(Call{Method: Capture, AuthorizationID: authorizationID, Amount: amount, Currency: currency, Options: opts})
+
+	if err != nil || c.CaptureFunc == nil {
+		return err
+	}
+
+	return c.CaptureFunc(ctx, authorizationID, amount, currency, opts...)
+}
+
+// Reverse implements the card.Reverser interface.
+func (c *Card) Reverse(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error {
+	err := c.record(Call{Method: Reverse, AuthorizationID: authorizationID, Amount: amount, Currency: currency, Options: opts})
+
+	if err != nil || c.ReverseFunc == nil {
+		return err
+	}
+
+	return c.ReverseFunc(ctx, authorizationID, amount, currency, opts...)
+}
+
+// Refund implements the card.Refunder interface.
+func (c *Card) Refund(ctx context.Context, authorizationID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) error {
+	err := c.record(Call{Method: Refund, AuthorizationID: authorizationID, Amount: amount, Currency: currency, Options: opts})
+
+	if err != nil || c.RefundFunc == nil {
+		return err
+	}
+
+	return c.RefundFunc(ctx, authorizationID, amount, currency, opts...)
+}
+
+// Balance implements the card.Balancer interface. By default it returns a
+// zero balance.
+func (c *Card) Balance(ctx context.Context) (*card.Balance, error) {
+	err := c.record(Call{Method: Balance})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.BalanceFunc != nil {
+		return c.BalanceFunc(ctx)
+	}
+
+	return &card.Balance{
+		Total:     apd.New(0, 0),
+		Available: apd.New(0, 0),
+		Blocked:   apd.New(0, 0),
+	}, nil
+}
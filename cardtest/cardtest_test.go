@@ -0,0 +1,92 @@
+package cardtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	. "github.com/martingallagher/card/cardtest"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func TestCard(t *testing.T) {
+	var c Card
+
+	require.NoError(t, c.Load(ctx, apd.New(100, 0), "GBP"))
+
+	au, err := c.Authorize(ctx, 321, apd.New(15, 0), "GBP")
+
+	require.NoError(t, err)
+	require.Equal(t, 1, au.ID)
+	require.Equal(t, 321, au.MerchantID)
+	require.Equal(t, "15", au.Amount.String())
+	require.Equal(t, card.AuthorizationOpen, au.Status)
+	require.NoError(t, c.Capture(ctx, au.ID, apd.New(10, 0), "GBP"))
+	require.NoError(t, c.Reverse(ctx, au.ID, apd.New(5, 0), "GBP"))
+	require.NoError(t, c.Refund(ctx, au.ID, apd.New(2, 0), "GBP", card.WithReference("ref")))
+
+	balance, err := c.Balance(ctx)
+
+	require.NoError(t, err)
+	require.Zero(t, balance.Available.Sign())
+
+	calls := c.Calls()
+
+	require.Len(t, calls, 6)
+	require.Equal(t, []Method{Load, Authorize, Capture, Reverse, Refund, Balance}, []Method{
+		calls[0].Method, calls[1].Method, calls[2].Method, calls[3].Method, calls[4].Method, calls[5].Method,
+	})
+	require.Equal(t, 321, calls[1].MerchantID)
+	require.Equal(t, au.ID, calls[2].AuthorizationID)
+	require.Equal(t, "10", calls[2].Amount.String())
+	require.Equal(t, "GBP", calls[2].Currency)
+	require.Len(t, calls[4].Options, 1)
+	require.Len(t, c.CallsTo(Capture), 1)
+
+	t.Run("Scripted", func(t *testing.T) {
+		c := &Card{
+			AuthorizeFunc: func(ctx context.Context, merchantID int, amount *apd.Decimal, currency string, opts ...card.TransactionOption) (*card.Authorization, error) {
+				return &card.Authorization{ID: 42}, nil
+			},
+			BalanceFunc: func(ctx context.Context) (*card.Balance, error) {
+				return &card.Balance{Available: apd.New(5, 0)}, nil
+			},
+		}
+
+		au, err := c.Authorize(ctx, 1, apd.New(1, 0), "GBP")
+
+		require.NoError(t, err)
+		require.Equal(t, 42, au.ID)
+
+		balance, err := c.Balance(ctx)
+
+		require.NoError(t, err)
+		require.Equal(t, "5", balance.Available.String())
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		c.Reset()
+		c.FailNext(Authorize, card.ErrUnderflow, card.ErrLimitExceeded)
+
+		_, err := c.Authorize(ctx, 1, apd.New(1, 0), "GBP")
+
+		require.Equal(t, card.ErrUnderflow, err)
+
+		_, err = c.Authorize(ctx, 1, apd.New(1, 0), "GBP")
+
+		require.Equal(t, card.ErrLimitExceeded, err)
+
+		_, err = c.Authorize(ctx, 1, apd.New(1, 0), "GBP")
+
+		require.NoError(t, err)
+		require.NoError(t, c.Load(ctx, apd.New(1, 0), "GBP"))
+		require.Len(t, c.Calls(), 4)
+
+		c.Reset()
+
+		require.Empty(t, c.Calls())
+	})
+}
@@ -0,0 +1,185 @@
+package card
+
+import (
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Clone returns a deep copy of the account, safe to read while the original
+// is mutated. The merchant registry, rate provider, clock, decimal context and
+// observers are shared.
+func (a *Account) Clone() *Account {
+	if a == nil {
+		return nil
+	}
+
+	c := *a
+	c.Available = copyDecimal(a.Available)
+	c.Blocked = copyDecimal(a.Blocked)
+	c.Overdraft = copyDecimal(a.Overdraft)
+	c.Merchants = copyMerchants(a.Merchants)
+	c.observers = append(([]func(Transaction))(nil), a.observers...)
+	c.topUpObservers = append(([]func(error))(nil), a.topUpObservers...)
+
+	if a.TopUp != nil {
+		c.TopUp = &TopUp{
+			Threshold: copyDecimal(a.TopUp.Threshold),
+			Amount:    copyDecimal(a.TopUp.Amount),
+		}
+	}
+
+	if a.Pockets != nil {
+		c.Pockets = make(map[string]*Pocket, len(a.Pockets))
+
+		for k, v := range a.Pockets {
+			c.Pockets[k] = &Pocket{
+				Available: copyDecimal(v.Available),
+				Blocked:   copyDecimal(v.Blocked),
+				Merchants: copyMerchants(v.Merchants),
+			}
+		}
+	}
+
+	if a.Authorizations != nil {
+		c.Authorizations = make(map[int]*Authorization, len(a.Authorizations))
+
+		for k, v := range a.Authorizations {
+			au := *v
+			au.Amount = copyDecimal(v.Amount)
+			au.Captured = copyDecimal(v.Captured)
+			au.Reversed = copyDecimal(v.Reversed)
+			au.Refunded = copyDecimal(v.Refunded)
+			c.Authorizations[k] = &au
+		}
+	}
+
+	if a.Transactions != nil {
+		c.Transactions = make([]Transaction, len(a.Transactions))
+
+		for i, v := range a.Transactions {
+			v.MerchantID = copyInt(v.MerchantID)
+			v.AuthorizationID = copyInt(v.AuthorizationID)
+			v.OriginalTransactionID = copyInt(v.OriginalTransactionID)
+			v.MandateID = copyInt(v.MandateID)
+			v.DisputeID = copyInt(v.DisputeID)
+			v.Amount = copyDecimal(v.Amount)
+			v.OriginalAmount = copyDecimal(v.OriginalAmount)
+			c.Transactions[i] = v
+		}
+	}
+
+	if a.Limits != nil {
+		c.Limits = make([]Limit, len(a.Limits))
+
+		for i, v := range a.Limits {
+			c.Limits[i] = Limit{
+				Period: v.Period,
+				Amount: copyDecimal(v.Amount),
+			}
+		}
+	}
+
+	if a.CategoryRules != nil {
+		c.CategoryRules = &CategoryRules{
+			Allowed: append([]string(nil), a.CategoryRules.Allowed...),
+			Blocked: append([]string(nil), a.CategoryRules.Blocked...),
+		}
+	}
+
+	if a.IdempotencyKeys != nil {
+		c.IdempotencyKeys = make(map[string]IdempotencyRecord, len(a.IdempotencyKeys))
+
+		for k, v := range a.IdempotencyKeys {
+			c.IdempotencyKeys[k] = v
+		}
+	}
+
+	if a.Schedules != nil {
+		c.Schedules = make(map[int]*Schedule, len(a.Schedules))
+
+		for k, v := range a.Schedules {
+			s := *v
+			s.Amount = copyDecimal(v.Amount)
+			s.End = copyTime(v.End)
+			s.Next = copyTime(v.Next)
+			c.Schedules[k] = &s
+		}
+	}
+
+	if a.Mandates != nil {
+		c.Mandates = make(map[int]*Mandate, len(a.Mandates))
+
+		for k, v := range a.Mandates {
+			m := *v
+			m.Limit = copyDecimal(v.Limit)
+			m.Pulled = copyDecimal(v.Pulled)
+			m.Revoked = copyTime(v.Revoked)
+			c.Mandates[k] = &m
+		}
+	}
+
+	if a.Disputes != nil {
+		c.Disputes = make(map[int]*Dispute, len(a.Disputes))
+
+		for k, v := range a.Disputes {
+			d := *v
+			d.Amount = copyDecimal(v.Amount)
+			d.Resolved = copyTime(v.Resolved)
+			c.Disputes[k] = &d
+		}
+	}
+
+	return &c
+}
+
+// copyMerchants returns a deep copy of the given merchant records.
+func copyMerchants(merchants map[int]*Merchant) map[int]*Merchant {
+	if merchants == nil {
+		return nil
+	}
+
+	c := make(map[int]*Merchant, len(merchants))
+
+	for k, v := range merchants {
+		c[k] = &Merchant{
+			Available: copyDecimal(v.Available),
+			Captured:  copyDecimal(v.Captured),
+			Limit:     copyDecimal(v.Limit),
+			Settled:   copyDecimal(v.Settled),
+		}
+	}
+
+	return c
+}
+
+// copyDecimal returns a copy of the given decimal, or nil if nil.
+func copyDecimal(d *apd.Decimal) *apd.Decimal {
+	if d == nil {
+		return nil
+	}
+
+	return apd.New(0, 0).Set(d)
+}
+
+// copyInt returns a copy of the given integer pointer value, or nil if nil.
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+
+	v := *i
+
+	return &v
+}
+
+// copyTime returns a copy of the given time pointer value, or nil if nil.
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	v := *t
+
+	return &v
+}
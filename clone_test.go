@@ -0,0 +1,33 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	clone := account.Clone()
+
+	require.Equal(t, account.Transactions, clone.Transactions)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+	require.Len(t, clone.Transactions, 2)
+	require.Zero(t, clone.Available.Cmp(apd.New(50, 0)))
+	require.Zero(t, clone.Blocked.Cmp(apd.New(50, 0)))
+	require.True(t, clone.Merchants[merchantID].Captured.IsZero())
+	require.True(t, clone.Authorizations[au.ID].Captured.IsZero())
+
+	clone.Transactions[0].Amount.SetInt64(1)
+
+	require.Zero(t, account.Transactions[0].Amount.Cmp(apd.New(100, 0)))
+}
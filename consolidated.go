@@ -0,0 +1,166 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/apd"
+)
+
+// consolidatedEntry represents a transaction of a consolidated statement.
+type consolidatedEntry struct {
+	accountID   int
+	transaction Transaction
+}
+
+// ConsolidatedStatement generates a statement across the given accounts,
+// reporting the balances of each account, the grand total balances per
+// currency and the transactions of all accounts ordered by timestamp. Closed
+// accounts are omitted. Each account's balances are added to the totals with
+// the account's decimal context.
+func ConsolidatedStatement(accounts []*Account) (string, error) {
+	var (
+		o       = &statementOptions{}
+		sb      strings.Builder
+		totals  = map[string]*Balance{}
+		entries []consolidatedEntry
+		line    = strings.Repeat("-", 78)
+	)
+
+	fmt.Fprintf(&sb, `%[1]s
+ Account | Currency |      Available |        Blocked |          Total
+%[1]s
+`, line)
+
+	for _, a := range accounts {
+		if a.Status == Closed {
+			continue
+		}
+
+		balances, err := a.Balances(context.Background())
+
+		if err != nil {
+			return "", err
+		}
+
+		dctx := a.decimalContext()
+
+		for _, currency := range a.Currencies() {
+			balance := balances[currency]
+			total, exists := totals[currency]
+
+			if !exists {
+				total = &Balance{Total: apd.New(0, 0), Available: apd.New(0, 0), Blocked: apd.New(0, 0)}
+				totals[currency] = total
+			}
+
+			for _, v := range [][2]*apd.Decimal{
+				{total.Total, balance.Total},
+				{total.Available, balance.Available},
+				{total.Blocked, balance.Blocked},
+			} {
+				_, err = dctx.Add(v[0], v[0], v[1])
+
+				if err != nil {
+					return "", err
+				}
+			}
+
+			err = consolidatedBalance(&sb, o, strconv.Itoa(a.ID), currency, balance)
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		for _, v := range a.Transactions {
+			entries = append(entries, consolidatedEntry{a.ID, v})
+		}
+	}
+
+	currencies := make([]string, 0, len(totals))
+
+	for k := range totals {
+		currencies = append(currencies, k)
+	}
+
+	sort.Strings(currencies)
+	sb.WriteString(line)
+	sb.WriteByte('\n')
+
+	for _, currency := range currencies {
+		err := consolidatedBalance(&sb, o, "Total", currency, totals[currency])
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Entries are in account then ID order; ties retain it
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].transaction.Timestamp.Before(entries[j].transaction.Timestamp)
+	})
+
+	fmt.Fprintf(&sb, `%[1]s
+
+%[1]s
+ Account | ID     | Date                | Type      | Merchant | Amount
+%[1]s
+`, line)
+
+	if len(entries) == 0 {
+		sb.WriteString("                    *** NO TRANSACTIONS ***")
+
+		return sb.String(), nil
+	}
+
+	for _, v := range entries {
+		t := v.transaction
+
+		var merchant string
+
+		if t.MerchantID != nil {
+			merchant = o.merchantName(*t.MerchantID)
+		}
+
+		amount, err := o.formatAmount(t.Amount, t.Currency)
+
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&sb, " %-7d | %-6d | %-19s | %-9s | %-8s | %9s %s\n", v.accountID, t.ID, t.Timestamp.UTC().Format(timestampFormat), t.Type, merchant, amount, t.Currency)
+	}
+
+	sb.WriteString(line)
+
+	return sb.String(), nil
+}
+
+// consolidatedBalance writes a consolidated statement balance row.
+func consolidatedBalance(sb *strings.Builder, o *statementOptions, account, currency string, balance *Balance) error {
+	available, err := o.formatAmount(balance.Available, currency)
+
+	if err != nil {
+		return err
+	}
+
+	blocked, err := o.formatAmount(balance.Blocked, currency)
+
+	if err != nil {
+		return err
+	}
+
+	total, err := o.formatAmount(balance.Total, currency)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(sb, " %-7s | %-8s | %14s | %14s | %14s\n", account, currency, available, blocked, total)
+
+	return nil
+}
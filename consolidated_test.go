@@ -0,0 +1,65 @@
+package card_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsolidatedStatement(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time {
+		now = now.Add(time.Minute)
+
+		return now
+	})
+	first := NewAccount(1, clock)
+	second := NewAccount(2, clock)
+	closed := NewAccount(3, clock)
+
+	require.NoError(t, second.AddCurrency("EUR"))
+	require.NoError(t, first.Load(ctx, decimalFromString("100"), DefaultCurrency))
+	require.NoError(t, second.Load(ctx, decimalFromString("50.5"), DefaultCurrency))
+	require.NoError(t, second.Load(ctx, decimalFromString("20"), "EUR"))
+
+	_, err := first.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	statement, err := ConsolidatedStatement([]*Account{first, second, closed})
+
+	require.NoError(t, err)
+
+	const expected = `------------------------------------------------------------------------------
+ Account | Currency |      Available |        Blocked |          Total
+------------------------------------------------------------------------------
+ 1       | GBP      |          90.00 |          10.00 |         100.00
+ 2       | GBP      |          50.50 |           0.00 |          50.50
+ 2       | EUR      |          20.00 |           0.00 |          20.00
+------------------------------------------------------------------------------
+ Total   | EUR      |          20.00 |           0.00 |          20.00
+ Total   | GBP      |         140.50 |          10.00 |         150.50
+------------------------------------------------------------------------------
+
+------------------------------------------------------------------------------
+ Account | ID     | Date                | Type      | Merchant | Amount
+------------------------------------------------------------------------------
+ 1       | 1      | 2018-06-01 09:31:00 | LOAD      |          |    100.00 GBP
+ 2       | 1      | 2018-06-01 09:32:00 | LOAD      |          |     50.50 GBP
+ 2       | 2      | 2018-06-01 09:33:00 | LOAD      |          |     20.00 EUR
+ 1       | 2      | 2018-06-01 09:35:00 | AUTHORIZE | 1        |     10.00 GBP
+------------------------------------------------------------------------------`
+
+	require.Equal(t, expected, statement)
+
+	t.Run("Empty", func(t *testing.T) {
+		statement, err := ConsolidatedStatement(nil)
+
+		require.NoError(t, err)
+		require.Contains(t, statement, "*** NO TRANSACTIONS ***")
+	})
+}
@@ -0,0 +1,97 @@
+package card
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// csvHeader is the CSV statement header row.
+var csvHeader = []string{"id", "timestamp", "type", "merchant", "amount", "currency", "balance"}
+
+// StatementCSV writes the transaction log as RFC 4180 CSV, with the running
+// available balance of the transaction currency after each transaction.
+// Filtered and paged statements omit rows but not their effect on the
+// balance.
+func (a *Account) StatementCSV(w io.Writer, opts ...StatementOption) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	var (
+		o        = newStatementOptions(opts)
+		cw       = csv.NewWriter(w)
+		dctx     = a.decimalContext()
+		balances = map[string]*apd.Decimal{}
+		running  = map[int]string{}
+
+		selected, _ = a.page(o)
+	)
+
+	for _, v := range selected {
+		running[v.ID] = ""
+	}
+
+	for _, v := range a.Transactions {
+		balance, exists := balances[v.Currency]
+
+		if !exists {
+			balance = apd.New(0, 0)
+			balances[v.Currency] = balance
+		}
+
+		var err error
+
+		switch v.Type {
+		case Load, Reverse, Refund, Adjustment, Chargeback:
+			_, err = dctx.Add(balance, balance, v.Amount)
+		case Authorize:
+			_, err = dctx.Sub(balance, balance, v.Amount)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, exists = running[v.ID]
+
+		if exists {
+			running[v.ID] = balance.Text('f')
+		}
+	}
+
+	err := cw.Write(csvHeader)
+
+	if err != nil {
+		return err
+	}
+
+	for _, v := range selected {
+		var merchant string
+
+		if v.MerchantID != nil {
+			merchant = strconv.Itoa(*v.MerchantID)
+		}
+
+		err = cw.Write([]string{
+			strconv.Itoa(v.ID),
+			v.Timestamp.UTC().Format(time.RFC3339),
+			v.Type.String(),
+			merchant,
+			v.Amount.Text('f'),
+			v.Currency,
+			running[v.ID],
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,44 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementCSV(t *testing.T) {
+	account := NewAccount(0, WithClock(func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}))
+
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, 1, decimalFromString("15.00"), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, decimalFromString("2.5"), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+
+	var sb strings.Builder
+
+	require.NoError(t, account.StatementCSV(&sb))
+
+	expected := `id,timestamp,type,merchant,amount,currency,balance
+1,2018-06-01T09:30:00Z,LOAD,,915.75,GBP,915.75
+2,2018-06-01T09:30:00Z,AUTHORIZE,1,15.00,GBP,900.75
+3,2018-06-01T09:30:00Z,CAPTURE,1,10,GBP,900.75
+4,2018-06-01T09:30:00Z,REVERSE,1,2.5,GBP,903.25
+5,2018-06-01T09:30:00Z,REFUND,1,10,GBP,913.25
+`
+
+	require.Equal(t, expected, sb.String())
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.StatementCSV(&sb))
+	})
+}
@@ -0,0 +1,190 @@
+package card
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCurrency is returned for malformed ISO 4217 currency codes.
+var ErrInvalidCurrency = newError("INVALID_CURRENCY", "invalid currency code")
+
+// RateProvider provides currency exchange rates.
+type RateProvider interface {
+	// Rate returns the amount of the "to" currency equal to one unit of the
+	// "from" currency.
+	Rate(from, to string) (*apd.Decimal, error)
+}
+
+// Pocket represents the balances held in a single currency.
+type Pocket struct {
+	Available *apd.Decimal      `json:"available"`
+	Blocked   *apd.Decimal      `json:"blocked"`
+	Merchants map[int]*Merchant `json:"merchants,omitempty"`
+}
+
+// validCurrency reports whether the given value is a three letter ISO 4217
+// currency code.
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddCurrency opens a balance in the given currency alongside the account
+// currency. Amounts in held currencies are loaded and authorized without
+// conversion.
+func (a *Account) AddCurrency(currency string) error {
+	if !validCurrency(currency) {
+		return errors.Wrapf(ErrInvalidCurrency, "%q", currency)
+	}
+
+	if currency == a.Currency {
+		return nil
+	}
+
+	_, exists := a.Pockets[currency]
+
+	if exists {
+		return nil
+	}
+
+	if a.Pockets == nil {
+		a.Pockets = map[string]*Pocket{}
+	}
+
+	a.Pockets[currency] = &Pocket{
+		Available: apd.New(0, 0),
+		Blocked:   apd.New(0, 0),
+	}
+	a.bump()
+
+	return nil
+}
+
+// Currencies returns the currencies held by the account, account currency
+// first.
+func (a *Account) Currencies() []string {
+	currencies := make([]string, 0, len(a.Pockets))
+
+	for k := range a.Pockets {
+		currencies = append(currencies, k)
+	}
+
+	sort.Strings(currencies)
+
+	return append([]string{a.Currency}, currencies...)
+}
+
+// pocket returns the balances held in the given currency. The account
+// currency pocket shares the account balances.
+func (a *Account) pocket(currency string) (*Pocket, bool) {
+	if currency == a.Currency {
+		return &Pocket{
+			Available: a.Available,
+			Blocked:   a.Blocked,
+			Merchants: a.Merchants,
+		}, true
+	}
+
+	p, exists := a.Pockets[currency]
+
+	return p, exists
+}
+
+// fund returns the pocket funding an amount in the given currency, along with
+// the amount and currency applied to it. Amounts in currencies the account
+// doesn't hold are converted to the account currency.
+func (a *Account) fund(amount *apd.Decimal, currency string) (*Pocket, *apd.Decimal, string, error) {
+	p, exists := a.pocket(currency)
+
+	if exists {
+		return p, amount, currency, nil
+	}
+
+	converted, err := a.convert(amount, currency, a.Currency)
+
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	p, _ = a.pocket(a.Currency)
+
+	return p, converted, a.Currency, nil
+}
+
+// convert converts the given amount between currencies using the account
+// rate provider, rounding to two decimal places.
+func (a *Account) convert(amount *apd.Decimal, from, to string) (*apd.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	if a.Rates == nil {
+		return nil, errors.Wrapf(ErrCurrencyMismatch, "%s (account: %s)", from, to)
+	}
+
+	rate, err := a.Rates.Rate(from, to)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s to %s rate", from, to)
+	}
+
+	converted := apd.New(0, 0)
+	dctx := a.decimalContext()
+	_, err = dctx.Mul(converted, amount, rate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dctx.Quantize(converted, converted, -2)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if converted.Sign() <= 0 {
+		return nil, amountError(ErrInvalidAmount, converted, nil)
+	}
+
+	return converted, nil
+}
+
+// Balances returns the account balance for each held currency.
+func (a *Account) Balances(ctx context.Context) (map[string]*Balance, error) {
+	balance, err := a.Balance(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[string]*Balance{a.Currency: balance}
+
+	for k, v := range a.Pockets {
+		total := apd.New(0, 0)
+		_, err = a.decimalContext().Add(total, v.Available, v.Blocked)
+
+		if err != nil {
+			return nil, err
+		}
+
+		balances[k] = &Balance{
+			Total:     total,
+			Available: v.Available,
+			Blocked:   v.Blocked,
+		}
+	}
+
+	return balances, nil
+}
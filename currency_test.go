@@ -0,0 +1,135 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedRates converts between currencies at fixed rates.
+type fixedRates map[string]*apd.Decimal
+
+func (r fixedRates) Rate(from, to string) (*apd.Decimal, error) {
+	rate, exists := r[from+to]
+
+	if !exists {
+		return nil, errors.Errorf("no rate for %s/%s", from, to)
+	}
+
+	return rate, nil
+}
+
+func TestAddCurrency(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, ErrInvalidCurrency, errors.Cause(account.AddCurrency("eur")))
+	require.Equal(t, ErrInvalidCurrency, errors.Cause(account.AddCurrency("EURO")))
+	require.NoError(t, account.AddCurrency(DefaultCurrency))
+	require.NoError(t, account.AddCurrency("USD"))
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.Equal(t, []string{DefaultCurrency, "EUR", "USD"}, account.Currencies())
+}
+
+func TestCurrencyPockets(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(50, 0), "EUR"))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(20, 0), "EUR")
+
+	require.NoError(t, err)
+	require.Equal(t, "EUR", au.Currency)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(5, 0), "EUR"))
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(5, 0), "EUR"))
+
+	balances, err := account.Balances(ctx)
+
+	require.NoError(t, err)
+	require.Len(t, balances, 2)
+	require.Zero(t, balances[DefaultCurrency].Available.Cmp(apd.New(100, 0)))
+	require.True(t, balances[DefaultCurrency].Blocked.IsZero())
+	require.Zero(t, balances["EUR"].Available.Cmp(apd.New(35, 0)))
+	require.Zero(t, balances["EUR"].Blocked.Cmp(apd.New(10, 0)))
+	require.Zero(t, balances["EUR"].Total.Cmp(apd.New(45, 0)))
+
+	t.Run("Underflow", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(36, 0), "EUR")
+
+		require.Equal(t, ErrUnderflow, errors.Cause(err))
+	})
+
+	t.Run("Unheld currency", func(t *testing.T) {
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Load(ctx, apd.New(1, 0), "USD")))
+		require.Equal(t, ErrCurrencyMismatch, errors.Cause(account.Capture(ctx, au.ID, apd.New(1, 0), DefaultCurrency)))
+	})
+}
+
+func TestCurrencyConversion(t *testing.T) {
+	account := NewAccount(0)
+	account.Rates = fixedRates{
+		"USDGBP": decimalFromString("0.75"),
+		"GBPEUR": decimalFromString("1.125"),
+	}
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), "USD"))
+	require.Zero(t, account.Available.Cmp(apd.New(75, 0)))
+
+	v := account.Transactions[0]
+
+	require.Equal(t, DefaultCurrency, v.Currency)
+	require.Equal(t, "USD", v.OriginalCurrency)
+	require.Zero(t, v.OriginalAmount.Cmp(apd.New(100, 0)))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(40, 0), "USD")
+
+	require.NoError(t, err)
+	require.Equal(t, DefaultCurrency, au.Currency)
+	require.Zero(t, au.Amount.Cmp(apd.New(30, 0)))
+
+	t.Run("Authorization currency", func(t *testing.T) {
+		require.NoError(t, account.Capture(ctx, au.ID, apd.New(10, 0), "USD"))
+		require.Zero(t, au.Captured.Cmp(decimalFromString("7.50")))
+	})
+
+	t.Run("Held currency", func(t *testing.T) {
+		require.NoError(t, account.Load(ctx, apd.New(10, 0), "EUR"))
+		require.Zero(t, account.Available.Cmp(apd.New(45, 0)))
+		require.Nil(t, account.Transactions[len(account.Transactions)-1].OriginalAmount)
+
+		au, err := account.Authorize(ctx, merchantID, apd.New(10, 0), "EUR")
+
+		require.NoError(t, err)
+		require.NoError(t, account.Reverse(ctx, au.ID, apd.New(8, 0), DefaultCurrency))
+		require.Zero(t, au.Reversed.Cmp(apd.New(9, 0)))
+	})
+
+	t.Run("Missing rate", func(t *testing.T) {
+		require.Error(t, account.Load(ctx, apd.New(1, 0), "JPY"))
+	})
+}
+
+func TestStatementCurrencies(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), "EUR"))
+
+	statement, err := account.Statement()
+
+	require.NoError(t, err)
+
+	sections := strings.Split(statement, "\n\nCurrency:")
+
+	require.Len(t, sections, 2)
+	require.Contains(t, sections[0], "*** NO TRANSACTIONS ***")
+	require.Contains(t, sections[1], "EUR")
+	require.Contains(t, sections[1], "LOAD")
+}
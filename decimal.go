@@ -0,0 +1,130 @@
+package card
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Default decimal arithmetic settings, complying with GAAP decimal precision.
+const (
+	DefaultPrecision = 16
+	DefaultRounding  = apd.RoundHalfUp
+)
+
+// Decimal context errors.
+var (
+	ErrInvalidPrecision = newError("INVALID_PRECISION", "invalid decimal precision")
+	ErrInvalidRounding  = newError("INVALID_ROUNDING", "invalid decimal rounding mode")
+)
+
+var (
+	decimalMu        sync.RWMutex
+	decimalPrecision uint32 = DefaultPrecision
+	decimalRounding         = DefaultRounding
+)
+
+// SetDecimalContext sets the precision and rounding mode of the decimal
+// arithmetic used by all accounts. The rounding mode must be one of the apd
+// rounding constants, e.g. apd.RoundHalfEven.
+func SetDecimalContext(precision uint32, rounding string) error {
+	err := validateDecimalContext(precision, rounding)
+
+	if err != nil {
+		return err
+	}
+
+	decimalMu.Lock()
+	decimalPrecision = precision
+	decimalRounding = rounding
+	decimalMu.Unlock()
+
+	return nil
+}
+
+// validateDecimalContext returns an error if the given precision or rounding
+// mode is invalid.
+func validateDecimalContext(precision uint32, rounding string) error {
+	if precision == 0 || precision > apd.MaxExponent {
+		return errors.Wrapf(ErrInvalidPrecision, "%d", precision)
+	}
+
+	_, exists := apd.Roundings[rounding]
+
+	if !exists {
+		return errors.Wrapf(ErrInvalidRounding, "%q", rounding)
+	}
+
+	return nil
+}
+
+// getContext returns the decimal context for account arithmetic.
+func getContext() *apd.Context {
+	decimalMu.RLock()
+
+	defer decimalMu.RUnlock()
+
+	c := apd.BaseContext.WithPrecision(decimalPrecision)
+	c.Rounding = decimalRounding
+
+	return c
+}
+
+// decimalContext returns the decimal context for the account's arithmetic.
+func (a *Account) decimalContext() *apd.Context {
+	if a.DecimalContext == nil {
+		return getContext()
+	}
+
+	c := *a.DecimalContext
+
+	return &c
+}
+
+// decimalSettings is the persisted precision and rounding mode of an
+// account's decimal context.
+type decimalSettings struct {
+	Precision uint32 `json:"precision"`
+	Rounding  string `json:"rounding"`
+}
+
+// context returns the decimal context with the settings' precision and
+// rounding mode.
+func (s *decimalSettings) context() (*apd.Context, error) {
+	err := validateDecimalContext(s.Precision, s.Rounding)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := apd.BaseContext.WithPrecision(s.Precision)
+	c.Rounding = s.Rounding
+
+	return c, nil
+}
+
+// quantize returns the given decimal rounded to the given exponent, e.g. -2
+// for two decimal places. The precision is widened as needed so that large
+// amounts are never truncated.
+func quantize(d *apd.Decimal, exp int32) (*apd.Decimal, error) {
+	dctx := getContext()
+	digits := uint32(d.NumDigits()) + uint32(-exp)
+
+	if d.Exponent > 0 {
+		digits += uint32(d.Exponent)
+	}
+
+	if digits > dctx.Precision {
+		dctx.Precision = digits
+	}
+
+	rounded := apd.New(0, 0)
+	_, err := dctx.Quantize(rounded, d, exp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rounded, nil
+}
@@ -0,0 +1,38 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDecimalContext(t *testing.T) {
+	defer SetDecimalContext(DefaultPrecision, DefaultRounding)
+
+	require.Equal(t, ErrInvalidPrecision, errors.Cause(SetDecimalContext(0, apd.RoundHalfEven)))
+	require.Equal(t, ErrInvalidRounding, errors.Cause(SetDecimalContext(DefaultPrecision, "nearest")))
+
+	convert := func(t *testing.T) *apd.Decimal {
+		account := NewAccount(0)
+		account.Rates = fixedRates{"USDGBP": decimalFromString("0.125")}
+
+		require.NoError(t, account.Load(ctx, apd.New(1, 0), "USD"))
+
+		return account.Available
+	}
+
+	require.Equal(t, "0.13", convert(t).String())
+
+	t.Run("Half even", func(t *testing.T) {
+		require.NoError(t, SetDecimalContext(DefaultPrecision, apd.RoundHalfEven))
+		require.Equal(t, "0.12", convert(t).String())
+	})
+
+	t.Run("Up", func(t *testing.T) {
+		require.NoError(t, SetDecimalContext(DefaultPrecision, apd.RoundUp))
+		require.Equal(t, "0.13", convert(t).String())
+	})
+}
@@ -0,0 +1,403 @@
+package card
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Dispute statuses.
+const (
+	DisputeOpen DisputeStatus = iota
+	DisputeAccepted
+	DisputeRejected
+)
+
+// Dispute errors.
+var (
+	ErrDisputeNotFound      = newError("DISPUTE_NOT_FOUND", "dispute not found")
+	ErrDisputeResolved      = newError("DISPUTE_RESOLVED", "dispute already resolved")
+	ErrInvalidDispute       = newError("INVALID_DISPUTE", "only captures may be disputed")
+	ErrInvalidDisputeStatus = newError("INVALID_DISPUTE_STATUS", "invalid dispute status")
+)
+
+// DisputeStatus represents the state of a dispute.
+type DisputeStatus uint8
+
+func (s DisputeStatus) String() string {
+	switch s {
+	case DisputeOpen:
+		return "OPEN"
+	case DisputeAccepted:
+		return "ACCEPTED"
+	case DisputeRejected:
+		return "REJECTED"
+	}
+
+	return "UNKNOWN"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s DisputeStatus) MarshalText() ([]byte, error) {
+	if s > DisputeRejected {
+		return nil, errors.Wrapf(ErrInvalidDisputeStatus, "%d", s)
+	}
+
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *DisputeStatus) UnmarshalText(text []byte) error {
+	for v := DisputeOpen; v <= DisputeRejected; v++ {
+		if strings.EqualFold(string(text), v.String()) {
+			*s = v
+
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrInvalidDisputeStatus, "%q", text)
+}
+
+// Dispute represents a cardholder's dispute of a captured amount. While open,
+// the disputed amount is provisionally credited to the account.
+type Dispute struct {
+	ID              int           `json:"id"`
+	TransactionID   int           `json:"transactionID"`
+	AuthorizationID int           `json:"authorizationID"`
+	MerchantID      int           `json:"merchantID"`
+	Amount          *apd.Decimal  `json:"amount"`
+	Currency        string        `json:"currency"`
+	Reason          string        `json:"reason,omitempty"`
+	Status          DisputeStatus `json:"status"`
+	Opened          time.Time     `json:"opened"`
+	Resolved        *time.Time    `json:"resolved,omitempty"`
+}
+
+// withDispute links an operation to the dispute it opens or resolves.
+func withDispute(id int) TransactionOption {
+	return func(o *transactionOptions) {
+		o.disputeID = id
+	}
+}
+
+// dispute returns the linked dispute ID, or nil if the operation isn't
+// linked to a dispute.
+func (o *transactionOptions) dispute() *int {
+	if o.disputeID == 0 {
+		return nil
+	}
+
+	id := o.disputeID
+
+	return &id
+}
+
+// Dispute returns the dispute with the given ID.
+func (a *Account) Dispute(id int) (*Dispute, error) {
+	d, exists := a.Disputes[id]
+
+	if !exists {
+		return nil, errors.Wrapf(ErrDisputeNotFound, "%d", id)
+	}
+
+	return d, nil
+}
+
+// ListDisputes returns the account disputes in ID order.
+func (a *Account) ListDisputes() []*Dispute {
+	res := make([]*Dispute, 0, len(a.Disputes))
+
+	for _, v := range a.Disputes {
+		res = append(res, v)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// replayDispute returns the dispute linked to the transaction recorded for
+// the given idempotency key, if it's already been processed.
+func (a *Account) replayDispute(key string, op Operation) (*Dispute, bool, error) {
+	id, replayed, err := a.replay(key, op)
+
+	if err != nil || !replayed {
+		return nil, false, err
+	}
+
+	t, err := a.Transaction(id)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if t.DisputeID == nil {
+		return nil, false, errors.Wrapf(ErrIdempotencyKeyReused, "key: %s (%s)", key, t.Type)
+	}
+
+	d, err := a.Dispute(*t.DisputeID)
+
+	return d, err == nil, err
+}
+
+// disputable returns the amount of the given capture which may still be
+// disputed: the amount not refunded or disputed by open or accepted disputes.
+func (a *Account) disputable(au *Authorization, captureID int) (*apd.Decimal, error) {
+	remaining, err := a.linkable(Refund, au, captureID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dctx := a.decimalContext()
+
+	for _, v := range a.Disputes {
+		// Accepted disputes are already counted as refunds
+		if v.TransactionID != captureID || v.Status != DisputeOpen {
+			continue
+		}
+
+		_, err = dctx.Sub(remaining, remaining, v.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return remaining, nil
+}
+
+// OpenDispute disputes the given amount of the capture with the given
+// transaction ID, or the whole amount not already refunded or disputed if
+// nil, provisionally crediting it to the account with a Chargeback
+// transaction until the dispute is resolved.
+func (a *Account) OpenDispute(ctx context.Context, transactionID int, amount *apd.Decimal, reason string, opts ...TransactionOption) (*Dispute, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := newTransactionOptions(opts)
+	d, replayed, err := a.replayDispute(o.idempotencyKey, Chargeback)
+
+	if err != nil || replayed {
+		return d, err
+	}
+
+	err = a.checkStatus(Chargeback)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := a.Transaction(transactionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Type != Capture || t.AuthorizationID == nil {
+		return nil, errors.Wrapf(ErrInvalidDispute, "%s transaction %d", t.Type, transactionID)
+	}
+
+	au, p, _, err := a.authorizationPocket(*t.AuthorizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	disputable, err := a.disputable(au, transactionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if amount == nil {
+		amount = disputable
+	} else if amount.Form != apd.Finite || amount.Sign() <= 0 {
+		return nil, amountError(ErrInvalidAmount, amount, nil)
+	}
+
+	if amount.Sign() <= 0 || disputable.Cmp(amount) < 0 {
+		return nil, amountError(ErrUnderflow, amount, disputable)
+	}
+
+	_, err = a.decimalContext().Add(p.Available, p.Available, amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d = &Dispute{
+		ID:              a.LastDisputeID + 1,
+		TransactionID:   transactionID,
+		AuthorizationID: au.ID,
+		MerchantID:      au.MerchantID,
+		Amount:          apd.New(0, 0).Set(amount),
+		Currency:        t.Currency,
+		Reason:          strings.TrimSpace(reason),
+		Status:          DisputeOpen,
+		Opened:          a.now(),
+	}
+
+	if a.Disputes == nil {
+		a.Disputes = map[int]*Dispute{}
+	}
+
+	a.Disputes[d.ID] = d
+	a.LastDisputeID = d.ID
+	a.chargeback(o, d, amount)
+
+	return d, nil
+}
+
+// AcceptDispute resolves the dispute with the given ID in the cardholder's
+// favour: the provisional credit is released by a Chargeback transaction and
+// the disputed amount refunded against the capture.
+func (a *Account) AcceptDispute(ctx context.Context, id int, opts ...TransactionOption) (*Dispute, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := newTransactionOptions(opts)
+	d, replayed, err := a.replayDispute(o.idempotencyKey, Refund)
+
+	if err != nil || replayed {
+		return d, err
+	}
+
+	d, err = a.openDispute(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The idempotency key is recorded against the refund
+	err = a.Refund(ctx, d.AuthorizationID, d.Amount, d.Currency, append(opts, WithOriginalTransaction(d.TransactionID), withDispute(id))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p, _ := a.pocket(d.Currency)
+	_, err = a.decimalContext().Sub(p.Available, p.Available, d.Amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.resolve(d, DisputeAccepted)
+	a.chargeback(newTransactionOptions(append(opts, WithIdempotencyKey(""))), d, new(apd.Decimal).Neg(d.Amount))
+
+	return d, nil
+}
+
+// RejectDispute resolves the dispute with the given ID in the merchant's
+// favour, re-debiting the provisional credit with a Chargeback transaction.
+// The whole credit is re-debited: if the spendable balance can't cover it,
+// ErrUnderflow is returned and the dispute remains open, to be rejected once
+// the account is funded.
+func (a *Account) RejectDispute(ctx context.Context, id int, opts ...TransactionOption) (*Dispute, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := newTransactionOptions(opts)
+	d, replayed, err := a.replayDispute(o.idempotencyKey, Chargeback)
+
+	if err != nil || replayed {
+		return d, err
+	}
+
+	d, err = a.openDispute(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p, _ := a.pocket(d.Currency)
+	spendable, err := a.spendable(p, d.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if spendable.Cmp(d.Amount) < 0 {
+		return nil, amountError(ErrUnderflow, d.Amount, spendable)
+	}
+
+	_, err = a.decimalContext().Sub(p.Available, p.Available, d.Amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.resolve(d, DisputeRejected)
+	a.chargeback(o, d, new(apd.Decimal).Neg(d.Amount))
+
+	return d, nil
+}
+
+// openDispute returns the dispute with the given ID if it's still open and
+// the account status permits resolving it.
+func (a *Account) openDispute(id int) (*Dispute, error) {
+	err := a.checkStatus(Chargeback)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := a.Dispute(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Status != DisputeOpen {
+		return nil, errors.Wrapf(ErrDisputeResolved, "%d (%s)", id, d.Status)
+	}
+
+	return d, nil
+}
+
+// resolve records the resolution of the given dispute.
+func (a *Account) resolve(d *Dispute, status DisputeStatus) {
+	now := a.now()
+	d.Status = status
+	d.Resolved = &now
+}
+
+// chargeback records a Chargeback transaction of the given signed amount for
+// the given dispute.
+func (a *Account) chargeback(o *transactionOptions, d *Dispute, amount *apd.Decimal) {
+	merchantID, authorizationID, transactionID := d.MerchantID, d.AuthorizationID, d.TransactionID
+	t := Transaction{
+		Type:                  Chargeback,
+		MerchantID:            &merchantID,
+		AuthorizationID:       &authorizationID,
+		OriginalTransactionID: &transactionID,
+		Amount:                amount,
+		Currency:              d.Currency,
+	}
+	o.annotate(&t)
+
+	id := d.ID
+	t.DisputeID = &id
+
+	t = a.addTransaction(t)
+
+	a.remember(o.idempotencyKey, t)
+	a.notify(t)
+}
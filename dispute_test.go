@@ -0,0 +1,122 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispute(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(60, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(50, 0), DefaultCurrency))
+
+	capture := account.Transactions[len(account.Transactions)-1].ID
+
+	_, err = account.OpenDispute(ctx, au.ID, nil, "")
+
+	require.Equal(t, ErrInvalidDispute, errors.Cause(err))
+
+	_, err = account.OpenDispute(ctx, capture, apd.New(51, 0), "")
+
+	require.Equal(t, ErrUnderflow, errors.Cause(err))
+
+	d, err := account.OpenDispute(ctx, capture, apd.New(20, 0), "not received", WithIdempotencyKey("open-1"))
+
+	require.NoError(t, err)
+	require.Equal(t, DisputeOpen, d.Status)
+	require.Equal(t, merchantID, d.MerchantID)
+	require.Zero(t, account.Available.Cmp(apd.New(60, 0)), "provisional credit")
+
+	replayed, err := account.OpenDispute(ctx, capture, apd.New(20, 0), "not received", WithIdempotencyKey("open-1"))
+
+	require.NoError(t, err)
+	require.Equal(t, d.ID, replayed.ID)
+	require.Len(t, account.Disputes, 1)
+
+	// The rest of the capture
+	rest, err := account.OpenDispute(ctx, capture, nil, "")
+
+	require.NoError(t, err)
+	require.Zero(t, rest.Amount.Cmp(apd.New(30, 0)))
+
+	_, err = account.OpenDispute(ctx, capture, nil, "")
+
+	require.Equal(t, ErrUnderflow, errors.Cause(err))
+
+	t.Run("Accept", func(t *testing.T) {
+		_, err := account.AcceptDispute(ctx, d.ID)
+
+		require.NoError(t, err)
+		require.Equal(t, DisputeAccepted, d.Status)
+		require.NotNil(t, d.Resolved)
+		require.Zero(t, account.Available.Cmp(apd.New(90, 0)))
+		require.Zero(t, account.Authorizations[au.ID].Refunded.Cmp(apd.New(20, 0)))
+
+		n := len(account.Transactions)
+		refund, release := account.Transactions[n-2], account.Transactions[n-1]
+
+		require.Equal(t, Refund, refund.Type)
+		require.Equal(t, d.ID, *refund.DisputeID)
+		require.Equal(t, Chargeback, release.Type)
+		require.Zero(t, release.Amount.Cmp(apd.New(-20, 0)))
+
+		_, err = account.RejectDispute(ctx, d.ID)
+
+		require.Equal(t, ErrDisputeResolved, errors.Cause(err))
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		// Refused while the spendable balance can't cover the credit
+		hold, err := account.Authorize(ctx, merchantID, apd.New(70, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+
+		n := len(account.Transactions)
+		_, err = account.RejectDispute(ctx, rest.ID)
+
+		require.Equal(t, ErrUnderflow, errors.Cause(err))
+		require.Equal(t, DisputeOpen, rest.Status)
+		require.Len(t, account.Transactions, n)
+		require.Zero(t, account.Available.Cmp(apd.New(20, 0)))
+		require.NoError(t, account.Reverse(ctx, hold.ID, apd.New(70, 0), DefaultCurrency))
+
+		_, err = account.RejectDispute(ctx, rest.ID)
+
+		require.NoError(t, err)
+		require.Equal(t, DisputeRejected, rest.Status)
+		require.Zero(t, account.Available.Cmp(apd.New(60, 0)), "re-debited")
+		require.NoError(t, account.Validate())
+
+		_, err = account.Dispute(3)
+
+		require.Equal(t, ErrDisputeNotFound, errors.Cause(err))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(rest)
+
+		require.NoError(t, err)
+		require.Contains(t, string(b), `"status":"REJECTED"`)
+		require.Contains(t, string(b), `"amount":"30"`)
+
+		b, err = json.Marshal(account)
+
+		require.NoError(t, err)
+
+		var restored Account
+
+		require.NoError(t, json.Unmarshal(b, &restored))
+		require.Len(t, restored.ListDisputes(), 2)
+		require.NoError(t, restored.Validate())
+	})
+}
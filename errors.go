@@ -0,0 +1,96 @@
+package card
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Code represents a stable, machine-readable error code.
+type Code string
+
+// Error represents an account error identified by a stable code. Account
+// methods may return an Error wrapped with additional context; use
+// errors.Cause or ErrorCode to recover it.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func newError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// AmountError annotates an account error with the offending amount and the
+// amount available to it, e.g. the available balance or remaining headroom.
+type AmountError struct {
+	Err       error
+	Amount    *apd.Decimal
+	Available *apd.Decimal
+}
+
+// amountError annotates the given error with the offending amount and the
+// amount available to it, which may be nil.
+func amountError(err error, amount, available *apd.Decimal) error {
+	return &AmountError{
+		Err:       err,
+		Amount:    amount,
+		Available: available,
+	}
+}
+
+func (e *AmountError) Error() string {
+	if e.Available == nil {
+		return fmt.Sprintf("%s (amount: %s)", e.Err, e.Amount)
+	}
+
+	return fmt.Sprintf("%s (amount: %s, available: %s)", e.Err, e.Amount, e.Available)
+}
+
+// Cause returns the underlying error.
+func (e *AmountError) Cause() error {
+	return e.Err
+}
+
+// ErrorCode returns the code of the account error underlying err, or an
+// empty code if err isn't an account error.
+func ErrorCode(err error) Code {
+	e, ok := errors.Cause(err).(*Error)
+
+	if !ok {
+		return ""
+	}
+
+	return e.Code
+}
+
+// ErrorAmounts returns the offending and available amounts annotating err,
+// or nil if err isn't annotated.
+func ErrorAmounts(err error) (amount, available *apd.Decimal) {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		e, ok := err.(*AmountError)
+
+		if ok {
+			return e.Amount, e.Available
+		}
+
+		c, ok := err.(causer)
+
+		if !ok {
+			break
+		}
+
+		err = c.Cause()
+	}
+
+	return nil, nil
+}
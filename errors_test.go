@@ -0,0 +1,53 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCodes(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+	_, err := account.Authorize(ctx, merchantID, apd.New(15, 0), DefaultCurrency)
+
+	require.Equal(t, Code("UNDERFLOW"), ErrorCode(err))
+
+	amount, available := ErrorAmounts(err)
+
+	require.Zero(t, amount.Cmp(apd.New(15, 0)))
+	require.Zero(t, available.Cmp(apd.New(10, 0)))
+	require.Equal(t, "requested amount exceeds available amount (amount: 15, available: 10)", err.Error())
+
+	t.Run("Invalid amount", func(t *testing.T) {
+		err := account.Load(ctx, apd.New(-1, 0), DefaultCurrency)
+
+		require.Equal(t, Code("INVALID_AMOUNT"), ErrorCode(err))
+
+		amount, available := ErrorAmounts(err)
+
+		require.Zero(t, amount.Cmp(apd.New(-1, 0)))
+		require.Nil(t, available)
+	})
+
+	t.Run("Wrapped", func(t *testing.T) {
+		err := account.Capture(ctx, 99, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, Code("AUTHORIZATION_NOT_FOUND"), ErrorCode(err))
+
+		amount, available := ErrorAmounts(err)
+
+		require.Nil(t, amount)
+		require.Nil(t, available)
+	})
+
+	t.Run("Foreign errors", func(t *testing.T) {
+		require.Empty(t, ErrorCode(errors.New("boom")))
+		require.Empty(t, ErrorCode(nil))
+	})
+}
@@ -0,0 +1,235 @@
+package card
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/apd"
+)
+
+// ofxTimeFormat is the OFX date and time layout.
+const ofxTimeFormat = "20060102150405"
+
+// qifDateFormat is the QIF date layout.
+const qifDateFormat = "01/02/2006"
+
+// ofxNameWidth is the maximum length of the OFX payee name.
+const ofxNameWidth = 32
+
+// ofxHeader is the OFX 1.0.2 SGML document header.
+const ofxHeader = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+`
+
+// ofxEscaper escapes OFX element values.
+var ofxEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ExportOFX writes the posted transactions as an OFX 1.0.2 credit card
+// statement per held currency, for import into personal finance tools.
+// Loads and refunds are credits and captures are debits; authorizations and
+// reversals only hold funds and are omitted.
+func (a *Account) ExportOFX(w io.Writer, opts ...StatementOption) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	balances, err := a.Balances(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		o           = newStatementOptions(opts)
+		bw          = bufio.NewWriter(w)
+		now         = a.now().UTC().Format(ofxTimeFormat)
+		selected, _ = a.page(o)
+	)
+
+	bw.WriteString(ofxHeader)
+	fmt.Fprintf(bw, `<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS>
+<CODE>0
+<SEVERITY>INFO
+</STATUS>
+<DTSERVER>%s
+<LANGUAGE>ENG
+</SONRS>
+</SIGNONMSGSRSV1>
+<CREDITCARDMSGSRSV1>
+`, now)
+
+	for _, currency := range a.Currencies() {
+		var (
+			transactions = postedTransactions(selected, currency)
+			start, end   = now, now
+			balance      = balances[currency]
+		)
+
+		for i, v := range transactions {
+			ts := v.Timestamp.UTC().Format(ofxTimeFormat)
+
+			// The layout sorts lexically in time order
+			if i == 0 || ts < start {
+				start = ts
+			}
+
+			if i == 0 || ts > end {
+				end = ts
+			}
+		}
+
+		fmt.Fprintf(bw, `<CCSTMTTRNRS>
+<TRNUID>0
+<STATUS>
+<CODE>0
+<SEVERITY>INFO
+</STATUS>
+<CCSTMTRS>
+<CURDEF>%s
+<CCACCTFROM>
+<ACCTID>%d
+</CCACCTFROM>
+<BANKTRANLIST>
+<DTSTART>%s
+<DTEND>%s
+`, currency, a.ID, start, end)
+
+		for _, v := range transactions {
+			trnType := "CREDIT"
+
+			if v.Type == Capture || v.Amount.Sign() < 0 {
+				trnType = "DEBIT"
+			}
+
+			name := []rune(o.payee(v))
+
+			if len(name) > ofxNameWidth {
+				name = name[:ofxNameWidth]
+			}
+
+			fmt.Fprintf(bw, `<STMTTRN>
+<TRNTYPE>%s
+<DTPOSTED>%s
+<TRNAMT>%s
+<FITID>%d
+<NAME>%s
+`, trnType, v.Timestamp.UTC().Format(ofxTimeFormat), signedAmount(v), v.ID, ofxEscaper.Replace(string(name)))
+
+			if v.Description != "" {
+				fmt.Fprintf(bw, "<MEMO>%s\n", ofxEscaper.Replace(v.Description))
+			}
+
+			bw.WriteString("</STMTTRN>\n")
+		}
+
+		fmt.Fprintf(bw, `</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>%s
+<DTASOF>%[3]s
+</LEDGERBAL>
+<AVAILBAL>
+<BALAMT>%[2]s
+<DTASOF>%[3]s
+</AVAILBAL>
+</CCSTMTRS>
+</CCSTMTTRNRS>
+`, balance.Total.Text('f'), balance.Available.Text('f'), now)
+	}
+
+	bw.WriteString("</CREDITCARDMSGSRSV1>\n</OFX>\n")
+
+	return bw.Flush()
+}
+
+// ExportQIF writes the posted transactions as a QIF credit card account per
+// held currency, for import into personal finance tools. Authorizations and
+// reversals only hold funds and are omitted.
+func (a *Account) ExportQIF(w io.Writer, opts ...StatementOption) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	var (
+		o           = newStatementOptions(opts)
+		bw          = bufio.NewWriter(w)
+		selected, _ = a.page(o)
+	)
+
+	for _, currency := range a.Currencies() {
+		fmt.Fprintf(bw, "!Account\nNCard %d %s\nTCCard\n^\n!Type:CCard\n", a.ID, currency)
+
+		for _, v := range postedTransactions(selected, currency) {
+			fmt.Fprintf(bw, "D%s\nT%s\nP%s\n", v.Timestamp.UTC().Format(qifDateFormat), signedAmount(v), o.payee(v))
+
+			if v.Description != "" {
+				fmt.Fprintf(bw, "M%s\n", v.Description)
+			}
+
+			bw.WriteString("^\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// postedTransactions returns the given transactions in the given currency
+// which move funds into or out of the account.
+func postedTransactions(transactions []Transaction, currency string) []Transaction {
+	var posted []Transaction
+
+	for _, v := range transactions {
+		if v.Currency != currency {
+			continue
+		}
+
+		switch v.Type {
+		case Load, Capture, Refund, Adjustment, Chargeback:
+			posted = append(posted, v)
+		}
+	}
+
+	return posted
+}
+
+// signedAmount returns the transaction amount, negative for funds leaving the
+// account. Adjustment and chargeback amounts are already signed.
+func signedAmount(v Transaction) string {
+	if v.Type == Capture {
+		return new(apd.Decimal).Neg(v.Amount).Text('f')
+	}
+
+	return v.Amount.Text('f')
+}
+
+// payee returns the export payee of the given transaction: the registered
+// merchant name, or the merchant ID or transaction type.
+func (o *statementOptions) payee(v Transaction) string {
+	if v.MerchantID == nil {
+		return v.Type.String()
+	}
+
+	if o.merchants != nil {
+		m, err := o.merchants.Get(*v.MerchantID)
+
+		if err == nil && m.Name != "" {
+			return m.Name
+		}
+	}
+
+	return "Merchant " + strconv.Itoa(*v.MerchantID)
+}
@@ -0,0 +1,89 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func newExportAccount(t *testing.T) *Account {
+	account := NewAccount(7, WithClock(func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}))
+
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency, WithDescription("Top up")))
+
+	au, err := account.Authorize(ctx, 1, decimalFromString("15.00"), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, decimalFromString("2.5"), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, decimalFromString("4"), DefaultCurrency))
+
+	return account
+}
+
+func TestExportOFX(t *testing.T) {
+	account := newExportAccount(t)
+	merchants := NewMerchantRegistry(MerchantInfo{ID: 1, Name: "Fish & Chips", MCC: "5814", Country: "GB"})
+
+	var sb strings.Builder
+
+	require.NoError(t, account.ExportOFX(&sb, WithMerchantRegistry(merchants)))
+
+	ofx := sb.String()
+
+	require.True(t, strings.HasPrefix(ofx, "OFXHEADER:100\n"))
+	require.Contains(t, ofx, "<CURDEF>GBP\n<CCACCTFROM>\n<ACCTID>7\n")
+	require.Contains(t, ofx, "<TRNTYPE>CREDIT\n<DTPOSTED>20180601093000\n<TRNAMT>915.75\n<FITID>1\n<NAME>LOAD\n<MEMO>Top up\n")
+	require.Contains(t, ofx, "<TRNTYPE>DEBIT\n<DTPOSTED>20180601093000\n<TRNAMT>-10\n<FITID>3\n<NAME>Fish &amp; Chips\n")
+	require.Contains(t, ofx, "<TRNAMT>4\n<FITID>5\n")
+	require.NotContains(t, ofx, "<FITID>2\n")
+	require.NotContains(t, ofx, "<FITID>4\n")
+	require.Contains(t, ofx, "<LEDGERBAL>\n<BALAMT>909.75\n")
+	require.Contains(t, ofx, "<AVAILBAL>\n<BALAMT>907.25\n")
+	require.True(t, strings.HasSuffix(ofx, "</CREDITCARDMSGSRSV1>\n</OFX>\n"))
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.ExportOFX(&sb))
+	})
+}
+
+func TestExportQIF(t *testing.T) {
+	account := newExportAccount(t)
+
+	var sb strings.Builder
+
+	require.NoError(t, account.ExportQIF(&sb))
+
+	expected := `!Account
+NCard 7 GBP
+TCCard
+^
+!Type:CCard
+D06/01/2018
+T915.75
+PLOAD
+MTop up
+^
+D06/01/2018
+T-10
+PMerchant 1
+^
+D06/01/2018
+T4
+PMerchant 1
+^
+`
+
+	require.Equal(t, expected, sb.String())
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.ExportQIF(&sb))
+	})
+}
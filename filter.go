@@ -0,0 +1,66 @@
+package card
+
+import (
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// FilterOptions scopes the transactions included in a statement. Zero values
+// don't filter.
+type FilterOptions struct {
+	// From and To bound the transaction timestamps, inclusive of From and
+	// exclusive of To.
+	From time.Time
+	To   time.Time
+
+	MerchantID *int
+	Type       *Operation
+
+	// MinAmount and MaxAmount bound the transaction amounts, inclusive.
+	MinAmount *apd.Decimal
+	MaxAmount *apd.Decimal
+}
+
+// Match reports whether the given transaction satisfies the filter.
+func (f FilterOptions) Match(t Transaction) bool {
+	if !f.From.IsZero() && t.Timestamp.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !t.Timestamp.Before(f.To) {
+		return false
+	}
+
+	if f.MerchantID != nil && (t.MerchantID == nil || *t.MerchantID != *f.MerchantID) {
+		return false
+	}
+
+	if f.Type != nil && t.Type != *f.Type {
+		return false
+	}
+
+	if f.MinAmount != nil && t.Amount.Cmp(f.MinAmount) < 0 {
+		return false
+	}
+
+	if f.MaxAmount != nil && t.Amount.Cmp(f.MaxAmount) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// WithFilter limits the statement to transactions matching the given
+// filter. Balances are unaffected.
+func WithFilter(f FilterOptions) StatementOption {
+	return func(o *statementOptions) {
+		o.filter = f
+	}
+}
+
+// StatementFiltered generates an account statement of the transactions
+// matching the given filter.
+func (a *Account) StatementFiltered(f FilterOptions, opts ...StatementOption) (string, error) {
+	return a.Statement(append(opts, WithFilter(f))...)
+}
@@ -0,0 +1,96 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementFiltered(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	account := NewAccount(0, WithClock(func() time.Time {
+		return now
+	}))
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	now = now.Add(24 * time.Hour)
+
+	first, err := account.Authorize(ctx, 1, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	now = now.Add(24 * time.Hour)
+
+	_, err = account.Authorize(ctx, 2, apd.New(20, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, first.ID, apd.New(10, 0), DefaultCurrency))
+
+	rows := func(t *testing.T, f FilterOptions) []string {
+		statement, err := account.StatementFiltered(f)
+
+		require.NoError(t, err)
+
+		var ids []string
+
+		for _, v := range strings.Split(statement, "\n") {
+			fields := strings.Fields(v)
+
+			if len(fields) > 2 && fields[1] == "|" && fields[0] != "ID" {
+				ids = append(ids, fields[0])
+			}
+		}
+
+		return ids
+	}
+
+	require.Equal(t, []string{"1", "2", "3", "4"}, rows(t, FilterOptions{}))
+
+	t.Run("Date range", func(t *testing.T) {
+		from := time.Date(2018, time.June, 2, 0, 0, 0, 0, time.UTC)
+
+		require.Equal(t, []string{"2", "3", "4"}, rows(t, FilterOptions{From: from}))
+		require.Equal(t, []string{"2"}, rows(t, FilterOptions{From: from, To: from.Add(24 * time.Hour)}))
+	})
+
+	t.Run("Merchant", func(t *testing.T) {
+		merchantID := 1
+
+		require.Equal(t, []string{"2", "4"}, rows(t, FilterOptions{MerchantID: &merchantID}))
+	})
+
+	t.Run("Type", func(t *testing.T) {
+		op := Authorize
+
+		require.Equal(t, []string{"2", "3"}, rows(t, FilterOptions{Type: &op}))
+	})
+
+	t.Run("Amount", func(t *testing.T) {
+		require.Equal(t, []string{"2", "3", "4"}, rows(t, FilterOptions{MaxAmount: apd.New(20, 0)}))
+		require.Equal(t, []string{"1", "3"}, rows(t, FilterOptions{MinAmount: apd.New(20, 0)}))
+		require.Equal(t, []string{"3"}, rows(t, FilterOptions{MinAmount: apd.New(15, 0), MaxAmount: apd.New(20, 0)}))
+	})
+
+	t.Run("No matches", func(t *testing.T) {
+		op := Refund
+		statement, err := account.StatementFiltered(FilterOptions{Type: &op})
+
+		require.NoError(t, err)
+		require.Contains(t, statement, "*** NO TRANSACTIONS ***")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var (
+			sb strings.Builder
+			op = Capture
+		)
+
+		require.NoError(t, account.StatementCSV(&sb, WithFilter(FilterOptions{Type: &op})))
+		require.Equal(t, "id,timestamp,type,merchant,amount,currency,balance\n4,2018-06-03T09:30:00Z,CAPTURE,1,10,GBP,70\n", sb.String())
+	})
+}
@@ -0,0 +1,30 @@
+package card
+
+// OnTransaction registers a function called with the recorded transaction
+// after every successful operation. Observers are called synchronously in
+// registration order and must not modify the account.
+func (a *Account) OnTransaction(fn func(Transaction)) {
+	a.observers = append(a.observers, fn)
+}
+
+// OnTopUpFailure registers a function called with the error of each
+// automatic top-up that fails. The operation triggering the top-up still
+// succeeds.
+func (a *Account) OnTopUpFailure(fn func(error)) {
+	a.topUpObservers = append(a.topUpObservers, fn)
+}
+
+// notify calls the registered observers with the given transaction.
+func (a *Account) notify(t Transaction) {
+	for _, fn := range a.observers {
+		fn(t)
+	}
+}
+
+// notifyTopUpFailure calls the registered top-up failure observers with the
+// given error.
+func (a *Account) notifyTopUpFailure(err error) {
+	for _, fn := range a.topUpObservers {
+		fn(err)
+	}
+}
@@ -0,0 +1,44 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnTransaction(t *testing.T) {
+	var (
+		account = NewAccount(0)
+		ops     []Operation
+	)
+
+	account.OnTransaction(func(t Transaction) {
+		ops = append(ops, t.Type)
+	})
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+	require.Equal(t, []Operation{Load, Authorize, Capture, Reverse, Refund}, ops)
+
+	t.Run("Failed operations", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(1000, 0), DefaultCurrency)
+
+		require.Equal(t, ErrUnderflow, errors.Cause(err))
+		require.Len(t, ops, 5)
+	})
+
+	t.Run("Replays", func(t *testing.T) {
+		require.NoError(t, account.Load(ctx, apd.New(1, 0), DefaultCurrency, WithIdempotencyKey("key")))
+		require.NoError(t, account.Load(ctx, apd.New(1, 0), DefaultCurrency, WithIdempotencyKey("key")))
+		require.Len(t, ops, 6)
+	})
+}
@@ -0,0 +1,51 @@
+package card
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlStatement is the HTML statement template, producing a fragment
+// suitable for embedding in emails or web pages.
+var htmlStatement = template.Must(template.New("statement").Parse(`<article class="statement">
+<h1>Account {{.AccountID}}</h1>
+{{- range .Sections}}
+<section class="statement-currency">
+<h2>{{.Currency}}</h2>
+<dl class="statement-balance">
+<dt>Available</dt><dd>{{.Available}}</dd>
+<dt>Blocked</dt><dd>{{.Blocked}}</dd>
+<dt>Total</dt><dd>{{.Total}}</dd>
+{{- if .OverdraftUsed}}
+<dt>Overdraft used</dt><dd>{{.OverdraftUsed}}</dd>
+<dt>Overdraft headroom</dt><dd>{{.OverdraftHeadroom}}</dd>
+{{- end}}
+</dl>
+<table class="statement-transactions">
+<thead>
+<tr><th scope="col">ID</th><th scope="col">Date</th><th scope="col">Type</th><th scope="col">Merchant</th><th scope="col">Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Transaction.ID}}</td><td><time datetime="{{.Transaction.Timestamp.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.Date}}</time></td><td>{{.Type}}{{with .Transaction.OriginalTransactionID}} of txn {{.}}{{end}}</td><td>{{.Merchant}}</td><td>{{.Amount}}</td></tr>
+{{- else}}
+<tr><td colspan="5">No transactions</td></tr>
+{{- end}}
+</tbody>
+</table>
+</section>
+{{- end}}
+</article>
+`))
+
+// WriteStatementHTML writes the account statement as an HTML fragment, with
+// a balance summary and transaction table per held currency.
+func (a *Account) WriteStatementHTML(w io.Writer, opts ...StatementOption) error {
+	data, err := a.statementData(newStatementOptions(opts))
+
+	if err != nil {
+		return err
+	}
+
+	return htmlStatement.Execute(w, data)
+}
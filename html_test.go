@@ -0,0 +1,39 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatementHTML(t *testing.T) {
+	account := NewAccount(3, WithClock(func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}))
+	merchants := NewMerchantRegistry(MerchantInfo{ID: 1, Name: "Fish & Chips", MCC: "5814", Country: "GB"})
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+
+	_, err := account.Authorize(ctx, 1, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	var sb strings.Builder
+
+	require.NoError(t, account.WriteStatementHTML(&sb, WithMerchantRegistry(merchants)))
+
+	html := sb.String()
+
+	require.Contains(t, html, "<h1>Account 3</h1>")
+	require.Contains(t, html, "<h2>GBP</h2>")
+	require.Contains(t, html, "<dt>Available</dt><dd>905.75</dd>")
+	require.Contains(t, html, `<tr><td>1</td><td><time datetime="2018-06-01T09:30:00Z">2018-06-01 09:30:00</time></td><td>LOAD</td><td></td><td>915.75</td></tr>`)
+	require.Contains(t, html, "<td>Fish &amp; C</td>")
+	require.Contains(t, html, "<h2>EUR</h2>")
+	require.Contains(t, html, `<tr><td colspan="5">No transactions</td></tr>`)
+}
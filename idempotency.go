@@ -0,0 +1,113 @@
+package card
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultIdempotencyRetention is the period idempotency keys are retained for
+// accounts without an explicit IdempotencyRetention.
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is replayed for
+// a different operation type.
+var ErrIdempotencyKeyReused = newError("IDEMPOTENCY_KEY_REUSED", "idempotency key used for a different operation")
+
+// IdempotencyRecord represents a processed idempotency key.
+type IdempotencyRecord struct {
+	TransactionID int       `json:"transactionID"`
+	Type          Operation `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// TransactionOption configures an individual account operation.
+type TransactionOption func(*transactionOptions)
+
+type transactionOptions struct {
+	idempotencyKey        string
+	description           string
+	reference             string
+	origin                Origin
+	originalTransactionID int
+	mandateID             int
+	disputeID             int
+}
+
+// WithIdempotencyKey sets the operation idempotency key. Replays of an
+// operation with the same key return the original result instead of applying
+// the amount again.
+func WithIdempotencyKey(key string) TransactionOption {
+	return func(o *transactionOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+func newTransactionOptions(opts []TransactionOption) *transactionOptions {
+	o := &transactionOptions{}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// idempotencyRetention returns the period idempotency keys are retained for.
+func (a *Account) idempotencyRetention() time.Duration {
+	if a.IdempotencyRetention > 0 {
+		return a.IdempotencyRetention
+	}
+
+	return DefaultIdempotencyRetention
+}
+
+// replay returns the transaction ID recorded for the given idempotency key,
+// reporting whether the key has already been processed.
+func (a *Account) replay(key string, op Operation) (int, bool, error) {
+	if key == "" {
+		return 0, false, nil
+	}
+
+	a.pruneIdempotencyKeys()
+
+	r, exists := a.IdempotencyKeys[key]
+
+	if !exists {
+		return 0, false, nil
+	}
+
+	if r.Type != op {
+		return 0, false, errors.Wrapf(ErrIdempotencyKeyReused, "key: %s (%s)", key, r.Type)
+	}
+
+	return r.TransactionID, true, nil
+}
+
+// pruneIdempotencyKeys removes idempotency keys past the retention window.
+func (a *Account) pruneIdempotencyKeys() {
+	cutoff := a.now().Add(-a.idempotencyRetention())
+
+	for k, v := range a.IdempotencyKeys {
+		if v.Timestamp.Before(cutoff) {
+			delete(a.IdempotencyKeys, k)
+		}
+	}
+}
+
+// remember records the given transaction against its idempotency key.
+func (a *Account) remember(key string, t Transaction) {
+	if key == "" {
+		return
+	}
+
+	if a.IdempotencyKeys == nil {
+		a.IdempotencyKeys = map[string]IdempotencyRecord{}
+	}
+
+	a.IdempotencyKeys[key] = IdempotencyRecord{
+		TransactionID: t.ID,
+		Type:          t.Type,
+		Timestamp:     t.Timestamp,
+	}
+}
@@ -0,0 +1,56 @@
+package card_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotency(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.IdempotencyRetention = time.Hour
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	t.Run("Replayed load", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency, WithIdempotencyKey("load-1")))
+		}
+
+		require.Equal(t, apd.New(10, 0), account.Available)
+		require.Len(t, account.Transactions, 1)
+	})
+
+	t.Run("Replayed authorization", func(t *testing.T) {
+		first, err := account.Authorize(ctx, merchantID, apd.New(4, 0), DefaultCurrency, WithIdempotencyKey("auth-1"))
+
+		require.NoError(t, err)
+
+		second, err := account.Authorize(ctx, merchantID, apd.New(4, 0), DefaultCurrency, WithIdempotencyKey("auth-1"))
+
+		require.NoError(t, err)
+		require.Equal(t, first, second)
+		require.Len(t, account.Transactions, 2)
+	})
+
+	t.Run("Key reused for a different operation", func(t *testing.T) {
+		err := account.Capture(ctx, 2, apd.New(1, 0), DefaultCurrency, WithIdempotencyKey("load-1"))
+
+		require.Equal(t, ErrIdempotencyKeyReused, errors.Cause(err))
+		require.Len(t, account.Transactions, 2)
+	})
+
+	t.Run("Key expired", func(t *testing.T) {
+		now = now.Add(time.Hour + time.Second)
+
+		require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency, WithIdempotencyKey("load-1")))
+		require.Len(t, account.Transactions, 3)
+		require.Len(t, account.IdempotencyKeys, 1)
+	})
+}
@@ -0,0 +1,63 @@
+package iso8583
+
+import (
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// currency represents an ISO 4217 currency.
+type currency struct {
+	code     string
+	exponent int32
+}
+
+// currencies maps ISO 4217 numeric codes to their alphabetic codes and minor
+// unit exponents.
+var currencies = map[string]currency{
+	"036": {"AUD", 2},
+	"048": {"BHD", 3},
+	"124": {"CAD", 2},
+	"156": {"CNY", 2},
+	"203": {"CZK", 2},
+	"208": {"DKK", 2},
+	"344": {"HKD", 2},
+	"348": {"HUF", 2},
+	"356": {"INR", 2},
+	"392": {"JPY", 0},
+	"410": {"KRW", 0},
+	"414": {"KWD", 3},
+	"484": {"MXN", 2},
+	"554": {"NZD", 2},
+	"578": {"NOK", 2},
+	"702": {"SGD", 2},
+	"710": {"ZAR", 2},
+	"752": {"SEK", 2},
+	"756": {"CHF", 2},
+	"826": {"GBP", 2},
+	"840": {"USD", 2},
+	"949": {"TRY", 2},
+	"978": {"EUR", 2},
+	"985": {"PLN", 2},
+	"986": {"BRL", 2},
+}
+
+// parseAmount returns the amount and alphabetic currency code of the given
+// amount in minor units and numeric currency code.
+func parseAmount(amount, numeric string) (*apd.Decimal, string, error) {
+	c, exists := currencies[numeric]
+
+	if !exists {
+		return nil, "", errors.Wrapf(card.ErrInvalidCurrency, "%q", numeric)
+	}
+
+	d, _, err := apd.NewFromString(amount)
+
+	if err != nil || amount == "" {
+		return nil, "", errors.Wrapf(ErrInvalidMessage, "amount %q", amount)
+	}
+
+	d.Exponent -= c.exponent
+
+	return d, c.code, nil
+}
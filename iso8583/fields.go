@@ -0,0 +1,73 @@
+package iso8583
+
+// Field data element numbers.
+const (
+	PAN                      = 2
+	ProcessingCode           = 3
+	Amount                   = 4
+	TransmissionDateTime     = 7
+	STAN                     = 11
+	LocalTime                = 12
+	LocalDate                = 13
+	ExpirationDate           = 14
+	MerchantType             = 18
+	POSEntryMode             = 22
+	POSConditionCode         = 25
+	AcquiringInstitutionID   = 32
+	Track2                   = 35
+	RetrievalReferenceNumber = 37
+	AuthorizationID          = 38
+	ResponseCode             = 39
+	TerminalID               = 41
+	CardAcceptorID           = 42
+	CardAcceptorName         = 43
+	CurrencyCode             = 49
+	AdditionalAmounts        = 54
+	NetworkManagementCode    = 70
+	OriginalDataElements     = 90
+	AccountID                = 102
+)
+
+// fieldFormat represents the length encoding of a field.
+type fieldFormat uint8
+
+const (
+	fixed fieldFormat = iota
+	llvar
+	lllvar
+)
+
+// fieldSpec describes the encoding of a data element.
+type fieldSpec struct {
+	format  fieldFormat
+	length  int
+	numeric bool
+}
+
+// fieldSpecs describes the supported ISO 8583:1987 data elements.
+var fieldSpecs = map[int]fieldSpec{
+	PAN:                      {llvar, 19, true},
+	ProcessingCode:           {fixed, 6, true},
+	Amount:                   {fixed, 12, true},
+	TransmissionDateTime:     {fixed, 10, true},
+	STAN:                     {fixed, 6, true},
+	LocalTime:                {fixed, 6, true},
+	LocalDate:                {fixed, 4, true},
+	ExpirationDate:           {fixed, 4, true},
+	MerchantType:             {fixed, 4, true},
+	POSEntryMode:             {fixed, 3, true},
+	POSConditionCode:         {fixed, 2, true},
+	AcquiringInstitutionID:   {llvar, 11, true},
+	Track2:                   {llvar, 37, false},
+	RetrievalReferenceNumber: {fixed, 12, false},
+	AuthorizationID:          {fixed, 6, false},
+	ResponseCode:             {fixed, 2, false},
+	TerminalID:               {fixed, 8, false},
+	CardAcceptorID:           {fixed, 15, false},
+	CardAcceptorName:         {fixed, 40, false},
+	CurrencyCode:             {fixed, 3, true},
+	AdditionalAmounts:        {lllvar, 120, false},
+	NetworkManagementCode:    {fixed, 3, true},
+	OriginalDataElements:     {fixed, 42, true},
+	AccountID:                {llvar, 28, false},
+}
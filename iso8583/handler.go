@@ -0,0 +1,233 @@
+package iso8583
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// Response codes.
+const (
+	Approved                = "00"
+	DoNotHonor              = "05"
+	InvalidTransaction      = "12"
+	InvalidAmount           = "13"
+	InvalidCardNumber       = "14"
+	UnableToLocateRecord    = "25"
+	FormatError             = "30"
+	InsufficientFunds       = "51"
+	TransactionNotPermitted = "57"
+	ExceedsAmountLimit      = "61"
+	RestrictedCard          = "62"
+	SystemMalfunction       = "96"
+)
+
+// ErrAccountNotFound is returned by Accounts implementations for unknown
+// primary account numbers.
+var ErrAccountNotFound = &card.Error{Code: "ACCOUNT_NOT_FOUND", Message: "account not found"}
+
+// Accounts provides the accounts addressed by primary account numbers.
+type Accounts interface {
+	// Update calls fn with the account of the given primary account number,
+	// persisting the account if fn succeeds. Implementations must serialize
+	// updates of an account, discard the changes of a failed fn and return
+	// ErrAccountNotFound for unknown numbers.
+	Update(ctx context.Context, pan string, fn func(card.Card) error) error
+}
+
+// echoedFields are copied from requests to their responses.
+var echoedFields = []int{
+	PAN,
+	ProcessingCode,
+	Amount,
+	TransmissionDateTime,
+	STAN,
+	LocalTime,
+	LocalDate,
+	AcquiringInstitutionID,
+	RetrievalReferenceNumber,
+	TerminalID,
+	CardAcceptorID,
+	CurrencyCode,
+	NetworkManagementCode,
+	OriginalDataElements,
+}
+
+// Handler applies ISO 8583 requests to accounts:
+//
+//   - 0100 authorization requests authorize the amount, returning the
+//     authorization ID in field 38 of the 0110 response
+//   - 0200 financial requests authorize and capture the amount
+//   - 0400 reversal requests (and 0401 repeats) reverse the amount of the
+//     authorization identified by field 38, or refund it when field 90 names
+//     an original 0200 financial request
+//   - 0800 network management requests are answered as approved
+//
+// The card acceptor ID (field 42) identifies the merchant and amounts are
+// given in the minor units of the numeric currency code (field 49).
+// Operations are made idempotent by the acquiring institution, transmission
+// time and STAN (fields 32, 7 and 11), so retransmitted requests aren't
+// applied twice.
+type Handler struct {
+	Accounts Accounts
+}
+
+// Handle applies the request, returning its response.
+func (h *Handler) Handle(ctx context.Context, req *Message) *Message {
+	res := NewMessage(responseMTI(req.MTI))
+
+	for _, v := range echoedFields {
+		if req.Has(v) {
+			res.Set(v, req.Get(v))
+		}
+	}
+
+	var err error
+
+	switch req.MTI {
+	case "0100":
+		err = h.authorize(ctx, req, res, false)
+	case "0200":
+		err = h.authorize(ctx, req, res, true)
+	case "0400", "0401":
+		err = h.reverse(ctx, req)
+	case "0800":
+	default:
+		res.Set(ResponseCode, InvalidTransaction)
+
+		return res
+	}
+
+	res.Set(ResponseCode, responseCode(err))
+
+	return res
+}
+
+// authorize authorizes and optionally captures the requested amount.
+func (h *Handler) authorize(ctx context.Context, req, res *Message, capture bool) error {
+	amount, currency, err := parseAmount(req.Get(Amount), req.Get(CurrencyCode))
+
+	if err != nil {
+		return err
+	}
+
+	merchantID, err := strconv.Atoi(strings.TrimSpace(req.Get(CardAcceptorID)))
+
+	if err != nil {
+		return errors.Wrapf(ErrInvalidMessage, "card acceptor ID %q", req.Get(CardAcceptorID))
+	}
+
+	return h.Accounts.Update(ctx, req.Get(PAN), func(c card.Card) error {
+		au, err := c.Authorize(ctx, merchantID, amount, currency, options(req, card.Authorize)...)
+
+		if err != nil {
+			return err
+		}
+
+		if au.ID > 999999 {
+			return errors.Errorf("authorization ID %d exceeds field 38", au.ID)
+		}
+
+		if capture {
+			err = c.Capture(ctx, au.ID, amount, currency, options(req, card.Capture)...)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		res.Set(AuthorizationID, pad(au.ID, 6))
+
+		return nil
+	})
+}
+
+// reverse reverses or refunds the requested amount of the original
+// authorization.
+func (h *Handler) reverse(ctx context.Context, req *Message) error {
+	amount, currency, err := parseAmount(req.Get(Amount), req.Get(CurrencyCode))
+
+	if err != nil {
+		return err
+	}
+
+	authorizationID, err := strconv.Atoi(strings.TrimSpace(req.Get(AuthorizationID)))
+
+	if err != nil {
+		return errors.Wrapf(card.ErrAuthorizationNotFound, "authorization ID %q", req.Get(AuthorizationID))
+	}
+
+	refund := strings.HasPrefix(req.Get(OriginalDataElements), "0200")
+
+	return h.Accounts.Update(ctx, req.Get(PAN), func(c card.Card) error {
+		if refund {
+			return c.Refund(ctx, authorizationID, amount, currency, options(req, card.Refund)...)
+		}
+
+		return c.Reverse(ctx, authorizationID, amount, currency, options(req, card.Reverse)...)
+	})
+}
+
+// options returns the transaction options of the request's operation.
+func options(req *Message, op card.Operation) []card.TransactionOption {
+	var opts []card.TransactionOption
+
+	if req.Has(RetrievalReferenceNumber) {
+		opts = append(opts, card.WithReference(strings.TrimSpace(req.Get(RetrievalReferenceNumber))))
+	}
+
+	if req.Has(TransmissionDateTime) && req.Has(STAN) {
+		key := strings.Join([]string{
+			"iso8583",
+			req.Get(AcquiringInstitutionID),
+			req.Get(TransmissionDateTime),
+			req.Get(STAN),
+			op.String(),
+		}, ":")
+		opts = append(opts, card.WithIdempotencyKey(key))
+	}
+
+	return opts
+}
+
+// responseMTI returns the response message type indicator of a request.
+func responseMTI(mti string) string {
+	if !validMTI(mti) {
+		return "0000"
+	}
+
+	return mti[:2] + string(mti[2]+1) + "0"
+}
+
+// responseCode returns the response code reporting the given error.
+func responseCode(err error) string {
+	if err == nil {
+		return Approved
+	}
+
+	switch card.ErrorCode(err) {
+	case ErrAccountNotFound.Code:
+		return InvalidCardNumber
+	case ErrInvalidMessage.Code, card.ErrInvalidCurrency.Code:
+		return FormatError
+	case card.ErrInvalidAmount.Code:
+		return InvalidAmount
+	case card.ErrUnderflow.Code:
+		return InsufficientFunds
+	case card.ErrLimitExceeded.Code, card.ErrMerchantLimitExceeded.Code:
+		return ExceedsAmountLimit
+	case card.ErrMerchantCategoryBlocked.Code, card.ErrCurrencyMismatch.Code:
+		return TransactionNotPermitted
+	case card.ErrAccountFrozen.Code, card.ErrAccountClosed.Code:
+		return RestrictedCard
+	case card.ErrAuthorizationNotFound.Code, card.ErrMerchantNotFound.Code:
+		return UnableToLocateRecord
+	case "":
+		return SystemMalfunction
+	}
+
+	return DoNotHonor
+}
@@ -0,0 +1,183 @@
+package iso8583_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	. "github.com/martingallagher/card/iso8583"
+	"github.com/stretchr/testify/require"
+)
+
+const pan = "4000123412341234"
+
+var ctx = context.Background()
+
+// accounts is an in-memory Accounts implementation.
+type accounts struct {
+	mu       sync.Mutex
+	accounts map[string]*card.Account
+}
+
+func newAccounts(balance int64) *accounts {
+	return &accounts{accounts: map[string]*card.Account{
+		pan: card.NewAccount(1, card.WithInitialBalance(apd.New(balance, 0))),
+	}}
+}
+
+func (a *accounts) Update(ctx context.Context, pan string, fn func(card.Card) error) error {
+	a.mu.Lock()
+
+	defer a.mu.Unlock()
+
+	account, exists := a.accounts[pan]
+
+	if !exists {
+		return ErrAccountNotFound
+	}
+
+	snapshot := account.Snapshot()
+	err := fn(account)
+
+	if err != nil {
+		a.accounts[pan] = card.RestoreAccount(snapshot)
+	}
+
+	return err
+}
+
+func (a *accounts) balance() *card.Balance {
+	a.mu.Lock()
+
+	defer a.mu.Unlock()
+
+	b, err := a.accounts[pan].Balance(ctx)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func request(mti, stan, amount string) *Message {
+	m := NewMessage(mti)
+	m.Set(PAN, pan)
+	m.Set(ProcessingCode, "000000")
+	m.Set(Amount, amount)
+	m.Set(TransmissionDateTime, "0615120000")
+	m.Set(STAN, stan)
+	m.Set(AcquiringInstitutionID, "123456")
+	m.Set(RetrievalReferenceNumber, "RRN000000001")
+	m.Set(CardAcceptorID, "321            ")
+	m.Set(CurrencyCode, "826")
+
+	return m
+}
+
+func TestHandler(t *testing.T) {
+	a := newAccounts(100)
+	h := &Handler{Accounts: a}
+
+	res := h.Handle(ctx, request("0100", "000001", "000000001050"))
+
+	require.Equal(t, "0110", res.MTI)
+	require.Equal(t, Approved, res.Get(ResponseCode))
+	require.Equal(t, "000002", res.Get(AuthorizationID))
+	require.Equal(t, "000001", res.Get(STAN))
+	require.Equal(t, "000000001050", res.Get(Amount))
+	require.Equal(t, "10.50", a.balance().Blocked.String())
+
+	t.Run("Retransmission", func(t *testing.T) {
+		res := h.Handle(ctx, request("0100", "000001", "000000001050"))
+
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "000002", res.Get(AuthorizationID))
+		require.Equal(t, "10.50", a.balance().Blocked.String())
+	})
+
+	t.Run("Reversal", func(t *testing.T) {
+		req := request("0400", "000002", "000000000050")
+		req.Set(AuthorizationID, "000002")
+		req.Set(OriginalDataElements, "0100000001061512000000000123456"+"00000000000")
+
+		res := h.Handle(ctx, req)
+
+		require.Equal(t, "0410", res.MTI)
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "10.00", a.balance().Blocked.String())
+
+		req.MTI = "0401"
+		res = h.Handle(ctx, req)
+
+		require.Equal(t, "0410", res.MTI)
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "10.00", a.balance().Blocked.String())
+	})
+
+	t.Run("Financial", func(t *testing.T) {
+		res := h.Handle(ctx, request("0200", "000003", "000000002000"))
+
+		require.Equal(t, "0210", res.MTI)
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "000004", res.Get(AuthorizationID))
+		require.Equal(t, "70.00", a.balance().Available.String())
+
+		req := request("0400", "000004", "000000002000")
+		req.Set(AuthorizationID, "000004")
+		req.Set(OriginalDataElements, "0200000003061512000000000123456"+"00000000000")
+		res = h.Handle(ctx, req)
+
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "90.00", a.balance().Available.String())
+	})
+
+	t.Run("Network management", func(t *testing.T) {
+		req := NewMessage("0800")
+		req.Set(STAN, "000005")
+		req.Set(NetworkManagementCode, "301")
+
+		res := h.Handle(ctx, req)
+
+		require.Equal(t, "0810", res.MTI)
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, "301", res.Get(NetworkManagementCode))
+	})
+
+	t.Run("Declines", func(t *testing.T) {
+		unknown := request("0100", "000010", "000000000100")
+		unknown.Set(PAN, "4000000000000000")
+
+		noCurrency := request("0100", "000011", "000000000100")
+		noCurrency.Set(CurrencyCode, "999")
+
+		noMerchant := request("0100", "000012", "000000000100")
+		noMerchant.Set(CardAcceptorID, "ACCEPTOR       ")
+
+		noAuthorization := request("0400", "000013", "000000000100")
+		noAuthorization.Set(AuthorizationID, "000099")
+
+		for _, v := range []struct {
+			req  *Message
+			code string
+		}{
+			{request("0100", "000006", "000000100000"), InsufficientFunds},
+			{request("0100", "000007", "000000000000"), InvalidAmount},
+			{request("0200", "000008", "000000100000"), InsufficientFunds},
+			{request("0300", "000009", "000000000100"), InvalidTransaction},
+			{unknown, InvalidCardNumber},
+			{noCurrency, FormatError},
+			{noMerchant, FormatError},
+			{noAuthorization, UnableToLocateRecord},
+		} {
+			res := h.Handle(ctx, v.req)
+
+			require.Equal(t, v.code, res.Get(ResponseCode), v.req.MTI+" "+v.req.Get(STAN))
+			require.False(t, res.Has(AuthorizationID))
+		}
+
+		require.Equal(t, "90.00", a.balance().Available.String())
+	})
+}
@@ -0,0 +1,290 @@
+// Package iso8583 adapts accounts to ISO 8583 card network messages,
+// accepting authorization, financial and reversal requests over TCP.
+//
+// Messages are encoded as ASCII: a four digit message type indicator (MTI),
+// a binary bitmap (with a secondary bitmap when fields above 64 are present)
+// and the data elements, variable length elements being prefixed with their
+// length as two (LLVAR) or three (LLLVAR) ASCII digits. Over TCP each message
+// is framed by a two byte big-endian length header.
+package iso8583
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidMessage is returned for malformed messages.
+var ErrInvalidMessage = &card.Error{Code: "INVALID_MESSAGE", Message: "invalid ISO 8583 message"}
+
+// maxMessageLength is the largest message length a two byte header frames.
+const maxMessageLength = 1<<16 - 1
+
+// Message represents an ISO 8583 message.
+type Message struct {
+	MTI    string
+	Fields map[int]string
+}
+
+// NewMessage returns an empty message with the given message type indicator.
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, Fields: map[int]string{}}
+}
+
+// Get returns the value of the given field, or an empty string if it's
+// absent.
+func (m *Message) Get(field int) string {
+	return m.Fields[field]
+}
+
+// Set sets the value of the given field.
+func (m *Message) Set(field int, value string) {
+	if m.Fields == nil {
+		m.Fields = map[int]string{}
+	}
+
+	m.Fields[field] = value
+}
+
+// Has reports whether the given field is present.
+func (m *Message) Has(field int) bool {
+	_, exists := m.Fields[field]
+
+	return exists
+}
+
+// Pack encodes the message.
+func (m *Message) Pack() ([]byte, error) {
+	if !validMTI(m.MTI) {
+		return nil, errors.Wrapf(ErrInvalidMessage, "MTI %q", m.MTI)
+	}
+
+	fields := make([]int, 0, len(m.Fields))
+
+	for k := range m.Fields {
+		fields = append(fields, k)
+	}
+
+	sort.Ints(fields)
+
+	bitmap := make([]byte, 8)
+
+	if len(fields) > 0 && fields[len(fields)-1] > 64 {
+		bitmap = make([]byte, 16)
+		bitmap[0] |= 0x80
+	}
+
+	var buf bytes.Buffer
+
+	for _, v := range fields {
+		spec, exists := fieldSpecs[v]
+
+		if !exists {
+			return nil, errors.Wrapf(ErrInvalidMessage, "unsupported field %d", v)
+		}
+
+		value := m.Fields[v]
+		err := spec.validate(value)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %d", v)
+		}
+
+		bitmap[(v-1)/8] |= 0x80 >> uint((v-1)%8)
+
+		switch spec.format {
+		case llvar:
+			buf.WriteString(pad(len(value), 2))
+		case lllvar:
+			buf.WriteString(pad(len(value), 3))
+		}
+
+		buf.WriteString(value)
+	}
+
+	res := make([]byte, 0, len(m.MTI)+len(bitmap)+buf.Len())
+	res = append(res, m.MTI...)
+	res = append(res, bitmap...)
+
+	return append(res, buf.Bytes()...), nil
+}
+
+// Unpack decodes a message.
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < 12 {
+		return nil, errors.Wrap(ErrInvalidMessage, "message too short")
+	}
+
+	m := NewMessage(string(b[:4]))
+
+	if !validMTI(m.MTI) {
+		return nil, errors.Wrapf(ErrInvalidMessage, "MTI %q", m.MTI)
+	}
+
+	bitmap, b := b[4:12], b[12:]
+
+	if bitmap[0]&0x80 != 0 {
+		if len(b) < 8 {
+			return nil, errors.Wrap(ErrInvalidMessage, "truncated secondary bitmap")
+		}
+
+		bitmap = append(bitmap[:8:8], b[:8]...)
+		b = b[8:]
+	}
+
+	for i := 2; i <= len(bitmap)*8; i++ {
+		if bitmap[(i-1)/8]&(0x80>>uint((i-1)%8)) == 0 {
+			continue
+		}
+
+		spec, exists := fieldSpecs[i]
+
+		if !exists {
+			return nil, errors.Wrapf(ErrInvalidMessage, "unsupported field %d", i)
+		}
+
+		var (
+			value string
+			err   error
+		)
+
+		value, b, err = spec.unpack(b)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %d", i)
+		}
+
+		m.Fields[i] = value
+	}
+
+	if len(b) > 0 {
+		return nil, errors.Wrapf(ErrInvalidMessage, "%d trailing bytes", len(b))
+	}
+
+	return m, nil
+}
+
+// ReadMessage reads and decodes a length framed message.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [2]byte
+
+	_, err := io.ReadFull(r, header[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint16(header[:]))
+	_, err = io.ReadFull(r, b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Unpack(b)
+}
+
+// WriteMessage encodes and writes the length framed message.
+func WriteMessage(w io.Writer, m *Message) error {
+	b, err := m.Pack()
+
+	if err != nil {
+		return err
+	}
+
+	if len(b) > maxMessageLength {
+		return errors.Wrapf(ErrInvalidMessage, "length %d exceeds %d", len(b), maxMessageLength)
+	}
+
+	frame := make([]byte, 2, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	_, err = w.Write(append(frame, b...))
+
+	return err
+}
+
+// validate checks the value fits the field.
+func (s fieldSpec) validate(value string) error {
+	if s.format == fixed && len(value) != s.length {
+		return errors.Wrapf(ErrInvalidMessage, "length %d, expected %d", len(value), s.length)
+	}
+
+	if len(value) > s.length {
+		return errors.Wrapf(ErrInvalidMessage, "length %d exceeds %d", len(value), s.length)
+	}
+
+	if s.numeric && !digits(value) {
+		return errors.Wrapf(ErrInvalidMessage, "non-numeric value %q", value)
+	}
+
+	return nil
+}
+
+// unpack decodes the field at the start of b, returning its value and the
+// remaining bytes.
+func (s fieldSpec) unpack(b []byte) (string, []byte, error) {
+	n := s.length
+
+	if s.format != fixed {
+		prefix := 2
+
+		if s.format == lllvar {
+			prefix = 3
+		}
+
+		if len(b) < prefix {
+			return "", nil, errors.Wrap(ErrInvalidMessage, "truncated length")
+		}
+
+		var err error
+
+		n, err = strconv.Atoi(string(b[:prefix]))
+
+		if err != nil || n < 0 {
+			return "", nil, errors.Wrapf(ErrInvalidMessage, "length %q", b[:prefix])
+		}
+
+		b = b[prefix:]
+	}
+
+	if len(b) < n {
+		return "", nil, errors.Wrap(ErrInvalidMessage, "truncated value")
+	}
+
+	value := string(b[:n])
+
+	return value, b[n:], s.validate(value)
+}
+
+// validMTI reports whether the given value is a four digit message type
+// indicator.
+func validMTI(mti string) bool {
+	return len(mti) == 4 && digits(mti)
+}
+
+// digits reports whether the given value consists of ASCII digits.
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pad returns n formatted as a zero padded decimal of the given width.
+func pad(n, width int) string {
+	s := strconv.Itoa(n)
+
+	for len(s) < width {
+		s = "0" + s
+	}
+
+	return s
+}
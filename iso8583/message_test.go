@@ -0,0 +1,100 @@
+package iso8583_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/martingallagher/card/iso8583"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPack(t *testing.T) {
+	m := NewMessage("0100")
+	m.Set(PAN, "4000123412341234")
+	m.Set(ProcessingCode, "000000")
+	m.Set(Amount, "000000001050")
+	m.Set(STAN, "000001")
+	m.Set(CardAcceptorID, "321            ")
+	m.Set(CurrencyCode, "826")
+
+	b, err := m.Pack()
+
+	require.NoError(t, err)
+	require.Equal(t, "0100", string(b[:4]))
+	require.Equal(t, []byte{0x70, 0x20, 0x00, 0x00, 0x00, 0x40, 0x80, 0x00}, b[4:12])
+	require.Equal(t, "164000123412341234000000000000001050000001321            826", string(b[12:]))
+
+	t.Run("Round trip", func(t *testing.T) {
+		res, err := Unpack(b)
+
+		require.NoError(t, err)
+		require.Equal(t, m, res)
+	})
+
+	t.Run("Secondary bitmap", func(t *testing.T) {
+		m := NewMessage("0400")
+		m.Set(STAN, "000002")
+		m.Set(AccountID, "123")
+
+		b, err := m.Pack()
+
+		require.NoError(t, err)
+		require.Equal(t, byte(0x80), b[4]&0x80)
+		require.Len(t, b, 4+16+6+2+3)
+
+		res, err := Unpack(b)
+
+		require.NoError(t, err)
+		require.Equal(t, m, res)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, v := range []*Message{
+			{MTI: "01A0"},
+			{MTI: "0100", Fields: map[int]string{Amount: "1050"}},
+			{MTI: "0100", Fields: map[int]string{Amount: "00000000105A"}},
+			{MTI: "0100", Fields: map[int]string{PAN: "40001234123412341234"}},
+			{MTI: "0100", Fields: map[int]string{5: "000000001050"}},
+		} {
+			_, err := v.Pack()
+
+			require.Equal(t, ErrInvalidMessage, errors.Cause(err))
+		}
+	})
+}
+
+func TestUnpack(t *testing.T) {
+	for _, v := range []string{
+		"0100",
+		"0100\x00\x00\x00\x00\x00\x00\x00",
+		"0100\x10\x00\x00\x00\x00\x00\x00\x00000000",
+		"0100\x40\x00\x00\x00\x00\x00\x00\x00204000",
+		"0100\x00\x00\x00\x00\x00\x00\x00\x00trailing",
+		"0100\x80\x00\x00\x00\x00\x00\x00\x00",
+		"0100\x08\x00\x00\x00\x00\x00\x00\x00",
+	} {
+		_, err := Unpack([]byte(v))
+
+		require.Equal(t, ErrInvalidMessage, errors.Cause(err), "%q", v)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	var buf bytes.Buffer
+
+	m := NewMessage("0800")
+	m.Set(NetworkManagementCode, "301")
+
+	require.NoError(t, WriteMessage(&buf, m))
+	require.Equal(t, []byte{0, 23}, buf.Bytes()[:2])
+
+	res, err := ReadMessage(&buf)
+
+	require.NoError(t, err)
+	require.Equal(t, m, res)
+
+	_, err = ReadMessage(&buf)
+
+	require.Error(t, err)
+}
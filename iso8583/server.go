@@ -0,0 +1,175 @@
+package iso8583
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrServerClosed is returned by Serve after the server is closed.
+var ErrServerClosed = errors.New("iso8583: server closed")
+
+// Server accepts length framed ISO 8583 requests over TCP, answering each
+// with the response of its handler. Requests on a connection are handled in
+// order.
+type Server struct {
+	Handler *Handler
+
+	// IdleTimeout closes connections without requests for the given
+	// duration; zero disables it.
+	IdleTimeout time.Duration
+
+	// ErrorLog is called with connection errors, if set.
+	ErrorLog func(error)
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ListenAndServe listens on the given TCP address and serves requests.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+
+		return ErrServerClosed
+	}
+
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+
+			return ErrServerClosed
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections, closes open connections and waits for
+// requests being handled to complete.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+
+	var err error
+
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	return err
+}
+
+// track registers the connection, reporting false if the server is closed.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if s.conns == nil {
+		s.conns = map[net.Conn]bool{}
+	}
+
+	s.conns[conn] = true
+	s.wg.Add(1)
+
+	return true
+}
+
+// serveConn answers the connection's requests until it's closed or a
+// malformed message is received.
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		s.wg.Done()
+	}()
+
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+
+		req, err := ReadMessage(conn)
+
+		if err != nil {
+			s.logError(errors.Wrapf(err, "read from %s", conn.RemoteAddr()))
+
+			return
+		}
+
+		err = WriteMessage(conn, s.Handler.Handle(context.Background(), req))
+
+		if err != nil {
+			s.logError(errors.Wrapf(err, "write to %s", conn.RemoteAddr()))
+
+			return
+		}
+	}
+}
+
+// logError reports the connection error unless the server is closing.
+func (s *Server) logError(err error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed || s.ErrorLog == nil || errors.Cause(err) == io.EOF {
+		return
+	}
+
+	s.ErrorLog(err)
+}
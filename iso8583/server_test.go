@@ -0,0 +1,55 @@
+package iso8583_test
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/martingallagher/card/iso8583"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.NoError(t, err)
+
+	var (
+		s    = &Server{Handler: &Handler{Accounts: newAccounts(100)}}
+		done = make(chan error)
+	)
+
+	go func() {
+		done <- s.Serve(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	for _, v := range []struct {
+		stan            string
+		authorizationID string
+	}{
+		{"000001", "000002"},
+		{"000002", "000003"},
+	} {
+		require.NoError(t, WriteMessage(conn, request("0100", v.stan, "000000001000")))
+
+		res, err := ReadMessage(conn)
+
+		require.NoError(t, err)
+		require.Equal(t, "0110", res.MTI)
+		require.Equal(t, Approved, res.Get(ResponseCode))
+		require.Equal(t, v.stan, res.Get(STAN))
+		require.Equal(t, v.authorizationID, res.Get(AuthorizationID))
+	}
+
+	require.NoError(t, s.Close())
+	require.Equal(t, ErrServerClosed, <-done)
+
+	_, err = ReadMessage(conn)
+
+	require.Error(t, err)
+}
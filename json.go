@@ -0,0 +1,373 @@
+package card
+
+import (
+	"encoding/json"
+
+	"github.com/cockroachdb/apd"
+)
+
+// plainDecimal marshals a decimal as a plain notation string, e.g. "1000"
+// rather than "1.000E+3".
+type plainDecimal struct {
+	*apd.Decimal
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d plainDecimal) MarshalText() ([]byte, error) {
+	return []byte(d.Text('f')), nil
+}
+
+// plain returns the given decimal for plain notation marshaling, or nil if
+// nil.
+func plain(d *apd.Decimal) *plainDecimal {
+	if d == nil {
+		return nil
+	}
+
+	return &plainDecimal{d}
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings and recording the precision and rounding mode of the
+// account's decimal context, if set.
+func (a *Account) MarshalJSON() ([]byte, error) {
+	type account Account
+
+	var decimal *decimalSettings
+
+	if a.DecimalContext != nil {
+		decimal = &decimalSettings{a.DecimalContext.Precision, a.DecimalContext.Rounding}
+	}
+
+	return json.Marshal(&struct {
+		*account
+		Available *plainDecimal    `json:"available"`
+		Blocked   *plainDecimal    `json:"blocked"`
+		Overdraft *plainDecimal    `json:"overdraft,omitempty"`
+		Decimal   *decimalSettings `json:"decimal,omitempty"`
+	}{
+		account:   (*account)(a),
+		Available: plain(a.Available),
+		Blocked:   plain(a.Blocked),
+		Overdraft: plain(a.Overdraft),
+		Decimal:   decimal,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, initialising the
+// merchant records of accounts encoded without any and restoring the
+// account's decimal context.
+func (a *Account) UnmarshalJSON(data []byte) error {
+	type account Account
+
+	v := struct {
+		*account
+		Decimal *decimalSettings `json:"decimal"`
+	}{account: (*account)(a)}
+
+	err := json.Unmarshal(data, &v)
+
+	if err != nil {
+		return err
+	}
+
+	if a.Merchants == nil {
+		a.Merchants = map[int]*Merchant{}
+	}
+
+	if v.Decimal != nil {
+		a.DecimalContext, err = v.Decimal.context()
+	}
+
+	return err
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (p Pocket) MarshalJSON() ([]byte, error) {
+	type pocket Pocket
+
+	return json.Marshal(&struct {
+		pocket
+		Available *plainDecimal `json:"available"`
+		Blocked   *plainDecimal `json:"blocked"`
+	}{
+		pocket:    pocket(p),
+		Available: plain(p.Available),
+		Blocked:   plain(p.Blocked),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (m Merchant) MarshalJSON() ([]byte, error) {
+	type merchant Merchant
+
+	return json.Marshal(&struct {
+		merchant
+		Available *plainDecimal `json:"available"`
+		Captured  *plainDecimal `json:"captured"`
+		Limit     *plainDecimal `json:"limit,omitempty"`
+		Settled   *plainDecimal `json:"settled,omitempty"`
+	}{
+		merchant:  merchant(m),
+		Available: plain(m.Available),
+		Captured:  plain(m.Captured),
+		Limit:     plain(m.Limit),
+		Settled:   plain(m.Settled),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (s MerchantSettlement) MarshalJSON() ([]byte, error) {
+	type merchantSettlement MerchantSettlement
+
+	return json.Marshal(&struct {
+		merchantSettlement
+		Amount *plainDecimal `json:"amount"`
+	}{
+		merchantSettlement: merchantSettlement(s),
+		Amount:             plain(s.Amount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (au Authorization) MarshalJSON() ([]byte, error) {
+	type authorization Authorization
+
+	return json.Marshal(&struct {
+		authorization
+		Amount   *plainDecimal `json:"amount"`
+		Captured *plainDecimal `json:"captured"`
+		Reversed *plainDecimal `json:"reversed"`
+		Refunded *plainDecimal `json:"refunded"`
+	}{
+		authorization: authorization(au),
+		Amount:        plain(au.Amount),
+		Captured:      plain(au.Captured),
+		Reversed:      plain(au.Reversed),
+		Refunded:      plain(au.Refunded),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type transaction Transaction
+
+	return json.Marshal(&struct {
+		transaction
+		Amount         *plainDecimal `json:"amount"`
+		OriginalAmount *plainDecimal `json:"originalAmount,omitempty"`
+	}{
+		transaction:    transaction(t),
+		Amount:         plain(t.Amount),
+		OriginalAmount: plain(t.OriginalAmount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (l Limit) MarshalJSON() ([]byte, error) {
+	type limit Limit
+
+	return json.Marshal(&struct {
+		limit
+		Amount *plainDecimal `json:"amount"`
+	}{
+		limit:  limit(l),
+		Amount: plain(l.Amount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (t TopUp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Threshold *plainDecimal `json:"threshold"`
+		Amount    *plainDecimal `json:"amount"`
+	}{
+		Threshold: plain(t.Threshold),
+		Amount:    plain(t.Amount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (m Mandate) MarshalJSON() ([]byte, error) {
+	type mandate Mandate
+
+	return json.Marshal(&struct {
+		mandate
+		Limit  *plainDecimal `json:"limit"`
+		Pulled *plainDecimal `json:"pulled"`
+	}{
+		mandate: mandate(m),
+		Limit:   plain(m.Limit),
+		Pulled:  plain(m.Pulled),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (d Dispute) MarshalJSON() ([]byte, error) {
+	type dispute Dispute
+
+	return json.Marshal(&struct {
+		dispute
+		Amount *plainDecimal `json:"amount"`
+	}{
+		dispute: dispute(d),
+		Amount:  plain(d.Amount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	type schedule Schedule
+
+	return json.Marshal(&struct {
+		schedule
+		Amount *plainDecimal `json:"amount"`
+	}{
+		schedule: schedule(s),
+		Amount:   plain(s.Amount),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (b Balance) MarshalJSON() ([]byte, error) {
+	type balance Balance
+
+	return json.Marshal(&struct {
+		balance
+		Total             *plainDecimal `json:"total"`
+		Available         *plainDecimal `json:"available"`
+		Blocked           *plainDecimal `json:"blocked"`
+		OverdraftUsed     *plainDecimal `json:"overdraftUsed,omitempty"`
+		OverdraftHeadroom *plainDecimal `json:"overdraftHeadroom,omitempty"`
+	}{
+		balance:           balance(b),
+		Total:             plain(b.Total),
+		Available:         plain(b.Available),
+		Blocked:           plain(b.Blocked),
+		OverdraftUsed:     plain(b.OverdraftUsed),
+		OverdraftHeadroom: plain(b.OverdraftHeadroom),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (t SummaryTotals) MarshalJSON() ([]byte, error) {
+	type summaryTotals SummaryTotals
+
+	return json.Marshal(&struct {
+		summaryTotals
+		Loaded      *plainDecimal `json:"loaded"`
+		Authorized  *plainDecimal `json:"authorized"`
+		Captured    *plainDecimal `json:"captured"`
+		Reversed    *plainDecimal `json:"reversed"`
+		Refunded    *plainDecimal `json:"refunded"`
+		ChargedBack *plainDecimal `json:"chargedBack"`
+	}{
+		summaryTotals: summaryTotals(t),
+		Loaded:        plain(t.Loaded),
+		Authorized:    plain(t.Authorized),
+		Captured:      plain(t.Captured),
+		Reversed:      plain(t.Reversed),
+		Refunded:      plain(t.Refunded),
+		ChargedBack:   plain(t.ChargedBack),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (h MerchantHolding) MarshalJSON() ([]byte, error) {
+	type merchantHolding MerchantHolding
+
+	return json.Marshal(&struct {
+		merchantHolding
+		Available *plainDecimal `json:"available"`
+		Captured  *plainDecimal `json:"captured"`
+		Limit     *plainDecimal `json:"limit,omitempty"`
+		Settled   *plainDecimal `json:"settled,omitempty"`
+	}{
+		merchantHolding: merchantHolding(h),
+		Available:       plain(h.Available),
+		Captured:        plain(h.Captured),
+		Limit:           plain(h.Limit),
+		Settled:         plain(h.Settled),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (p Payout) MarshalJSON() ([]byte, error) {
+	type payout Payout
+
+	return json.Marshal(&struct {
+		payout
+		FeeRate *plainDecimal `json:"feeRate,omitempty"`
+	}{
+		payout:  payout(p),
+		FeeRate: plain(p.FeeRate),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (t PayoutTotal) MarshalJSON() ([]byte, error) {
+	type payoutTotal PayoutTotal
+
+	return json.Marshal(&struct {
+		payoutTotal
+		Gross   *plainDecimal `json:"gross"`
+		Refunds *plainDecimal `json:"refunds"`
+		Fees    *plainDecimal `json:"fees"`
+		Net     *plainDecimal `json:"net"`
+	}{
+		payoutTotal: payoutTotal(t),
+		Gross:       plain(t.Gross),
+		Refunds:     plain(t.Refunds),
+		Fees:        plain(t.Fees),
+		Net:         plain(t.Net),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (l PayoutLine) MarshalJSON() ([]byte, error) {
+	type payoutLine PayoutLine
+
+	return json.Marshal(&struct {
+		payoutLine
+		Amount *plainDecimal `json:"amount"`
+		Fee    *plainDecimal `json:"fee,omitempty"`
+	}{
+		payoutLine: payoutLine(l),
+		Amount:     plain(l.Amount),
+		Fee:        plain(l.Fee),
+	})
+}
+
+// MarshalJSON implements the json.Marshaler interface, rendering amounts as
+// plain decimal strings.
+func (d Discrepancy) MarshalJSON() ([]byte, error) {
+	type discrepancy Discrepancy
+
+	return json.Marshal(&struct {
+		discrepancy
+		Stored     *plainDecimal `json:"stored"`
+		Computed   *plainDecimal `json:"computed"`
+		Difference *plainDecimal `json:"difference"`
+	}{
+		discrepancy: discrepancy(d),
+		Stored:      plain(d.Stored),
+		Computed:    plain(d.Computed),
+		Difference:  plain(d.Difference),
+	})
+}
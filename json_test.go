@@ -0,0 +1,97 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecimalJSON(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(1, 3), DefaultCurrency))
+	require.NoError(t, account.SetMerchantLimit(merchantID, apd.New(5, 2)))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(15, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	b, err := json.Marshal(account)
+
+	require.NoError(t, err)
+
+	var v map[string]interface{}
+
+	require.NoError(t, json.Unmarshal(b, &v))
+	require.Equal(t, "1900.75", v["available"])
+	require.Equal(t, "15", v["blocked"])
+	require.Equal(t, "1000", v["transactions"].([]interface{})[1].(map[string]interface{})["amount"])
+	require.Equal(t, "500", v["merchants"].(map[string]interface{})["1"].(map[string]interface{})["limit"])
+	require.Equal(t, "15", v["authorizations"].(map[string]interface{})["3"].(map[string]interface{})["amount"])
+
+	t.Run("Round trip", func(t *testing.T) {
+		var restored Account
+
+		require.NoError(t, json.Unmarshal(b, &restored))
+		require.Zero(t, restored.Available.Cmp(account.Available))
+		require.Zero(t, restored.Merchants[merchantID].Limit.Cmp(apd.New(500, 0)))
+		require.Zero(t, restored.Authorizations[au.ID].Amount.Cmp(apd.New(15, 0)))
+		require.Equal(t, account.Transactions[0].Amount.String(), restored.Transactions[0].Amount.String())
+	})
+
+	t.Run("No merchants", func(t *testing.T) {
+		var restored Account
+
+		require.NoError(t, json.Unmarshal([]byte(`{"id":1,"currency":"GBP","available":"100","blocked":"0"}`), &restored))
+		require.NotNil(t, restored.Merchants)
+
+		_, err := restored.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+		require.Zero(t, restored.Merchants[merchantID].Available.Cmp(apd.New(10, 0)))
+	})
+
+	t.Run("Decimal context", func(t *testing.T) {
+		c := apd.BaseContext.WithPrecision(3)
+		c.Rounding = apd.RoundDown
+		account := NewAccount(1, WithDecimalContext(c), WithInitialBalance(apd.New(100, 0)))
+		b, err := json.Marshal(account)
+
+		require.NoError(t, err)
+
+		var restored Account
+
+		require.NoError(t, json.Unmarshal(b, &restored))
+		require.NotNil(t, restored.DecimalContext)
+		require.Equal(t, uint32(3), restored.DecimalContext.Precision)
+		require.Equal(t, apd.RoundDown, restored.DecimalContext.Rounding)
+		require.NoError(t, restored.Load(ctx, apd.New(5, -1), DefaultCurrency))
+		require.Equal(t, "100", restored.Available.Text('f'), "rounded to the persisted precision")
+
+		// Accounts without a context use the package context
+		b, err = json.Marshal(NewAccount(2))
+
+		require.NoError(t, err)
+		require.NotContains(t, string(b), `"decimal"`)
+
+		err = json.Unmarshal([]byte(`{"id":1,"available":"0","blocked":"0","decimal":{"precision":16,"rounding":"nearest"}}`), &restored)
+
+		require.Equal(t, ErrInvalidRounding, errors.Cause(err))
+	})
+
+	t.Run("Balance", func(t *testing.T) {
+		balance, err := account.Balance(ctx)
+
+		require.NoError(t, err)
+
+		b, err := json.Marshal(balance)
+
+		require.NoError(t, err)
+		require.JSONEq(t, `{"total":"1915.75","available":"1900.75","blocked":"15"}`, string(b))
+	})
+}
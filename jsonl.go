@@ -0,0 +1,120 @@
+package card
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// auditRecord represents a transaction of the JSON Lines audit trail along
+// with the resulting balances of its currency.
+type auditRecord struct {
+	ID         int           `json:"id"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Operation  Operation     `json:"op"`
+	MerchantID *int          `json:"merchantID,omitempty"`
+	Amount     *plainDecimal `json:"amount"`
+	Currency   string        `json:"currency"`
+	Available  *plainDecimal `json:"available"`
+	Blocked    *plainDecimal `json:"blocked"`
+}
+
+// ExportJSONLines writes the transaction log as JSON Lines, one object per
+// transaction with the available and blocked balances of the transaction
+// currency after it, for log and analytics pipelines. Filtered and paged
+// exports omit records but not their effect on the balances.
+func (a *Account) ExportJSONLines(w io.Writer, opts ...StatementOption) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	var (
+		o        = newStatementOptions(opts)
+		enc      = json.NewEncoder(w)
+		dctx     = a.decimalContext()
+		balances = map[string]*Pocket{}
+		records  = map[int]*auditRecord{}
+
+		selected, _ = a.page(o)
+	)
+
+	for _, v := range selected {
+		records[v.ID] = &auditRecord{
+			ID:         v.ID,
+			Timestamp:  v.Timestamp,
+			Operation:  v.Type,
+			MerchantID: v.MerchantID,
+			Amount:     plain(v.Amount),
+			Currency:   v.Currency,
+		}
+	}
+
+	for _, v := range a.Transactions {
+		p, exists := balances[v.Currency]
+
+		if !exists {
+			p = &Pocket{Available: apd.New(0, 0), Blocked: apd.New(0, 0)}
+			balances[v.Currency] = p
+		}
+
+		err := applyTransaction(dctx, p, v)
+
+		if err != nil {
+			return err
+		}
+
+		r, exists := records[v.ID]
+
+		if exists {
+			r.Available = plain(copyDecimal(p.Available))
+			r.Blocked = plain(copyDecimal(p.Blocked))
+		}
+	}
+
+	for _, v := range selected {
+		err := enc.Encode(records[v.ID])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTransaction applies the balance movement of the given transaction to
+// the given pocket balances.
+func applyTransaction(dctx *apd.Context, p *Pocket, v Transaction) error {
+	var credit, debit *apd.Decimal
+
+	switch v.Type {
+	case Load, Refund, Adjustment, Chargeback:
+		credit = p.Available
+	case Authorize:
+		credit, debit = p.Blocked, p.Available
+	case Capture:
+		debit = p.Blocked
+	case Reverse:
+		credit, debit = p.Available, p.Blocked
+	}
+
+	if credit != nil {
+		_, err := dctx.Add(credit, credit, v.Amount)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if debit != nil {
+		_, err := dctx.Sub(debit, debit, v.Amount)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
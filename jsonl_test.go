@@ -0,0 +1,51 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJSONLines(t *testing.T) {
+	account := NewAccount(0, WithClock(func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}))
+
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, 1, decimalFromString("15.00"), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, decimalFromString("2.5"), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+
+	var sb strings.Builder
+
+	require.NoError(t, account.ExportJSONLines(&sb))
+
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+
+	require.Len(t, lines, 5)
+	require.JSONEq(t, `{"id":1,"timestamp":"2018-06-01T09:30:00Z","op":"LOAD","amount":"915.75","currency":"GBP","available":"915.75","blocked":"0"}`, lines[0])
+	require.JSONEq(t, `{"id":2,"timestamp":"2018-06-01T09:30:00Z","op":"AUTHORIZE","merchantID":1,"amount":"15.00","currency":"GBP","available":"900.75","blocked":"15.00"}`, lines[1])
+	require.JSONEq(t, `{"id":3,"timestamp":"2018-06-01T09:30:00Z","op":"CAPTURE","merchantID":1,"amount":"10","currency":"GBP","available":"900.75","blocked":"5.00"}`, lines[2])
+	require.JSONEq(t, `{"id":4,"timestamp":"2018-06-01T09:30:00Z","op":"REVERSE","merchantID":1,"amount":"2.5","currency":"GBP","available":"903.25","blocked":"2.50"}`, lines[3])
+	require.JSONEq(t, `{"id":5,"timestamp":"2018-06-01T09:30:00Z","op":"REFUND","merchantID":1,"amount":"10","currency":"GBP","available":"913.25","blocked":"2.50"}`, lines[4])
+
+	t.Run("Filtered", func(t *testing.T) {
+		var sb strings.Builder
+		op := Capture
+
+		require.NoError(t, account.ExportJSONLines(&sb, WithFilter(FilterOptions{Type: &op})))
+		require.JSONEq(t, lines[2], sb.String())
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, ErrAccountClosed, account.ExportJSONLines(&sb))
+	})
+}
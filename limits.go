@@ -0,0 +1,162 @@
+package card
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Spending limit periods.
+const (
+	Daily Period = iota
+	Monthly
+)
+
+// Spending limit errors.
+var (
+	ErrLimitExceeded = newError("LIMIT_EXCEEDED", "spending limit exceeded")
+	ErrInvalidPeriod = newError("INVALID_PERIOD", "invalid spending limit period")
+)
+
+// Period represents a rolling spending limit period.
+type Period uint8
+
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "DAY"
+	case Monthly:
+		return "MONTH"
+	}
+
+	return "UNKNOWN"
+}
+
+// ParsePeriod returns the period for the given name.
+func ParsePeriod(s string) (Period, error) {
+	switch strings.ToUpper(s) {
+	case "DAY":
+		return Daily, nil
+	case "MONTH":
+		return Monthly, nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidPeriod, "%q", s)
+}
+
+// Start returns the start of the rolling period ending at the given time.
+func (p Period) Start(now time.Time) time.Time {
+	if p == Monthly {
+		return now.AddDate(0, -1, 0)
+	}
+
+	return now.AddDate(0, 0, -1)
+}
+
+// Limit represents a maximum authorized amount per rolling period.
+type Limit struct {
+	Period Period       `json:"period"`
+	Amount *apd.Decimal `json:"amount"`
+}
+
+// SetLimits replaces the account spending limits.
+func (a *Account) SetLimits(limits []Limit) error {
+	seen := make(map[Period]bool, len(limits))
+
+	for _, v := range limits {
+		if v.Period != Daily && v.Period != Monthly {
+			return errors.Wrapf(ErrInvalidPeriod, "%d", v.Period)
+		}
+
+		if seen[v.Period] {
+			return errors.Wrapf(ErrInvalidPeriod, "duplicate %s limit", v.Period)
+		}
+
+		if v.Amount == nil {
+			return ErrInvalidAmount
+		}
+
+		if v.Amount.Form != apd.Finite || v.Amount.Sign() <= 0 {
+			return amountError(ErrInvalidAmount, v.Amount, nil)
+		}
+
+		seen[v.Period] = true
+	}
+
+	a.Limits = limits
+	a.bump()
+
+	return nil
+}
+
+// Spent returns the amount authorized in the account currency since the
+// given time, excluding reversed amounts.
+func (a *Account) Spent(since time.Time) (*apd.Decimal, error) {
+	var (
+		spent = apd.New(0, 0)
+		dctx  = a.decimalContext()
+	)
+
+	for _, au := range a.Authorizations {
+		if au.Currency != a.Currency {
+			continue
+		}
+
+		t, err := a.Transaction(au.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Timestamp.Before(since) {
+			continue
+		}
+
+		_, err = dctx.Add(spent, spent, au.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = dctx.Sub(spent, spent, au.Reversed)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spent, nil
+}
+
+// checkLimits verifies authorizing the given amount doesn't breach any
+// spending limit.
+func (a *Account) checkLimits(amount *apd.Decimal) error {
+	now := a.now()
+
+	for _, v := range a.Limits {
+		spent, err := a.Spent(v.Period.Start(now))
+
+		if err != nil {
+			return err
+		}
+
+		headroom := apd.New(0, 0)
+		_, err = a.decimalContext().Sub(headroom, v.Amount, spent)
+
+		if err != nil {
+			return err
+		}
+
+		if headroom.Cmp(amount) < 0 {
+			if headroom.Sign() < 0 {
+				headroom.SetInt64(0)
+			}
+
+			return amountError(errors.Wrapf(ErrLimitExceeded, "%s limit: %s", v.Period, v.Amount), amount, headroom)
+		}
+	}
+
+	return nil
+}
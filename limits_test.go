@@ -0,0 +1,93 @@
+package card_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriod(t *testing.T) {
+	p, err := ParsePeriod("day")
+
+	require.NoError(t, err)
+	require.Equal(t, Daily, p)
+
+	p, err = ParsePeriod("MONTH")
+
+	require.NoError(t, err)
+	require.Equal(t, Monthly, p)
+
+	_, err = ParsePeriod("week")
+
+	require.Equal(t, ErrInvalidPeriod, errors.Cause(err))
+}
+
+func TestSetLimits(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, ErrInvalidAmount, errors.Cause(account.SetLimits([]Limit{{Daily, apd.New(-1, 0)}})))
+	require.Equal(t, ErrInvalidPeriod, errors.Cause(account.SetLimits([]Limit{{Daily, apd.New(1, 0)}, {Daily, apd.New(2, 0)}})))
+	require.Equal(t, ErrInvalidPeriod, errors.Cause(account.SetLimits([]Limit{{Period(9), apd.New(1, 0)}})))
+	require.Empty(t, account.Limits)
+}
+
+func TestLimits(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0)
+	account.Clock = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, account.Load(ctx, apd.New(5000, 0), DefaultCurrency))
+	require.NoError(t, account.SetLimits([]Limit{
+		{Daily, apd.New(500, 0)},
+		{Monthly, apd.New(2000, 0)},
+	}))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(400, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	t.Run("Daily limit", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(101, 0), DefaultCurrency)
+
+		require.Equal(t, ErrLimitExceeded, errors.Cause(err))
+
+		_, err = account.Authorize(ctx, merchantID, apd.New(100, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Reversed amounts are excluded", func(t *testing.T) {
+		require.NoError(t, account.Reverse(ctx, au.ID, apd.New(50, 0), DefaultCurrency))
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Monthly limit", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			now = now.Add(25 * time.Hour)
+
+			_, err := account.Authorize(ctx, merchantID, apd.New(500, 0), DefaultCurrency)
+
+			require.NoError(t, err)
+		}
+
+		now = now.Add(25 * time.Hour)
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, ErrLimitExceeded, errors.Cause(err))
+
+		spent, err := account.Spent(Monthly.Start(now))
+
+		require.NoError(t, err)
+		require.Zero(t, spent.Cmp(apd.New(2000, 0)))
+	})
+}
@@ -0,0 +1,87 @@
+package card
+
+import (
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidOriginalTransaction is returned when a reversal or refund is
+// linked to a transaction it can't apply to.
+var ErrInvalidOriginalTransaction = newError("INVALID_ORIGINAL_TRANSACTION", "invalid original transaction")
+
+// WithOriginalTransaction links a reversal to its authorization transaction
+// or a refund to its capture transaction. Linked refunds are limited to the
+// amount of the capture not already refunded against it.
+func WithOriginalTransaction(id int) TransactionOption {
+	return func(o *transactionOptions) {
+		o.originalTransactionID = id
+	}
+}
+
+// linkable returns the amount of the given original transaction which may
+// still be reversed or refunded by the given operation against the given
+// authorization.
+func (a *Account) linkable(op Operation, au *Authorization, id int) (*apd.Decimal, error) {
+	t, err := a.Transaction(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if op == Reverse && t.Type == Authorize && t.ID == au.ID {
+		return au.remaining(a.decimalContext())
+	}
+
+	if op != Refund || t.Type != Capture || t.AuthorizationID == nil || *t.AuthorizationID != au.ID {
+		return nil, errors.Wrapf(ErrInvalidOriginalTransaction, "%s of transaction %d (authorization: %d)", op, id, au.ID)
+	}
+
+	dctx := a.decimalContext()
+	remaining := apd.New(0, 0).Set(t.Amount)
+
+	for _, v := range a.Transactions {
+		if v.Type != Refund || v.OriginalTransactionID == nil || *v.OriginalTransactionID != id {
+			continue
+		}
+
+		_, err = dctx.Sub(remaining, remaining, v.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return remaining, nil
+}
+
+// originalTransaction returns the linked original transaction ID, or nil if
+// the operation isn't linked.
+func (o *transactionOptions) originalTransaction() *int {
+	if o.originalTransactionID == 0 {
+		return nil
+	}
+
+	id := o.originalTransactionID
+
+	return &id
+}
+
+// checkLink verifies the given amount can be reversed or refunded against the
+// linked original transaction, if any.
+func (a *Account) checkLink(op Operation, au *Authorization, o *transactionOptions, amount *apd.Decimal) error {
+	if o.originalTransactionID == 0 {
+		return nil
+	}
+
+	remaining, err := a.linkable(op, au, o.originalTransactionID)
+
+	if err != nil {
+		return err
+	}
+
+	if remaining.Cmp(amount) < 0 {
+		return amountError(ErrUnderflow, amount, remaining)
+	}
+
+	return nil
+}
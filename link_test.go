@@ -0,0 +1,47 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginalTransaction(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+
+	first, second := account.Transactions[2].ID, account.Transactions[3].ID
+
+	t.Run("Reverse", func(t *testing.T) {
+		require.Equal(t, ErrInvalidOriginalTransaction, errors.Cause(account.Reverse(ctx, au.ID, apd.New(5, 0), DefaultCurrency, WithOriginalTransaction(first))))
+		require.NoError(t, account.Reverse(ctx, au.ID, apd.New(5, 0), DefaultCurrency, WithOriginalTransaction(au.ID)))
+		require.Equal(t, au.ID, *account.Transactions[len(account.Transactions)-1].OriginalTransactionID)
+	})
+
+	t.Run("Refund", func(t *testing.T) {
+		require.Equal(t, ErrInvalidOriginalTransaction, errors.Cause(account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency, WithOriginalTransaction(au.ID))))
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Refund(ctx, au.ID, apd.New(11, 0), DefaultCurrency, WithOriginalTransaction(second))))
+		require.NoError(t, account.Refund(ctx, au.ID, apd.New(15, 0), DefaultCurrency, WithOriginalTransaction(first)))
+		require.Equal(t, ErrUnderflow, errors.Cause(account.Refund(ctx, au.ID, apd.New(6, 0), DefaultCurrency, WithOriginalTransaction(first))))
+		require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency, WithOriginalTransaction(first)))
+	})
+
+	t.Run("Statement", func(t *testing.T) {
+		statement, err := account.Statement()
+
+		require.NoError(t, err)
+		require.True(t, strings.Contains(statement, "| REFUND of txn 3\n"))
+		require.True(t, strings.Contains(statement, "| REVERSE of txn 2\n"))
+	})
+}
@@ -0,0 +1,154 @@
+package card
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidLocale is returned for unsupported statement locales.
+var ErrInvalidLocale = newError("INVALID_LOCALE", "unsupported locale")
+
+// locale represents the amount formatting conventions of a locale.
+type locale struct {
+	decimal     string
+	group       string
+	symbolAfter bool
+}
+
+// locales are the supported statement locales, keyed by BCP 47 tag.
+var locales = map[string]locale{
+	"en-GB": {decimal: ".", group: ","},
+	"en-US": {decimal: ".", group: ","},
+	"de-DE": {decimal: ",", group: ".", symbolAfter: true},
+	"es-ES": {decimal: ",", group: ".", symbolAfter: true},
+	"fr-FR": {decimal: ",", group: " ", symbolAfter: true},
+	"it-IT": {decimal: ",", group: ".", symbolAfter: true},
+}
+
+// currencySymbols are the display symbols of common currencies; other
+// currencies are rendered with their ISO 4217 code.
+var currencySymbols = map[string]string{
+	"CHF": "CHF",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"USD": "$",
+}
+
+// operationNames are the statement operation names of non-English
+// languages, keyed by ISO 639-1 language code.
+var operationNames = map[string]map[Operation]string{
+	"de": {Load: "AUFLADUNG", Authorize: "AUTORISIERUNG", Capture: "BUCHUNG", Reverse: "STORNO", Refund: "ERSTATTUNG", Adjustment: "KORREKTUR", Chargeback: "RÜCKBUCHUNG"},
+	"es": {Load: "RECARGA", Authorize: "AUTORIZACIÓN", Capture: "CARGO", Reverse: "ANULACIÓN", Refund: "REEMBOLSO", Adjustment: "AJUSTE", Chargeback: "CONTRACARGO"},
+	"fr": {Load: "RECHARGE", Authorize: "AUTORISATION", Capture: "DÉBIT", Reverse: "ANNULATION", Refund: "REMBOURSEMENT", Adjustment: "AJUSTEMENT", Chargeback: "RÉTROFACTURATION"},
+	"it": {Load: "RICARICA", Authorize: "AUTORIZZAZIONE", Capture: "ADDEBITO", Reverse: "STORNO", Refund: "RIMBORSO", Adjustment: "RETTIFICA", Chargeback: "CHARGEBACK"},
+}
+
+// MatchLocale returns the supported statement locale for the given BCP 47
+// tag, matching by language if the region isn't supported, e.g. "de-DE" for
+// "de" or "de-AT". It returns an empty string if no locale matches.
+func MatchLocale(tag string) string {
+	tag = strings.TrimSpace(tag)
+
+	for k := range locales {
+		if strings.EqualFold(k, tag) {
+			return k
+		}
+	}
+
+	language := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+
+	if language == "en" {
+		return "en-GB"
+	}
+
+	for k := range locales {
+		if strings.HasPrefix(k, language+"-") {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// WithLocale renders statement amounts with the currency symbol, decimal and
+// thousands separators of the given locale, e.g. "£9,999.99" for "en-GB" or
+// "9.999,99 €" for "de-DE", and operation names in its language.
+func WithLocale(tag string) StatementOption {
+	return func(o *statementOptions) {
+		o.locale = tag
+	}
+}
+
+// formatAmount returns the statement display value of the given amount.
+func (o *statementOptions) formatAmount(d *apd.Decimal, currency string) (string, error) {
+	rounded, err := quantize(d, -2)
+
+	if err != nil {
+		return "", err
+	}
+
+	if o.locale == "" {
+		return rounded.Text('f'), nil
+	}
+
+	l, exists := locales[o.locale]
+
+	if !exists {
+		return "", errors.Wrapf(ErrInvalidLocale, "%q", o.locale)
+	}
+
+	var (
+		negative = rounded.Sign() < 0
+		digits   = strings.TrimPrefix(rounded.Text('f'), "-")
+		point    = strings.IndexByte(digits, '.')
+		integer  = digits[:point]
+		sb       strings.Builder
+	)
+
+	if negative {
+		sb.WriteByte('-')
+	}
+
+	symbol, exists := currencySymbols[currency]
+
+	if !exists {
+		symbol = currency
+	}
+
+	if !l.symbolAfter {
+		sb.WriteString(symbol)
+	}
+
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			sb.WriteString(l.group)
+		}
+
+		sb.WriteRune(c)
+	}
+
+	sb.WriteString(l.decimal)
+	sb.WriteString(digits[point+1:])
+
+	if l.symbolAfter {
+		sb.WriteByte(' ')
+		sb.WriteString(symbol)
+	}
+
+	return sb.String(), nil
+}
+
+// operationName returns the statement display name of the given operation.
+func (o *statementOptions) operationName(op Operation) string {
+	language := strings.SplitN(o.locale, "-", 2)[0]
+	name, exists := operationNames[language][op]
+
+	if !exists {
+		return op.String()
+	}
+
+	return name
+}
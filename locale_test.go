@@ -0,0 +1,90 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementLocale(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("9999.99"), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, decimalFromString("1234567.005"), DefaultCurrency))
+
+	statement, err := account.Statement(WithLocale("en-GB"))
+
+	require.NoError(t, err)
+	require.Contains(t, statement, "Available:                                              £1,244,567.00\n")
+	require.Contains(t, statement, "|     £9,999.99\n")
+	require.Contains(t, statement, "| £1,234,567.01\n")
+
+	t.Run("Symbol after", func(t *testing.T) {
+		account := NewAccount(0, WithCurrency("EUR"))
+
+		require.NoError(t, account.Load(ctx, decimalFromString("9999.99"), "EUR"))
+
+		statement, err := account.Statement(WithLocale("de-DE"))
+
+		require.NoError(t, err)
+		require.Contains(t, statement, "| 9.999,99 €\n")
+	})
+
+	t.Run("Unknown currency symbol", func(t *testing.T) {
+		account := NewAccount(0, WithCurrency("SEK"))
+
+		require.NoError(t, account.Load(ctx, apd.New(5, 0), "SEK"))
+
+		statement, err := account.Statement(WithLocale("en-US"))
+
+		require.NoError(t, err)
+		require.Contains(t, statement, "|   SEK5.00\n")
+	})
+
+	t.Run("Unsupported locale", func(t *testing.T) {
+		_, err := account.Statement(WithLocale("xx-XX"))
+
+		require.Equal(t, ErrInvalidLocale, errors.Cause(err))
+	})
+}
+
+func TestMatchLocale(t *testing.T) {
+	for tag, expected := range map[string]string{
+		"en-US": "en-US",
+		"fr-fr": "fr-FR",
+		"de":    "de-DE",
+		"de-AT": "de-DE",
+		"en":    "en-GB",
+		" it ":  "it-IT",
+		"nl-NL": "",
+		"":      "",
+	} {
+		require.Equal(t, expected, MatchLocale(tag), tag)
+	}
+}
+
+func TestStatementOperationNames(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+
+	statement, err := account.Statement(WithLocale("es-ES"))
+
+	require.NoError(t, err)
+	require.Contains(t, statement, "| RECARGA      |")
+	require.Contains(t, statement, "| AUTORIZACIÓN |")
+	require.Contains(t, statement, "| ANULACIÓN    |")
+
+	statement, err = account.Statement(WithLocale("en-US"))
+
+	require.NoError(t, err)
+	require.Contains(t, statement, "| AUTHORIZE |")
+}
@@ -0,0 +1,235 @@
+package card
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Mandate errors.
+var (
+	ErrMandateNotFound      = newError("MANDATE_NOT_FOUND", "mandate not found")
+	ErrMandateRevoked       = newError("MANDATE_REVOKED", "mandate revoked")
+	ErrMandateLimitExceeded = newError("MANDATE_LIMIT_EXCEEDED", "mandate limit exceeded")
+)
+
+// Mandate represents a cardholder's standing approval for a merchant to pull
+// payments of up to the limit each from the account, without a fresh
+// cardholder action.
+type Mandate struct {
+	ID         int          `json:"id"`
+	MerchantID int          `json:"merchantID"`
+	Limit      *apd.Decimal `json:"limit"`
+	Currency   string       `json:"currency"`
+	Created    time.Time    `json:"created"`
+
+	// Pulled is the total amount pulled under the mandate.
+	Pulled *apd.Decimal `json:"pulled"`
+
+	// Revoked is the time the mandate was revoked, nil while active.
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// withMandate links an operation to the mandate it's made under.
+func withMandate(id int) TransactionOption {
+	return func(o *transactionOptions) {
+		o.mandateID = id
+	}
+}
+
+// mandate returns the linked mandate ID, or nil if the operation isn't made
+// under a mandate.
+func (o *transactionOptions) mandate() *int {
+	if o.mandateID == 0 {
+		return nil
+	}
+
+	id := o.mandateID
+
+	return &id
+}
+
+// AddMandate approves the given merchant to pull payments of up to the given
+// limit each. The currency defaults to the account currency when empty.
+func (a *Account) AddMandate(merchantID int, limit *apd.Decimal, currency string) (*Mandate, error) {
+	if a.Status == Closed {
+		return nil, ErrAccountClosed
+	}
+
+	if limit == nil {
+		return nil, ErrInvalidAmount
+	}
+
+	if limit.Form != apd.Finite || limit.Sign() <= 0 {
+		return nil, amountError(ErrInvalidAmount, limit, nil)
+	}
+
+	if currency == "" {
+		currency = a.Currency
+	}
+
+	if !validCurrency(currency) {
+		return nil, errors.Wrapf(ErrInvalidCurrency, "%q", currency)
+	}
+
+	// Pulls in currencies the account doesn't hold are converted
+	_, exists := a.pocket(currency)
+
+	if !exists && a.Rates == nil {
+		return nil, errors.Wrapf(ErrCurrencyMismatch, "%s (account: %s)", currency, a.Currency)
+	}
+
+	m := &Mandate{
+		ID:         a.LastMandateID + 1,
+		MerchantID: merchantID,
+		Limit:      apd.New(0, 0).Set(limit),
+		Currency:   currency,
+		Created:    a.now(),
+		Pulled:     apd.New(0, 0),
+	}
+
+	if a.Mandates == nil {
+		a.Mandates = map[int]*Mandate{}
+	}
+
+	a.Mandates[m.ID] = m
+	a.LastMandateID = m.ID
+	a.bump()
+
+	return m, nil
+}
+
+// Mandate returns the mandate with the given ID.
+func (a *Account) Mandate(id int) (*Mandate, error) {
+	m, exists := a.Mandates[id]
+
+	if !exists {
+		return nil, errors.Wrapf(ErrMandateNotFound, "%d", id)
+	}
+
+	return m, nil
+}
+
+// ListMandates returns the account mandates, including revoked mandates, in
+// ID order.
+func (a *Account) ListMandates() []*Mandate {
+	res := make([]*Mandate, 0, len(a.Mandates))
+
+	for _, v := range a.Mandates {
+		res = append(res, v)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// RevokeMandate revokes the mandate with the given ID, refusing further pulls.
+// Revoked mandates are kept with the payments pulled under them.
+func (a *Account) RevokeMandate(id int) (*Mandate, error) {
+	m, err := a.Mandate(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Revoked != nil {
+		return nil, errors.Wrapf(ErrMandateRevoked, "%d", id)
+	}
+
+	now := a.now()
+	m.Revoked = &now
+	a.bump()
+
+	return m, nil
+}
+
+// Pull authorizes and captures the given amount in the mandate currency for
+// the merchant of the given mandate, returning the captured authorization.
+// Both transactions are linked to the mandate. Replays with the same
+// idempotency key return the original authorization. If the capture fails,
+// the authorization is reversed and the pull may be retried with the same
+// idempotency key.
+func (a *Account) Pull(ctx context.Context, mandateID int, amount *apd.Decimal, opts ...TransactionOption) (*Authorization, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := newTransactionOptions(opts)
+	id, replayed, err := a.replay(o.idempotencyKey, Authorize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		return a.Authorization(id)
+	}
+
+	m, err := a.Mandate(mandateID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Revoked != nil {
+		return nil, errors.Wrapf(ErrMandateRevoked, "%d", mandateID)
+	}
+
+	err = a.checkRequest(Authorize, amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if amount.Cmp(m.Limit) > 0 {
+		return nil, amountError(ErrMandateLimitExceeded, amount, m.Limit)
+	}
+
+	opts = append(opts, withMandate(mandateID))
+	au, err := a.Authorize(ctx, m.MerchantID, amount, m.Currency, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The idempotency key is recorded against the authorization
+	err = a.Capture(ctx, au.ID, amount, m.Currency, append(opts, WithIdempotencyKey(""))...)
+
+	if err != nil {
+		return nil, a.releasePull(au, mandateID, o.idempotencyKey, err)
+	}
+
+	_, err = a.decimalContext().Add(m.Pulled, m.Pulled, amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return au, nil
+}
+
+// releasePull reverses the authorization of a pull whose capture failed,
+// so no funds remain held, and forgets the pull's idempotency key. The
+// reversal isn't cancelled with the pull's context, e.g. when the capture
+// failed because the request was cancelled.
+func (a *Account) releasePull(au *Authorization, mandateID int, idempotencyKey string, cause error) error {
+	err := a.Reverse(context.Background(), au.ID, au.Amount, au.Currency, withMandate(mandateID))
+
+	if err != nil {
+		return errors.Wrapf(cause, "reversing authorization %d: %v", au.ID, err)
+	}
+
+	if idempotencyKey != "" {
+		delete(a.IdempotencyKeys, idempotencyKey)
+	}
+
+	return cause
+}
@@ -0,0 +1,135 @@
+package card_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMandate(t *testing.T) {
+	account := NewAccount(0)
+
+	_, err := account.AddMandate(merchantID, apd.New(0, 0), "")
+
+	require.Equal(t, ErrInvalidAmount, errors.Cause(err))
+
+	_, err = account.AddMandate(merchantID, apd.New(10, 0), "USD")
+
+	require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+
+	m, err := account.AddMandate(merchantID, apd.New(30, 0), "")
+
+	require.NoError(t, err)
+	require.Equal(t, 1, m.ID)
+	require.Equal(t, DefaultCurrency, m.Currency)
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	_, err = account.Pull(ctx, m.ID, apd.New(31, 0))
+
+	require.Equal(t, ErrMandateLimitExceeded, errors.Cause(err))
+
+	_, err = account.Pull(ctx, 2, apd.New(1, 0))
+
+	require.Equal(t, ErrMandateNotFound, errors.Cause(err))
+
+	au, err := account.Pull(ctx, m.ID, apd.New(25, 0), WithIdempotencyKey("pull-1"))
+
+	require.NoError(t, err)
+	require.Equal(t, AuthorizationCaptured, au.Status)
+	require.Zero(t, account.Available.Cmp(apd.New(75, 0)))
+	require.True(t, account.Blocked.IsZero())
+	require.Zero(t, m.Pulled.Cmp(apd.New(25, 0)))
+
+	// Both transactions are linked to the mandate
+	for _, v := range account.Transactions[1:] {
+		require.NotNil(t, v.MandateID)
+		require.Equal(t, m.ID, *v.MandateID)
+	}
+
+	replayed, err := account.Pull(ctx, m.ID, apd.New(25, 0), WithIdempotencyKey("pull-1"))
+
+	require.NoError(t, err)
+	require.Equal(t, au.ID, replayed.ID)
+	require.Len(t, account.Transactions, 3)
+
+	// Pulls are refunded like any other capture
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+	require.NoError(t, account.Validate())
+
+	b, err := json.Marshal(m)
+
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"limit":"30","pulled":"25"`)
+
+	clone := account.Clone()
+	clone.Mandates[1].Pulled.SetInt64(0)
+
+	require.Zero(t, m.Pulled.Cmp(apd.New(25, 0)))
+
+	_, err = account.RevokeMandate(m.ID)
+
+	require.NoError(t, err)
+	require.NotNil(t, m.Revoked)
+
+	_, err = account.RevokeMandate(m.ID)
+
+	require.Equal(t, ErrMandateRevoked, errors.Cause(err))
+
+	_, err = account.Pull(ctx, m.ID, apd.New(1, 0))
+
+	require.Equal(t, ErrMandateRevoked, errors.Cause(err))
+	require.Len(t, account.ListMandates(), 1)
+}
+
+func TestPullCaptureFailure(t *testing.T) {
+	account := NewAccount(0)
+	m, err := account.AddMandate(merchantID, apd.New(30, 0), "")
+
+	require.NoError(t, err)
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	// Cancelling the request once the authorization is recorded fails the
+	// capture
+	cancelled, cancel := context.WithCancel(ctx)
+
+	defer cancel()
+
+	account.OnTransaction(func(t Transaction) {
+		if t.Type == Authorize {
+			cancel()
+		}
+	})
+
+	_, err = account.Pull(cancelled, m.ID, apd.New(25, 0), WithIdempotencyKey("pull-1"))
+
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Len(t, account.Transactions, 3)
+
+	reversal := account.Transactions[2]
+
+	require.Equal(t, Reverse, reversal.Type)
+	require.Equal(t, m.ID, *reversal.MandateID)
+
+	au, err := account.Authorization(*reversal.AuthorizationID)
+
+	require.NoError(t, err)
+	require.Equal(t, AuthorizationReversed, au.Status)
+	require.Zero(t, account.Available.Cmp(apd.New(100, 0)))
+	require.True(t, account.Blocked.IsZero())
+	require.True(t, account.Merchants[merchantID].Available.IsZero())
+	require.True(t, m.Pulled.IsZero())
+	require.NoError(t, account.Validate())
+
+	// The pull is retried with the same idempotency key
+	retried, err := account.Pull(ctx, m.ID, apd.New(25, 0), WithIdempotencyKey("pull-1"))
+
+	require.NoError(t, err)
+	require.NotEqual(t, au.ID, retried.ID)
+	require.Equal(t, AuthorizationCaptured, retried.Status)
+	require.Zero(t, m.Pulled.Cmp(apd.New(25, 0)))
+}
@@ -0,0 +1,186 @@
+package card
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrMerchantLimitExceeded is returned when an authorization would exceed the
+// merchant spending cap.
+var ErrMerchantLimitExceeded = newError("MERCHANT_LIMIT_EXCEEDED", "merchant spending limit exceeded")
+
+// newMerchant returns a new merchant record.
+func newMerchant() *Merchant {
+	return &Merchant{
+		Available: apd.New(0, 0),
+		Captured:  apd.New(0, 0),
+	}
+}
+
+// Spent returns the cumulative amount held and captured by the merchant,
+// including captured amounts already settled, computed with the context set
+// by SetDecimalContext.
+func (m *Merchant) Spent() (*apd.Decimal, error) {
+	return m.spent(getContext())
+}
+
+// spent returns the cumulative amount held and captured by the merchant,
+// computed with the given context.
+func (m *Merchant) spent(dctx *apd.Context) (*apd.Decimal, error) {
+	spent := apd.New(0, 0)
+	_, err := dctx.Add(spent, m.Available, m.Captured)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Settled != nil {
+		_, err = dctx.Add(spent, spent, m.Settled)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spent, nil
+}
+
+// Headroom returns the amount the merchant may still authorize before
+// reaching its spending cap, or nil if the merchant is uncapped, computed
+// with the context set by SetDecimalContext.
+func (m *Merchant) Headroom() (*apd.Decimal, error) {
+	return m.headroom(getContext())
+}
+
+// headroom returns the amount the merchant may still authorize, computed with
+// the given context.
+func (m *Merchant) headroom(dctx *apd.Context) (*apd.Decimal, error) {
+	if m.Limit == nil {
+		return nil, nil
+	}
+
+	spent, err := m.spent(dctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	headroom := apd.New(0, 0)
+	_, err = dctx.Sub(headroom, m.Limit, spent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if headroom.Sign() < 0 {
+		headroom.SetInt64(0)
+	}
+
+	return headroom, nil
+}
+
+// checkLimit verifies authorizing the given amount doesn't breach the
+// merchant spending cap.
+func (m *Merchant) checkLimit(dctx *apd.Context, merchantID int, amount *apd.Decimal) error {
+	headroom, err := m.headroom(dctx)
+
+	if err != nil || headroom == nil {
+		return err
+	}
+
+	if headroom.Cmp(amount) < 0 {
+		return amountError(errors.Wrapf(ErrMerchantLimitExceeded, "merchant %d limit: %s", merchantID, m.Limit), amount, headroom)
+	}
+
+	return nil
+}
+
+// merchant returns the merchant record for the given ID, creating it if
+// necessary.
+func (p *Pocket) merchant(merchantID int) *Merchant {
+	m, exists := p.Merchants[merchantID]
+
+	if !exists {
+		if p.Merchants == nil {
+			p.Merchants = map[int]*Merchant{}
+		}
+
+		m = newMerchant()
+		p.Merchants[merchantID] = m
+	}
+
+	return m
+}
+
+// SetMerchantLimit caps the cumulative amount held and captured by the given
+// merchant in the account currency. A nil limit removes the cap.
+func (a *Account) SetMerchantLimit(merchantID int, limit *apd.Decimal) error {
+	if limit != nil && (limit.Form != apd.Finite || limit.Sign() <= 0) {
+		return amountError(ErrInvalidAmount, limit, nil)
+	}
+
+	p, _ := a.pocket(a.Currency)
+	p.merchant(merchantID).Limit = limit
+	a.bump()
+
+	return nil
+}
+
+// MerchantHolding represents the amounts held and captured by a merchant in
+// a single currency.
+type MerchantHolding struct {
+	MerchantID int          `json:"merchantID"`
+	Currency   string       `json:"currency"`
+	Available  *apd.Decimal `json:"available"`
+	Captured   *apd.Decimal `json:"captured"`
+	Limit      *apd.Decimal `json:"limit,omitempty"`
+	Settled    *apd.Decimal `json:"settled,omitempty"`
+}
+
+// MerchantHoldings returns the holdings of every merchant the account has
+// transacted with, ordered by merchant ID and then by currency.
+func (a *Account) MerchantHoldings() []MerchantHolding {
+	var holdings []MerchantHolding
+
+	for _, currency := range a.Currencies() {
+		p, _ := a.pocket(currency)
+
+		for id, m := range p.Merchants {
+			holdings = append(holdings, MerchantHolding{
+				MerchantID: id,
+				Currency:   currency,
+				Available:  copyDecimal(m.Available),
+				Captured:   copyDecimal(m.Captured),
+				Limit:      copyDecimal(m.Limit),
+				Settled:    copyDecimal(m.Settled),
+			})
+		}
+	}
+
+	// Currencies are already ordered
+	sort.SliceStable(holdings, func(i, j int) bool {
+		return holdings[i].MerchantID < holdings[j].MerchantID
+	})
+
+	return holdings
+}
+
+// MerchantHolding returns the holdings of the given merchant in each
+// currency.
+func (a *Account) MerchantHolding(merchantID int) ([]MerchantHolding, error) {
+	var holdings []MerchantHolding
+
+	for _, v := range a.MerchantHoldings() {
+		if v.MerchantID == merchantID {
+			holdings = append(holdings, v)
+		}
+	}
+
+	if len(holdings) == 0 {
+		return nil, errors.Wrapf(ErrMerchantNotFound, "ID: %d", merchantID)
+	}
+
+	return holdings, nil
+}
@@ -0,0 +1,107 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantLimit(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(1000, 0), DefaultCurrency))
+	require.Equal(t, ErrInvalidAmount, errors.Cause(account.SetMerchantLimit(merchantID, apd.New(0, 0))))
+	require.NoError(t, account.SetMerchantLimit(merchantID, apd.New(100, 0)))
+
+	headroom, err := account.Merchants[merchantID].Headroom()
+
+	require.NoError(t, err)
+	require.Zero(t, headroom.Cmp(apd.New(100, 0)))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(60, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(60, 0), DefaultCurrency))
+
+	t.Run("Cap exceeded", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(41, 0), DefaultCurrency)
+
+		require.Equal(t, ErrMerchantLimitExceeded, errors.Cause(err))
+
+		headroom, err := account.Merchants[merchantID].Headroom()
+
+		require.NoError(t, err)
+		require.Zero(t, headroom.Cmp(apd.New(40, 0)))
+	})
+
+	t.Run("Other merchants are uncapped", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID+1, apd.New(500, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+
+		headroom, err := account.Merchants[merchantID+1].Headroom()
+
+		require.NoError(t, err)
+		require.Nil(t, headroom)
+	})
+
+	t.Run("Refunds restore headroom", func(t *testing.T) {
+		require.NoError(t, account.Refund(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Remove cap", func(t *testing.T) {
+		require.NoError(t, account.SetMerchantLimit(merchantID, nil))
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+}
+
+func TestMerchantHoldings(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), "EUR"))
+	require.NoError(t, account.SetMerchantLimit(2, apd.New(50, 0)))
+
+	au, err := account.Authorize(ctx, 2, apd.New(20, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+
+	_, err = account.Authorize(ctx, 1, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	_, err = account.Authorize(ctx, 2, apd.New(30, 0), "EUR")
+
+	require.NoError(t, err)
+
+	b, err := json.Marshal(account.MerchantHoldings())
+
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"merchantID": 1, "currency": "GBP", "available": "10", "captured": "0"},
+		{"merchantID": 2, "currency": "GBP", "available": "15", "captured": "5", "limit": "50"},
+		{"merchantID": 2, "currency": "EUR", "available": "30", "captured": "0"}
+	]`, string(b))
+
+	holdings, err := account.MerchantHolding(2)
+
+	require.NoError(t, err)
+	require.Len(t, holdings, 2)
+
+	_, err = account.MerchantHolding(3)
+
+	require.Equal(t, ErrMerchantNotFound, errors.Cause(err))
+}
@@ -0,0 +1,79 @@
+package card
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Transaction origins.
+const (
+	OriginUnknown Origin = iota
+	OriginAPI
+	OriginImport
+	OriginSystem
+)
+
+// ErrInvalidOrigin is returned for unknown transaction origin names.
+var ErrInvalidOrigin = newError("INVALID_ORIGIN", "invalid transaction origin")
+
+// Origin represents the source of a transaction.
+type Origin uint8
+
+func (o Origin) String() string {
+	switch o {
+	case OriginAPI:
+		return "API"
+	case OriginImport:
+		return "IMPORT"
+	case OriginSystem:
+		return "SYSTEM"
+	}
+
+	return "UNKNOWN"
+}
+
+// ParseOrigin returns the origin for the given name.
+func ParseOrigin(s string) (Origin, error) {
+	switch strings.ToUpper(s) {
+	case "API":
+		return OriginAPI, nil
+	case "IMPORT":
+		return OriginImport, nil
+	case "SYSTEM":
+		return OriginSystem, nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidOrigin, "%q", s)
+}
+
+// WithDescription sets the free-form transaction description.
+func WithDescription(description string) TransactionOption {
+	return func(o *transactionOptions) {
+		o.description = description
+	}
+}
+
+// WithReference sets the transaction reference used by upstream payment
+// systems.
+func WithReference(reference string) TransactionOption {
+	return func(o *transactionOptions) {
+		o.reference = reference
+	}
+}
+
+// WithOrigin sets the transaction origin.
+func WithOrigin(origin Origin) TransactionOption {
+	return func(o *transactionOptions) {
+		o.origin = origin
+	}
+}
+
+// annotate applies the operation metadata to the given transaction.
+func (o *transactionOptions) annotate(t *Transaction) {
+	t.Description = o.description
+	t.Reference = o.reference
+	t.Origin = o.origin
+	t.MandateID = o.mandate()
+	t.DisputeID = o.dispute()
+}
@@ -0,0 +1,92 @@
+package card
+
+import (
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Option configures a new account.
+type Option func(*accountOptions)
+
+type accountOptions struct {
+	currency       string
+	limits         []Limit
+	overdraft      *apd.Decimal
+	initialBalance *apd.Decimal
+	registry       *MerchantRegistry
+	rates          RateProvider
+	clock          func() time.Time
+	decimalContext *apd.Context
+}
+
+// WithCurrency sets the account currency, defaulting to DefaultCurrency. The
+// currency must be a three letter ISO 4217 code: accounts created with any
+// other value fail Validate with ErrInvalidCurrency.
+func WithCurrency(currency string) Option {
+	return func(o *accountOptions) {
+		o.currency = currency
+	}
+}
+
+// WithLimit adds a rolling spending limit.
+func WithLimit(period Period, amount *apd.Decimal) Option {
+	return func(o *accountOptions) {
+		o.limits = append(o.limits, Limit{Period: period, Amount: amount})
+	}
+}
+
+// WithOverdraft sets the account overdraft limit.
+func WithOverdraft(limit *apd.Decimal) Option {
+	return func(o *accountOptions) {
+		o.overdraft = limit
+	}
+}
+
+// WithInitialBalance loads the given amount in the account currency once the
+// account is created. Non-positive amounts are ignored.
+func WithInitialBalance(amount *apd.Decimal) Option {
+	return func(o *accountOptions) {
+		o.initialBalance = amount
+	}
+}
+
+// WithRegistry sets the merchant registry used by category rules.
+func WithRegistry(r *MerchantRegistry) Option {
+	return func(o *accountOptions) {
+		o.registry = r
+	}
+}
+
+// WithRateProvider sets the provider used to convert amounts in currencies
+// the account doesn't hold.
+func WithRateProvider(r RateProvider) Option {
+	return func(o *accountOptions) {
+		o.rates = r
+	}
+}
+
+// WithClock sets the account clock used for transaction timestamps.
+func WithClock(clock func() time.Time) Option {
+	return func(o *accountOptions) {
+		o.clock = clock
+	}
+}
+
+// WithDecimalContext sets the precision, rounding and traps of the account's
+// decimal arithmetic, overriding the context set by SetDecimalContext.
+func WithDecimalContext(c *apd.Context) Option {
+	return func(o *accountOptions) {
+		o.decimalContext = c
+	}
+}
+
+func newAccountOptions(opts []Option) *accountOptions {
+	o := &accountOptions{currency: DefaultCurrency}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
@@ -0,0 +1,71 @@
+package card_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccountOptions(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	registry := NewMerchantRegistry()
+	account := NewAccount(1,
+		WithCurrency("EUR"),
+		WithInitialBalance(apd.New(100, 0)),
+		WithLimit(Daily, apd.New(50, 0)),
+		WithOverdraft(apd.New(20, 0)),
+		WithRegistry(registry),
+		WithClock(func() time.Time {
+			return now
+		}),
+	)
+
+	require.Equal(t, 1, account.ID)
+	require.Equal(t, "EUR", account.Currency)
+	require.Zero(t, account.Available.Cmp(apd.New(100, 0)))
+	require.Len(t, account.Transactions, 1)
+	require.Equal(t, Load, account.Transactions[0].Type)
+	require.Equal(t, "EUR", account.Transactions[0].Currency)
+	require.Equal(t, now, account.Transactions[0].Timestamp)
+	require.Equal(t, []Limit{{Period: Daily, Amount: apd.New(50, 0)}}, account.Limits)
+	require.Zero(t, account.Overdraft.Cmp(apd.New(20, 0)))
+	require.Equal(t, registry, account.Registry)
+
+	t.Run("Defaults", func(t *testing.T) {
+		account := NewAccount(2, WithInitialBalance(apd.New(-1, 0)))
+
+		require.Equal(t, DefaultCurrency, account.Currency)
+		require.True(t, account.Available.IsZero())
+		require.Empty(t, account.Transactions)
+		require.Nil(t, account.Overdraft)
+	})
+
+	t.Run("DecimalContext", func(t *testing.T) {
+		c := apd.BaseContext.WithPrecision(3)
+		c.Rounding = apd.RoundDown
+		account := NewAccount(3, WithDecimalContext(c), WithInitialBalance(apd.New(100, 0)))
+
+		require.NoError(t, account.Load(ctx, apd.New(5, -1), DefaultCurrency))
+		require.Equal(t, "100", account.Available.Text('f'), "rounded to the account precision")
+		require.NoError(t, account.Validate())
+
+		// Other accounts use the package context
+		other := NewAccount(4, WithInitialBalance(apd.New(100, 0)))
+
+		require.NoError(t, other.Load(ctx, apd.New(5, -1), DefaultCurrency))
+		require.Equal(t, "100.5", other.Available.Text('f'))
+		require.Equal(t, c, account.Clone().DecimalContext)
+	})
+
+	t.Run("InvalidCurrency", func(t *testing.T) {
+		for _, v := range []string{"eur", "EURO", "E1R"} {
+			account := NewAccount(5, WithCurrency(v))
+
+			require.Equal(t, ErrInvalidCurrency, errors.Cause(account.Validate()), v)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package card
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statement transaction orders.
+const (
+	OrderID SortOrder = iota
+	OrderNewest
+	OrderAmount
+	OrderMerchant
+)
+
+// ErrInvalidSortOrder is returned for unknown sort order names.
+var ErrInvalidSortOrder = newError("INVALID_SORT_ORDER", "invalid sort order")
+
+// SortOrder represents the order of statement transactions.
+type SortOrder uint8
+
+func (s SortOrder) String() string {
+	switch s {
+	case OrderNewest:
+		return "NEWEST"
+	case OrderAmount:
+		return "AMOUNT"
+	case OrderMerchant:
+		return "MERCHANT"
+	}
+
+	return "ID"
+}
+
+// ParseSortOrder returns the sort order for the given name.
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch strings.ToUpper(s) {
+	case "ID":
+		return OrderID, nil
+	case "NEWEST":
+		return OrderNewest, nil
+	case "AMOUNT":
+		return OrderAmount, nil
+	case "MERCHANT":
+		return OrderMerchant, nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidSortOrder, "%q", s)
+}
+
+// WithSort orders the statement transactions: by ID (insertion order, the
+// default), newest first, largest amount first or by merchant ID. Pages are
+// selected from the transactions in this order.
+func WithSort(order SortOrder) StatementOption {
+	return func(o *statementOptions) {
+		o.order = order
+	}
+}
+
+// less reports whether transaction a precedes transaction b in the statement
+// order. Ties are ordered by ID, latest first when newest first, so the order
+// is total.
+func (o *statementOptions) less(a, b Transaction) bool {
+	switch o.order {
+	case OrderNewest:
+		if a.Timestamp.Equal(b.Timestamp) {
+			return a.ID > b.ID
+		}
+
+		return a.Timestamp.After(b.Timestamp)
+	case OrderAmount:
+		c := a.Amount.Cmp(b.Amount)
+
+		if c != 0 {
+			return c > 0
+		}
+	case OrderMerchant:
+		switch {
+		case a.MerchantID == nil && b.MerchantID != nil:
+			return true
+		case a.MerchantID != nil && b.MerchantID == nil:
+			return false
+		case a.MerchantID != nil && *a.MerchantID != *b.MerchantID:
+			return *a.MerchantID < *b.MerchantID
+		}
+	}
+
+	return a.ID < b.ID
+}
+
+// sort orders the given transactions according to the statement options.
+func (o *statementOptions) sort(transactions []Transaction) {
+	if o.order == OrderID {
+		return
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return o.less(transactions[i], transactions[j])
+	})
+}
@@ -0,0 +1,119 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSortOrder(t *testing.T) {
+	for _, v := range []SortOrder{OrderID, OrderNewest, OrderAmount, OrderMerchant} {
+		order, err := ParseSortOrder(strings.ToLower(v.String()))
+
+		require.NoError(t, err)
+		require.Equal(t, v, order)
+	}
+
+	_, err := ParseSortOrder("oldest")
+
+	require.Equal(t, ErrInvalidSortOrder, errors.Cause(err))
+}
+
+func TestSortOrder(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	account := NewAccount(0, WithClock(func() time.Time {
+		now = now.Add(time.Minute)
+
+		return now
+	}))
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	for _, v := range []struct {
+		merchantID int
+		amount     int64
+	}{{3, 5}, {1, 20}, {2, 10}} {
+		_, err := account.Authorize(ctx, v.merchantID, apd.New(v.amount, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	}
+
+	ids := func(p *TransactionPage) []int {
+		var ids []int
+
+		for _, v := range p.Transactions {
+			ids = append(ids, v.ID)
+		}
+
+		return ids
+	}
+
+	for _, test := range []struct {
+		order    SortOrder
+		expected []int
+	}{
+		{OrderID, []int{1, 2, 3, 4}},
+		{OrderNewest, []int{4, 3, 2, 1}},
+		{OrderAmount, []int{1, 3, 4, 2}},
+		{OrderMerchant, []int{1, 3, 4, 2}},
+	} {
+		t.Run(test.order.String(), func(t *testing.T) {
+			require.Equal(t, test.expected, ids(account.TransactionsPage(0, 0, FilterOptions{}, WithSort(test.order))))
+		})
+	}
+
+	t.Run("Paged", func(t *testing.T) {
+		for _, test := range []struct {
+			order    SortOrder
+			expected [][]int
+		}{
+			{OrderID, [][]int{{1, 2, 3}, {4}}},
+			{OrderNewest, [][]int{{4, 3, 2}, {1}}},
+			{OrderAmount, [][]int{{1, 3, 4}, {2}}},
+			{OrderMerchant, [][]int{{1, 3, 4}, {2}}},
+		} {
+			page := account.TransactionsPage(0, 3, FilterOptions{}, WithSort(test.order))
+
+			require.Equal(t, test.expected[0], ids(page), test.order.String())
+			require.Equal(t, test.expected[0][2], page.NextCursor)
+
+			page = account.TransactionsPage(page.NextCursor, 3, FilterOptions{}, WithSort(test.order))
+
+			require.Equal(t, test.expected[1], ids(page), test.order.String())
+			require.Zero(t, page.NextCursor)
+		}
+
+		// Transactions added between pages don't shift later pages
+		account := account.Clone()
+		page := account.TransactionsPage(0, 2, FilterOptions{}, WithSort(OrderNewest))
+
+		require.Equal(t, []int{4, 3}, ids(page))
+		require.NoError(t, account.Load(ctx, apd.New(1, 0), DefaultCurrency))
+
+		page = account.TransactionsPage(page.NextCursor, 2, FilterOptions{}, WithSort(OrderNewest))
+
+		require.Equal(t, []int{2, 1}, ids(page))
+
+		page = account.TransactionsPage(0, 1, FilterOptions{}, WithSort(OrderAmount))
+
+		require.Equal(t, []int{1}, ids(page))
+		require.Empty(t, account.TransactionsPage(99, 1, FilterOptions{}, WithSort(OrderAmount)).Transactions, "unknown cursor")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var sb strings.Builder
+
+		require.NoError(t, account.StatementCSV(&sb, WithSort(OrderNewest)))
+
+		rows := strings.Split(sb.String(), "\n")
+
+		require.True(t, strings.HasPrefix(rows[1], "4,"))
+		require.True(t, strings.HasSuffix(rows[1], ",65"))
+		require.True(t, strings.HasSuffix(rows[4], ",100"))
+	})
+}
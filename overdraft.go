@@ -0,0 +1,68 @@
+package card
+
+import (
+	"github.com/cockroachdb/apd"
+)
+
+// SetOverdraft permits authorizations in the account currency to take the
+// available balance below zero by up to the given limit. A nil limit removes
+// the overdraft.
+func (a *Account) SetOverdraft(limit *apd.Decimal) error {
+	if limit != nil && (limit.Form != apd.Finite || limit.Sign() <= 0) {
+		return amountError(ErrInvalidAmount, limit, nil)
+	}
+
+	a.Overdraft = limit
+	a.bump()
+
+	return nil
+}
+
+// OverdraftUsed returns the amount of the overdraft in use.
+func (a *Account) OverdraftUsed() *apd.Decimal {
+	used := apd.New(0, 0)
+
+	if a.Available.Sign() < 0 {
+		used.Neg(a.Available)
+	}
+
+	return used
+}
+
+// OverdraftHeadroom returns the overdraft amount still available, or nil if
+// the account has no overdraft.
+func (a *Account) OverdraftHeadroom() (*apd.Decimal, error) {
+	if a.Overdraft == nil {
+		return nil, nil
+	}
+
+	headroom := apd.New(0, 0)
+	_, err := a.decimalContext().Sub(headroom, a.Overdraft, a.OverdraftUsed())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if headroom.Sign() < 0 {
+		headroom.SetInt64(0)
+	}
+
+	return headroom, nil
+}
+
+// spendable returns the amount which may be authorized from the given
+// pocket, including any overdraft on the account currency.
+func (a *Account) spendable(p *Pocket, currency string) (*apd.Decimal, error) {
+	if currency != a.Currency || a.Overdraft == nil {
+		return p.Available, nil
+	}
+
+	spendable := apd.New(0, 0)
+	_, err := a.decimalContext().Add(spendable, p.Available, a.Overdraft)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return spendable, nil
+}
@@ -0,0 +1,68 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverdraft(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, ErrInvalidAmount, errors.Cause(account.SetOverdraft(apd.New(-1, 0))))
+	require.NoError(t, account.Load(ctx, apd.New(50, 0), DefaultCurrency))
+
+	_, err := account.Authorize(ctx, merchantID, apd.New(80, 0), DefaultCurrency)
+
+	require.Equal(t, ErrUnderflow, errors.Cause(err))
+	require.NoError(t, account.SetOverdraft(apd.New(100, 0)))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(80, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Zero(t, account.Available.Cmp(apd.New(-30, 0)))
+
+	balance, err := account.Balance(ctx)
+
+	require.NoError(t, err)
+	require.Zero(t, balance.OverdraftUsed.Cmp(apd.New(30, 0)))
+	require.Zero(t, balance.OverdraftHeadroom.Cmp(apd.New(70, 0)))
+
+	t.Run("Limit exceeded", func(t *testing.T) {
+		_, err := account.Authorize(ctx, merchantID, apd.New(71, 0), DefaultCurrency)
+
+		require.Equal(t, ErrUnderflow, errors.Cause(err))
+	})
+
+	t.Run("Statement", func(t *testing.T) {
+		statement, err := account.Statement()
+
+		require.NoError(t, err)
+		require.True(t, strings.Contains(statement, "Overdraft used:"))
+		require.True(t, strings.Contains(statement, "Overdraft headroom:"))
+	})
+
+	t.Run("Repay", func(t *testing.T) {
+		require.NoError(t, account.Reverse(ctx, au.ID, apd.New(80, 0), DefaultCurrency))
+
+		balance, err := account.Balance(ctx)
+
+		require.NoError(t, err)
+		require.True(t, balance.OverdraftUsed.IsZero())
+		require.Zero(t, balance.OverdraftHeadroom.Cmp(apd.New(100, 0)))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, account.SetOverdraft(nil))
+
+		balance, err := account.Balance(ctx)
+
+		require.NoError(t, err)
+		require.Nil(t, balance.OverdraftUsed)
+		require.Nil(t, balance.OverdraftHeadroom)
+	})
+}
@@ -0,0 +1,112 @@
+package card
+
+import (
+	"sort"
+)
+
+// DefaultPageLimit is the number of transactions per page when no positive
+// limit is given.
+const DefaultPageLimit = 100
+
+// TransactionPage represents a page of the transaction log.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+
+	// Total is the number of transactions matching the filter on all pages.
+	Total int `json:"total"`
+
+	// NextCursor is the cursor of the next page, or zero on the last page.
+	NextCursor int `json:"nextCursor,omitempty"`
+}
+
+// WithPage limits the statement to at most limit transactions following the
+// transaction with the given ID, the cursor, in the statement order: by
+// default, the transactions with greater IDs. The cursor of the next page is
+// the ID of the last transaction on the page, so pages remain stable as
+// transactions are added.
+func WithPage(cursor, limit int) StatementOption {
+	return func(o *statementOptions) {
+		if limit <= 0 {
+			limit = DefaultPageLimit
+		}
+
+		o.cursor = cursor
+		o.limit = limit
+	}
+}
+
+// TransactionsPage returns up to limit transactions matching the given
+// filter following the given cursor. Further options, such as WithSort, may
+// be given; pages are selected in the resulting order.
+func (a *Account) TransactionsPage(cursor, limit int, f FilterOptions, opts ...StatementOption) *TransactionPage {
+	o := newStatementOptions(opts)
+
+	WithFilter(f)(o)
+	WithPage(cursor, limit)(o)
+
+	transactions, next := a.page(o)
+	page := &TransactionPage{
+		Transactions: make([]Transaction, len(transactions)),
+		NextCursor:   next,
+	}
+
+	copy(page.Transactions, transactions)
+
+	for _, v := range a.Transactions {
+		if f.Match(v) {
+			page.Total++
+		}
+	}
+
+	return page
+}
+
+// page returns the transactions selected by the statement filter and page,
+// in the statement order, along with the cursor of the next page.
+func (a *Account) page(o *statementOptions) ([]Transaction, int) {
+	var selected []Transaction
+
+	for _, v := range a.Transactions {
+		if o.filter.Match(v) {
+			selected = append(selected, v)
+		}
+	}
+
+	o.sort(selected)
+
+	if o.cursor > 0 {
+		after, ok := a.cursorTransaction(o)
+
+		if !ok {
+			return nil, 0
+		}
+
+		i := sort.Search(len(selected), func(i int) bool {
+			return o.less(after, selected[i])
+		})
+		selected = selected[i:]
+	}
+
+	if o.limit > 0 && len(selected) > o.limit {
+		selected = selected[:o.limit]
+
+		return selected, selected[len(selected)-1].ID
+	}
+
+	return selected, 0
+}
+
+// cursorTransaction returns the transaction identified by the page cursor.
+// In ID order any cursor is valid, as only its ID is compared.
+func (a *Account) cursorTransaction(o *statementOptions) (Transaction, bool) {
+	// Transaction IDs are assigned in ascending order
+	i := sort.Search(len(a.Transactions), func(i int) bool {
+		return a.Transactions[i].ID >= o.cursor
+	})
+
+	if i < len(a.Transactions) && a.Transactions[i].ID == o.cursor {
+		return a.Transactions[i], true
+	}
+
+	return Transaction{ID: o.cursor}, o.order == OrderID
+}
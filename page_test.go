@@ -0,0 +1,78 @@
+package card_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionsPage(t *testing.T) {
+	account := NewAccount(0)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, account.Load(ctx, apd.New(10, 0), DefaultCurrency))
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(1, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	}
+
+	ids := func(p *TransactionPage) []int {
+		var ids []int
+
+		for _, v := range p.Transactions {
+			ids = append(ids, v.ID)
+		}
+
+		return ids
+	}
+
+	page := account.TransactionsPage(0, 4, FilterOptions{})
+
+	require.Equal(t, []int{1, 2, 3, 4}, ids(page))
+	require.Equal(t, 10, page.Total)
+	require.Equal(t, 4, page.NextCursor)
+
+	page = account.TransactionsPage(page.NextCursor, 4, FilterOptions{})
+
+	require.Equal(t, []int{5, 6, 7, 8}, ids(page))
+	require.Equal(t, 8, page.NextCursor)
+
+	page = account.TransactionsPage(page.NextCursor, 4, FilterOptions{})
+
+	require.Equal(t, []int{9, 10}, ids(page))
+	require.Zero(t, page.NextCursor)
+
+	t.Run("Filtered", func(t *testing.T) {
+		op := Authorize
+		page := account.TransactionsPage(2, 3, FilterOptions{Type: &op})
+
+		require.Equal(t, []int{4, 6, 8}, ids(page))
+		require.Equal(t, 5, page.Total)
+		require.Equal(t, 8, page.NextCursor)
+	})
+
+	t.Run("Default limit", func(t *testing.T) {
+		page := account.TransactionsPage(0, 0, FilterOptions{})
+
+		require.Len(t, page.Transactions, 10)
+		require.Zero(t, page.NextCursor)
+	})
+
+	t.Run("Statement", func(t *testing.T) {
+		statement, err := account.Statement(WithPage(8, 1))
+
+		require.NoError(t, err)
+		require.Contains(t, statement, " 9      |")
+		require.NotContains(t, statement, " 10     |")
+
+		var sb strings.Builder
+
+		require.NoError(t, account.StatementCSV(&sb, WithPage(8, 1)))
+		require.Equal(t, 2, strings.Count(sb.String(), "\n"))
+		require.Contains(t, sb.String(), "\n9,")
+	})
+}
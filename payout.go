@@ -0,0 +1,248 @@
+package card
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// payoutCSVHeader is the CSV payout report header row.
+var payoutCSVHeader = []string{"account", "transaction", "authorization", "timestamp", "type", "currency", "gross", "refunds", "fees", "net"}
+
+// Payout represents a merchant's captures and refunds across accounts over a
+// period, with the amounts due to the merchant per currency.
+type Payout struct {
+	MerchantID   int           `json:"merchantID"`
+	From         *time.Time    `json:"from,omitempty"`
+	To           *time.Time    `json:"to,omitempty"`
+	FeeRate      *apd.Decimal  `json:"feeRate,omitempty"`
+	Totals       []PayoutTotal `json:"totals"`
+	Transactions []PayoutLine  `json:"transactions"`
+}
+
+// PayoutTotal represents a merchant's payout in a single currency: the gross
+// amount captured, less refunds and fees.
+type PayoutTotal struct {
+	Currency string       `json:"currency"`
+	Gross    *apd.Decimal `json:"gross"`
+	Refunds  *apd.Decimal `json:"refunds"`
+	Fees     *apd.Decimal `json:"fees"`
+	Net      *apd.Decimal `json:"net"`
+}
+
+// PayoutLine represents a capture or refund included in a payout. Fees are
+// charged on captures.
+type PayoutLine struct {
+	AccountID       int          `json:"accountID"`
+	TransactionID   int          `json:"transactionID"`
+	AuthorizationID *int         `json:"authorizationID,omitempty"`
+	Timestamp       time.Time    `json:"timestamp"`
+	Type            Operation    `json:"type"`
+	Amount          *apd.Decimal `json:"amount"`
+	Currency        string       `json:"currency"`
+	Fee             *apd.Decimal `json:"fee,omitempty"`
+}
+
+// MerchantPayout generates the payout report of the given merchant across the
+// given accounts, covering the captures and refunds with timestamps from the
+// given time, inclusive, to the given time, exclusive. Zero times don't bound
+// the period. Fees are charged on each capture at the merchant's fee rate,
+// rounded to two decimal places. Fees are computed, and added to the totals,
+// with the decimal context of the capture's account; the net totals, spanning
+// accounts, with the context set by SetDecimalContext.
+func MerchantPayout(accounts []*Account, merchant MerchantInfo, from, to time.Time) (*Payout, error) {
+	var (
+		totals = map[string]*PayoutTotal{}
+		f      = FilterOptions{From: from, To: to, MerchantID: &merchant.ID}
+		p      = &Payout{
+			MerchantID:   merchant.ID,
+			FeeRate:      merchant.FeeRate,
+			Totals:       []PayoutTotal{},
+			Transactions: []PayoutLine{},
+		}
+	)
+
+	if !from.IsZero() {
+		p.From = &from
+	}
+
+	if !to.IsZero() {
+		p.To = &to
+	}
+
+	for _, a := range accounts {
+		dctx := a.decimalContext()
+
+		for _, v := range a.Transactions {
+			if (v.Type != Capture && v.Type != Refund) || !f.Match(v) {
+				continue
+			}
+
+			total, exists := totals[v.Currency]
+
+			if !exists {
+				total = &PayoutTotal{
+					Currency: v.Currency,
+					Gross:    apd.New(0, 0),
+					Refunds:  apd.New(0, 0),
+					Fees:     apd.New(0, 0),
+				}
+				totals[v.Currency] = total
+			}
+
+			line := PayoutLine{
+				AccountID:       a.ID,
+				TransactionID:   v.ID,
+				AuthorizationID: copyInt(v.AuthorizationID),
+				Timestamp:       v.Timestamp,
+				Type:            v.Type,
+				Amount:          copyDecimal(v.Amount),
+				Currency:        v.Currency,
+			}
+
+			var err error
+
+			if v.Type == Refund {
+				_, err = dctx.Add(total.Refunds, total.Refunds, v.Amount)
+			} else {
+				line.Fee, err = payoutFee(dctx, v.Amount, merchant.FeeRate)
+
+				if err == nil {
+					_, err = dctx.Add(total.Gross, total.Gross, v.Amount)
+				}
+
+				if err == nil {
+					_, err = dctx.Add(total.Fees, total.Fees, line.Fee)
+				}
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			p.Transactions = append(p.Transactions, line)
+		}
+	}
+
+	dctx := getContext()
+
+	for _, v := range totals {
+		v.Net = apd.New(0, 0)
+		_, err := dctx.Sub(v.Net, v.Gross, v.Refunds)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = dctx.Sub(v.Net, v.Net, v.Fees)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.Totals = append(p.Totals, *v)
+	}
+
+	sort.Slice(p.Totals, func(i, j int) bool {
+		return p.Totals[i].Currency < p.Totals[j].Currency
+	})
+
+	sort.SliceStable(p.Transactions, func(i, j int) bool {
+		return p.Transactions[i].Timestamp.Before(p.Transactions[j].Timestamp)
+	})
+
+	return p, nil
+}
+
+// payoutFee returns the fee charged on the given captured amount, computed
+// with the given context.
+func payoutFee(dctx *apd.Context, amount, rate *apd.Decimal) (*apd.Decimal, error) {
+	if rate == nil {
+		return apd.New(0, 0), nil
+	}
+
+	fee := apd.New(0, 0)
+	_, err := dctx.Mul(fee, amount, rate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return quantize(fee, -2)
+}
+
+// WriteCSV writes the payout as RFC 4180 CSV: a row for each capture and
+// refund, followed by a TOTAL row for each currency.
+func (p *Payout) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(payoutCSVHeader)
+
+	if err != nil {
+		return err
+	}
+
+	for _, v := range p.Transactions {
+		var authorization string
+
+		if v.AuthorizationID != nil {
+			authorization = strconv.Itoa(*v.AuthorizationID)
+		}
+
+		gross, refunds, fees, net := "0", v.Amount.Text('f'), "0", new(apd.Decimal).Neg(v.Amount).Text('f')
+
+		if v.Type == Capture {
+			n := apd.New(0, 0)
+			_, err = getContext().Sub(n, v.Amount, v.Fee)
+
+			if err != nil {
+				return err
+			}
+
+			gross, refunds, fees, net = v.Amount.Text('f'), "0", v.Fee.Text('f'), n.Text('f')
+		}
+
+		err = cw.Write([]string{
+			strconv.Itoa(v.AccountID),
+			strconv.Itoa(v.TransactionID),
+			authorization,
+			v.Timestamp.UTC().Format(time.RFC3339),
+			v.Type.String(),
+			v.Currency,
+			gross,
+			refunds,
+			fees,
+			net,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, v := range p.Totals {
+		err = cw.Write([]string{
+			"",
+			"",
+			"",
+			"",
+			"TOTAL",
+			v.Currency,
+			v.Gross.Text('f'),
+			v.Refunds.Text('f'),
+			v.Fees.Text('f'),
+			v.Net.Text('f'),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,90 @@
+package card_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantPayout(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		return now
+	}
+
+	var accounts []*Account
+
+	for i := 1; i <= 2; i++ {
+		account := NewAccount(i, WithClock(clock))
+
+		require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+		au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+		require.NoError(t, account.Capture(ctx, au.ID, apd.New(4999, -2), DefaultCurrency))
+
+		other, err := account.Authorize(ctx, merchantID+1, apd.New(10, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+		require.NoError(t, account.Capture(ctx, other.ID, apd.New(10, 0), DefaultCurrency))
+
+		accounts = append(accounts, account)
+	}
+
+	now = now.Add(time.Hour)
+
+	require.NoError(t, accounts[1].Refund(ctx, 2, apd.New(10, 0), DefaultCurrency))
+
+	merchant := MerchantInfo{ID: merchantID, FeeRate: apd.New(15, -3)}
+	p, err := MerchantPayout(accounts, merchant, time.Time{}, time.Time{})
+
+	require.NoError(t, err)
+	require.Len(t, p.Transactions, 3)
+	require.Len(t, p.Totals, 1)
+	require.Zero(t, p.Transactions[0].Fee.Cmp(apd.New(75, -2)), "rounded fee")
+
+	total := p.Totals[0]
+
+	require.Zero(t, total.Gross.Cmp(apd.New(9998, -2)))
+	require.Zero(t, total.Refunds.Cmp(apd.New(10, 0)))
+	require.Zero(t, total.Fees.Cmp(apd.New(150, -2)))
+	require.Zero(t, total.Net.Cmp(apd.New(8848, -2)))
+
+	t.Run("Period", func(t *testing.T) {
+		p, err := MerchantPayout(accounts, MerchantInfo{ID: merchantID}, now, time.Time{})
+
+		require.NoError(t, err)
+		require.Len(t, p.Transactions, 1)
+		require.Equal(t, Refund, p.Transactions[0].Type)
+		require.Zero(t, p.Totals[0].Net.Cmp(apd.New(-10, 0)))
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, p.WriteCSV(&buf))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		require.Len(t, lines, 5)
+		require.Equal(t, "account,transaction,authorization,timestamp,type,currency,gross,refunds,fees,net", lines[0])
+		require.Equal(t, "1,3,2,2024-03-01T12:00:00Z,CAPTURE,GBP,49.99,0,0.75,49.24", lines[1])
+		require.Equal(t, "2,6,2,2024-03-01T13:00:00Z,REFUND,GBP,0,10,0,-10", lines[3])
+		require.Equal(t, ",,,,TOTAL,GBP,99.98,10,1.50,88.48", lines[4])
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(p)
+
+		require.NoError(t, err)
+		require.Contains(t, string(b), `"feeRate":"0.015"`)
+		require.Contains(t, string(b), `"net":"88.48"`)
+	})
+}
@@ -0,0 +1,302 @@
+package card
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Discrepancy represents a stored amount which doesn't match the amount
+// recomputed from the transaction log. Merchant and authorization amounts
+// identify the merchant or authorization; other amounts are pocket balances.
+type Discrepancy struct {
+	AccountID       int          `json:"accountID"`
+	Currency        string       `json:"currency"`
+	MerchantID      *int         `json:"merchantID,omitempty"`
+	AuthorizationID *int         `json:"authorizationID,omitempty"`
+	Field           string       `json:"field"`
+	Stored          *apd.Decimal `json:"stored"`
+	Computed        *apd.Decimal `json:"computed"`
+	Difference      *apd.Decimal `json:"difference"`
+}
+
+// Reconcile recomputes the account balances, merchant amounts and
+// authorization amounts by replaying the transaction log, returning the
+// stored amounts which don't match, ordered by currency. Merchant captured
+// amounts are compared including the amounts settled. The account isn't
+// modified.
+func (a *Account) Reconcile() ([]Discrepancy, error) {
+	pockets, authorizations, err := a.replayLog()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Discrepancy
+
+	compare := func(d Discrepancy, stored, computed *apd.Decimal) error {
+		if stored == nil {
+			stored = apd.New(0, 0)
+		}
+
+		if stored.Cmp(computed) == 0 {
+			return nil
+		}
+
+		d.AccountID = a.ID
+		d.Stored = apd.New(0, 0).Set(stored)
+		d.Computed = apd.New(0, 0).Set(computed)
+		d.Difference = apd.New(0, 0)
+		_, err := a.decimalContext().Sub(d.Difference, stored, computed)
+
+		if err != nil {
+			return err
+		}
+
+		res = append(res, d)
+
+		return nil
+	}
+
+	for _, currency := range a.reconciledCurrencies(pockets) {
+		stored := a.storedPocket(currency)
+		computed, exists := pockets[currency]
+
+		if !exists {
+			computed = newPocket()
+		}
+
+		for _, v := range []struct {
+			field            string
+			stored, computed *apd.Decimal
+		}{
+			{"available", stored.Available, computed.Available},
+			{"blocked", stored.Blocked, computed.Blocked},
+		} {
+			err = compare(Discrepancy{Currency: currency, Field: v.field}, v.stored, v.computed)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range merchantIDs(stored.Merchants, computed.Merchants) {
+			s, c := stored.Merchants[id], computed.Merchants[id]
+
+			if s == nil {
+				s = newMerchant()
+			}
+
+			if c == nil {
+				c = newMerchant()
+			}
+
+			captured := s.Captured
+
+			if s.Settled != nil {
+				captured = apd.New(0, 0)
+				_, err = a.decimalContext().Add(captured, s.Captured, s.Settled)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			merchantID := id
+
+			for _, v := range []struct {
+				field            string
+				stored, computed *apd.Decimal
+			}{
+				{"merchantAvailable", s.Available, c.Available},
+				{"merchantCaptured", captured, c.Captured},
+			} {
+				err = compare(Discrepancy{Currency: currency, MerchantID: &merchantID, Field: v.field}, v.stored, v.computed)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(a.Authorizations))
+
+	for id := range a.Authorizations {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		s, c := a.Authorizations[id], authorizations[id]
+
+		if c == nil {
+			c = &Authorization{Captured: apd.New(0, 0), Reversed: apd.New(0, 0), Refunded: apd.New(0, 0)}
+		}
+
+		authorizationID := id
+
+		for _, v := range []struct {
+			field            string
+			stored, computed *apd.Decimal
+		}{
+			{"authorizationCaptured", s.Captured, c.Captured},
+			{"authorizationReversed", s.Reversed, c.Reversed},
+			{"authorizationRefunded", s.Refunded, c.Refunded},
+		} {
+			err = compare(Discrepancy{Currency: s.Currency, AuthorizationID: &authorizationID, Field: v.field}, v.stored, v.computed)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// replayLog recomputes the pocket balances, merchant amounts and
+// authorization amounts from the transaction log.
+func (a *Account) replayLog() (map[string]*Pocket, map[int]*Authorization, error) {
+	var (
+		dctx           = a.decimalContext()
+		pockets        = map[string]*Pocket{}
+		authorizations = map[int]*Authorization{}
+	)
+
+	for _, v := range a.Transactions {
+		p, exists := pockets[v.Currency]
+
+		if !exists {
+			p = newPocket()
+			pockets[v.Currency] = p
+		}
+
+		var (
+			m          *Merchant
+			au         *Authorization
+			adds, subs []*apd.Decimal
+		)
+
+		switch v.Type {
+		case Authorize, Capture, Reverse, Refund:
+			if v.MerchantID == nil {
+				return nil, nil, errors.Wrapf(ErrInvalidState, "%s transaction %d has no merchant", v.Type, v.ID)
+			}
+
+			m = p.merchant(*v.MerchantID)
+		}
+
+		switch v.Type {
+		case Capture, Reverse, Refund:
+			if v.AuthorizationID == nil {
+				return nil, nil, errors.Wrapf(ErrInvalidState, "%s transaction %d has no authorization", v.Type, v.ID)
+			}
+
+			au, exists = authorizations[*v.AuthorizationID]
+
+			if !exists {
+				au = &Authorization{Captured: apd.New(0, 0), Reversed: apd.New(0, 0), Refunded: apd.New(0, 0)}
+				authorizations[*v.AuthorizationID] = au
+			}
+		}
+
+		switch v.Type {
+		case Load, Adjustment, Chargeback:
+			adds = []*apd.Decimal{p.Available}
+		case Authorize:
+			adds, subs = []*apd.Decimal{p.Blocked, m.Available}, []*apd.Decimal{p.Available}
+		case Capture:
+			adds, subs = []*apd.Decimal{m.Captured, au.Captured}, []*apd.Decimal{p.Blocked, m.Available}
+		case Reverse:
+			adds, subs = []*apd.Decimal{p.Available, au.Reversed}, []*apd.Decimal{p.Blocked, m.Available}
+		case Refund:
+			adds, subs = []*apd.Decimal{p.Available, au.Refunded}, []*apd.Decimal{m.Captured}
+		}
+
+		for _, d := range adds {
+			_, err := dctx.Add(d, d, v.Amount)
+
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		for _, d := range subs {
+			_, err := dctx.Sub(d, d, v.Amount)
+
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return pockets, authorizations, nil
+}
+
+// storedPocket returns the stored balances held in the given currency,
+// without creating missing pockets or merchant maps.
+func (a *Account) storedPocket(currency string) *Pocket {
+	if currency == a.Currency {
+		return &Pocket{Available: a.Available, Blocked: a.Blocked, Merchants: a.Merchants}
+	}
+
+	p, exists := a.Pockets[currency]
+
+	if !exists || p == nil {
+		return &Pocket{}
+	}
+
+	return p
+}
+
+// reconciledCurrencies returns the currencies held by the account, followed
+// by any other currencies of the transaction log in order.
+func (a *Account) reconciledCurrencies(pockets map[string]*Pocket) []string {
+	currencies := a.Currencies()
+	held := make(map[string]bool, len(currencies))
+
+	for _, v := range currencies {
+		held[v] = true
+	}
+
+	var other []string
+
+	for k := range pockets {
+		if !held[k] {
+			other = append(other, k)
+		}
+	}
+
+	sort.Strings(other)
+
+	return append(currencies, other...)
+}
+
+// newPocket returns an empty pocket.
+func newPocket() *Pocket {
+	return &Pocket{Available: apd.New(0, 0), Blocked: apd.New(0, 0)}
+}
+
+// merchantIDs returns the merchant IDs of either map in order.
+func merchantIDs(a, b map[int]*Merchant) []int {
+	var ids []int
+
+	for id := range a {
+		ids = append(ids, id)
+	}
+
+	for id := range b {
+		_, exists := a[id]
+
+		if !exists {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
@@ -0,0 +1,72 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	account := NewAccount(1)
+	res, err := account.Reconcile()
+
+	require.NoError(t, err)
+	require.Empty(t, res)
+	require.Empty(t, account.Merchants, "account unmodified")
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(60, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(40, 0), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+
+	_, err = account.Settle()
+
+	require.NoError(t, err)
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+	require.NoError(t, account.Adjust(ctx, apd.New(-3, 0), DefaultCurrency, "fee"))
+
+	_, err = account.OpenDispute(ctx, au.ID+1, apd.New(5, 0), "")
+
+	require.NoError(t, err)
+
+	res, err = account.Reconcile()
+
+	require.NoError(t, err)
+	require.Empty(t, res)
+
+	require.Zero(t, account.Available.Cmp(apd.New(57, 0)))
+
+	account.Available = apd.New(58, 0)
+	account.Merchants[merchantID].Captured = apd.New(0, 0)
+	account.Authorizations[au.ID].Refunded = apd.New(0, 0)
+
+	res, err = account.Reconcile()
+
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+
+	require.Equal(t, 1, res[0].AccountID)
+	require.Equal(t, DefaultCurrency, res[0].Currency)
+	require.Equal(t, "available", res[0].Field)
+	require.Zero(t, res[0].Difference.Cmp(apd.New(1, 0)))
+
+	require.Equal(t, "merchantCaptured", res[1].Field)
+	require.Equal(t, merchantID, *res[1].MerchantID)
+	require.Zero(t, res[1].Stored.Cmp(apd.New(40, 0)), "including settled")
+	require.Zero(t, res[1].Computed.Cmp(apd.New(30, 0)))
+
+	require.Equal(t, "authorizationRefunded", res[2].Field)
+	require.Equal(t, au.ID, *res[2].AuthorizationID)
+	require.Zero(t, res[2].Difference.Cmp(apd.New(-10, 0)))
+
+	b, err := json.Marshal(res[2])
+
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"difference":"-10"`)
+}
@@ -0,0 +1,187 @@
+package card
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Merchant registry errors.
+var (
+	ErrMerchantExists = newError("MERCHANT_EXISTS", "merchant record already exists")
+	ErrInvalidFeeRate = newError("INVALID_FEE_RATE", "fee rate must be between 0 and 1")
+)
+
+// MerchantInfo represents a registered merchant.
+type MerchantInfo struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	MCC     string `json:"mcc"`
+	Country string `json:"country"`
+
+	// FeeRate is the fraction of captured amounts charged as fees on merchant
+	// payouts, e.g. 0.015 for 1.5%.
+	FeeRate *apd.Decimal `json:"feeRate,omitempty"`
+}
+
+// validate checks the merchant's fee rate.
+func (m MerchantInfo) validate() error {
+	if m.FeeRate == nil {
+		return nil
+	}
+
+	if m.FeeRate.Form != apd.Finite || m.FeeRate.Sign() < 0 || m.FeeRate.Cmp(apd.New(1, 0)) > 0 {
+		return errors.Wrapf(ErrInvalidFeeRate, "%s", m.FeeRate)
+	}
+
+	return nil
+}
+
+// MerchantRegistry holds merchant details shared across accounts. It is safe
+// for concurrent use.
+type MerchantRegistry struct {
+	mu        sync.RWMutex
+	merchants map[int]MerchantInfo
+}
+
+// NewMerchantRegistry returns a new registry holding the given merchants.
+func NewMerchantRegistry(merchants ...MerchantInfo) *MerchantRegistry {
+	r := &MerchantRegistry{merchants: make(map[int]MerchantInfo, len(merchants))}
+
+	for _, v := range merchants {
+		r.merchants[v.ID] = v
+	}
+
+	return r
+}
+
+// Add registers a new merchant.
+func (r *MerchantRegistry) Add(m MerchantInfo) error {
+	err := m.validate()
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	_, exists := r.merchants[m.ID]
+
+	if exists {
+		return errors.Wrapf(ErrMerchantExists, "ID: %d", m.ID)
+	}
+
+	if r.merchants == nil {
+		r.merchants = map[int]MerchantInfo{}
+	}
+
+	r.merchants[m.ID] = m
+
+	return nil
+}
+
+// Get returns the merchant for the given ID.
+func (r *MerchantRegistry) Get(id int) (MerchantInfo, error) {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	m, exists := r.merchants[id]
+
+	if !exists {
+		return MerchantInfo{}, errors.Wrapf(ErrMerchantNotFound, "ID: %d", id)
+	}
+
+	return m, nil
+}
+
+// Update replaces the details of a registered merchant.
+func (r *MerchantRegistry) Update(m MerchantInfo) error {
+	err := m.validate()
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	_, exists := r.merchants[m.ID]
+
+	if !exists {
+		return errors.Wrapf(ErrMerchantNotFound, "ID: %d", m.ID)
+	}
+
+	r.merchants[m.ID] = m
+
+	return nil
+}
+
+// Delete removes the merchant for the given ID.
+func (r *MerchantRegistry) Delete(id int) error {
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	_, exists := r.merchants[id]
+
+	if !exists {
+		return errors.Wrapf(ErrMerchantNotFound, "ID: %d", id)
+	}
+
+	delete(r.merchants, id)
+
+	return nil
+}
+
+// List returns all registered merchants ordered by ID.
+func (r *MerchantRegistry) List() []MerchantInfo {
+	r.mu.RLock()
+
+	merchants := make([]MerchantInfo, 0, len(r.merchants))
+
+	for _, v := range r.merchants {
+		merchants = append(merchants, v)
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(merchants, func(i, j int) bool {
+		return merchants[i].ID < merchants[j].ID
+	})
+
+	return merchants
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *MerchantRegistry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.List())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *MerchantRegistry) UnmarshalJSON(b []byte) error {
+	var merchants []MerchantInfo
+
+	err := json.Unmarshal(b, &merchants)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.merchants = make(map[int]MerchantInfo, len(merchants))
+
+	for _, v := range merchants {
+		r.merchants[v.ID] = v
+	}
+
+	r.mu.Unlock()
+
+	return nil
+}
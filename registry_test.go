@@ -0,0 +1,74 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantRegistry(t *testing.T) {
+	r := NewMerchantRegistry(MerchantInfo{ID: 2, Name: "Coffee Shop", MCC: "5814", Country: "GB"})
+
+	t.Run("Add", func(t *testing.T) {
+		require.NoError(t, r.Add(MerchantInfo{ID: 1, Name: "Book Store", MCC: "5942", Country: "GB"}))
+		require.Equal(t, ErrMerchantExists, errors.Cause(r.Add(MerchantInfo{ID: 1})))
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		m, err := r.Get(2)
+
+		require.NoError(t, err)
+		require.Equal(t, "Coffee Shop", m.Name)
+
+		_, err = r.Get(3)
+
+		require.Equal(t, ErrMerchantNotFound, errors.Cause(err))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		require.NoError(t, r.Update(MerchantInfo{ID: 2, Name: "Cafe", MCC: "5814", Country: "FR"}))
+		require.Equal(t, ErrMerchantNotFound, errors.Cause(r.Update(MerchantInfo{ID: 3})))
+
+		m, err := r.Get(2)
+
+		require.NoError(t, err)
+		require.Equal(t, "FR", m.Country)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		merchants := r.List()
+
+		require.Len(t, merchants, 2)
+		require.Equal(t, 1, merchants[0].ID)
+		require.Equal(t, 2, merchants[1].ID)
+	})
+
+	t.Run("JSON round-trip", func(t *testing.T) {
+		b, err := json.Marshal(r)
+
+		require.NoError(t, err)
+
+		decoded := NewMerchantRegistry()
+
+		require.NoError(t, json.Unmarshal(b, decoded))
+		require.Equal(t, r.List(), decoded.List())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, r.Delete(1))
+		require.Equal(t, ErrMerchantNotFound, errors.Cause(r.Delete(1)))
+		require.Len(t, r.List(), 1)
+	})
+}
+
+func TestMerchantFeeRate(t *testing.T) {
+	r := NewMerchantRegistry()
+
+	require.Equal(t, ErrInvalidFeeRate, errors.Cause(r.Add(MerchantInfo{ID: 1, FeeRate: apd.New(-1, 2)})))
+	require.NoError(t, r.Add(MerchantInfo{ID: 1, FeeRate: apd.New(2, -2)}))
+	require.Equal(t, ErrInvalidFeeRate, errors.Cause(r.Update(MerchantInfo{ID: 1, FeeRate: apd.New(2, 0)})))
+}
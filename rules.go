@@ -0,0 +1,100 @@
+package card
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Merchant category rule errors.
+var (
+	ErrMerchantCategoryBlocked = newError("MERCHANT_CATEGORY_BLOCKED", "merchant category blocked")
+	ErrInvalidMCC              = newError("INVALID_MCC", "invalid merchant category code")
+)
+
+// CategoryRules restricts authorizations by merchant category code (MCC).
+// When Allowed is non-empty only the listed categories are permitted;
+// Blocked categories are always rejected.
+type CategoryRules struct {
+	Allowed []string `json:"allowed,omitempty"`
+	Blocked []string `json:"blocked,omitempty"`
+}
+
+// Permits reports whether the rules permit the given merchant category code.
+func (r *CategoryRules) Permits(mcc string) bool {
+	for _, v := range r.Blocked {
+		if v == mcc {
+			return false
+		}
+	}
+
+	if len(r.Allowed) == 0 {
+		return true
+	}
+
+	for _, v := range r.Allowed {
+		if v == mcc {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validMCC reports whether the given value is a four digit ISO 18245 merchant
+// category code.
+func validMCC(mcc string) bool {
+	if len(mcc) != 4 {
+		return false
+	}
+
+	for _, c := range mcc {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetCategoryRules replaces the account merchant category rules. Nil rules
+// permit all categories.
+func (a *Account) SetCategoryRules(r *CategoryRules) error {
+	if r != nil {
+		for _, codes := range [][]string{r.Allowed, r.Blocked} {
+			for _, v := range codes {
+				if !validMCC(v) {
+					return errors.Wrapf(ErrInvalidMCC, "%q", v)
+				}
+			}
+		}
+	}
+
+	a.CategoryRules = r
+	a.bump()
+
+	return nil
+}
+
+// checkCategory verifies the account category rules permit the given
+// merchant. Merchants absent from the account registry have no category and
+// are only permitted when no categories are explicitly allowed.
+func (a *Account) checkCategory(merchantID int) error {
+	if a.CategoryRules == nil {
+		return nil
+	}
+
+	var mcc string
+
+	if a.Registry != nil {
+		m, err := a.Registry.Get(merchantID)
+
+		if err == nil {
+			mcc = m.MCC
+		}
+	}
+
+	if !a.CategoryRules.Permits(mcc) {
+		return errors.Wrapf(ErrMerchantCategoryBlocked, "MCC: %q", mcc)
+	}
+
+	return nil
+}
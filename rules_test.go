@@ -0,0 +1,68 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategoryRules(t *testing.T) {
+	const (
+		casino = iota + 1
+		grocer
+		unregistered
+	)
+
+	account := NewAccount(0)
+	account.Registry = NewMerchantRegistry(
+		MerchantInfo{ID: casino, Name: "Casino", MCC: "7995", Country: "GB"},
+		MerchantInfo{ID: grocer, Name: "Grocer", MCC: "5411", Country: "GB"},
+	)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.Equal(t, ErrInvalidMCC, errors.Cause(account.SetCategoryRules(&CategoryRules{Blocked: []string{"79"}})))
+
+	t.Run("Blocked category", func(t *testing.T) {
+		require.NoError(t, account.SetCategoryRules(&CategoryRules{Blocked: []string{"7995"}}))
+
+		_, err := account.Authorize(ctx, casino, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, ErrMerchantCategoryBlocked, errors.Cause(err))
+		require.Contains(t, err.Error(), "7995")
+
+		_, err = account.Authorize(ctx, grocer, apd.New(1, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+
+		_, err = account.Authorize(ctx, unregistered, apd.New(1, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Allowed categories", func(t *testing.T) {
+		require.NoError(t, account.SetCategoryRules(&CategoryRules{Allowed: []string{"5411"}}))
+
+		_, err := account.Authorize(ctx, grocer, apd.New(1, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+
+		_, err = account.Authorize(ctx, casino, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, ErrMerchantCategoryBlocked, errors.Cause(err))
+
+		_, err = account.Authorize(ctx, unregistered, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, ErrMerchantCategoryBlocked, errors.Cause(err))
+	})
+
+	t.Run("Rules removed", func(t *testing.T) {
+		require.NoError(t, account.SetCategoryRules(nil))
+
+		_, err := account.Authorize(ctx, casino, apd.New(1, 0), DefaultCurrency)
+
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,385 @@
+package card
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// Recurring load cadences.
+const (
+	CadenceDaily Cadence = iota
+	CadenceWeekly
+	CadenceMonthly
+)
+
+// Schedule errors.
+var (
+	ErrInvalidCadence   = newError("INVALID_CADENCE", "invalid schedule cadence")
+	ErrInvalidSchedule  = newError("INVALID_SCHEDULE", "schedule ends before it starts")
+	ErrScheduleNotFound = newError("SCHEDULE_NOT_FOUND", "schedule not found")
+)
+
+// Cadence represents how often a recurring load runs.
+type Cadence uint8
+
+func (c Cadence) String() string {
+	switch c {
+	case CadenceDaily:
+		return "DAY"
+	case CadenceWeekly:
+		return "WEEK"
+	case CadenceMonthly:
+		return "MONTH"
+	}
+
+	return "UNKNOWN"
+}
+
+// ParseCadence returns the cadence for the given name.
+func ParseCadence(s string) (Cadence, error) {
+	for c := CadenceDaily; c <= CadenceMonthly; c++ {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidCadence, "%q", s)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (c Cadence) MarshalText() ([]byte, error) {
+	if c > CadenceMonthly {
+		return nil, errors.Wrapf(ErrInvalidCadence, "%d", c)
+	}
+
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (c *Cadence) UnmarshalText(text []byte) error {
+	v, err := ParseCadence(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*c = v
+
+	return nil
+}
+
+// Schedule represents a recurring load of a fixed amount, run at each
+// occurrence of its cadence from its start until its end, if any.
+type Schedule struct {
+	ID       int          `json:"id"`
+	Amount   *apd.Decimal `json:"amount"`
+	Currency string       `json:"currency"`
+	Cadence  Cadence      `json:"cadence"`
+	Start    time.Time    `json:"start"`
+	End      *time.Time   `json:"end,omitempty"`
+
+	// Next is the time of the next load, nil once the schedule has ended.
+	Next *time.Time `json:"next,omitempty"`
+
+	// Executions counts the loads recorded by the schedule.
+	Executions int `json:"executions"`
+
+	// Missed counts the occurrences skipped because a later occurrence was
+	// also due when the schedule ran, e.g. after downtime.
+	Missed int `json:"missed,omitempty"`
+}
+
+// occurrence returns the nth occurrence of the schedule, the first being its
+// start. Monthly schedules starting on a day missing from shorter months run
+// on their last day.
+func (s *Schedule) occurrence(n int) time.Time {
+	switch s.Cadence {
+	case CadenceDaily:
+		return s.Start.AddDate(0, 0, n)
+	case CadenceWeekly:
+		return s.Start.AddDate(0, 0, 7*n)
+	}
+
+	t := s.Start.AddDate(0, n, 0)
+
+	if t.Day() != s.Start.Day() {
+		t = t.AddDate(0, 0, -t.Day())
+	}
+
+	return t
+}
+
+// following returns the first occurrence of the schedule after the given
+// time.
+func (s *Schedule) following(t time.Time) time.Time {
+	if t.Before(s.Start) {
+		return s.Start
+	}
+
+	var n int
+
+	switch s.Cadence {
+	case CadenceDaily:
+		n = int(t.Sub(s.Start) / (24 * time.Hour))
+	case CadenceWeekly:
+		n = int(t.Sub(s.Start) / (7 * 24 * time.Hour))
+	default:
+		n = (t.Year()-s.Start.Year())*12 + int(t.Month()-s.Start.Month())
+	}
+
+	// The estimate may be an occurrence late, e.g. across daylight saving
+	// time changes
+	if n > 0 {
+		n--
+	}
+
+	for !s.occurrence(n).After(t) {
+		n++
+	}
+
+	return s.occurrence(n)
+}
+
+// schedule sets the next load to the given time, ending the schedule if it's
+// past its end.
+func (s *Schedule) schedule(next time.Time) {
+	if s.End != nil && next.After(*s.End) {
+		s.Next = nil
+
+		return
+	}
+
+	s.Next = &next
+}
+
+// validateSchedule verifies the schedule amount is a positive, finite decimal
+// in a valid currency, its cadence is known and it doesn't end before it
+// starts.
+func validateSchedule(s *Schedule) error {
+	if s.Amount == nil {
+		return ErrInvalidAmount
+	}
+
+	if s.Amount.Form != apd.Finite || s.Amount.Sign() <= 0 {
+		return amountError(ErrInvalidAmount, s.Amount, nil)
+	}
+
+	if !validCurrency(s.Currency) {
+		return errors.Wrapf(ErrInvalidCurrency, "%q", s.Currency)
+	}
+
+	if s.Cadence > CadenceMonthly {
+		return errors.Wrapf(ErrInvalidCadence, "%d", s.Cadence)
+	}
+
+	if s.End != nil && s.End.Before(s.Start) {
+		return ErrInvalidSchedule
+	}
+
+	return nil
+}
+
+// AddSchedule adds a recurring load of the given amount and cadence, starting
+// at the given time, or now if it's zero, and ending at the given time, if
+// any. Occurrences already past aren't run. The currency defaults to the
+// account currency when empty.
+func (a *Account) AddSchedule(amount *apd.Decimal, currency string, cadence Cadence, start time.Time, end *time.Time) (*Schedule, error) {
+	s := &Schedule{
+		ID:       a.LastScheduleID + 1,
+		Amount:   amount,
+		Currency: currency,
+		Cadence:  cadence,
+		Start:    start,
+		End:      end,
+	}
+
+	err := a.setSchedule(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.LastScheduleID = s.ID
+
+	return s, nil
+}
+
+// UpdateSchedule replaces the amount, cadence, start and end of the schedule
+// with the given ID, like AddSchedule. Its execution and missed counts are
+// kept.
+func (a *Account) UpdateSchedule(id int, amount *apd.Decimal, currency string, cadence Cadence, start time.Time, end *time.Time) (*Schedule, error) {
+	current, err := a.Schedule(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schedule{
+		ID:         id,
+		Amount:     amount,
+		Currency:   currency,
+		Cadence:    cadence,
+		Start:      start,
+		End:        end,
+		Executions: current.Executions,
+		Missed:     current.Missed,
+	}
+
+	err = a.setSchedule(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// setSchedule validates the given schedule and stores it, scheduling its
+// first occurrence from now.
+func (a *Account) setSchedule(s *Schedule) error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	now := a.now()
+
+	if s.Start.IsZero() {
+		s.Start = now
+	}
+
+	if s.Currency == "" {
+		s.Currency = a.Currency
+	}
+
+	err := validateSchedule(s)
+
+	if err != nil {
+		return err
+	}
+
+	// Loads in currencies the account doesn't hold are converted
+	_, exists := a.pocket(s.Currency)
+
+	if !exists && a.Rates == nil {
+		return errors.Wrapf(ErrCurrencyMismatch, "%s (account: %s)", s.Currency, a.Currency)
+	}
+
+	if s.Start.Before(now) {
+		s.schedule(s.following(now))
+	} else {
+		s.schedule(s.Start)
+	}
+
+	if a.Schedules == nil {
+		a.Schedules = map[int]*Schedule{}
+	}
+
+	a.Schedules[s.ID] = s
+	a.bump()
+
+	return nil
+}
+
+// Schedule returns the schedule with the given ID.
+func (a *Account) Schedule(id int) (*Schedule, error) {
+	s, exists := a.Schedules[id]
+
+	if !exists {
+		return nil, errors.Wrapf(ErrScheduleNotFound, "%d", id)
+	}
+
+	return s, nil
+}
+
+// ListSchedules returns the account schedules in ID order.
+func (a *Account) ListSchedules() []*Schedule {
+	res := make([]*Schedule, 0, len(a.Schedules))
+
+	for _, v := range a.Schedules {
+		res = append(res, v)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// RemoveSchedule removes the schedule with the given ID.
+func (a *Account) RemoveSchedule(id int) error {
+	_, err := a.Schedule(id)
+
+	if err != nil {
+		return err
+	}
+
+	delete(a.Schedules, id)
+	a.bump()
+
+	return nil
+}
+
+// DueSchedules reports whether any schedule has a load due at the given
+// time.
+func (a *Account) DueSchedules(now time.Time) bool {
+	if a.Status == Closed {
+		return false
+	}
+
+	for _, v := range a.Schedules {
+		if v.Next != nil && !v.Next.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunSchedules records a load for each of the account schedules due at the
+// given time, in schedule ID order, returning the transactions recorded. A
+// schedule loads once however many of its occurrences are due, e.g. after
+// downtime: the earlier occurrences are skipped and counted as missed, and
+// the schedule moves to its next occurrence after the given time. Loads are
+// system-originated, described as scheduled and referenced by schedule ID.
+// Schedules of closed accounts don't run.
+func (a *Account) RunSchedules(ctx context.Context, now time.Time) ([]Transaction, error) {
+	if a.Status == Closed {
+		return nil, nil
+	}
+
+	var res []Transaction
+
+	for _, s := range a.ListSchedules() {
+		if s.Next == nil || s.Next.After(now) {
+			continue
+		}
+
+		err := a.Load(ctx, s.Amount, s.Currency,
+			WithDescription("scheduled load"),
+			WithReference("schedule:"+strconv.Itoa(s.ID)),
+			WithOrigin(OriginSystem),
+		)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "schedule %d", s.ID)
+		}
+
+		res = append(res, a.Transactions[len(a.Transactions)-1])
+		s.Executions++
+
+		for t := s.following(*s.Next); !t.After(now) && (s.End == nil || !t.After(*s.End)); t = s.following(t) {
+			s.Missed++
+		}
+
+		s.schedule(s.following(now))
+	}
+
+	return res, nil
+}
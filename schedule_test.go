@@ -0,0 +1,213 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCadence(t *testing.T) {
+	c, err := ParseCadence("week")
+
+	require.NoError(t, err)
+	require.Equal(t, CadenceWeekly, c)
+
+	c, err = ParseCadence("MONTH")
+
+	require.NoError(t, err)
+	require.Equal(t, CadenceMonthly, c)
+
+	_, err = ParseCadence("year")
+
+	require.Equal(t, ErrInvalidCadence, errors.Cause(err))
+}
+
+func TestAddSchedule(t *testing.T) {
+	now := time.Date(2018, time.June, 10, 12, 0, 0, 0, time.UTC)
+	account := NewAccount(0, WithClock(func() time.Time { return now }))
+	end := now.AddDate(0, 0, -1)
+
+	_, err := account.AddSchedule(apd.New(-1, 0), "", CadenceDaily, time.Time{}, nil)
+
+	require.Equal(t, ErrInvalidAmount, errors.Cause(err))
+
+	_, err = account.AddSchedule(apd.New(1, 0), "", Cadence(9), time.Time{}, nil)
+
+	require.Equal(t, ErrInvalidCadence, errors.Cause(err))
+
+	_, err = account.AddSchedule(apd.New(1, 0), "", CadenceDaily, time.Time{}, &end)
+
+	require.Equal(t, ErrInvalidSchedule, errors.Cause(err))
+
+	_, err = account.AddSchedule(apd.New(1, 0), "USD", CadenceDaily, time.Time{}, nil)
+
+	require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+	require.Empty(t, account.Schedules)
+
+	// Starting now
+	s, err := account.AddSchedule(apd.New(10, 0), "", CadenceWeekly, time.Time{}, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, s.ID)
+	require.Equal(t, DefaultCurrency, s.Currency)
+	require.Equal(t, now, *s.Next)
+
+	// Started in the past: occurrences already past aren't run
+	s, err = account.AddSchedule(apd.New(5, 0), "", CadenceDaily, now.AddDate(0, 0, -3).Add(time.Hour), nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, s.ID)
+	require.Equal(t, now.Add(time.Hour), *s.Next)
+
+	s, err = account.UpdateSchedule(2, apd.New(6, 0), "", CadenceMonthly, now.AddDate(0, 1, 0), nil)
+
+	require.NoError(t, err)
+	require.Equal(t, now.AddDate(0, 1, 0), *s.Next)
+	require.Len(t, account.ListSchedules(), 2)
+
+	_, err = account.UpdateSchedule(3, apd.New(1, 0), "", CadenceDaily, time.Time{}, nil)
+
+	require.Equal(t, ErrScheduleNotFound, errors.Cause(err))
+	require.NoError(t, account.RemoveSchedule(1))
+	require.Equal(t, ErrScheduleNotFound, errors.Cause(account.RemoveSchedule(1)))
+	require.Len(t, account.ListSchedules(), 1)
+
+	// IDs aren't reused
+	s, err = account.AddSchedule(apd.New(1, 0), "", CadenceDaily, time.Time{}, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 3, s.ID)
+}
+
+func TestRunSchedules(t *testing.T) {
+	start := time.Date(2018, time.June, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	account := NewAccount(0, WithClock(func() time.Time { return now }))
+	end := start.AddDate(0, 0, 14)
+
+	_, err := account.AddSchedule(apd.New(10, 0), "", CadenceWeekly, start, &end)
+
+	require.NoError(t, err)
+
+	_, err = account.AddSchedule(apd.New(1, 0), "", CadenceDaily, start, nil)
+
+	require.NoError(t, err)
+	require.True(t, account.DueSchedules(now))
+	require.False(t, account.DueSchedules(now.Add(-time.Second)))
+
+	txns, err := account.RunSchedules(ctx, now)
+
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	require.Equal(t, Load, txns[0].Type)
+	require.Equal(t, OriginSystem, txns[0].Origin)
+	require.Equal(t, "schedule:1", txns[0].Reference)
+	require.Equal(t, "scheduled load", txns[0].Description)
+	require.Zero(t, account.Available.Cmp(apd.New(11, 0)))
+	require.False(t, account.DueSchedules(now))
+
+	// Schedules due several times load once, skipping the missed occurrences
+	now = start.AddDate(0, 0, 20)
+	txns, err = account.RunSchedules(ctx, now)
+
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	require.Zero(t, account.Available.Cmp(apd.New(22, 0)))
+
+	s, err := account.Schedule(1)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Executions)
+	require.Equal(t, 1, s.Missed, "occurrences after the end aren't missed")
+	require.Nil(t, s.Next, "ended")
+
+	s, err = account.Schedule(2)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Executions)
+	require.Equal(t, 19, s.Missed)
+	require.Equal(t, start.AddDate(0, 0, 21), *s.Next)
+
+	// Counts are kept by updates
+	s, err = account.UpdateSchedule(2, apd.New(2, 0), "", CadenceDaily, start, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Executions)
+	require.Equal(t, 19, s.Missed)
+	require.NoError(t, account.Validate())
+
+	// Schedules of closed accounts don't run
+	require.NoError(t, account.Close())
+
+	now = now.AddDate(0, 0, 1)
+	txns, err = account.RunSchedules(ctx, now)
+
+	require.NoError(t, err)
+	require.Empty(t, txns)
+	require.False(t, account.DueSchedules(now))
+}
+
+func TestMonthlySchedule(t *testing.T) {
+	start := time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)
+	now := start
+	account := NewAccount(0, WithClock(func() time.Time { return now }))
+
+	_, err := account.AddSchedule(apd.New(1, 0), "", CadenceMonthly, start, nil)
+
+	require.NoError(t, err)
+
+	var next []time.Time
+
+	for i := 0; i < 3; i++ {
+		_, err := account.RunSchedules(ctx, now)
+
+		require.NoError(t, err)
+
+		s, err := account.Schedule(1)
+
+		require.NoError(t, err)
+
+		now = *s.Next
+		next = append(next, now)
+	}
+
+	// Shorter months run on their last day
+	require.Equal(t, []time.Time{
+		time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.April, 30, 0, 0, 0, 0, time.UTC),
+	}, next)
+}
+
+func TestScheduleJSON(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 9, 0, 0, 0, time.UTC)
+	account := NewAccount(0, WithClock(func() time.Time { return now }))
+
+	_, err := account.AddSchedule(apd.New(125, -1), "", CadenceWeekly, time.Time{}, nil)
+
+	require.NoError(t, err)
+
+	clone := account.Clone()
+	clone.Schedules[1].Amount.SetInt64(1)
+
+	require.Zero(t, account.Schedules[1].Amount.Cmp(apd.New(125, -1)))
+
+	b, err := json.Marshal(account.Schedules[1])
+
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":1,"amount":"12.5","currency":"GBP","cadence":"WEEK","start":"2018-06-01T09:00:00Z","next":"2018-06-01T09:00:00Z","executions":0}`, string(b))
+
+	var restored Account
+
+	b, err = json.Marshal(account)
+
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &restored))
+	require.Equal(t, CadenceWeekly, restored.Schedules[1].Cadence)
+	require.Equal(t, 1, restored.LastScheduleID)
+}
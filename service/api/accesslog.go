@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+var (
+	accessSample uint
+	accessCount  uint64
+)
+
+func init() {
+	flag.UintVar(&accessSample, "log-sample", 1, "Log one in N successful requests, 0 for none; failed requests are always logged")
+}
+
+// accessRecorder captures the response status, size and reported error for
+// the access log.
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	err    error
+}
+
+func (rec *accessRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *accessRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+
+	return n, err
+}
+
+// recordError reports the error behind a response in the access log.
+func recordError(w http.ResponseWriter, err error) {
+	rec, ok := w.(*accessRecorder)
+
+	if ok {
+		rec.err = err
+	}
+}
+
+// accessLog logs each request with its status, latency, response size,
+// request ID and account ID. Failed requests are logged with their error.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &accessRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if rec.status < http.StatusBadRequest && rec.err == nil && !sampled() {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rec.status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", rec.bytes),
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+		if err == nil {
+			fields = append(fields, zap.Int("account", id))
+		}
+
+		if rec.err != nil {
+			fields = append(fields, zap.Error(rec.err))
+			e, ok := rec.err.(*requestError)
+
+			if ok && e.reason != nil {
+				fields = append(fields, zap.NamedError("reason", e.reason))
+			}
+		}
+
+		log := requestLogger(r)
+
+		switch {
+		case rec.status >= http.StatusInternalServerError || rec.err != nil && rec.status < http.StatusBadRequest:
+			log.Error("Request", fields...)
+		case rec.status >= http.StatusBadRequest:
+			log.Warn("Request", fields...)
+		default:
+			log.Info("Request", fields...)
+		}
+	})
+}
+
+// sampled reports whether a successful request is logged.
+func sampled() bool {
+	if accessSample == 0 {
+		return false
+	}
+
+	return atomic.AddUint64(&accessCount, 1)%uint64(accessSample) == 0
+}
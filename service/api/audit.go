@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"go.uber.org/zap"
+)
+
+var auditFile string
+
+func init() {
+	flag.StringVar(&auditFile, "audit", "./audit.ndjson", "Append-only NDJSON audit log of mutating API requests")
+}
+
+// auditEntry records a mutating API request: who made it, when, against
+// which endpoint and account, and its outcome.
+type auditEntry struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Subject   string    `json:"subject,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	AccountID *int      `json:"accountID,omitempty"`
+	Amount    string    `json:"amount,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+	ErrorCode card.Code `json:"errorCode,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+}
+
+// auditPage represents a page of the audit log.
+type auditPage struct {
+	Entries []auditEntry `json:"entries"`
+
+	// Total is the number of entries matching the filter on all pages.
+	Total int `json:"total"`
+
+	// NextCursor is the cursor of the next page, or zero on the last page.
+	NextCursor int `json:"nextCursor,omitempty"`
+}
+
+// auditFilter selects audit entries; zero fields match every entry.
+type auditFilter struct {
+	AccountID *int
+	Subject   string
+	From      time.Time
+	To        time.Time
+}
+
+// match reports whether the entry matches the filter. The time range
+// includes its start and excludes its end.
+func (f auditFilter) match(e auditEntry) bool {
+	switch {
+	case f.AccountID != nil && (e.AccountID == nil || *e.AccountID != *f.AccountID):
+		return false
+	case f.Subject != "" && e.Subject != f.Subject:
+		return false
+	case !f.From.IsZero() && e.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Timestamp.Before(f.To):
+		return false
+	}
+
+	return true
+}
+
+// auditLog is the append-only audit store, kept apart from the account
+// transaction logs. Entries are written as JSON lines, encrypted if
+// encryption is enabled, and only rewritten to re-encrypt them.
+type auditLog struct {
+	mu       sync.Mutex
+	filename string
+	f        *os.File
+	lastID   int
+
+	// syncMu serializes syncs; entries appended during a sync are synced
+	// together by the next one
+	syncMu sync.Mutex
+	synced int
+}
+
+var audit = &auditLog{}
+
+// openAuditLog opens the audit log at the given path, creating it if needed,
+// and resumes entry IDs after the last recorded entry.
+func openAuditLog(filename string) (*auditLog, error) {
+	l := &auditLog{filename: filename}
+
+	f, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	err = scanAudit(f, func(e auditEntry) {
+		l.lastID = e.ID
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.synced = l.lastID
+
+	return l, nil
+}
+
+// scanAudit decodes each audit entry from the reader in order, decrypting
+// entries if needed.
+func scanAudit(r io.Reader, fn func(auditEntry)) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		b, err := unsealLine(s.Bytes())
+
+		if err != nil {
+			return err
+		}
+
+		var e auditEntry
+
+		err = json.Unmarshal(b, &e)
+
+		if err != nil {
+			return err
+		}
+
+		fn(e)
+	}
+
+	return s.Err()
+}
+
+// append assigns the next entry ID and appends the entry to the log,
+// encrypted if encryption is enabled, syncing it to disk before returning.
+// Concurrent appends share syncs.
+func (l *auditLog) append(e auditEntry) error {
+	id, err := l.write(e)
+
+	if err != nil {
+		return err
+	}
+
+	return l.sync(id)
+}
+
+// write assigns the next entry ID and writes the entry to the log, returning
+// its ID.
+func (l *auditLog) write(e auditEntry) (int, error) {
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		f, err := os.OpenFile(l.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+		if err != nil {
+			return 0, err
+		}
+
+		l.f = f
+	}
+
+	e.ID = l.lastID + 1
+	b, err := json.Marshal(e)
+
+	if err == nil {
+		b, err = sealLine(b)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = l.f.Write(append(b, '\n'))
+
+	if err != nil {
+		return 0, err
+	}
+
+	l.lastID = e.ID
+
+	return e.ID, nil
+}
+
+// sync syncs the log to disk unless the entry with the given ID already is,
+// along with every entry written before the sync starts.
+func (l *auditLog) sync(id int) error {
+	l.syncMu.Lock()
+
+	defer l.syncMu.Unlock()
+
+	if l.synced >= id {
+		return nil
+	}
+
+	l.mu.Lock()
+	f, lastID := l.f, l.lastID
+	l.mu.Unlock()
+
+	err := f.Sync()
+
+	if err != nil {
+		return err
+	}
+
+	l.synced = lastID
+
+	return nil
+}
+
+// rewrite atomically replaces the log with its entries encrypted with the
+// active key, or decrypted when encryption is disabled. It's the only
+// rewrite of the log, made when re-encrypting the data.
+func (l *auditLog) rewrite() error {
+	if l.filename == "" {
+		return nil
+	}
+
+	l.syncMu.Lock()
+
+	defer l.syncMu.Unlock()
+
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	var entries []auditEntry
+
+	f, err := os.Open(l.filename)
+
+	if err != nil {
+		return err
+	}
+
+	err = scanAudit(f, func(e auditEntry) {
+		entries = append(entries, e)
+	})
+
+	f.Close()
+
+	if err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(l.filename)
+	tmp, err := ioutil.TempFile(dir, "."+base+".")
+
+	if err != nil {
+		return err
+	}
+
+	// Removing the temporary file fails harmlessly once it's renamed
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+
+	for _, v := range entries {
+		b, err := json.Marshal(v)
+
+		if err == nil {
+			b, err = sealLine(b)
+		}
+
+		if err == nil {
+			_, err = w.Write(append(b, '\n'))
+		}
+
+		if err != nil {
+			tmp.Close()
+
+			return err
+		}
+	}
+
+	err = w.Flush()
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	err = tmp.Close()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), l.filename)
+
+	if err != nil {
+		return err
+	}
+
+	// Appends continue on the rewritten log
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+
+	l.synced = l.lastID
+
+	return syncDir(dir)
+}
+
+// open opens the log for reading, returning its size. Entries are written
+// whole under l.mu, so the log holds complete entries up to the size, and
+// entries appended later are beyond it.
+func (l *auditLog) open() (*os.File, int64, error) {
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.filename)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// page returns up to limit entries matching the given filter with IDs
+// greater than the given cursor. The log is scanned up to its size when the
+// page is requested, without blocking appends.
+func (l *auditLog) page(cursor, limit int, filter auditFilter) (*auditPage, error) {
+	f, size, err := l.open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if limit <= 0 {
+		limit = card.DefaultPageLimit
+	}
+
+	page := &auditPage{Entries: []auditEntry{}}
+
+	err = scanAudit(io.LimitReader(f, size), func(e auditEntry) {
+		if !filter.match(e) {
+			return
+		}
+
+		page.Total++
+
+		if e.ID <= cursor {
+			return
+		}
+
+		if len(page.Entries) == limit {
+			page.NextCursor = page.Entries[limit-1].ID
+
+			return
+		}
+
+		page.Entries = append(page.Entries, e)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+type auditKey struct{}
+
+// auditTrail records every mutating request in the audit log once it has
+// been handled, along with requests of any method refused as unauthenticated
+// or forbidden. It runs before authentication so refused tokens are
+// recorded. The amount, currency and account ID are taken from the route and
+// request body, limited to the maximum body size, when present.
+func auditTrail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutating := true
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			mutating = false
+		}
+
+		// Share the access log recorder so errors are reported to both
+		rec, ok := w.(*accessRecorder)
+
+		if !ok {
+			rec = &accessRecorder{ResponseWriter: w}
+		}
+
+		// The token claims are recorded by authenticate
+		e := &auditEntry{}
+
+		if mutating && r.Body != nil {
+			b, err := ioutil.ReadAll(http.MaxBytesReader(rec, r.Body, maxBodyBytes))
+
+			if err != nil {
+				status := http.StatusBadRequest
+				_, tooLarge := err.(*http.MaxBytesError)
+
+				if tooLarge {
+					status = http.StatusRequestEntityTooLarge
+				}
+
+				writeError(rec, status, &requestError{err})
+				recordAudit(r, rec, e)
+
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+			var body struct {
+				ID       *int   `json:"id"`
+				Amount   string `json:"amount"`
+				Currency string `json:"currency"`
+			}
+
+			// Bodies other than a single object, e.g. batches, are recorded
+			// without an amount
+			json.Unmarshal(b, &body)
+
+			e.Amount, e.Currency = body.Amount, body.Currency
+
+			if strings.HasSuffix(r.URL.Path, "/accounts") {
+				e.AccountID = body.ID
+			}
+		}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, e)))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if mutating || rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden {
+			recordAudit(r, rec, e)
+		}
+	})
+}
+
+// recordAudit completes the audit entry of the handled request and appends
+// it to the audit log.
+func recordAudit(r *http.Request, rec *accessRecorder, e *auditEntry) {
+	e.Timestamp = time.Now().UTC()
+	e.Method = r.Method
+	e.Path = r.URL.Path
+	e.Status = rec.status
+	e.Outcome = "success"
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err == nil {
+		e.AccountID = &id
+	}
+
+	if rec.status >= http.StatusBadRequest {
+		e.Outcome = "failure"
+	}
+
+	if rec.err != nil {
+		e.ErrorCode = newErrorBody(rec.err).Code
+	}
+
+	e.RequestID, _ = r.Context().Value(requestIDKey{}).(string)
+
+	err = audit.append(*e)
+
+	if err != nil {
+		requestLogger(r).Error("Failed to record audit entry", zap.Error(err))
+	}
+}
+
+// auditClaims records the subject and role of the verified token claims in
+// the request's audit entry.
+func auditClaims(r *http.Request, c *claims) {
+	e, ok := r.Context().Value(auditKey{}).(*auditEntry)
+
+	if ok {
+		e.Subject, e.Role = c.Subject, c.Role
+	}
+}
+
+// auditQuery parses the audit log filter from the account, subject, from
+// and to query parameters.
+func auditQuery(r *http.Request) (auditFilter, error) {
+	var (
+		f   auditFilter
+		q   = r.URL.Query()
+		err error
+	)
+
+	account := q.Get("account")
+
+	if account != "" {
+		id, err := strconv.Atoi(account)
+
+		if err != nil {
+			return f, err
+		}
+
+		f.AccountID = &id
+	}
+
+	f.Subject = q.Get("subject")
+	from := q.Get("from")
+
+	if from != "" {
+		f.From, err = time.Parse(time.RFC3339, from)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	to := q.Get("to")
+
+	if to != "" {
+		f.To, err = time.Parse(time.RFC3339, to)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+func getAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditQuery(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	cursor, limit, _, err := pageParams(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	page, err := audit.page(cursor, limit, filter)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
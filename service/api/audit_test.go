@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestAudit replaces the audit log with one in a temporary directory,
+// returning a function restoring the previous log.
+func useTestAudit(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	l, err := openAuditLog(filepath.Join(dir, "audit.ndjson"))
+
+	require.NoError(t, err)
+
+	previous := audit
+	audit = l
+
+	return func() {
+		audit = previous
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	defer useTestStore(t)()
+	defer useTestAudit(t)()
+
+	previousSecret, previousMax := jwtSecret, maxBodyBytes
+	jwtSecret, maxBodyBytes = testSecret, 64
+
+	defer func() {
+		jwtSecret, maxBodyBytes = previousSecret, previousMax
+	}()
+
+	r := chi.NewRouter()
+	r.Use(auditTrail)
+	r.Use(authenticate)
+	r.With(allow(roleAdmin)).Get("/accounts", getAccounts)
+	r.With(allow(roleAdmin)).Post("/accounts", createAccount)
+
+	admin := signToken(t, "HS256", claims{Subject: "alice", Role: roleAdmin}, testSecret)
+	cardholder := signToken(t, "HS256", claims{Subject: "bob", Role: roleCardholder, AccountID: 1}, testSecret)
+	do := func(method, token, body string) int {
+		req := httptest.NewRequest(method, "/accounts", strings.NewReader(body))
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "", `{"id":1}`))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "invalid", ""))
+	require.Equal(t, http.StatusForbidden, do(http.MethodGet, cardholder, ""))
+	require.Equal(t, http.StatusOK, do(http.MethodGet, admin, ""))
+	require.Equal(t, http.StatusOK, do(http.MethodPost, admin, `{"id":1}`))
+	require.Equal(t, http.StatusRequestEntityTooLarge, do(http.MethodPost, admin, `{"id":2,"currency":"`+strings.Repeat("X", 64)+`"}`))
+
+	page, err := audit.page(0, 0, auditFilter{})
+
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 5, "refused requests of any method and mutating requests")
+
+	for i, v := range []struct {
+		method  string
+		subject string
+		status  int
+		code    string
+	}{
+		{http.MethodPost, "", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{http.MethodGet, "", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{http.MethodGet, "bob", http.StatusForbidden, "FORBIDDEN"},
+		{http.MethodPost, "alice", http.StatusOK, ""},
+		{http.MethodPost, "", http.StatusRequestEntityTooLarge, "INVALID_REQUEST"},
+	} {
+		e := page.Entries[i]
+
+		require.Equal(t, v.method, e.Method, i)
+		require.Equal(t, v.subject, e.Subject, i)
+		require.Equal(t, v.status, e.Status, i)
+		require.Equal(t, v.code, string(e.ErrorCode), i)
+	}
+
+	require.Equal(t, 1, *page.Entries[3].AccountID)
+	require.Equal(t, "success", page.Entries[3].Outcome)
+	require.Equal(t, "failure", page.Entries[0].Outcome)
+}
+
+func TestAuditAppend(t *testing.T) {
+	defer useTestAudit(t)()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			require.NoError(t, audit.append(auditEntry{Method: http.MethodPost, Path: "/v1/accounts"}))
+		}()
+
+		// Pages read while entries are appended see complete entries only
+		go func() {
+			defer wg.Done()
+
+			page, err := audit.page(0, 100, auditFilter{})
+
+			require.NoError(t, err)
+
+			for i, v := range page.Entries {
+				require.Equal(t, i+1, v.ID)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	page, err := audit.page(0, 100, auditFilter{})
+
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 20)
+
+	for i, v := range page.Entries {
+		require.Equal(t, i+1, v.ID)
+	}
+
+	require.Equal(t, 20, audit.synced, "concurrent appends synced")
+
+	l, err := openAuditLog(audit.filename)
+
+	require.NoError(t, err)
+	require.Equal(t, 20, l.lastID)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// Token roles.
+const (
+	roleCardholder = "cardholder"
+	roleMerchant   = "merchant"
+	roleAdmin      = "admin"
+)
+
+// Authentication errors.
+var (
+	errUnauthorized = &card.Error{Code: "UNAUTHORIZED", Message: "missing or invalid bearer token"}
+	errForbidden    = &card.Error{Code: "FORBIDDEN", Message: "operation not permitted for token"}
+)
+
+var jwtSecret string
+
+func init() {
+	flag.StringVar(&jwtSecret, "jwt-secret", "", "JWT HS256 secret; authentication is disabled when empty")
+}
+
+type claimsKey struct{}
+
+// claims holds the verified bearer token claims. Cardholder tokens are
+// scoped to a single account, and merchant tokens to a single merchant.
+type claims struct {
+	Subject    string `json:"sub"`
+	Role       string `json:"role"`
+	AccountID  int    `json:"accountID"`
+	MerchantID *int   `json:"merchantID"`
+	ExpiresAt  int64  `json:"exp"`
+	NotBefore  int64  `json:"nbf"`
+}
+
+// authenticate verifies the request bearer token and stores its claims in the
+// request context. Authentication is disabled when no secret is configured.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if jwtSecret == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		token := r.Header.Get("Authorization")
+
+		if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, errorStatus(errUnauthorized), errUnauthorized)
+
+			return
+		}
+
+		c, err := parseToken(strings.TrimSpace(token[7:]), []byte(jwtSecret), time.Now())
+
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, errorStatus(err), err)
+
+			return
+		}
+
+		auditClaims(r, c)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, c)))
+	})
+}
+
+// allow restricts a route to the given roles. Cardholder tokens are further
+// limited to routes for their own account, and merchant tokens to routes for
+// their own merchant.
+func allow(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if jwtSecret == "" {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			c, ok := r.Context().Value(claimsKey{}).(*claims)
+
+			if !ok {
+				writeError(w, errorStatus(errUnauthorized), errUnauthorized)
+
+				return
+			}
+
+			if !c.permits(roles, chi.URLParam(r, "id"), chi.URLParam(r, "merchantID")) {
+				writeError(w, errorStatus(errForbidden), errors.Wrapf(errForbidden, "role %q", c.Role))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// permits reports whether the claims grant access to a route restricted to
+// the given roles and, for account and merchant routes, the given account or
+// merchant ID.
+func (c *claims) permits(roles []string, accountID, merchantID string) bool {
+	for _, v := range roles {
+		if v != c.Role {
+			continue
+		}
+
+		switch {
+		case c.Role == roleCardholder && accountID != "":
+			return accountID == strconv.Itoa(c.AccountID)
+		case c.Role == roleMerchant && merchantID != "":
+			return c.MerchantID != nil && merchantID == strconv.Itoa(*c.MerchantID)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// checkMerchant returns errForbidden if the request was made with a merchant
+// token for a merchant other than the given one. Operations on
+// authorizations and mandates are checked before they're applied, as their
+// merchant isn't part of the route.
+func checkMerchant(r *http.Request, merchantID int) error {
+	c, ok := r.Context().Value(claimsKey{}).(*claims)
+
+	if !ok || c.Role != roleMerchant || (c.MerchantID != nil && *c.MerchantID == merchantID) {
+		return nil
+	}
+
+	return errors.Wrapf(errForbidden, "merchant %d", merchantID)
+}
+
+// parseToken verifies an HS256 signed JWT and returns its claims.
+func parseToken(token string, secret []byte, now time.Time) (*claims, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, errors.Wrap(errUnauthorized, "malformed token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+
+	err := decodeSegment(parts[0], &header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Algorithm != "HS256" {
+		return nil, errors.Wrapf(errUnauthorized, "unsupported algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, errors.Wrap(errUnauthorized, "malformed signature")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.Wrap(errUnauthorized, "invalid signature")
+	}
+
+	c := &claims{}
+	err = decodeSegment(parts[1], c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt:
+		return nil, errors.Wrap(errUnauthorized, "token expired")
+	case c.NotBefore != 0 && now.Unix() < c.NotBefore:
+		return nil, errors.Wrap(errUnauthorized, "token not yet valid")
+	}
+
+	switch c.Role {
+	case roleCardholder, roleAdmin:
+	case roleMerchant:
+		if c.MerchantID == nil {
+			return nil, errors.Wrap(errUnauthorized, "merchant token without a merchant ID")
+		}
+	default:
+		return nil, errors.Wrapf(errUnauthorized, "unknown role %q", c.Role)
+	}
+
+	return c, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON token segment.
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return errors.Wrap(errUnauthorized, "malformed token")
+	}
+
+	err = json.Unmarshal(b, v)
+
+	if err != nil {
+		return errors.Wrap(errUnauthorized, "malformed token")
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "secret"
+
+// signToken returns a JWT of the given claims signed with the given
+// algorithm header and secret.
+func signToken(t *testing.T, alg string, v interface{}, secret string) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(v)
+
+	require.NoError(t, err)
+
+	s := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(s))
+
+	return s + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseToken(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	merchant := 7
+
+	for _, v := range []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{"Valid", signToken(t, "HS256", claims{Subject: "a", Role: roleAdmin, ExpiresAt: now.Unix() + 1, NotBefore: now.Unix()}, testSecret), ""},
+		{"Merchant", signToken(t, "HS256", claims{Role: roleMerchant, MerchantID: &merchant}, testSecret), ""},
+		{"Algorithm", signToken(t, "none", claims{Role: roleAdmin}, testSecret), "unsupported algorithm"},
+		{"Signature", signToken(t, "HS256", claims{Role: roleAdmin}, "other"), "invalid signature"},
+		{"Expired", signToken(t, "HS256", claims{Role: roleAdmin, ExpiresAt: now.Unix()}, testSecret), "token expired"},
+		{"NotBefore", signToken(t, "HS256", claims{Role: roleAdmin, NotBefore: now.Unix() + 1}, testSecret), "not yet valid"},
+		{"Role", signToken(t, "HS256", claims{Role: "root"}, testSecret), "unknown role"},
+		{"MerchantID", signToken(t, "HS256", claims{Role: roleMerchant}, testSecret), "without a merchant ID"},
+		{"Malformed", "a.b", "malformed token"},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			c, err := parseToken(v.token, []byte(testSecret), now)
+
+			if v.reason == "" {
+				require.NoError(t, err)
+				require.NotNil(t, c)
+
+				return
+			}
+
+			require.Error(t, err)
+			require.Equal(t, errUnauthorized, errors.Cause(err))
+			require.Contains(t, err.Error(), v.reason)
+		})
+	}
+
+	t.Run("Tampered", func(t *testing.T) {
+		token := signToken(t, "HS256", claims{Role: roleCardholder, AccountID: 1}, testSecret)
+		parts := strings.Split(token, ".")
+		payload, err := json.Marshal(claims{Role: roleAdmin})
+
+		require.NoError(t, err)
+
+		parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+		_, err = parseToken(strings.Join(parts, "."), []byte(testSecret), now)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid signature")
+	})
+}
+
+func TestPermits(t *testing.T) {
+	merchant := 7
+	admin := &claims{Role: roleAdmin}
+	cardholder := &claims{Role: roleCardholder, AccountID: 1}
+	m := &claims{Role: roleMerchant, MerchantID: &merchant}
+	own := []string{roleAdmin, roleCardholder}
+	all := []string{roleAdmin, roleCardholder, roleMerchant}
+
+	require.True(t, admin.permits([]string{roleAdmin}, "2", ""))
+	require.False(t, cardholder.permits([]string{roleAdmin}, "", ""))
+	require.True(t, cardholder.permits(own, "1", ""))
+	require.False(t, cardholder.permits(own, "2", ""), "another account")
+	require.True(t, cardholder.permits(all, "", "7"))
+	require.False(t, m.permits(own, "1", ""))
+	require.True(t, m.permits(all, "1", ""), "merchants aren't scoped to accounts")
+	require.True(t, m.permits(all, "", "7"))
+	require.False(t, m.permits(all, "", "8"), "another merchant")
+	require.False(t, (&claims{Role: roleMerchant}).permits(all, "", "7"))
+}
+
+func TestMerchantScope(t *testing.T) {
+	defer useTestStore(t)()
+
+	previous := jwtSecret
+	jwtSecret = testSecret
+
+	defer func() {
+		jwtSecret = previous
+	}()
+
+	ctx := context.Background()
+
+	var au, other *card.Authorization
+
+	require.NoError(t, store.CreateAccount(ctx, card.NewAccount(1)))
+	require.NoError(t, store.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		err := a.Load(ctx, apd.New(100, 0), card.DefaultCurrency)
+
+		if err == nil {
+			au, err = a.Authorize(ctx, 7, apd.New(10, 0), card.DefaultCurrency)
+		}
+
+		if err == nil {
+			other, err = a.Authorize(ctx, 8, apd.New(10, 0), card.DefaultCurrency)
+		}
+
+		return err
+	}))
+
+	r := chi.NewRouter()
+	r.Use(authenticate)
+	r.With(allow(roleAdmin, roleMerchant)).Post("/accounts/{id}/capture", capture)
+
+	merchant := 7
+	token := signToken(t, "HS256", claims{Role: roleMerchant, MerchantID: &merchant}, testSecret)
+	post := func(authorizationID int) int {
+		body := `{"authorizationID":` + strconv.Itoa(authorizationID) + `,"amount":"5"}`
+		req := httptest.NewRequest(http.MethodPost, "/accounts/1/capture", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusForbidden, post(other.ID))
+	require.Equal(t, http.StatusOK, post(au.ID))
+
+	account, err := store.GetAccount(ctx, 1)
+
+	require.NoError(t, err)
+	require.True(t, account.Authorizations[other.ID].Captured.IsZero(), "not captured by another merchant")
+	require.Zero(t, account.Authorizations[au.ID].Captured.Cmp(apd.New(5, 0)))
+}
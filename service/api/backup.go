@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+var backupDir string
+
+func init() {
+	flag.StringVar(&backupDir, "backup-dir", "", "Directory backups are written to and restored from; backups are downloaded when empty")
+}
+
+// errBackupNotFound is returned when restoring a backup file that doesn't
+// exist.
+var errBackupNotFound = &card.Error{Code: "BACKUP_NOT_FOUND", Message: "backup not found"}
+
+// archive is a point-in-time backup of the accounts, their events awaiting
+// publication, the merchant registry, the webhook subscriptions and the
+// settlement batches, independent of the account store. Backups taken before
+// settlement batches were archived have none.
+type archive struct {
+	Schema      int             `json:"schema"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Accounts    []*card.Account `json:"accounts"`
+	Outbox      *eventOutbox    `json:"outbox"`
+	Merchants   json.RawMessage `json:"merchants"`
+	Webhooks    json.RawMessage `json:"webhooks"`
+	Settlements json.RawMessage `json:"settlements,omitempty"`
+}
+
+// backupInfo describes a backup taken or restored.
+type backupInfo struct {
+	File      string    `json:"file,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Accounts  int       `json:"accounts"`
+}
+
+// takeBackup returns a backup of the service's state. The merchant registry,
+// webhook subscriptions and settlement batches are copied while account
+// transactions are blocked, so the backup is consistent.
+func takeBackup(ctx context.Context) (*archive, error) {
+	a := &archive{Schema: schemaVersion, Outbox: newEventOutbox()}
+
+	var err error
+
+	snapshotErr := store.Snapshot(ctx, func(accounts []*card.Account, events []outboxEvent) {
+		a.CreatedAt = time.Now().UTC()
+		a.Accounts = accounts
+		a.Outbox.restore(events)
+		a.Merchants, err = json.Marshal(merchants)
+
+		if err == nil {
+			a.Webhooks, err = json.Marshal(webhooks)
+		}
+
+		if err == nil {
+			a.Settlements, err = json.Marshal(settlements)
+		}
+	})
+
+	if snapshotErr != nil {
+		return nil, snapshotErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// readBackup decodes and validates the backup read from r, encrypted or not.
+// Invalid backups are reported as request errors.
+func readBackup(r io.Reader) (*archive, error) {
+	r, err := unsealReader(r)
+
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	a := &archive{Outbox: newEventOutbox()}
+
+	err = json.NewDecoder(r).Decode(a)
+
+	if err == nil {
+		err = validateBackup(a)
+	}
+
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	return a, nil
+}
+
+// validateBackup validates the accounts of the given backup, migrating those
+// of backups taken by earlier versions, and checks its merchant registry,
+// webhook subscriptions and settlement batches decode.
+func validateBackup(a *archive) error {
+	err := checkSchema(a.Schema)
+
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(a.Accounts))
+
+	for _, v := range a.Accounts {
+		if v == nil {
+			return errors.New("null account")
+		}
+
+		if seen[v.ID] {
+			return errors.Errorf("duplicate account %d", v.ID)
+		}
+
+		seen[v.ID] = true
+
+		err := migrateAccount(v, a.Schema)
+
+		if err == nil {
+			err = v.Validate()
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "account %d", v.ID)
+		}
+	}
+
+	err = json.Unmarshal(a.Merchants, card.NewMerchantRegistry())
+
+	if err != nil {
+		return errors.Wrap(err, "merchants")
+	}
+
+	err = json.Unmarshal(a.Webhooks, &webhookRegistry{})
+
+	if err != nil {
+		return errors.Wrap(err, "webhooks")
+	}
+
+	if a.Settlements != nil {
+		err = json.Unmarshal(a.Settlements, &settlementRegistry{})
+
+		if err != nil {
+			return errors.Wrap(err, "settlements")
+		}
+	}
+
+	return nil
+}
+
+// restoreBackup replaces the service's state with the given backup. The
+// accounts are restored first; the merchant registry and webhook
+// subscriptions are only replaced once they're persisted. Settlement runs
+// wait for the restore, and the settlement batches are restored with the
+// accounts' settled totals, so no capture is settled twice; backups without
+// settlement batches keep the current ones.
+func restoreBackup(ctx context.Context, a *archive) error {
+	settleMu.Lock()
+
+	defer settleMu.Unlock()
+
+	err := store.Restore(ctx, a.Accounts, a.Outbox.committed())
+
+	if err != nil {
+		return err
+	}
+
+	if a.Settlements != nil {
+		err = restoreSettlements(a.Settlements)
+	} else {
+		logger.Warn("Backup without settlement batches, keeping the current batches")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = restoreMerchants(a.Merchants)
+
+	if err != nil {
+		return err
+	}
+
+	var v webhookRegistryJSON
+
+	err = json.Unmarshal(a.Webhooks, &v)
+
+	if err != nil {
+		return err
+	}
+
+	return webhooks.change(func(current *webhookRegistryJSON) (bool, error) {
+		*current = v
+
+		return true, nil
+	})
+}
+
+// restoreMerchants persists the given merchant registry, then replaces the
+// registry's merchants; the registry itself is kept, as accounts share it.
+func restoreMerchants(data json.RawMessage) error {
+	r := card.NewMerchantRegistry()
+	err := json.Unmarshal(data, r)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeDB(merchantsFile, r)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, merchants)
+}
+
+// restoreSettlements persists the given settlement batches, then replaces
+// the registry's. It must be called with settleMu held.
+func restoreSettlements(data json.RawMessage) error {
+	r := &settlementRegistry{}
+	err := json.Unmarshal(data, r)
+
+	if err != nil {
+		return err
+	}
+
+	return settlements.write(settlementRegistryJSON{r.lastID, r.batches})
+}
+
+// backupFilename returns the name of the backup file for a backup taken at
+// the given time.
+func backupFilename(t time.Time) string {
+	return "card-" + t.Format("20060102T150405.000000000Z") + ".json"
+}
+
+func backupStore(w http.ResponseWriter, r *http.Request) {
+	a, err := takeBackup(r.Context())
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	name := backupFilename(a.CreatedAt)
+	info := backupInfo{CreatedAt: a.CreatedAt, Accounts: len(a.Accounts)}
+
+	if backupDir == "" || r.URL.Query().Get("download") == "true" {
+		b, err := json.Marshal(a)
+
+		if err == nil {
+			b, err = seal(append(b, '\n'))
+		}
+
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		contentType := "application/json; charset=utf-8"
+
+		if keys != nil {
+			contentType = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+
+		return
+	}
+
+	err = os.MkdirAll(backupDir, 0700)
+
+	if err == nil {
+		err = writeDB(filepath.Join(backupDir, name), a)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	info.File = name
+
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// restoreStore restores the backup in the request body or, given the file
+// query parameter, the named backup in the backup directory.
+func restoreStore(w http.ResponseWriter, r *http.Request) {
+	var (
+		body = io.Reader(r.Body)
+		name = r.URL.Query().Get("file")
+	)
+
+	if name != "" {
+		if backupDir == "" || name != filepath.Base(name) {
+			err := &requestError{errors.Errorf("invalid backup file %q", name)}
+			writeError(w, errorStatus(err), err)
+
+			return
+		}
+
+		f, err := os.Open(filepath.Join(backupDir, name))
+
+		if os.IsNotExist(err) {
+			writeError(w, errorStatus(errBackupNotFound), errBackupNotFound)
+
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		defer f.Close()
+
+		body = f
+	}
+
+	a, err := readBackup(body)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	err = restoreBackup(r.Context(), a)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, backupInfo{File: name, CreatedAt: a.CreatedAt, Accounts: len(a.Accounts)})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// registryState returns the JSON encoding of the merchant registry, webhook
+// subscriptions and settlement batches.
+func registryState(t *testing.T) string {
+	b, err := json.Marshal([]interface{}{merchants, webhooks, settlements})
+
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func TestBackup(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+	defer useTestSettlements(dir)()
+
+	previousStore, previousMerchants, previousWebhooks := store, merchants, webhooks
+	previousFiles := []string{merchantsFile, webhooksFile}
+	merchants, webhooks = card.NewMerchantRegistry(), &webhookRegistry{}
+	merchantsFile = filepath.Join(dir, "merchants.json")
+	webhooksFile = filepath.Join(dir, "webhooks.json")
+
+	defer func() {
+		store, merchants, webhooks = previousStore, previousMerchants, previousWebhooks
+		merchantsFile, webhooksFile = previousFiles[0], previousFiles[1]
+	}()
+
+	ctx := context.Background()
+	filename := filepath.Join(dir, "db.json")
+	o := newEventOutbox()
+	s, err := openFileStore(filename, o, stageEvents(o))
+
+	require.NoError(t, err)
+
+	store = s
+
+	mutateStore(t, s)
+	require.NoError(t, merchants.Add(card.MerchantInfo{ID: 1, Name: "Shop", MCC: "5411", Country: "GB"}))
+	_, err = webhooks.add(webhook{AccountID: 1, URL: "https://example.com/hook", Events: []card.Operation{card.Load}})
+
+	require.NoError(t, err)
+
+	_, err = settle(ctx)
+
+	require.NoError(t, err)
+
+	state, registries := storeState(t, s), registryState(t)
+	a, err := takeBackup(ctx)
+
+	require.NoError(t, err)
+	require.Len(t, a.Accounts, 2)
+
+	b, err := json.Marshal(a)
+
+	require.NoError(t, err)
+
+	// Changes after the backup are discarded by restoring it, including
+	// settlements of captures the restored accounts hold unsettled
+	captureAmount(t, 2, 10)
+
+	_, err = settle(ctx)
+
+	require.NoError(t, err)
+	require.Len(t, settlements.list(), 2)
+	require.NoError(t, s.UpdateAccount(ctx, 2, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(50, 0), card.DefaultCurrency)
+	}))
+	require.NoError(t, s.DeleteAccount(ctx, 1, nil))
+	require.NoError(t, s.CreateAccount(ctx, card.NewAccount(4)))
+	require.NoError(t, merchants.Delete(1))
+	removed, err := webhooks.removeAccount(1)
+
+	require.NoError(t, err)
+	require.True(t, removed)
+	require.NotEqual(t, state, storeState(t, s))
+
+	restored, err := readBackup(bytes.NewReader(b))
+
+	require.NoError(t, err)
+
+	// Registries that fail to persist aren't restored
+	current, err := json.Marshal([]interface{}{merchants, webhooks})
+
+	require.NoError(t, err)
+
+	merchantsFile = filepath.Join(dir, "missing", "merchants.json")
+
+	require.Error(t, restoreBackup(ctx, restored))
+
+	b, err = json.Marshal([]interface{}{merchants, webhooks})
+
+	require.NoError(t, err)
+	require.Equal(t, string(current), string(b))
+
+	merchantsFile = filepath.Join(dir, "merchants.json")
+
+	require.NoError(t, restoreBackup(ctx, restored))
+	require.Equal(t, state, storeState(t, s))
+	require.Equal(t, registries, registryState(t))
+
+	// The restored state is persisted
+	require.NoError(t, s.Close())
+
+	s, err = openFileStore(filename, o, stageEvents(o))
+
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	require.Equal(t, state, storeState(t, s))
+
+	merchants, err = loadMerchants(merchantsFile)
+	webhooks, settlements = &webhookRegistry{}, &settlementRegistry{}
+
+	require.NoError(t, err)
+	require.NoError(t, loadWebhooks(webhooksFile))
+	require.NoError(t, loadSettlements(settlementsFile))
+	require.Equal(t, registries, registryState(t))
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, v := range []string{
+			`{"schema":0}`,
+			`{"schema":1,"accounts":[null],"merchants":{},"webhooks":{}}`,
+			`{"schema":1,"accounts":[{"id":1},{"id":1}],"merchants":{},"webhooks":{}}`,
+			`not json`,
+		} {
+			_, err := readBackup(strings.NewReader(v))
+
+			require.Error(t, err, v)
+			require.IsType(t, &requestError{}, err, v)
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// Batch item statuses.
+const (
+	batchCreated    = "CREATED"
+	batchApplied    = "APPLIED"
+	batchFailed     = "FAILED"
+	batchRolledBack = "ROLLED_BACK"
+	batchSkipped    = "SKIPPED"
+)
+
+// batchItem is an operation of a batch request.
+type batchItem struct {
+	transactionRequest
+	Op             card.Operation `json:"op"`
+	IdempotencyKey string         `json:"idempotencyKey"`
+}
+
+// batchResult is the outcome of a batch item.
+type batchResult struct {
+	Status        string              `json:"status"`
+	Transaction   *card.Transaction   `json:"transaction,omitempty"`
+	Authorization *card.Authorization `json:"authorization,omitempty"`
+	Error         *errorBody          `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []batchResult `json:"results"`
+}
+
+// batch applies an ordered list of operations atomically: either every
+// operation is applied and persisted or the account is left unchanged.
+func batch(w http.ResponseWriter, r *http.Request) {
+	id, err := accountID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	var items []batchItem
+
+	err = json.NewDecoder(r.Body).Decode(&items)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	var (
+		amounts = make([]*apd.Decimal, len(items))
+		opts    = make([][]card.TransactionOption, len(items))
+	)
+
+	for i, v := range items {
+		amounts[i], _, err = apd.NewFromString(v.Amount)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{errors.Wrapf(err, "item %d", i)})
+
+			return
+		}
+
+		opts[i], err = transactionOptions(v.IdempotencyKey, v.requestMetadata)
+
+		if err != nil {
+			writeError(w, errorStatus(err), errors.Wrapf(err, "item %d", i))
+
+			return
+		}
+	}
+
+	var (
+		res    = batchResponse{Results: make([]batchResult, len(items))}
+		body   json.RawMessage
+		failed bool
+	)
+
+	err = store.UpdateAccount(r.Context(), id, func(account *card.Account) error {
+		err := checkIfMatch(r, account)
+
+		if err != nil {
+			return err
+		}
+
+		for i, v := range items {
+			n := len(account.Transactions)
+			au, err := v.apply(r.Context(), account, v.Op, amounts[i], opts[i])
+
+			if err != nil {
+				failed = true
+
+				for j := range res.Results[:i] {
+					res.Results[j].Status = batchRolledBack
+				}
+
+				body := newErrorBody(err)
+				res.Results[i] = batchResult{Status: batchFailed, Error: &body}
+
+				for j := range res.Results[i+1:] {
+					res.Results[i+1+j].Status = batchSkipped
+				}
+
+				return errors.Wrapf(err, "item %d", i)
+			}
+
+			res.Results[i] = batchResult{Status: batchApplied, Authorization: au}
+
+			// Idempotent replays don't record a transaction
+			if len(account.Transactions) > n {
+				t := account.Transactions[len(account.Transactions)-1]
+				res.Results[i].Transaction = &t
+			}
+		}
+
+		res.Applied = true
+		body, err = json.Marshal(res)
+
+		return err
+	})
+
+	switch {
+	case failed:
+		recordError(w, err)
+		writeJSON(w, errorStatus(err), res)
+	case err != nil:
+		writeError(w, errorStatus(err), err)
+	default:
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// accountBatchItem is an account of a batch account creation request.
+type accountBatchItem struct {
+	ID             int    `json:"id"`
+	Currency       string `json:"currency"`
+	InitialBalance string `json:"initialBalance"`
+}
+
+// options returns the options of the account to create.
+func (v accountBatchItem) options() ([]card.Option, error) {
+	var opts []card.Option
+
+	if v.Currency != "" {
+		opts = append(opts, card.WithCurrency(strings.ToUpper(v.Currency)))
+	}
+
+	if v.InitialBalance == "" {
+		return opts, nil
+	}
+
+	d, _, err := apd.NewFromString(v.InitialBalance)
+
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	if d.Form != apd.Finite || d.Sign() <= 0 {
+		return nil, errors.Wrapf(card.ErrInvalidAmount, "%s", v.InitialBalance)
+	}
+
+	return append(opts, card.WithInitialBalance(d)), nil
+}
+
+// accountBatchResult is the outcome of an account batch item.
+type accountBatchResult struct {
+	ID      int           `json:"id"`
+	Status  string        `json:"status"`
+	Account *card.Account `json:"account,omitempty"`
+	Error   *errorBody    `json:"error,omitempty"`
+}
+
+// createAccounts creates many accounts in one request. Every item is
+// validated before any account is created; invalid items and duplicate IDs
+// are reported as failed without affecting the others.
+func createAccounts(w http.ResponseWriter, r *http.Request) {
+	var items []accountBatchItem
+
+	err := json.NewDecoder(r.Body).Decode(&items)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	var (
+		results = make([]accountBatchResult, len(items))
+		opts    = make([][]card.Option, len(items))
+		seen    = make(map[int]bool, len(items))
+	)
+
+	for i, v := range items {
+		results[i].ID = v.ID
+		_, err = store.GetAccount(r.Context(), v.ID)
+
+		switch {
+		case err == nil || seen[v.ID]:
+			err = errAccountExists
+		case errors.Cause(err) == errAccountNotFound:
+			err = nil
+		}
+
+		if err == nil {
+			opts[i], err = v.options()
+		}
+
+		seen[v.ID] = true
+
+		if err != nil {
+			body := newErrorBody(err)
+			results[i].Status = batchFailed
+			results[i].Error = &body
+		}
+	}
+
+	var created []*card.Account
+
+	for i, v := range items {
+		if results[i].Status == batchFailed {
+			continue
+		}
+
+		account := card.NewAccount(v.ID, opts[i]...)
+		err = account.Validate()
+
+		if err != nil {
+			body := newErrorBody(err)
+			results[i].Status = batchFailed
+			results[i].Error = &body
+
+			continue
+		}
+
+		created = append(created, account)
+		results[i].Status = batchCreated
+		results[i].Account = account
+	}
+
+	err = store.CreateAccount(r.Context(), created...)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// envPrefix prefixes the environment variables overriding settings, e.g.
+// CARD_READ_TIMEOUT for -read-timeout.
+const envPrefix = "CARD_"
+
+var (
+	configFile  string
+	printConfig bool
+)
+
+// flagAliases maps the short flags of earlier versions to their settings.
+var flagAliases = map[string]string{
+	"a": "addr",
+	"d": "db",
+	"e": "sweep-interval",
+	"j": "jwt-secret",
+	"m": "merchants",
+	"p": "precision",
+	"r": "rounding",
+}
+
+// secretSettings are redacted when the configuration is printed.
+var secretSettings = map[string]bool{
+	"jwt-secret":      true,
+	"encryption-keys": true,
+}
+
+func init() {
+	flag.StringVar(&configFile, "config", "", "JSON configuration file")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration and exit")
+}
+
+// registerAliases registers the short flag aliases. It's called once every
+// setting is defined.
+func registerAliases() {
+	for alias, name := range flagAliases {
+		flag.Var(flag.Lookup(name).Value, alias, "Alias of -"+name)
+	}
+}
+
+// loadConfig applies the configuration file and environment variables to the
+// settings not given on the command line, then validates the result. Command
+// line flags take precedence over environment variables, which take
+// precedence over the file.
+func loadConfig() error {
+	explicit := map[string]bool{}
+
+	flag.Visit(func(f *flag.Flag) {
+		explicit[settingName(f.Name)] = true
+	})
+
+	if configFile != "" {
+		err := loadConfigFile(configFile, explicit)
+
+		if err != nil {
+			return errors.Wrapf(err, "config file %s", configFile)
+		}
+	}
+
+	var err error
+
+	visitSettings(func(f *flag.Flag) {
+		v, exists := os.LookupEnv(envName(f.Name))
+
+		if !exists || explicit[f.Name] || err != nil {
+			return
+		}
+
+		err = errors.Wrapf(f.Value.Set(v), "environment variable %s", envName(f.Name))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return validateConfig()
+}
+
+// loadConfigFile applies the settings of a JSON object keyed by setting name.
+func loadConfigFile(filename string, explicit map[string]bool) error {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var settings map[string]interface{}
+
+	d := json.NewDecoder(f)
+	d.UseNumber()
+	err = d.Decode(&settings)
+
+	if err != nil {
+		return err
+	}
+
+	for k, v := range settings {
+		name := settingName(k)
+		setting := flag.Lookup(name)
+
+		if setting == nil || !isSetting(name) {
+			return errors.Errorf("unknown setting %q", k)
+		}
+
+		if explicit[name] {
+			continue
+		}
+
+		err = setting.Value.Set(fmt.Sprint(v))
+
+		if err != nil {
+			return errors.Wrapf(err, "setting %q", k)
+		}
+	}
+
+	return nil
+}
+
+// validateConfig checks the settings are consistent.
+func validateConfig() error {
+	_, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return errors.Wrap(err, "addr")
+	}
+
+	if precision == 0 {
+		return errors.New("precision must be greater than zero")
+	}
+
+	if dbFile == "" || merchantsFile == "" || webhooksFile == "" || settlementsFile == "" || auditFile == "" {
+		return errors.New("db, merchants, webhooks, settlements and audit files are required")
+	}
+
+	switch storeBackend {
+	case "dir":
+		if dbDir == "" {
+			return errors.New("the dir store requires db-dir")
+		}
+	case "journal":
+		if journalFile == "" {
+			return errors.New("the journal store requires journal")
+		}
+
+		if journalCompactSize < 0 {
+			return errors.New("journal-compact-size must not be negative")
+		}
+	case "file":
+	default:
+		return errors.Errorf("store must be dir, journal or file, not %q", storeBackend)
+	}
+
+	if durability != durabilitySync && durability != durabilityAsync {
+		return errors.Errorf("durability must be sync or async, not %q", durability)
+	}
+
+	if migrateTo != "" {
+		_, _, err = parseTarget(migrateTo)
+
+		if err != nil {
+			return errors.Wrap(err, "migrate-to")
+		}
+	}
+
+	_, err = parseKeys(encryptionKeys)
+
+	if err != nil {
+		return errors.Wrap(err, "encryption-keys")
+	}
+
+	if webhookWorkers <= 0 || webhookAttempts <= 0 {
+		return errors.New("webhook-workers and webhook-attempts must be greater than zero")
+	}
+
+	if tlsEnabled() && (tlsCert == "" || tlsKey == "") {
+		return errors.New("TLS requires both a certificate and key")
+	}
+
+	if redirectAddr != "" && !tlsEnabled() {
+		return errors.New("tls-redirect requires TLS")
+	}
+
+	if sweepInterval <= 0 {
+		return errors.New("sweep-interval must be greater than zero")
+	}
+
+	if scheduleInterval <= 0 {
+		return errors.New("schedule-interval must be greater than zero")
+	}
+
+	if maxHeaderBytes <= 0 {
+		return errors.New("max-header-bytes must be greater than zero")
+	}
+
+	if maxBodyBytes <= 0 {
+		return errors.New("max-body-bytes must be greater than zero")
+	}
+
+	for k, v := range map[string]time.Duration{
+		"read-timeout":             readTimeout,
+		"read-header-timeout":      readHeaderTimeout,
+		"write-timeout":            writeTimeout,
+		"idle-timeout":             idleTimeout,
+		"shutdown-timeout":         shutdownTimeout,
+		"journal-compact-interval": journalCompactInterval,
+		"flush-interval":           flushInterval,
+		"sweep-jitter":             sweepJitter,
+		"settlement-interval":      settlementInterval,
+	} {
+		if v < 0 {
+			return errors.Errorf("%s must not be negative", k)
+		}
+	}
+
+	return nil
+}
+
+// writeConfig writes the effective settings as a JSON configuration file,
+// redacting secrets.
+func writeConfig(w io.Writer) error {
+	settings := map[string]interface{}{}
+
+	visitSettings(func(f *flag.Flag) {
+		var v interface{} = f.Value.String()
+
+		// Durations are kept in their string form, e.g. "30s"
+		getter, ok := f.Value.(flag.Getter)
+
+		if ok {
+			_, duration := getter.Get().(time.Duration)
+
+			if !duration {
+				v = getter.Get()
+			}
+		}
+
+		if secretSettings[f.Name] && f.Value.String() != "" {
+			v = "REDACTED"
+		}
+
+		settings[f.Name] = v
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(settings)
+}
+
+// visitSettings calls fn for each setting in name order, excluding aliases
+// and the configuration flags themselves.
+func visitSettings(fn func(*flag.Flag)) {
+	var names []string
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if isSetting(f.Name) {
+			names = append(names, f.Name)
+		}
+	})
+
+	sort.Strings(names)
+
+	for _, v := range names {
+		fn(flag.Lookup(v))
+	}
+}
+
+// isSetting reports whether the named flag is a configurable setting.
+func isSetting(name string) bool {
+	_, alias := flagAliases[name]
+
+	return !alias && name != "config" && name != "print-config"
+}
+
+// settingName returns the setting name for a flag or its alias.
+func settingName(name string) string {
+	v, alias := flagAliases[name]
+
+	if alias {
+		return v
+	}
+
+	return name
+}
+
+// envName returns the environment variable overriding the given setting.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+var (
+	corsOrigins string
+	corsMethods string
+	corsHeaders string
+)
+
+func init() {
+	flag.StringVar(&corsOrigins, "cors-origins", "", "Comma-separated CORS allowed origins, or * for any; CORS is disabled when empty")
+	flag.StringVar(&corsMethods, "cors-methods", "GET,POST,PUT,DELETE", "Comma-separated CORS allowed methods")
+	flag.StringVar(&corsHeaders, "cors-headers", "Accept-Version,Authorization,Content-Type,Durability,If-Match,X-Request-ID", "Comma-separated CORS allowed request headers")
+}
+
+// corsExposedHeaders are the response headers readable by browser clients.
+const corsExposedHeaders = "API-Version, Deprecation, ETag, Link, X-Total-Count, X-Next-Cursor, X-Request-ID"
+
+// cors adds the CORS response headers for allowed origins and answers
+// preflight requests before they're routed.
+func cors(next http.Handler) http.Handler {
+	origins := splitList(corsOrigins)
+	methods := strings.Join(splitList(corsMethods), ", ")
+	headers := strings.Join(splitList(corsHeaders), ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if origin == "" || len(origins) == 0 {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		if !allowedOrigin(origins, origin) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		h.Set("Access-Control-Allow-Headers", headers)
+		h.Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedOrigin reports whether the origin is in the allowed list.
+func allowedOrigin(origins []string, origin string) bool {
+	for _, v := range origins {
+		if v == "*" || strings.EqualFold(v, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitList splits a comma-separated list, dropping empty values.
+func splitList(s string) []string {
+	var res []string
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
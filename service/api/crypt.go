@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// sealedMagic prefixes encrypted data, followed by the length of the key ID,
+// the key ID, the nonce and the AES-GCM ciphertext.
+const sealedMagic = "CARDENC1"
+
+var (
+	encryptionKeys string
+
+	// keys encrypts the persisted data, or is nil when encryption is
+	// disabled.
+	keys *keyring
+
+	// staleEncryption is set once data encrypted with a retired key, or not
+	// encrypted at all, is read while encryption is enabled.
+	staleEncryption int32
+
+	// reencrypting is set while the data is re-encrypted, so the versions
+	// replaced, readable with retired keys or not encrypted, aren't kept as
+	// backups.
+	reencrypting int32
+)
+
+func init() {
+	flag.StringVar(&encryptionKeys, "encryption-keys", "", "Comma-separated database encryption keys as ID:base64 AES key (16, 24 or 32 bytes); the first encrypts, the others only decrypt data written before a key rotation. Encryption is disabled when empty")
+}
+
+// keyring holds the AES-GCM keys by ID, along with the ID of the active key
+// encrypting new data.
+type keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// parseKeys parses the encryption keys setting, returning nil if it's empty.
+func parseKeys(s string) (*keyring, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	k := &keyring{aeads: map[string]cipher.AEAD{}}
+
+	for _, v := range strings.Split(s, ",") {
+		i := strings.IndexByte(v, ':')
+
+		if i < 0 {
+			return nil, errors.New("keys must be given as ID:base64 key")
+		}
+
+		id := strings.TrimSpace(v[:i])
+
+		if id == "" || len(id) > 255 {
+			return nil, errors.New("key IDs must be 1 to 255 bytes long")
+		}
+
+		_, exists := k.aeads[id]
+
+		if exists {
+			return nil, errors.Errorf("duplicate key %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v[i+1:]))
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %q", id)
+		}
+
+		block, err := aes.NewCipher(key)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %q", id)
+		}
+
+		aead, err := cipher.NewGCM(block)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %q", id)
+		}
+
+		if k.active == "" {
+			k.active = id
+		}
+
+		k.aeads[id] = aead
+	}
+
+	return k, nil
+}
+
+// seal encrypts the data with the active key, returning it unchanged when
+// encryption is disabled.
+func seal(data []byte) ([]byte, error) {
+	if keys == nil {
+		return data, nil
+	}
+
+	aead := keys.aeads[keys.active]
+	header := append([]byte(sealedMagic), byte(len(keys.active)))
+	header = append(header, keys.active...)
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err := io.ReadFull(rand.Reader, nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is authenticated along with the ciphertext
+	res := make([]byte, 0, len(header)+len(nonce)+len(data)+aead.Overhead())
+	res = append(append(res, header...), nonce...)
+
+	return aead.Seal(res, nonce, data, header), nil
+}
+
+// unseal decrypts data encrypted by seal. Data that isn't encrypted, e.g.
+// written before encryption was enabled, is returned unchanged.
+func unseal(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(sealedMagic)) {
+		if keys != nil && len(bytes.TrimSpace(data)) > 0 {
+			atomic.StoreInt32(&staleEncryption, 1)
+		}
+
+		return data, nil
+	}
+
+	if keys == nil {
+		return nil, errors.New("data is encrypted but no encryption keys are set")
+	}
+
+	n := len(sealedMagic)
+
+	if len(data) <= n || len(data) < n+1+int(data[n]) {
+		return nil, errors.New("truncated encrypted data")
+	}
+
+	header := data[:n+1+int(data[n])]
+	id := string(header[n+1:])
+	aead, exists := keys.aeads[id]
+
+	if !exists {
+		return nil, errors.Errorf("data is encrypted with unknown key %q", id)
+	}
+
+	data = data[len(header):]
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("truncated encrypted data")
+	}
+
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], header)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "key %q", id)
+	}
+
+	if id != keys.active {
+		atomic.StoreInt32(&staleEncryption, 1)
+	}
+
+	return res, nil
+}
+
+// unsealReader returns a reader of the decrypted contents of the given
+// reader.
+func unsealReader(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = unseal(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// sealLine encrypts a line of a line-oriented file, e.g. a journal entry,
+// encoding it as base64 so it remains a single line. Lines are returned
+// unchanged when encryption is disabled.
+func sealLine(line []byte) ([]byte, error) {
+	if keys == nil {
+		return line, nil
+	}
+
+	data, err := seal(line)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(res, data)
+
+	return res, nil
+}
+
+// unsealLine decrypts a line encrypted by sealLine. JSON lines, which aren't
+// encrypted, are returned unchanged.
+func unsealLine(line []byte) ([]byte, error) {
+	line = bytes.TrimSpace(line)
+
+	if len(line) == 0 || line[0] == '{' {
+		return unseal(line)
+	}
+
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(data, line)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return unseal(data[:n])
+}
+
+// rewriter is implemented by stores able to rewrite all their persisted
+// data.
+type rewriter interface {
+	Rewrite(ctx context.Context) error
+}
+
+// reencrypt rewrites the accounts, merchant registry, webhook subscriptions,
+// settlement batches and audit log if any were read encrypted with a retired
+// key, or not encrypted, so the data is only readable with the active key.
+// The backups of the rewritten files are removed.
+func reencrypt(ctx context.Context) error {
+	if atomic.LoadInt32(&staleEncryption) == 0 {
+		return nil
+	}
+
+	s, ok := store.(rewriter)
+
+	if !ok {
+		return errors.New("the account store can't be re-encrypted")
+	}
+
+	atomic.StoreInt32(&reencrypting, 1)
+
+	defer atomic.StoreInt32(&reencrypting, 0)
+
+	err := s.Rewrite(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeDB(merchantsFile, merchants)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeDB(webhooksFile, webhooks)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeDB(settlementsFile, settlements)
+
+	if err != nil {
+		return err
+	}
+
+	err = audit.rewrite()
+
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&staleEncryption, 0)
+	logger.Info("Re-encrypted database", zap.String("key", keys.active))
+
+	return nil
+}
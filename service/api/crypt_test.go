@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// useTestKeys enables encryption with the given keys setting, returning a
+// function restoring the previous keys.
+func useTestKeys(t *testing.T, s string) func() {
+	k, err := parseKeys(s)
+
+	require.NoError(t, err)
+
+	previous := keys
+	keys = k
+	atomic.StoreInt32(&staleEncryption, 0)
+
+	return func() {
+		keys = previous
+		atomic.StoreInt32(&staleEncryption, 0)
+	}
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSeal(t *testing.T) {
+	data := []byte(`{"id":1}`)
+
+	res, err := seal(data)
+
+	require.NoError(t, err)
+	require.Equal(t, data, res, "unchanged when encryption is disabled")
+
+	defer useTestKeys(t, "k1:"+testKey(1))()
+
+	sealed, err := seal(data)
+
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(sealed, []byte(sealedMagic+"\x02k1")))
+	require.NotContains(t, string(sealed), `"id"`)
+
+	res, err = unseal(sealed)
+
+	require.NoError(t, err)
+	require.Equal(t, data, res)
+	require.Zero(t, atomic.LoadInt32(&staleEncryption))
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	_, err = unseal(tampered)
+
+	require.Error(t, err)
+
+	_, err = unseal(sealed[:len(sealedMagic)+2])
+
+	require.Error(t, err, "truncated")
+
+	t.Run("Lines", func(t *testing.T) {
+		line, err := sealLine(data)
+
+		require.NoError(t, err)
+		require.NotContains(t, string(line), "\n")
+
+		res, err := unsealLine(line)
+
+		require.NoError(t, err)
+		require.Equal(t, data, res)
+	})
+
+	t.Run("Unencrypted", func(t *testing.T) {
+		res, err := unsealLine(data)
+
+		require.NoError(t, err)
+		require.Equal(t, data, res)
+		require.NotZero(t, atomic.LoadInt32(&staleEncryption), "unencrypted data needs re-encrypting")
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	restore := useTestKeys(t, "k1:"+testKey(1))
+	data := []byte(`{"id":1}`)
+	sealed, err := seal(data)
+
+	require.NoError(t, err)
+	restore()
+
+	_, err = unseal(sealed)
+
+	require.Error(t, err, "encrypted data needs keys")
+
+	defer useTestKeys(t, "k2:"+testKey(2)+",k1:"+testKey(1))()
+
+	res, err := unseal(sealed)
+
+	require.NoError(t, err)
+	require.Equal(t, data, res, "retired keys decrypt")
+	require.NotZero(t, atomic.LoadInt32(&staleEncryption))
+
+	resealed, err := seal(data)
+
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(resealed, []byte(sealedMagic+"\x02k2")), "the first key encrypts")
+
+	useTestKeys(t, "k2:"+testKey(2))
+
+	_, err = unseal(sealed)
+
+	require.Error(t, err, "unknown key")
+}
+
+func TestReencrypt(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	previousStore, previousAudit := store, audit
+	previousFiles := []string{merchantsFile, webhooksFile, settlementsFile}
+	merchantsFile = filepath.Join(dir, "merchants.json")
+	webhooksFile = filepath.Join(dir, "webhooks.json")
+	settlementsFile = filepath.Join(dir, "settlements.json")
+
+	defer func() {
+		store, audit = previousStore, previousAudit
+		merchantsFile, webhooksFile, settlementsFile = previousFiles[0], previousFiles[1], previousFiles[2]
+	}()
+
+	ctx := context.Background()
+	filename := filepath.Join(dir, "db.json")
+	auditFilename := filepath.Join(dir, "audit.ndjson")
+
+	// Unencrypted data, with unencrypted backups
+	s, err := openFileStore(filename, newEventOutbox(), func(*card.Account) {})
+
+	require.NoError(t, err)
+	require.NoError(t, s.CreateAccount(ctx, card.NewAccount(1)))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.UpdateAccount(ctx, 1, func(a *card.Account) error {
+			return a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+		}))
+	}
+
+	require.NoError(t, s.Close())
+	require.FileExists(t, backupName(filename, 1))
+
+	audit, err = openAuditLog(auditFilename)
+
+	require.NoError(t, err)
+	require.NoError(t, audit.append(auditEntry{Method: "POST", Path: "/v1/accounts"}))
+
+	// Enable encryption
+	defer useTestKeys(t, "k1:"+testKey(1))()
+
+	store, err = openFileStore(filename, newEventOutbox(), func(*card.Account) {})
+
+	require.NoError(t, err)
+
+	defer store.Close()
+
+	audit, err = openAuditLog(auditFilename)
+
+	require.NoError(t, err)
+	require.NotZero(t, atomic.LoadInt32(&staleEncryption))
+	require.NoError(t, reencrypt(ctx))
+	require.Zero(t, atomic.LoadInt32(&staleEncryption))
+
+	for _, v := range []string{filename, merchantsFile, webhooksFile, settlementsFile} {
+		b, err := ioutil.ReadFile(v)
+
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(b, []byte(sealedMagic)), v)
+
+		for n := uint(1); n <= dbBackups; n++ {
+			_, err = os.Stat(backupName(v, n))
+
+			require.True(t, os.IsNotExist(err), "unencrypted backup %s kept", backupName(v, n))
+		}
+	}
+
+	b, err := ioutil.ReadFile(auditFilename)
+
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "/v1/accounts")
+	require.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 1)
+
+	page, err := audit.page(0, 0, auditFilter{})
+
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	require.Equal(t, "/v1/accounts", page.Entries[0].Path)
+
+	// Backups resume once re-encrypted
+	require.NoError(t, store.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+	}))
+
+	b, err = ioutil.ReadFile(backupName(filename, 1))
+
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(b, []byte(sealedMagic)))
+
+	account, err := store.GetAccount(ctx, 1)
+
+	require.NoError(t, err)
+	require.Zero(t, account.Available.Cmp(apd.New(30, 0)))
+}
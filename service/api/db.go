@@ -1,25 +1,101 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 var (
-	dbFile   string
-	dbFileMu = &sync.Mutex{}
+	dbFile    string
+	dbBackups uint
+	dbFileMu  = &sync.Mutex{}
 )
 
 func init() {
-	flag.StringVar(&dbFile, "d", "./db.json", "JSON database")
+	flag.StringVar(&dbFile, "db", "./db.json", "JSON database")
+	flag.UintVar(&dbBackups, "db-backups", 3, "Previous versions kept of each JSON file, suffixed .1 (newest) to .N")
 }
 
-func loadDB(filename string) ([]*card.Account, map[int]*card.Account, error) {
+// database is the persisted form of the accounts and their event outbox.
+type database struct {
+	Schema   int             `json:"schema"`
+	Accounts []*card.Account `json:"accounts"`
+	Outbox   *eventOutbox    `json:"outbox"`
+
+	// LSN is the last journal entry reflected by snapshots written by the
+	// journal store.
+	LSN int `json:"lsn,omitempty"`
+}
+
+// fileStore is the Store keeping accounts in memory and persisting them,
+// along with the event outbox, to a single JSON file rewritten by every
+// transaction, or once per batch of transactions persisted asynchronously.
+type fileStore struct {
+	mu          sync.RWMutex
+	filename    string
+	outbox      *eventOutbox
+	queue       *writeQueue
+	init        func(*card.Account)
+	accounts    []*card.Account
+	accountsMap map[int]*card.Account
+
+	// view holds the *fileView of the accounts, read without holding the
+	// mutex.
+	view atomic.Value
+}
+
+// fileView holds copies of the accounts of a fileStore as of their last
+// completed transaction, published for reads. It's never mutated: each
+// transaction publishes a new view, sharing the copies of the accounts it
+// didn't mutate.
+type fileView struct {
+	accounts    []*card.Account
+	accountsMap map[int]*card.Account
+}
+
+// openFileStore loads the JSON database at the given path, creating it if
+// needed, restoring the given outbox and calling init with each account.
+func openFileStore(filename string, outbox *eventOutbox, init func(*card.Account)) (*fileStore, error) {
+	db, err := loadDB(filename, outbox)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileStore{
+		filename:    filename,
+		outbox:      outbox,
+		queue:       newWriteQueue(),
+		init:        init,
+		accounts:    db.Accounts,
+		accountsMap: make(map[int]*card.Account, len(db.Accounts)),
+	}
+
+	for _, v := range db.Accounts {
+		init(v)
+		s.accountsMap[v.ID] = v
+	}
+
+	s.publish(nil)
+
+	return s, nil
+}
+
+// loadDB loads the JSON database at the given path, creating it if needed and
+// restoring the given outbox.
+func loadDB(filename string, outbox *eventOutbox) (*database, error) {
 	dbFileMu.Lock()
 
 	defer dbFileMu.Unlock()
@@ -30,46 +106,672 @@ func loadDB(filename string) ([]*card.Account, map[int]*card.Account, error) {
 		f, err = os.Create(filename)
 
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		return nil, map[int]*card.Account{}, nil
+		return &database{}, f.Close()
 	} else if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r, err := unsealReader(f)
+
+	if err != nil {
+		return nil, err
 	}
 
-	var accounts []*card.Account
+	var raw json.RawMessage
 
-	err = json.NewDecoder(f).Decode(&accounts)
+	err = json.NewDecoder(r).Decode(&raw)
 
 	if err == io.EOF {
 		// Assume empty database file
-		return nil, map[int]*card.Account{}, nil
+		return &database{}, nil
 	} else if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	accountsMap := make(map[int]*card.Account, len(accounts))
+	db := database{Outbox: outbox}
 
-	for _, v := range accounts {
-		accountsMap[v.ID] = v
+	// Earlier versions persisted the accounts list alone
+	if raw[0] == '[' {
+		err = json.Unmarshal(raw, &db.Accounts)
+	} else {
+		err = json.Unmarshal(raw, &db)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkSchema(db.Schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if db.Schema < schemaVersion && len(db.Accounts) > 0 {
+		logger.Info("Migrating database", zap.String("database", filename), zap.Int("from", db.Schema), zap.Int("to", schemaVersion))
+	}
+
+	for _, v := range db.Accounts {
+		err = migrateAccount(v, db.Schema)
+
+		if err == nil {
+			err = v.Validate()
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "account %d", v.ID)
+		}
 	}
 
-	return accounts, accountsMap, nil
+	return &db, nil
 }
 
+// writeDB atomically replaces the given JSON file with the encoded value,
+// serializing writes to the service's JSON files.
 func writeDB(filename string, i interface{}) error {
 	dbFileMu.Lock()
 
 	defer dbFileMu.Unlock()
 
-	f, err := os.OpenFile(filename, os.O_TRUNC|os.O_WRONLY, os.ModeAppend)
+	return writeFile(filename, i)
+}
+
+// writeFile atomically replaces the given JSON file with the encoded value,
+// encrypted if encryption is enabled: it's written to a temporary file in the
+// same directory, synced and renamed over the original, so a crash leaves
+// either the previous or the new version. The replaced version is kept as the
+// first of the rotating backups.
+func writeFile(filename string, i interface{}) error {
+	dir, base := filepath.Split(filename)
+	f, err := ioutil.TempFile(dir, "."+base+".")
 
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
+	// Removing the temporary file fails harmlessly once it's renamed
+	defer os.Remove(f.Name())
+
+	b, err := json.Marshal(i)
+
+	if err == nil {
+		b, err = seal(append(b, '\n'))
+	}
+
+	if err == nil {
+		_, err = f.Write(b)
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	err = f.Close()
+
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filename)
+
+	switch {
+	case err == nil:
+		err = os.Chmod(f.Name(), info.Mode())
+
+		if err == nil {
+			err = rotateBackups(filename)
+		}
+	case os.IsNotExist(err):
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), filename)
+
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// backupName returns the name of the nth backup of the given file.
+func backupName(filename string, n uint) string {
+	return filename + "." + strconv.FormatUint(uint64(n), 10)
+}
+
+// rotateBackups shifts the backups of the given file, dropping the oldest,
+// and links the current version as the first backup. The current version is
+// left in place. While the data is re-encrypted the backups are removed
+// instead.
+func rotateBackups(filename string) error {
+	if atomic.LoadInt32(&reencrypting) != 0 {
+		return removeBackups(filename)
+	}
+
+	if dbBackups == 0 {
+		return nil
+	}
+
+	for n := dbBackups; n > 1; n-- {
+		err := os.Rename(backupName(filename, n-1), backupName(filename, n))
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	first := backupName(filename, 1)
+	err := os.Remove(first)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Link(filename, first)
+}
+
+// removeBackups removes the backups of the given file.
+func removeBackups(filename string) error {
+	for n := uint(1); n <= dbBackups; n++ {
+		err := os.Remove(backupName(filename, n))
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncDir syncs the given directory, persisting renames within it.
+func syncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// write persists the accounts and outbox, committing the events staged for
+// the given accounts by the current transaction once they're written. It
+// must be called with the mutex held.
+func (s *fileStore) write(accountIDs ...int) error {
+	err := writeDB(s.filename, database{Schema: schemaVersion, Accounts: s.accounts, Outbox: s.outbox})
+
+	if err != nil {
+		return err
+	}
+
+	s.outbox.commit(accountIDs...)
+
+	return nil
+}
+
+// persist writes the accounts and outbox like write, unless the given
+// context allows asynchronous durability, in which case the events staged
+// for the given accounts are held and the write is queued. It must be called
+// with the mutex held.
+func (s *fileStore) persist(ctx context.Context, accountIDs ...int) error {
+	if !asyncDurability(ctx) {
+		return s.write(accountIDs...)
+	}
+
+	s.outbox.hold(accountIDs...)
+	s.queue.add(accountIDs...)
+
+	return nil
+}
+
+// queued implements the flusher interface.
+func (s *fileStore) queued() <-chan struct{} {
+	return s.queue.ready
+}
+
+// flush implements the flusher interface. The database is written once for
+// every queued mutation.
+func (s *fileStore) flush() error {
+	s.mu.RLock()
+
+	defer s.mu.RUnlock()
+
+	ids, dirty := s.queue.take()
+
+	if !dirty {
+		return nil
+	}
+
+	err := s.write(ids...)
+
+	if err != nil {
+		s.queue.add(ids...)
+
+		return err
+	}
+
+	return nil
+}
+
+// publish publishes copies of the accounts for reads, copying only the given
+// accounts again; a nil list copies every account. It must be called with the
+// mutex held.
+func (s *fileStore) publish(accountIDs []int) {
+	previous, _ := s.view.Load().(*fileView)
+	mutated := make(map[int]bool, len(accountIDs))
+
+	for _, id := range accountIDs {
+		mutated[id] = true
+	}
+
+	v := &fileView{
+		accounts:    make([]*card.Account, len(s.accounts)),
+		accountsMap: make(map[int]*card.Account, len(s.accounts)),
+	}
+
+	for i, a := range s.accounts {
+		var c *card.Account
+
+		if previous != nil && accountIDs != nil && !mutated[a.ID] {
+			c = previous.accountsMap[a.ID]
+		}
+
+		if c == nil {
+			c = a.Clone()
+		}
+
+		v.accounts[i], v.accountsMap[a.ID] = c, c
+	}
+
+	s.view.Store(v)
+}
+
+// replace replaces the account with the same ID. It must be called with the
+// mutex held.
+func (s *fileStore) replace(a *card.Account) {
+	for i, v := range s.accounts {
+		if v.ID == a.ID {
+			s.accounts[i] = a
+
+			break
+		}
+	}
+
+	s.accountsMap[a.ID] = a
+}
+
+// remove removes the account with the given ID, returning its index in the
+// accounts list. It must be called with the mutex held.
+func (s *fileStore) remove(id int) int {
+	for i, v := range s.accounts {
+		if v.ID == id {
+			s.accounts = append(s.accounts[:i], s.accounts[i+1:]...)
+			delete(s.accountsMap, id)
+
+			return i
+		}
+	}
+
+	return -1
+}
+
+// insert inserts the account at the given index of the accounts list. It must
+// be called with the mutex held.
+func (s *fileStore) insert(i int, a *card.Account) {
+	s.accounts = append(s.accounts, nil)
+	copy(s.accounts[i+1:], s.accounts[i:])
+	s.accounts[i] = a
+	s.accountsMap[a.ID] = a
+}
+
+// GetAccount implements the Store interface. The account is read from the
+// published view without locking.
+func (s *fileStore) GetAccount(ctx context.Context, id int) (*card.Account, error) {
+	a, exists := s.view.Load().(*fileView).accountsMap[id]
+
+	if !exists {
+		return nil, errAccountNotFound
+	}
+
+	return a.Clone(), nil
+}
+
+// ListAccounts implements the Store interface. The accounts are read from the
+// published view without locking; it's consistent across accounts.
+func (s *fileStore) ListAccounts(ctx context.Context) ([]*card.Account, error) {
+	accounts := s.view.Load().(*fileView).accounts
+	res := make([]*card.Account, len(accounts))
+
+	for i, v := range accounts {
+		res[i] = v.Clone()
+	}
+
+	return res, nil
+}
+
+// WalkAccounts implements the Store interface. The accounts are read from the
+// published view without locking.
+func (s *fileStore) WalkAccounts(ctx context.Context, fn func(*card.Account) error) error {
+	for _, v := range s.view.Load().(*fileView).accounts {
+		err := fn(v)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateAccount implements the Store interface. Copies of the given accounts
+// are stored.
+func (s *fileStore) CreateAccount(ctx context.Context, accounts ...*card.Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	seen := make(map[int]bool, len(accounts))
+
+	for _, v := range accounts {
+		_, exists := s.accountsMap[v.ID]
+
+		if exists || seen[v.ID] {
+			return errAccountExists
+		}
+
+		seen[v.ID] = true
+	}
+
+	n := len(s.accounts)
+	ids := make([]int, len(accounts))
+
+	for i, v := range accounts {
+		a := v.Clone()
+		s.init(a)
+		s.accounts = append(s.accounts, a)
+		s.accountsMap[a.ID] = a
+		ids[i] = a.ID
+	}
+
+	err := s.persist(ctx, ids...)
+
+	if err != nil {
+		for _, v := range s.accounts[n:] {
+			delete(s.accountsMap, v.ID)
+		}
+
+		s.accounts = s.accounts[:n]
+		s.outbox.discard(ids...)
+
+		return err
+	}
+
+	s.publish(ids)
+
+	return nil
+}
+
+// SaveAccount implements the Store interface. A copy of the given account is
+// stored.
+func (s *fileStore) SaveAccount(ctx context.Context, a *card.Account) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	previous, exists := s.accountsMap[a.ID]
+
+	if !exists {
+		return errAccountNotFound
+	}
+
+	s.replace(a.Clone())
+
+	err := s.persist(ctx, a.ID)
+
+	if err != nil {
+		s.replace(previous)
+		s.outbox.discard(a.ID)
+
+		return err
+	}
+
+	s.publish([]int{a.ID})
+
+	return nil
+}
+
+// UpdateAccount implements the Store interface.
+func (s *fileStore) UpdateAccount(ctx context.Context, id int, fn func(*card.Account) error) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	a, exists := s.accountsMap[id]
+
+	if !exists {
+		return errAccountNotFound
+	}
+
+	snapshot := a.Snapshot()
+	err := fn(a)
+
+	if err == nil {
+		err = a.Validate()
+	}
+
+	if err == nil {
+		err = s.persist(ctx, id)
+	}
+
+	if err != nil {
+		// Restored accounts share the observers attached by init
+		s.replace(card.RestoreAccount(snapshot))
+		s.outbox.discard(id)
+
+		return err
+	}
+
+	s.publish([]int{id})
+
+	return nil
+}
+
+// DeleteAccount implements the Store interface.
+func (s *fileStore) DeleteAccount(ctx context.Context, id int, fn func(*card.Account) error) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	a, exists := s.accountsMap[id]
+
+	if !exists {
+		return errAccountNotFound
+	}
+
+	if fn != nil {
+		err := fn(a.Clone())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	i := s.remove(id)
+	err := s.persist(ctx)
+
+	if err != nil {
+		s.insert(i, a)
+
+		return err
+	}
+
+	s.publish([]int{})
+
+	return nil
+}
+
+// SaveOutbox implements the Store interface. The whole outbox is written.
+func (s *fileStore) SaveOutbox(ctx context.Context, accountIDs ...int) error {
+	s.mu.RLock()
+
+	defer s.mu.RUnlock()
+
+	return s.write()
+}
+
+// Snapshot implements the Store interface.
+func (s *fileStore) Snapshot(ctx context.Context, fn func(accounts []*card.Account, events []outboxEvent)) error {
+	s.mu.RLock()
+
+	defer s.mu.RUnlock()
+
+	accounts := make([]*card.Account, len(s.accounts))
+
+	for i, v := range s.accounts {
+		accounts[i] = v.Clone()
+	}
+
+	fn(accounts, s.outbox.committed())
+
+	return nil
+}
+
+// Restore implements the Store interface.
+func (s *fileStore) Restore(ctx context.Context, accounts []*card.Account, events []outboxEvent) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	previous, previousEvents := s.accounts, s.outbox.committed()
+	restored := make([]*card.Account, len(accounts))
+
+	for i, v := range accounts {
+		restored[i] = v.Clone()
+		s.init(restored[i])
+	}
+
+	s.setAccounts(restored)
+	s.outbox.reset(events)
+
+	err := s.write()
+
+	if err != nil {
+		s.setAccounts(previous)
+		s.outbox.reset(previousEvents)
+
+		return err
+	}
+
+	s.publish(nil)
+
+	return nil
+}
+
+// Reload implements the Store interface.
+func (s *fileStore) Reload(ctx context.Context, check func(current, persisted []*card.Account) error) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	// Loading creates a missing database
+	_, err := os.Stat(s.filename)
+
+	if err != nil {
+		return err
+	}
+
+	outbox := newEventOutbox()
+	db, err := loadDB(s.filename, outbox)
+
+	if err != nil {
+		return err
+	}
+
+	err = check(s.accounts, db.Accounts)
+
+	if err != nil {
+		return err
+	}
+
+	for _, v := range db.Accounts {
+		s.init(v)
+	}
+
+	s.setAccounts(db.Accounts)
+	s.publish(nil)
+	s.outbox.reset(outbox.committed())
+
+	return nil
+}
+
+// setAccounts replaces the accounts list. It must be called with the mutex
+// held.
+func (s *fileStore) setAccounts(accounts []*card.Account) {
+	s.accounts = accounts
+	s.accountsMap = make(map[int]*card.Account, len(accounts))
+
+	for _, v := range accounts {
+		s.accountsMap[v.ID] = v
+	}
+}
+
+// Rewrite rewrites the database.
+func (s *fileStore) Rewrite(ctx context.Context) error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	return s.write()
+}
+
+// Close implements the Store interface.
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	return s.write()
+}
+
+// flushDB writes the final accounts and outbox, once in-flight transactions
+// complete, along with the merchant registry and webhook subscriptions.
+func flushDB() error {
+	err := store.Close()
+
+	if err != nil {
+		return err
+	}
+
+	err = writeDB(merchantsFile, merchants)
+
+	if err != nil {
+		return err
+	}
 
-	return json.NewEncoder(f).Encode(i)
+	return writeDB(webhooksFile, webhooks)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+var dbDir string
+
+func init() {
+	flag.StringVar(&dbDir, "db-dir", "./accounts", "Directory of per-account JSON files, used by the dir store")
+}
+
+// dirLog is the recordLog keeping the record of each account in its own
+// JSON file in a directory, so a transaction writes only the file of the
+// account it mutates.
+type dirLog struct {
+	dir string
+}
+
+// openDirStore opens a recordStore persisting accounts to the given
+// directory, importing the given JSON database when the directory is
+// created.
+func openDirStore(dir, legacy string, outbox *eventOutbox, init func(*card.Account)) (*recordStore, error) {
+	return openRecordStore(&dirLog{dir}, legacy, outbox, init)
+}
+
+// filename returns the name of the given account's file.
+func (l *dirLog) filename(id int) string {
+	return filepath.Join(l.dir, strconv.Itoa(id)+".json")
+}
+
+// load implements the recordLog interface.
+func (l *dirLog) load() (map[int]*accountRecord, bool, error) {
+	_, err := os.Stat(l.dir)
+
+	if os.IsNotExist(err) {
+		return nil, false, os.MkdirAll(l.dir, 0700)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	names, err := filepath.Glob(filepath.Join(l.dir, "*.json"))
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	records := make(map[int]*accountRecord, len(names))
+
+	for _, name := range names {
+		// Skip JSON files other than account records
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), ".json"))
+
+		if err != nil {
+			continue
+		}
+
+		rec, err := readRecord(name)
+
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "account %d", id)
+		}
+
+		records[id] = rec
+	}
+
+	return records, true, nil
+}
+
+// readRecord decodes the account record in the given file.
+func readRecord(filename string) (*accountRecord, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r, err := unsealReader(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rec accountRecord
+
+	err = json.NewDecoder(r).Decode(&rec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+// put implements the recordLog interface.
+func (l *dirLog) put(id int, rec *accountRecord) error {
+	filename := l.filename(id)
+
+	if !rec.empty() {
+		return writeFile(filename, rec)
+	}
+
+	err := os.Remove(filename)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Backups of deleted accounts are kept, unless they're being re-encrypted
+	if atomic.LoadInt32(&reencrypting) != 0 {
+		err = removeBackups(filename)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return syncDir(l.dir)
+}
+
+// close implements the recordLog interface. Records are written as they're
+// put, so there's nothing left to persist.
+func (l *dirLog) close(accounts []*card.Account) error {
+	return nil
+}
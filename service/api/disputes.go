@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+)
+
+func getDisputeID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func getDisputes(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account.ListDisputes())
+}
+
+// openDispute disputes a captured amount, provisionally crediting it to the
+// account.
+func openDispute(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		requestMetadata
+		TransactionID int     `json:"transactionID"`
+		Amount        *string `json:"amount"`
+		Reason        string  `json:"reason"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	var amount *apd.Decimal
+
+	if req.Amount != nil {
+		amount, _, err = apd.NewFromString(*req.Amount)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), req.requestMetadata)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccountStatus(w, r, http.StatusCreated, func(account *card.Account) (interface{}, error) {
+		return account.OpenDispute(r.Context(), req.TransactionID, amount, req.Reason, opts...)
+	})
+}
+
+func getDispute(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getDisputeID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	d, err := account.Dispute(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// resolveDispute resolves a dispute with the given account method, returning
+// the resolved dispute.
+func resolveDispute(w http.ResponseWriter, r *http.Request, resolve func(*card.Account, int, []card.TransactionOption) (*card.Dispute, error)) {
+	id, err := getDisputeID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	var req requestMetadata
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), req)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return resolve(account, id, opts)
+	})
+}
+
+func acceptDispute(w http.ResponseWriter, r *http.Request) {
+	resolveDispute(w, r, func(account *card.Account, id int, opts []card.TransactionOption) (*card.Dispute, error) {
+		return account.AcceptDispute(r.Context(), id, opts...)
+	})
+}
+
+func rejectDispute(w http.ResponseWriter, r *http.Request) {
+	resolveDispute(w, r, func(account *card.Account, id int, opts []card.TransactionOption) (*card.Dispute, error) {
+		return account.RejectDispute(r.Context(), id, opts...)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// Service errors, reported with codes alongside the account errors.
+var (
+	errInvalidRequest     = &card.Error{Code: "INVALID_REQUEST", Message: "invalid request"}
+	errAccountNotFound    = &card.Error{Code: "ACCOUNT_NOT_FOUND", Message: "account not found"}
+	errAccountExists      = &card.Error{Code: "ACCOUNT_EXISTS", Message: "account already exists"}
+	errFundsBlocked       = &card.Error{Code: "FUNDS_BLOCKED", Message: "account has blocked funds"}
+	errUnsupportedStore   = &card.Error{Code: "UNSUPPORTED_STORE", Message: "operation not supported by the account store"}
+	errPreconditionFailed = &card.Error{Code: "PRECONDITION_FAILED", Message: "account version does not match If-Match"}
+	errReloadConflict     = &card.Error{Code: "RELOAD_CONFLICT", Message: "persisted accounts are older than the accounts in memory"}
+)
+
+// requestError reports a malformed request along with the reason it was
+// rejected.
+type requestError struct {
+	reason error
+}
+
+func (e *requestError) Error() string {
+	return errInvalidRequest.Message
+}
+
+// Cause returns the underlying service error.
+func (e *requestError) Cause() error {
+	return errInvalidRequest
+}
+
+// errorResponse is the error envelope returned by every handler.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    card.Code         `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// writeError writes the error envelope for the given error and records it
+// for the access log.
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	recordError(w, err)
+	writeJSON(w, statusCode, errorResponse{newErrorBody(err)})
+}
+
+// newErrorBody returns the error envelope body for the given error. Errors
+// without a code are reported as internal errors without exposing their
+// message.
+func newErrorBody(err error) errorBody {
+	res := errorBody{
+		Code:    card.ErrorCode(err),
+		Message: err.Error(),
+		Details: map[string]string{},
+	}
+
+	if res.Code == "" {
+		res.Code = "INTERNAL_ERROR"
+		res.Message = http.StatusText(http.StatusInternalServerError)
+	}
+
+	amount, available := card.ErrorAmounts(err)
+
+	if amount != nil {
+		res.Details["amount"] = amount.Text('f')
+	}
+
+	if available != nil {
+		res.Details["available"] = available.Text('f')
+	}
+
+	e, ok := err.(*requestError)
+
+	if ok && e.reason != nil {
+		res.Details["reason"] = e.reason.Error()
+	}
+
+	return res
+}
+
+// errorStatus returns the HTTP status code for the given error: 400 for
+// malformed requests, 401 and 403 for rejected tokens, 404 for unknown
+// records, 406 for unsupported API versions, 409 for conflicts with the
+// account or record state, 422 for operations the account can't honour and
+// 500 otherwise.
+func errorStatus(err error) int {
+	switch errors.Cause(err) {
+	case errInvalidRequest, card.ErrInvalidOperation, card.ErrInvalidPeriod, card.ErrInvalidCadence, card.ErrInvalidSchedule, card.ErrInvalidMCC, card.ErrInvalidFeeRate, card.ErrInvalidCurrency, card.ErrInvalidOrigin, card.ErrInvalidLocale, card.ErrInvalidSortOrder, card.ErrInvalidDisputeStatus:
+		return http.StatusBadRequest
+	case errUnauthorized:
+		return http.StatusUnauthorized
+	case errForbidden:
+		return http.StatusForbidden
+	case errUnsupportedVersion:
+		return http.StatusNotAcceptable
+	case errAccountNotFound, errWebhookNotFound, errBackupNotFound, errSettlementNotFound, card.ErrAuthorizationNotFound, card.ErrMerchantNotFound, card.ErrTransactionNotFound, card.ErrScheduleNotFound, card.ErrMandateNotFound, card.ErrDisputeNotFound:
+		return http.StatusNotFound
+	case errAccountExists, errFundsBlocked, errReloadConflict, card.ErrMerchantExists, card.ErrIdempotencyKeyReused, card.ErrAccountFrozen, card.ErrAccountClosed, card.ErrMandateRevoked, card.ErrDisputeResolved, card.ErrAuthorizationExpired:
+		return http.StatusConflict
+	case card.ErrUnderflow, card.ErrInvalidAmount, card.ErrReasonRequired, card.ErrInvalidOriginalTransaction, card.ErrCurrencyMismatch, card.ErrLimitExceeded, card.ErrMerchantLimitExceeded, card.ErrMandateLimitExceeded, card.ErrInvalidDispute, card.ErrMerchantCategoryBlocked:
+		return http.StatusUnprocessableEntity
+	case errPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case errUnsupportedStore:
+		return http.StatusNotImplemented
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/martingallagher/card"
+	"go.uber.org/zap"
+)
+
+// initAccount attaches the merchant registry, transaction event logging, the
+// event outbox and top-up failure logging to the given account.
+func initAccount(a *card.Account) {
+	a.Registry = merchants
+	a.OnTransaction(func(t card.Transaction) {
+		logger.Info("Transaction",
+			zap.Int("account", a.ID),
+			zap.Int("id", t.ID),
+			zap.Stringer("type", t.Type),
+			zap.String("amount", t.Amount.String()),
+			zap.String("currency", t.Currency),
+		)
+		outbox.stage(a.ID, t)
+	})
+	a.OnTopUpFailure(func(err error) {
+		logger.Warn("Automatic top-up failed", zap.Int("account", a.ID), zap.Error(err))
+	})
+}
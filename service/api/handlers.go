@@ -1,108 +1,329 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/apd"
 	"github.com/go-chi/chi"
 	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-var (
-	accounts    []*card.Account
-	accountsMap = map[int]*card.Account{}
-	accountsMu  = &sync.RWMutex{}
-)
-
 func writeJSON(w http.ResponseWriter, statusCode int, i interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
 
 	err := json.NewEncoder(w).Encode(i)
 
 	if err != nil {
-		logger.Error("Failed encoding JSON", zap.Error(err))
+		recordError(w, err)
 	}
 }
 
-func updateDB(w http.ResponseWriter, i interface{}) {
-	err := writeDB(dbFile, accounts)
+// updateAccount applies fn to the account named by the request within a store
+// transaction, writing the result returned by fn, or the account if it's nil.
+// The result is encoded within the transaction, before other requests can
+// modify the account. Requests with an If-Match header naming another
+// version of the account are rejected.
+func updateAccount(w http.ResponseWriter, r *http.Request, fn func(*card.Account) (interface{}, error)) {
+	updateAccountStatus(w, r, http.StatusOK, fn)
+}
+
+// updateAccountStatus is updateAccount responding with the given status code
+// on success.
+func updateAccountStatus(w http.ResponseWriter, r *http.Request, statusCode int, fn func(*card.Account) (interface{}, error)) {
+	id, err := accountID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	var res json.RawMessage
+
+	err = store.UpdateAccount(r.Context(), id, func(account *card.Account) error {
+		err := checkIfMatch(r, account)
+
+		if err != nil {
+			return err
+		}
+
+		v, err := fn(account)
+
+		if err != nil {
+			return err
+		}
+
+		if v == nil {
+			v = account
+		}
+
+		res, err = json.Marshal(v)
+
+		return err
+	})
 
 	if err != nil {
-		logger.Error("Failed to write to database", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	writeJSON(w, http.StatusOK, i)
+	writeJSON(w, statusCode, res)
 }
 
+// getAccounts streams the JSON array of accounts one account at a time, so
+// memory use doesn't grow with the number of accounts. Errors occurring once
+// the response has started truncate it.
 func getAccounts(w http.ResponseWriter, r *http.Request) {
-	accountsMu.RLock()
-	writeJSON(w, http.StatusOK, accounts)
-	accountsMu.RUnlock()
+	view, err := parseAccountView(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	sep := "["
+
+	err = store.WalkAccounts(r.Context(), func(a *card.Account) error {
+		b, err := view.encode(a)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, sep)
+
+		if err != nil {
+			return err
+		}
+
+		sep = ","
+		_, err = w.Write(b)
+
+		return err
+	})
+
+	if err == nil && sep == "[" {
+		_, err = io.WriteString(w, "[")
+	}
+
+	if err == nil {
+		_, err = io.WriteString(w, "]\n")
+	}
+
+	if err != nil {
+		recordError(w, err)
+	}
+}
+
+func consolidatedStatement(w http.ResponseWriter, r *http.Request) {
+	accounts, err := store.ListAccounts(r.Context())
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	statement, err := card.ConsolidatedStatement(accounts)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	io.WriteString(w, statement)
 }
 
 func createAccount(w http.ResponseWriter, r *http.Request) {
 	var newAccount struct {
-		ID int `json:"id"`
+		ID       int    `json:"id"`
+		Currency string `json:"currency"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&newAccount)
 
 	if err != nil {
-		logger.Error("Failed to decode JSON", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, &requestError{err})
 
 		return
 	}
 
-	accountsMu.Lock()
+	var opts []card.Option
+
+	if newAccount.Currency != "" {
+		opts = append(opts, card.WithCurrency(strings.ToUpper(newAccount.Currency)))
+	}
 
-	defer accountsMu.Unlock()
+	account := card.NewAccount(newAccount.ID, opts...)
+	err = account.Validate()
 
-	_, exists := accountsMap[newAccount.ID]
+	if err == nil {
+		err = store.CreateAccount(r.Context(), account)
+	}
 
-	if exists {
-		w.WriteHeader(http.StatusConflict)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	account := card.NewAccount(newAccount.ID)
-	accounts = append(accounts, account)
-	accountsMap[account.ID] = account
+	writeJSON(w, http.StatusOK, account)
+}
+
+// accountID returns the account ID route parameter, writing an error if it's
+// malformed.
+func accountID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// accountETag returns the entity tag of the account's version.
+func accountETag(a *card.Account) string {
+	return `"` + strconv.Itoa(a.Version) + `"`
+}
+
+// checkIfMatch verifies the request's If-Match header, if any, names the
+// account's current version, rejecting requests made with a stale version.
+func checkIfMatch(r *http.Request, a *card.Account) error {
+	h := r.Header.Get("If-Match")
+
+	if h == "" {
+		return nil
+	}
+
+	etag := accountETag(a)
+
+	for _, v := range strings.Split(h, ",") {
+		v = strings.TrimSpace(v)
+
+		if v == "*" || v == etag {
+			return nil
+		}
+	}
 
-	updateDB(w, account)
+	return errPreconditionFailed
 }
 
+// getAccountValue returns a copy of the account named by the request, writing
+// an error if it doesn't exist. The account version is set as the response
+// ETag.
 func getAccountValue(w http.ResponseWriter, r *http.Request) (*card.Account, error) {
-	idParam := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idParam)
+	id, err := accountID(w, r)
 
 	if err != nil {
-		logger.Error("Invalid account ID", zap.String("id", idParam), zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
-
 		return nil, err
 	}
 
-	account, exists := accountsMap[id]
+	account, err := store.GetAccount(r.Context(), id)
 
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
 
-		return nil, errors.New("account not found")
+		return nil, err
 	}
 
+	w.Header().Set("ETag", accountETag(account))
+
 	return account, nil
 }
 
+// requestCurrency returns the normalized request currency, defaulting to the
+// account currency when omitted.
+func requestCurrency(account *card.Account, currency string) string {
+	if currency == "" {
+		return account.Currency
+	}
+
+	return strings.ToUpper(currency)
+}
+
+// requestMetadata represents the optional transaction metadata accepted by
+// operation requests.
+type requestMetadata struct {
+	Description string `json:"description"`
+	Reference   string `json:"reference"`
+	Origin      string `json:"origin"`
+}
+
+// transactionOptions returns the operation options for the request
+// Idempotency-Key header and metadata, defaulting the origin to the API.
+func transactionOptions(idempotencyKey string, m requestMetadata) ([]card.TransactionOption, error) {
+	origin := card.OriginAPI
+
+	if m.Origin != "" {
+		var err error
+		origin, err = card.ParseOrigin(m.Origin)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []card.TransactionOption{
+		card.WithIdempotencyKey(idempotencyKey),
+		card.WithDescription(m.Description),
+		card.WithReference(m.Reference),
+		card.WithOrigin(origin),
+	}, nil
+}
+
+// transactionRequest is the body of authorize, capture, reverse and refund
+// requests.
+type transactionRequest struct {
+	requestMetadata
+	MerchantID            int    `json:"merchantID"`
+	AuthorizationID       int    `json:"authorizationID"`
+	OriginalTransactionID int    `json:"originalTransactionID"`
+	Amount                string `json:"amount"`
+	Currency              string `json:"currency"`
+}
+
+// apply performs the given operation on the account, returning the
+// authorization of authorize requests.
+func (req *transactionRequest) apply(ctx context.Context, account *card.Account, op card.Operation, amount *apd.Decimal, opts []card.TransactionOption) (*card.Authorization, error) {
+	if req.OriginalTransactionID != 0 {
+		opts = append(opts, card.WithOriginalTransaction(req.OriginalTransactionID))
+	}
+
+	currency := requestCurrency(account, req.Currency)
+
+	switch op {
+	case card.Load:
+		return nil, account.Load(ctx, amount, currency, opts...)
+	case card.Authorize:
+		return account.Authorize(ctx, req.MerchantID, amount, currency, opts...)
+	case card.Capture:
+		return nil, account.Capture(ctx, req.AuthorizationID, amount, currency, opts...)
+	case card.Reverse:
+		return nil, account.Reverse(ctx, req.AuthorizationID, amount, currency, opts...)
+	case card.Refund:
+		return nil, account.Refund(ctx, req.AuthorizationID, amount, currency, opts...)
+	}
+
+	return nil, &requestError{errors.Errorf("unknown operation %s", op)}
+}
+
 func getAccount(w http.ResponseWriter, r *http.Request) {
 	account, err := getAccountValue(w, r)
 
@@ -113,146 +334,899 @@ func getAccount(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, account)
 }
 
-func statement(w http.ResponseWriter, r *http.Request) {
-	accountsMu.Lock()
-
-	defer accountsMu.Unlock()
-
+func getBalance(w http.ResponseWriter, r *http.Request) {
 	account, err := getAccountValue(w, r)
 
 	if err != nil {
 		return
 	}
 
-	statement, err := account.Statement()
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+
+	if currency == "" || currency == account.Currency {
+		balance, err := account.Balance(r.Context())
+
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, balance)
+
+		return
+	}
+
+	balances, err := account.Balances(r.Context())
 
 	if err != nil {
-		logger.Error("Failed to generate statement", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	balance, exists := balances[currency]
+
+	if !exists {
+		err = errors.Wrapf(card.ErrCurrencyMismatch, "%s", currency)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	w.Write([]byte(statement))
+	writeJSON(w, http.StatusOK, balance)
 }
 
-func load(w http.ResponseWriter, r *http.Request) {
-	accountsMu.Lock()
+func getMerchantHoldings(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
 
-	defer accountsMu.Unlock()
+	holdings := account.MerchantHoldings()
 
+	if holdings == nil {
+		holdings = []card.MerchantHolding{}
+	}
+
+	writeJSON(w, http.StatusOK, holdings)
+}
+
+func getMerchantHolding(w http.ResponseWriter, r *http.Request) {
 	account, err := getAccountValue(w, r)
 
 	if err != nil {
 		return
 	}
 
-	var load struct {
-		Amount string `json:"amount"`
+	id, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&load)
+	holdings, err := account.MerchantHolding(id)
 
 	if err != nil {
-		logger.Error("Failed to decode JSON", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	d, _, err := apd.NewFromString(load.Amount)
+	writeJSON(w, http.StatusOK, holdings)
+}
+
+func getTransaction(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	idParam := chi.URLParam(r, "transactionID")
+	id, err := strconv.Atoi(idParam)
 
 	if err != nil {
-		logger.Error("Failed to decode load request", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, &requestError{err})
 
 		return
 	}
 
-	err = account.Load(d)
+	txn, err := account.Transaction(id)
 
 	if err != nil {
-		logger.Error("Failed to load amount", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	updateDB(w, account)
+	writeJSON(w, http.StatusOK, txn)
 }
 
-func transaction(w http.ResponseWriter, r *http.Request, op card.Operation) {
-	accountsMu.Lock()
+// statementFilter returns the statement filter for the request from, to,
+// merchantID and type query parameters.
+func statementFilter(r *http.Request) (card.FilterOptions, error) {
+	var (
+		f   card.FilterOptions
+		q   = r.URL.Query()
+		err error
+	)
+
+	from := q.Get("from")
+
+	if from != "" {
+		f.From, err = time.Parse(time.RFC3339, from)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	to := q.Get("to")
+
+	if to != "" {
+		f.To, err = time.Parse(time.RFC3339, to)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	merchantID := q.Get("merchantID")
+
+	if merchantID != "" {
+		id, err := strconv.Atoi(merchantID)
+
+		if err != nil {
+			return f, err
+		}
+
+		f.MerchantID = &id
+	}
+
+	op := q.Get("type")
+
+	if op != "" {
+		v, err := card.ParseOperation(op)
+
+		if err != nil {
+			return f, err
+		}
+
+		f.Type = &v
+	}
+
+	minAmount := q.Get("minAmount")
+
+	if minAmount != "" {
+		f.MinAmount, _, err = apd.NewFromString(minAmount)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	maxAmount := q.Get("maxAmount")
+
+	if maxAmount != "" {
+		f.MaxAmount, _, err = apd.NewFromString(maxAmount)
+
+		if err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+// pageParams returns the request cursor and limit query parameters,
+// reporting whether the request is paged.
+func pageParams(r *http.Request) (int, int, bool, error) {
+	var (
+		q      = r.URL.Query()
+		cursor = q.Get("cursor")
+		limit  = q.Get("limit")
+	)
+
+	if cursor == "" && limit == "" {
+		return 0, 0, false, nil
+	}
+
+	var (
+		c, l int
+		err  error
+	)
+
+	if cursor != "" {
+		c, err = strconv.Atoi(cursor)
+
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	if limit != "" {
+		l, err = strconv.Atoi(limit)
+
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	return c, l, true, nil
+}
+
+// acceptLanguage returns the most preferred supported statement locale of
+// the Accept-Language header, or an empty string if none is supported.
+func acceptLanguage(r *http.Request) string {
+	type tag struct {
+		locale string
+		q      float64
+	}
+
+	var tags []tag
+
+	for _, v := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		parts := strings.Split(v, ";")
+		t := tag{locale: card.MatchLocale(parts[0]), q: 1}
+
+		if t.locale == "" {
+			continue
+		}
 
-	defer accountsMu.Unlock()
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
 
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+
+				if err == nil {
+					t.q = q
+				}
+			}
+		}
+
+		if t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	return tags[0].locale
+}
+
+// sortParam returns the statement option for the sort query parameter.
+func sortParam(r *http.Request) (card.StatementOption, error) {
+	order := card.OrderID
+	v := r.URL.Query().Get("sort")
+
+	if v != "" {
+		var err error
+
+		order, err = card.ParseSortOrder(v)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return card.WithSort(order), nil
+}
+
+func getTransactions(w http.ResponseWriter, r *http.Request) {
 	account, err := getAccountValue(w, r)
 
 	if err != nil {
 		return
 	}
 
-	var req struct {
-		MerchantID int    `json:"merchantID"`
-		Amount     string `json:"amount"`
+	filter, err := statementFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	cursor, limit, _, err := pageParams(r)
 
 	if err != nil {
-		logger.Error("Failed to decode JSON", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, &requestError{err})
 
 		return
 	}
 
-	d, _, err := apd.NewFromString(req.Amount)
+	order, err := sortParam(r)
 
 	if err != nil {
-		logger.Error("Failed to decode request", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	switch op {
-	case card.Authorize:
-		err = account.Authorize(req.MerchantID, d)
-	case card.Capture:
-		err = account.Capture(req.MerchantID, d)
-	case card.Reverse:
-		err = account.Reverse(req.MerchantID, d)
-	case card.Refund:
-		err = account.Refund(req.MerchantID, d)
-	default:
-		logger.Error("Unknown operation", zap.Uint8("op", uint8(op)))
-		w.WriteHeader(http.StatusBadRequest)
+	writeJSON(w, http.StatusOK, account.TransactionsPage(cursor, limit, filter, order))
+}
+
+func summary(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
 
+	if err != nil {
 		return
 	}
 
+	month := time.Now()
+	v := r.URL.Query().Get("month")
+
+	if v != "" {
+		month, err = time.Parse("2006-01", v)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	s, err := account.Summary(month)
+
 	if err != nil {
-		logger.Error("Failed to perform request", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, errorStatus(err), err)
 
 		return
 	}
 
-	updateDB(w, account)
+	writeJSON(w, http.StatusOK, s)
 }
 
-func authorize(w http.ResponseWriter, r *http.Request) {
-	transaction(w, r, card.Authorize)
-}
+func statement(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
 
-func capture(w http.ResponseWriter, r *http.Request) {
-	transaction(w, r, card.Capture)
-}
+	if err != nil {
+		return
+	}
 
-func reverse(w http.ResponseWriter, r *http.Request) {
-	transaction(w, r, card.Reverse)
-}
+	filter, err := statementFilter(r)
 
-func refund(w http.ResponseWriter, r *http.Request) {
-	transaction(w, r, card.Refund)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	cursor, limit, paged, err := pageParams(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	order, err := sortParam(r)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	opts := []card.StatementOption{card.WithFilter(filter), order}
+
+	if paged {
+		page := account.TransactionsPage(cursor, limit, filter, order)
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+
+		if page.NextCursor != 0 {
+			w.Header().Set("X-Next-Cursor", strconv.Itoa(page.NextCursor))
+		}
+
+		opts = append(opts, card.WithPage(cursor, limit))
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		err = account.StatementCSV(w, opts...)
+
+		if err != nil {
+			recordError(w, err)
+		}
+
+		return
+	}
+
+	opts = append(opts, card.WithMerchantRegistry(merchants))
+	locale := r.URL.Query().Get("locale")
+
+	if locale == "" {
+		locale = acceptLanguage(r)
+	}
+
+	if locale != "" {
+		opts = append(opts, card.WithLocale(locale))
+	}
+
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		err = account.WriteStatementHTML(w, opts...)
+	} else {
+		err = account.WriteStatement(w, opts...)
+	}
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+	}
+}
+
+func export(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	filter, err := statementFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts := []card.StatementOption{card.WithFilter(filter), card.WithMerchantRegistry(merchants)}
+
+	format := r.URL.Query().Get("format")
+
+	switch format {
+	case "ofx":
+		w.Header().Set("Content-Type", "application/x-ofx")
+
+		err = account.ExportOFX(w, opts...)
+	case "qif":
+		w.Header().Set("Content-Type", "application/qif")
+
+		err = account.ExportQIF(w, opts...)
+	case "camt053":
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+
+		err = account.ExportCAMT053(w, opts...)
+	default:
+		writeError(w, http.StatusBadRequest, &requestError{errors.Errorf("unsupported export format %q", format)})
+
+		return
+	}
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+	}
+}
+
+func exportJSONLines(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	filter, err := statementFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	order, err := sortParam(r)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	err = account.ExportJSONLines(w, card.WithFilter(filter), order)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+	}
+}
+
+func load(w http.ResponseWriter, r *http.Request) {
+	var load struct {
+		requestMetadata
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&load)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	d, _, err := apd.NewFromString(load.Amount)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), load.requestMetadata)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.Load(r.Context(), d, requestCurrency(account, load.Currency), opts...)
+	})
+}
+
+func transaction(w http.ResponseWriter, r *http.Request, op card.Operation) {
+	var req transactionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	d, _, err := apd.NewFromString(req.Amount)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), req.requestMetadata)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		switch op {
+		case card.Capture, card.Reverse, card.Refund:
+			au, err := account.Authorization(req.AuthorizationID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = checkMerchant(r, au.MerchantID)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		au, err := req.apply(r.Context(), account, op, d, opts)
+
+		if err != nil || au == nil {
+			return nil, err
+		}
+
+		return au, nil
+	})
+}
+
+func authorize(w http.ResponseWriter, r *http.Request) {
+	transaction(w, r, card.Authorize)
+}
+
+func capture(w http.ResponseWriter, r *http.Request) {
+	transaction(w, r, card.Capture)
+}
+
+func reverse(w http.ResponseWriter, r *http.Request) {
+	transaction(w, r, card.Reverse)
+}
+
+func refund(w http.ResponseWriter, r *http.Request) {
+	transaction(w, r, card.Refund)
+}
+
+// adjust applies a manual balance adjustment with the mandatory reason.
+func adjust(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount    string `json:"amount"`
+		Currency  string `json:"currency"`
+		Reason    string `json:"reason"`
+		Reference string `json:"reference"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	d, _, err := apd.NewFromString(req.Amount)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), requestMetadata{Reference: req.Reference})
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.Adjust(r.Context(), d, requestCurrency(account, req.Currency), req.Reason, opts...)
+	})
+}
+
+// release forcibly releases the remaining amount held by an authorization,
+// returning the updated authorization.
+func release(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		requestMetadata
+		AuthorizationID int `json:"authorizationID"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), req.requestMetadata)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		_, err := account.ReleaseAuthorization(r.Context(), req.AuthorizationID, opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return account.Authorization(req.AuthorizationID)
+	})
+}
+
+func setLimits(w http.ResponseWriter, r *http.Request) {
+	var req []struct {
+		Period string `json:"period"`
+		Amount string `json:"amount"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	limits := make([]card.Limit, len(req))
+
+	for i, v := range req {
+		limits[i].Period, err = card.ParsePeriod(v.Period)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+
+		limits[i].Amount, _, err = apd.NewFromString(v.Amount)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.SetLimits(limits)
+	})
+}
+
+func setOverdraft(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Limit *string `json:"limit"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	var limit *apd.Decimal
+
+	if req.Limit != nil {
+		limit, _, err = apd.NewFromString(*req.Limit)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.SetOverdraft(limit)
+	})
+}
+
+func setTopUp(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Threshold string  `json:"threshold"`
+		Amount    *string `json:"amount"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	var threshold, amount *apd.Decimal
+
+	if req.Amount != nil {
+		threshold, _, err = apd.NewFromString(req.Threshold)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+
+		amount, _, err = apd.NewFromString(*req.Amount)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.SetTopUp(threshold, amount)
+	})
+}
+
+func setCategoryRules(w http.ResponseWriter, r *http.Request) {
+	var rules card.CategoryRules
+
+	err := json.NewDecoder(r.Body).Decode(&rules)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.SetCategoryRules(&rules)
+	})
+}
+
+func addCurrency(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Currency string `json:"currency"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, account.AddCurrency(strings.ToUpper(req.Currency))
+	})
+}
+
+func changeStatus(w http.ResponseWriter, r *http.Request, change func(*card.Account) error) {
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return nil, change(account)
+	})
+}
+
+func freeze(w http.ResponseWriter, r *http.Request) {
+	changeStatus(w, r, (*card.Account).Freeze)
+}
+
+func unfreeze(w http.ResponseWriter, r *http.Request) {
+	changeStatus(w, r, (*card.Account).Unfreeze)
+}
+
+func closeAccount(w http.ResponseWriter, r *http.Request) {
+	changeStatus(w, r, (*card.Account).Close)
+}
+
+func deleteAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := accountID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	var force bool
+
+	v := r.URL.Query().Get("force")
+
+	if v != "" {
+		force, err = strconv.ParseBool(v)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &requestError{err})
+
+			return
+		}
+	}
+
+	err = store.DeleteAccount(r.Context(), id, func(account *card.Account) error {
+		err := checkIfMatch(r, account)
+
+		if err != nil {
+			return err
+		}
+
+		if !force && account.HasBlockedFunds() {
+			return errFundsBlocked
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	_, err = webhooks.removeAccount(id)
+
+	if err != nil {
+		requestLogger(r).Error("Failed to write webhook subscriptions", zap.Int("id", id), zap.Error(err))
+	}
+
+	requestLogger(r).Info("Account deleted", zap.Int("id", id), zap.Bool("force", force))
+	w.WriteHeader(http.StatusNoContent)
 }
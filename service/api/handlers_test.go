@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTransactionsSorted(t *testing.T) {
+	defer useTestStore(t)()
+
+	ctx := context.Background()
+	account := card.NewAccount(1)
+
+	require.NoError(t, store.CreateAccount(ctx, account))
+	require.NoError(t, store.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		// Loads of 1 to 5, so amount order is the reverse of ID order
+		for i := int64(1); i <= 5; i++ {
+			err := a.Load(ctx, apd.New(i, 0), card.DefaultCurrency)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}))
+
+	r := chi.NewRouter()
+	r.Get("/accounts/{id}/transactions", getTransactions)
+
+	get := func(query string) ([]int, int) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts/1/transactions?"+query, nil))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var page card.TransactionPage
+
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+		require.Equal(t, 5, page.Total)
+
+		var ids []int
+
+		for _, v := range page.Transactions {
+			ids = append(ids, v.ID)
+		}
+
+		return ids, page.NextCursor
+	}
+
+	for _, sort := range []string{"newest", "amount"} {
+		ids, next := get("sort=" + sort + "&limit=2")
+
+		require.Equal(t, []int{5, 4}, ids, sort)
+		require.Equal(t, 4, next)
+
+		ids, next = get("sort=" + sort + "&limit=2&cursor=4")
+
+		require.Equal(t, []int{3, 2}, ids, sort)
+		require.Equal(t, 2, next)
+
+		ids, next = get("sort=" + sort + "&limit=2&cursor=2")
+
+		require.Equal(t, []int{1}, ids, sort)
+		require.Zero(t, next)
+	}
+
+	ids, next := get("limit=2&cursor=2")
+
+	require.Equal(t, []int{3, 4}, ids)
+	require.Equal(t, 4, next)
+}
+
+func TestCreateAccountCurrency(t *testing.T) {
+	defer useTestStore(t)()
+
+	r := chi.NewRouter()
+	r.Post("/accounts", createAccount)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+
+		return w
+	}
+
+	w := post(`{"id":1,"currency":"EURO"}`)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "INVALID_CURRENCY")
+
+	_, err := store.GetAccount(context.Background(), 1)
+
+	require.Equal(t, errAccountNotFound, errors.Cause(err), "not created")
+
+	w = post(`{"id":1,"currency":"gbp"}`)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var account card.Account
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&account))
+	require.Equal(t, "GBP", account.Currency)
+}
+
+func TestGetPayouts(t *testing.T) {
+	defer useTestStore(t)()
+
+	previous := merchants
+	merchants = card.NewMerchantRegistry()
+
+	defer func() {
+		merchants = previous
+	}()
+
+	require.NoError(t, merchants.Add(card.MerchantInfo{ID: 1, Name: "Shop", MCC: "5411", Country: "GB"}))
+	require.NoError(t, store.CreateAccount(context.Background(), card.NewAccount(1), card.NewAccount(2)))
+	captureAmount(t, 1, 20)
+	captureAmount(t, 2, 30)
+
+	r := chi.NewRouter()
+	r.Get("/merchants/{merchantID}/payouts", getPayouts)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/merchants/1/payouts?"+query, nil))
+
+		return w
+	}
+
+	w := get("")
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var payout struct {
+		Totals []struct {
+			Gross string `json:"gross"`
+		} `json:"totals"`
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&payout))
+	require.Len(t, payout.Transactions, 2, "across accounts")
+	require.Len(t, payout.Totals, 1)
+	require.Equal(t, "50", payout.Totals[0].Gross)
+
+	// Statement filters payouts don't apply are refused
+	for _, v := range []string{"merchantID=2", "type=REFUND", "minAmount=25", "maxAmount=25"} {
+		w := get(v)
+
+		require.Equal(t, http.StatusBadRequest, w.Code, v)
+		require.Contains(t, w.Body.String(), "unsupported payout parameter", v)
+	}
+}
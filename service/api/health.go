@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// healthResponse reports the service status and, for readiness, the result
+// of each check.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// healthz reports the process is alive.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// readyz reports whether the service can handle requests: the accounts are
+// loaded and the database, merchant registry, webhook, settlement and audit
+// files are writable.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]error{
+		"accounts":    checkAccounts(),
+		"database":    checkDatabase(),
+		"merchants":   checkWritable(merchantsFile),
+		"webhooks":    checkWritable(webhooksFile),
+		"settlements": checkWritable(settlementsFile),
+		"audit":       checkWritable(auditFile),
+	}
+
+	res := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	statusCode := http.StatusOK
+
+	for k, err := range checks {
+		res.Checks[k] = "ok"
+
+		if err != nil {
+			res.Checks[k] = err.Error()
+			res.Status = "unavailable"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, statusCode, res)
+}
+
+// checkAccounts verifies the account store has been opened.
+func checkAccounts() error {
+	if store == nil {
+		return errors.New("accounts not loaded")
+	}
+
+	return nil
+}
+
+// checkDatabase verifies the account store's files are writable.
+func checkDatabase() error {
+	switch storeBackend {
+	case "dir":
+		return checkWritableDir(dbDir, "")
+	case "journal":
+		err := checkWritable(journalFile)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkWritable(dbFile)
+}
+
+// checkWritable verifies the given file may be opened for writing, and
+// replaced within its directory, without modifying it.
+func checkWritable(filename string) error {
+	dbFileMu.Lock()
+
+	defer dbFileMu.Unlock()
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+
+	// Files are replaced by renaming temporary files in their directory
+	dir, base := filepath.Split(filename)
+
+	return checkWritableDir(dir, base)
+}
+
+// checkWritableDir verifies a temporary file for the given base name may be
+// created in the directory.
+func checkWritableDir(dir, base string) error {
+	f, err := ioutil.TempFile(dir, "."+base+".")
+
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
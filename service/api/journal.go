@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	journalFile            string
+	journalCompactSize     int64
+	journalCompactInterval time.Duration
+)
+
+func init() {
+	flag.StringVar(&journalFile, "journal", "./journal.ndjson", "Append-only journal of account mutations, replayed over the -db snapshot by the journal store")
+	flag.Int64Var(&journalCompactSize, "journal-compact-size", 64<<20, "Journal size in bytes triggering compaction into a new snapshot, or 0 to disable")
+	flag.DurationVar(&journalCompactInterval, "journal-compact-interval", time.Hour, "Interval between journal compactions into a new snapshot, or 0 to disable")
+}
+
+// journalEntry is a journaled account mutation: the transactions it
+// recorded, if any, and the resulting account record.
+type journalEntry struct {
+	LSN          int                `json:"lsn"`
+	Timestamp    time.Time          `json:"timestamp"`
+	AccountID    int                `json:"accountID"`
+	Transactions []card.Transaction `json:"transactions,omitempty"`
+	Record       *accountRecord     `json:"record"`
+}
+
+// compaction reports the result of a journal compaction.
+type compaction struct {
+	// LSN is the last journal entry reflected by the new snapshot.
+	LSN int `json:"lsn"`
+
+	// JournalSize is the size in bytes of the journal entries appended since.
+	JournalSize int64 `json:"journalSize"`
+}
+
+// journalLog is the recordLog appending each account mutation to a journal,
+// synced before the mutation is acknowledged. The journal is replayed over
+// the last snapshot, a JSON database, on startup. Compactions, and closing
+// the log, rewrite the snapshot and discard the entries it reflects.
+type journalLog struct {
+	mu       sync.Mutex
+	filename string
+	snapshot string
+	outbox   *eventOutbox
+	f        *os.File
+	size     int64
+	lsn      int
+	full     chan struct{}
+}
+
+// journalStore is the recordStore persisting accounts to a journalLog.
+type journalStore struct {
+	*recordStore
+
+	log       *journalLog
+	compactMu sync.Mutex
+}
+
+// openJournalStore opens a recordStore journaling accounts to the given
+// file over the given snapshot.
+func openJournalStore(filename, snapshot string, outbox *eventOutbox, init func(*card.Account)) (*journalStore, error) {
+	l := &journalLog{
+		filename: filename,
+		snapshot: snapshot,
+		outbox:   outbox,
+		full:     make(chan struct{}, 1),
+	}
+
+	s, err := openRecordStore(l, "", outbox, init)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &journalStore{recordStore: s, log: l}, nil
+}
+
+// Compact writes a snapshot of every account and discards the journal
+// entries it reflects. Transactions are only blocked while the accounts are
+// copied.
+func (s *journalStore) Compact() (*compaction, error) {
+	s.compactMu.Lock()
+
+	defer s.compactMu.Unlock()
+
+	var (
+		db     database
+		offset int64
+	)
+
+	s.snapshot(func(accounts []*card.Account, events []outboxEvent) {
+		outbox := newEventOutbox()
+		outbox.restore(events)
+		db = database{Schema: schemaVersion, Accounts: accounts, Outbox: outbox}
+		db.LSN, offset = s.log.position()
+	})
+
+	size, err := s.log.compact(&db, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &compaction{db.LSN, size}, nil
+}
+
+// Rewrite rewrites the snapshot and the journal entries appended since by
+// compacting the journal.
+func (s *journalStore) Rewrite(ctx context.Context) error {
+	_, err := s.Compact()
+
+	return err
+}
+
+// Reload implements the Store interface, waiting for a compaction in
+// progress.
+func (s *journalStore) Reload(ctx context.Context, check func(current, persisted []*card.Account) error) error {
+	s.compactMu.Lock()
+
+	defer s.compactMu.Unlock()
+
+	return s.recordStore.Reload(ctx, check)
+}
+
+// Close implements the Store interface, waiting for a compaction in
+// progress.
+func (s *journalStore) Close() error {
+	s.compactMu.Lock()
+
+	defer s.compactMu.Unlock()
+
+	return s.recordStore.Close()
+}
+
+// load implements the recordLog interface. Entries already reflected by the
+// snapshot are skipped, and a final entry left incomplete by a crash, which
+// was never acknowledged, is truncated. Loading an open log, e.g. to reload
+// it, reopens the journal.
+func (l *journalLog) load() (map[int]*accountRecord, bool, error) {
+	outbox := newEventOutbox()
+	db, err := loadDB(l.snapshot, outbox)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	records := dbRecords(db.Accounts, outbox.committed())
+	lsn, size := db.LSN, int64(0)
+
+	f, err := os.OpenFile(l.filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+
+		if err == io.EOF {
+			if len(line) > 0 {
+				logger.Warn("Truncating incomplete journal entry", zap.Int64("offset", size))
+			}
+
+			break
+		} else if err != nil {
+			f.Close()
+
+			return nil, false, err
+		}
+
+		var e journalEntry
+
+		data, err := unsealLine(line)
+
+		if err == nil {
+			err = json.Unmarshal(data, &e)
+		}
+
+		if err != nil {
+			f.Close()
+
+			return nil, false, errors.Wrapf(err, "journal offset %d", size)
+		}
+
+		size += int64(len(line))
+
+		if e.LSN <= lsn {
+			continue
+		}
+
+		if e.Record == nil || e.Record.empty() {
+			delete(records, e.AccountID)
+		} else {
+			records[e.AccountID] = e.Record
+		}
+
+		lsn = e.LSN
+	}
+
+	err = f.Truncate(size)
+
+	if err != nil {
+		f.Close()
+
+		return nil, false, err
+	}
+
+	if l.f != nil {
+		l.f.Close()
+	}
+
+	l.f, l.size, l.lsn = f, size, lsn
+
+	return records, true, nil
+}
+
+// put implements the recordLog interface. The entry is synced to disk
+// before returning; an entry only partially written is truncated.
+func (l *journalLog) put(id int, rec *accountRecord) error {
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	e := journalEntry{
+		LSN:          l.lsn + 1,
+		Timestamp:    time.Now().UTC(),
+		AccountID:    id,
+		Transactions: l.outbox.staging(id),
+		Record:       rec,
+	}
+	b, err := json.Marshal(e)
+
+	if err == nil {
+		b, err = sealLine(b)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = l.f.Write(append(b, '\n'))
+
+	if err == nil {
+		err = l.f.Sync()
+	}
+
+	if err != nil {
+		l.f.Truncate(l.size)
+
+		return err
+	}
+
+	l.size += int64(len(b) + 1)
+	l.lsn = e.LSN
+
+	if journalCompactSize > 0 && l.size >= journalCompactSize {
+		select {
+		case l.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// position returns the LSN and journal offset of the last entry.
+func (l *journalLog) position() (int, int64) {
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	return l.lsn, l.size
+}
+
+// compact writes the given snapshot, then replaces the journal with the
+// entries appended after the given offset, returning their size. A crash
+// before the journal is replaced leaves entries already reflected by the
+// snapshot, which are skipped.
+func (l *journalLog) compact(db *database, offset int64) (int64, error) {
+	err := writeDB(l.snapshot, db)
+
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	dir, base := filepath.Split(l.filename)
+	f, err := ioutil.TempFile(dir, "."+base+".")
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Removing the temporary file fails harmlessly once it's renamed
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, io.NewSectionReader(l.f, offset, l.size-offset))
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	f.Close()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(f.Name(), l.filename)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = syncDir(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Appends continue on the new journal
+	nf, err := os.OpenFile(l.filename, os.O_RDWR|os.O_APPEND, 0600)
+
+	if err != nil {
+		return 0, err
+	}
+
+	l.f.Close()
+	l.f, l.size = nf, l.size-offset
+
+	return l.size, nil
+}
+
+// close implements the recordLog interface. The snapshot is rewritten with
+// the given accounts and the journal emptied; entries left by a crash between
+// the two are already reflected by the snapshot, so they're skipped.
+func (l *journalLog) close(accounts []*card.Account) error {
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	err := writeDB(l.snapshot, database{Schema: schemaVersion, Accounts: accounts, Outbox: l.outbox, LSN: l.lsn})
+
+	if err != nil {
+		return err
+	}
+
+	err = l.f.Truncate(0)
+
+	if err == nil {
+		err = l.f.Sync()
+	}
+
+	if err != nil {
+		l.f.Close()
+
+		return err
+	}
+
+	l.size = 0
+
+	return l.f.Close()
+}
+
+// compactJournal compacts the journal of the journal store every compaction
+// interval, and whenever it exceeds the compaction size, until the given
+// context is cancelled. Other stores aren't compacted.
+func compactJournal(ctx context.Context) {
+	s, ok := store.(*journalStore)
+
+	if !ok {
+		return
+	}
+
+	var tick <-chan time.Time
+
+	if journalCompactInterval > 0 {
+		ticker := time.NewTicker(journalCompactInterval)
+
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-s.log.full:
+		}
+
+		c, err := s.Compact()
+
+		if err != nil {
+			logger.Error("Failed to compact journal", zap.Error(err))
+
+			continue
+		}
+
+		logger.Info("Compacted journal", zap.Int("lsn", c.LSN), zap.Int64("size", c.JournalSize))
+	}
+}
+
+func compactStore(w http.ResponseWriter, r *http.Request) {
+	s, ok := store.(*journalStore)
+
+	if !ok {
+		writeError(w, errorStatus(errUnsupportedStore), errUnsupportedStore)
+
+		return
+	}
+
+	c, err := s.Compact()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
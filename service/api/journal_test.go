@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// openTestJournal opens a journal store in the given directory, staging
+// events in a new outbox.
+func openTestJournal(t *testing.T, dir string) *journalStore {
+	o := newEventOutbox()
+	s, err := openJournalStore(filepath.Join(dir, "journal.ndjson"), filepath.Join(dir, "db.json"), o, stageEvents(o))
+
+	require.NoError(t, err)
+
+	return s
+}
+
+// crash closes the journal of the given store without writing a snapshot,
+// as if the service had crashed.
+func crash(t *testing.T, s *journalStore) {
+	require.NoError(t, s.log.f.Close())
+}
+
+func TestJournalReplay(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	s := openTestJournal(t, dir)
+
+	mutateStore(t, s)
+
+	state := storeState(t, s)
+	filename := filepath.Join(dir, "journal.ndjson")
+
+	crash(t, s)
+
+	fi, err := os.Stat(filename)
+
+	require.NoError(t, err)
+	require.NotZero(t, fi.Size())
+
+	// An entry left incomplete by the crash
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0600)
+
+	require.NoError(t, err)
+
+	_, err = f.WriteString(`{"lsn":99,"accountID":2,"rec`)
+
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = openTestJournal(t, dir)
+
+	require.Equal(t, state, storeState(t, s))
+
+	truncated, err := os.Stat(filename)
+
+	require.NoError(t, err)
+	require.Equal(t, fi.Size(), truncated.Size(), "incomplete entry truncated")
+
+	// Closing writes a snapshot, emptying the journal
+	require.NoError(t, s.Close())
+
+	s = openTestJournal(t, dir)
+
+	defer s.Close()
+
+	require.Equal(t, state, storeState(t, s))
+}
+
+func TestJournalCompaction(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	filename := filepath.Join(dir, "journal.ndjson")
+	s := openTestJournal(t, dir)
+
+	mutateStore(t, s)
+
+	journal, err := ioutil.ReadFile(filename)
+
+	require.NoError(t, err)
+
+	c, err := s.Compact()
+
+	require.NoError(t, err)
+	require.NotZero(t, c.LSN)
+	require.Zero(t, c.JournalSize)
+
+	require.NoError(t, s.UpdateAccount(ctx, 2, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(50, 0), card.DefaultCurrency)
+	}))
+
+	state := storeState(t, s)
+
+	crash(t, s)
+
+	s = openTestJournal(t, dir)
+
+	require.Equal(t, state, storeState(t, s), "snapshot and journal replayed")
+
+	crash(t, s)
+
+	// A crash before the journal is replaced leaves the compacted entries,
+	// which the snapshot already reflects
+	compacted, err := ioutil.ReadFile(filename)
+
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filename, append(journal, compacted...), 0600))
+
+	s = openTestJournal(t, dir)
+
+	defer s.Close()
+
+	require.Equal(t, state, storeState(t, s), "compacted entries skipped")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// accountFields is the set of JSON fields of accounts.
+var accountFields = map[string]bool{}
+
+func init() {
+	t := reflect.TypeOf(card.Account{})
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+
+		if name != "" && name != "-" {
+			accountFields[name] = true
+		}
+	}
+
+	// Encoded by the account's JSON methods
+	accountFields["decimal"] = true
+}
+
+// expandable clears the collections of an account omitted from listings
+// unless named by the expand parameter, if given.
+var expandable = map[string]func(*card.Account){
+	"authorizations":  func(a *card.Account) { a.Authorizations = nil },
+	"disputes":        func(a *card.Account) { a.Disputes = nil },
+	"idempotencyKeys": func(a *card.Account) { a.IdempotencyKeys = nil },
+	"limits":          func(a *card.Account) { a.Limits = nil },
+	"mandates":        func(a *card.Account) { a.Mandates = nil },
+	"merchants":       func(a *card.Account) { a.Merchants = nil },
+	"pockets":         func(a *card.Account) { a.Pockets = nil },
+	"schedules":       func(a *card.Account) { a.Schedules = nil },
+	"transactions":    func(a *card.Account) { a.Transactions = nil },
+}
+
+// accountView selects the parts of accounts encoded by listings.
+type accountView struct {
+	// fields lists the fields encoded, in order; nil encodes every field.
+	fields []string
+
+	// omit clears the collections not expanded.
+	omit []func(*card.Account)
+}
+
+// listParam returns the comma-separated values of the given query parameter,
+// and whether it's given.
+func listParam(r *http.Request, name string) ([]string, bool) {
+	v, exists := r.URL.Query()[name]
+
+	if !exists {
+		return nil, false
+	}
+
+	var res []string
+
+	for _, s := range strings.Split(strings.Join(v, ","), ",") {
+		s = strings.TrimSpace(s)
+
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+
+	return res, true
+}
+
+// parseAccountView returns the view selected by the fields and expand query
+// parameters. Without expand, every collection is included.
+func parseAccountView(r *http.Request) (*accountView, error) {
+	v := &accountView{}
+	fields, exists := listParam(r, "fields")
+
+	if exists {
+		if len(fields) == 0 {
+			return nil, errors.New("fields must name at least one field")
+		}
+
+		for _, f := range fields {
+			if !accountFields[f] {
+				return nil, errors.Errorf("unknown field %q", f)
+			}
+		}
+
+		v.fields = fields
+	}
+
+	expand, exists := listParam(r, "expand")
+
+	if !exists {
+		return v, nil
+	}
+
+	expanded := make(map[string]bool, len(expand))
+
+	for _, f := range expand {
+		_, ok := expandable[f]
+
+		if !ok {
+			return nil, errors.Errorf("%q can't be expanded", f)
+		}
+
+		expanded[f] = true
+	}
+
+	for f, fn := range expandable {
+		if !expanded[f] {
+			v.omit = append(v.omit, fn)
+		}
+	}
+
+	return v, nil
+}
+
+// encode returns the JSON encoding of the given account's view. The account
+// isn't modified.
+func (v *accountView) encode(a *card.Account) ([]byte, error) {
+	if len(v.omit) > 0 {
+		c := *a
+
+		for _, fn := range v.omit {
+			fn(&c)
+		}
+
+		a = &c
+	}
+
+	b, err := json.Marshal(a)
+
+	if err != nil || v.fields == nil {
+		return b, err
+	}
+
+	var m map[string]json.RawMessage
+
+	err = json.Unmarshal(b, &m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, f := range v.fields {
+		raw, exists := m[f]
+
+		if !exists {
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(f)
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(raw)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
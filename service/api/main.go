@@ -12,54 +12,262 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
 	"go.uber.org/zap"
 )
 
-var logger *zap.Logger
+var (
+	logger            *zap.Logger
+	addr              string
+	precision         uint
+	rounding          string
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+	maxHeaderBytes    int
+	maxBodyBytes      int64
+)
+
+func init() {
+	flag.StringVar(&addr, "addr", "0.0.0.0:8080", "API address")
+	flag.UintVar(&precision, "precision", card.DefaultPrecision, "Decimal precision")
+	flag.StringVar(&rounding, "rounding", card.DefaultRounding, "Decimal rounding mode")
+	flag.DurationVar(&readTimeout, "read-timeout", 30*time.Second, "Maximum duration for reading a request, including the body")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 10*time.Second, "Maximum duration for reading request headers")
+	flag.DurationVar(&writeTimeout, "write-timeout", time.Minute, "Maximum duration for writing a response")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "Maximum keep-alive idle duration")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 5*time.Second, "Maximum duration to wait for in-flight requests on shutdown")
+	flag.IntVar(&maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum request header size in bytes")
+	flag.Int64Var(&maxBodyBytes, "max-body-bytes", 10<<20, "Maximum mutating request body size in bytes")
+}
 
 func main() {
+	registerAliases()
+	flag.Parse()
 	initLogger()
 
-	var err error
-	accounts, accountsMap, err = loadDB(dbFile)
+	err := loadConfig()
+
+	if err != nil {
+		logger.Fatal("Invalid configuration", zap.Error(err))
+	}
+
+	if printConfig {
+		err = writeConfig(os.Stdout)
+
+		if err != nil {
+			logger.Fatal("Failed to print configuration", zap.Error(err))
+		}
+
+		return
+	}
+
+	err = card.SetDecimalContext(uint32(precision), rounding)
+
+	if err != nil {
+		logger.Fatal("Invalid decimal settings", zap.Error(err))
+	}
+
+	keys, err = parseKeys(encryptionKeys)
+
+	if err != nil {
+		logger.Fatal("Invalid encryption keys", zap.Error(err))
+	}
+
+	store, err = openStore()
 
 	if err != nil {
 		logger.Fatal("Failed to load accounts", zap.Error(err))
 	}
 
-	var addr string
+	// Migrations leave the source store as it was loaded
+	if migrateTo != "" {
+		m, err := migrateStore(context.Background(), store, migrateTo)
+
+		if err != nil {
+			logger.Fatal("Failed to migrate accounts", zap.Error(err))
+		}
+
+		logger.Info("Migrated accounts",
+			zap.String("target", migrateTo),
+			zap.Int("accounts", m.Accounts),
+			zap.Int("events", m.Events),
+			zap.String("checksum", m.Checksum),
+		)
+
+		return
+	}
+
+	merchants, err = loadMerchants(merchantsFile)
+
+	if err != nil {
+		logger.Fatal("Failed to load merchants", zap.Error(err))
+	}
+
+	err = loadWebhooks(webhooksFile)
+
+	if err != nil {
+		logger.Fatal("Failed to load webhooks", zap.Error(err))
+	}
+
+	err = loadSettlements(settlementsFile)
+
+	if err != nil {
+		logger.Fatal("Failed to load settlements", zap.Error(err))
+	}
+
+	audit, err = openAuditLog(auditFile)
+
+	if err != nil {
+		logger.Fatal("Failed to open audit log", zap.Error(err))
+	}
+
+	err = reencrypt(context.Background())
 
-	flag.StringVar(&addr, "a", "0.0.0.0:8080", "API address")
+	if err != nil {
+		logger.Fatal("Failed to re-encrypt database", zap.Error(err))
+	}
+
+	if reconcileOnStartup {
+		_, err = reconcile(context.Background())
+
+		if err != nil {
+			logger.Fatal("Failed to reconcile accounts", zap.Error(err))
+		}
+	}
 
 	r := chi.NewRouter()
-	r.Get("/accounts", getAccounts)
-	r.Post("/accounts", createAccount)
-	r.Get("/accounts/{id}", getAccount)
-	r.Get("/accounts/{id}/statement", statement)
-	r.Post("/accounts/{id}/load", load)
-	r.Post("/accounts/{id}/authorize", authorize)
-	r.Post("/accounts/{id}/capture", capture)
-	r.Post("/accounts/{id}/reverse", reverse)
-	r.Post("/accounts/{id}/refund", refund)
-
-	s := &http.Server{Addr: addr, Handler: r}
+	r.Use(requestID)
+	r.Use(accessLog)
+	r.Use(cors)
+	r.Get("/healthz", healthz)
+	r.Get("/readyz", readyz)
+	r.Get("/openapi.json", openAPI)
+	r.Get("/docs", docs)
+	mountVersions(r, apiRoutes)
+
+	s := &http.Server{
+		Addr:              addr,
+		Handler:           r,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
 
 	go func() {
-		logger.Info("Starting server", zap.String("address", addr))
+		logger.Info("Starting server", zap.String("address", addr), zap.Bool("tls", tlsEnabled()))
 
-		err := s.ListenAndServe()
+		err := listen(s)
 
 		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Server failed to listen", zap.Error(err))
 		}
 	}()
 
-	stop := make(chan os.Signal)
+	var redirect *http.Server
+
+	if tlsEnabled() && redirectAddr != "" {
+		redirect = newRedirectServer(redirectAddr, addr)
+
+		go func() {
+			logger.Info("Starting HTTPS redirect", zap.String("address", redirectAddr))
+
+			err := redirect.ListenAndServe()
+
+			if err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Redirect server failed to listen", zap.Error(err))
+			}
+		}()
+	}
+
+	var profiler *http.Server
+
+	if pprofAddr != "" {
+		profiler = newPprofServer(pprofAddr)
+
+		go func() {
+			logger.Info("Starting profiler", zap.String("address", pprofAddr))
+
+			err := profiler.ListenAndServe()
+
+			if err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Profiler failed to listen", zap.Error(err))
+			}
+		}()
+	}
+
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+
+	go dispatchWebhooks(webhookCtx)
+
+	relayDone := make(chan struct{})
+
+	go func() {
+		relayOutbox(webhookCtx)
+		close(relayDone)
+	}()
+
+	sweepDone := make(chan struct{})
+
+	go func() {
+		sweepAuthorizations(sweepCtx, sweepInterval, sweepJitter)
+		close(sweepDone)
+	}()
+
+	scheduleCtx, stopSchedules := context.WithCancel(context.Background())
+	scheduleDone := make(chan struct{})
+
+	go func() {
+		runSchedules(scheduleCtx, scheduleInterval)
+		close(scheduleDone)
+	}()
+
+	settleCtx, stopSettlements := context.WithCancel(context.Background())
+	settleDone := make(chan struct{})
+
+	go func() {
+		if settlementInterval > 0 {
+			runSettlements(settleCtx, settlementInterval)
+		}
+
+		close(settleDone)
+	}()
+
+	compactCtx, stopCompaction := context.WithCancel(context.Background())
+	compactDone := make(chan struct{})
+
+	go func() {
+		compactJournal(compactCtx)
+		close(compactDone)
+	}()
+
+	flushCtx, stopFlush := context.WithCancel(context.Background())
+	flushDone := make(chan struct{})
+
+	go func() {
+		flushWrites(flushCtx)
+		close(flushDone)
+	}()
+
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	reloadDone := make(chan struct{})
+
+	go func() {
+		reloadOnHangup(reloadCtx)
+		close(reloadDone)
+	}()
+
+	stop := make(chan os.Signal, 1)
 
 	signal.Notify(
 		stop,
 		os.Interrupt,
-		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
@@ -68,17 +276,135 @@ func main() {
 	<-stop
 
 	logger.Info("Shutting down server")
+	stopSweep()
+	stopSchedules()
+	stopSettlements()
+	stopCompaction()
+	stopReload()
 
-	// Shut down gracefully, but wait no longer than 5 seconds before halting
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Shut down gracefully, but wait no longer than the shutdown timeout for
+	// in-flight requests before halting
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 
 	defer cancel()
 
-	s.Shutdown(ctx)
+	err = s.Shutdown(ctx)
+
+	if err != nil {
+		logger.Error("Server shutdown timed out", zap.Error(err))
+	}
+
+	if redirect != nil {
+		redirect.Shutdown(ctx)
+	}
+
+	if profiler != nil {
+		profiler.Shutdown(ctx)
+	}
+
+	<-sweepDone
+	<-scheduleDone
+	<-settleDone
+	<-compactDone
+	<-reloadDone
+
+	// Mutations still queued are written when the store is closed
+	stopFlush()
+	<-flushDone
+
+	// Stop publishing before the final write; events not yet sent remain in
+	// the outbox
+	stopWebhooks()
+	<-relayDone
+
+	err = flushDB()
+
+	if err != nil {
+		logger.Error("Failed to write to database", zap.Error(err))
+	}
 
 	logger.Info("Server gracefully stopped")
 }
 
+// apiRoutes registers the authenticated API routes.
+func apiRoutes(r chi.Router) {
+	admin := allow(roleAdmin)
+	own := allow(roleAdmin, roleCardholder)
+	settle := allow(roleAdmin, roleMerchant)
+	all := allow(roleAdmin, roleCardholder, roleMerchant)
+
+	r.Use(auditTrail)
+	r.Use(authenticate)
+	r.Use(requestDurability)
+	r.With(admin).Get("/accounts", getAccounts)
+	r.With(admin).Post("/accounts", createAccount)
+	r.With(admin).Post("/accounts:batch", createAccounts)
+	r.With(own).Get("/accounts/{id}", getAccount)
+	r.With(admin).Delete("/accounts/{id}", deleteAccount)
+	r.With(own).Get("/accounts/{id}/balance", getBalance)
+	r.With(own).Get("/accounts/{id}/merchants", getMerchantHoldings)
+	r.With(own).Get("/accounts/{id}/merchants/{merchantID}", getMerchantHolding)
+	r.With(admin).Get("/statements", consolidatedStatement)
+	r.With(admin).Get("/audit", getAudit)
+	r.With(admin).Post("/admin/compact", compactStore)
+	r.With(admin).Post("/admin/backup", backupStore)
+	r.With(admin).Post("/admin/restore", restoreStore)
+	r.With(admin).Post("/admin/reload", reloadStore)
+	r.With(admin).Post("/admin/reconcile", reconcileStore)
+	r.With(own).Get("/accounts/{id}/statement", statement)
+	r.With(own).Get("/accounts/{id}/export", export)
+	r.With(own).Get("/accounts/{id}/summary", summary)
+	r.With(own).Get("/accounts/{id}/transactions", getTransactions)
+	r.With(own).Get("/accounts/{id}/transactions.ndjson", exportJSONLines)
+	r.With(admin).Post("/accounts/{id}/transactions:batch", batch)
+	r.With(own).Get("/accounts/{id}/transactions/{transactionID}", getTransaction)
+	r.With(own).Post("/accounts/{id}/load", load)
+	r.With(own).Post("/accounts/{id}/authorize", authorize)
+	r.With(settle).Post("/accounts/{id}/capture", capture)
+	r.With(settle).Post("/accounts/{id}/reverse", reverse)
+	r.With(settle).Post("/accounts/{id}/refund", refund)
+	r.With(admin).Post("/accounts/{id}/adjust", adjust)
+	r.With(admin).Post("/accounts/{id}/release", release)
+	r.With(admin).Post("/accounts/{id}/freeze", freeze)
+	r.With(admin).Post("/accounts/{id}/unfreeze", unfreeze)
+	r.With(admin).Post("/accounts/{id}/close", closeAccount)
+	r.With(admin).Put("/accounts/{id}/limits", setLimits)
+	r.With(admin).Put("/accounts/{id}/overdraft", setOverdraft)
+	r.With(admin).Put("/accounts/{id}/top-up", setTopUp)
+	r.With(admin).Put("/accounts/{id}/rules", setCategoryRules)
+	r.With(admin).Post("/accounts/{id}/currencies", addCurrency)
+	r.With(own).Get("/accounts/{id}/schedules", getSchedules)
+	r.With(admin).Post("/accounts/{id}/schedules", createSchedule)
+	r.With(own).Get("/accounts/{id}/schedules/{scheduleID}", getSchedule)
+	r.With(admin).Put("/accounts/{id}/schedules/{scheduleID}", updateSchedule)
+	r.With(admin).Delete("/accounts/{id}/schedules/{scheduleID}", deleteSchedule)
+	r.With(own).Get("/accounts/{id}/disputes", getDisputes)
+	r.With(own).Post("/accounts/{id}/disputes", openDispute)
+	r.With(own).Get("/accounts/{id}/disputes/{disputeID}", getDispute)
+	r.With(admin).Post("/accounts/{id}/disputes/{disputeID}/accept", acceptDispute)
+	r.With(admin).Post("/accounts/{id}/disputes/{disputeID}/reject", rejectDispute)
+	r.With(own).Get("/accounts/{id}/mandates", getMandates)
+	r.With(own).Post("/accounts/{id}/mandates", createMandate)
+	r.With(own).Get("/accounts/{id}/mandates/{mandateID}", getMandate)
+	r.With(own).Post("/accounts/{id}/mandates/{mandateID}/revoke", revokeMandate)
+	r.With(settle).Post("/accounts/{id}/mandates/{mandateID}/pull", pull)
+	r.With(admin).Get("/accounts/{id}/webhooks", getWebhooks)
+	r.With(admin).Post("/accounts/{id}/webhooks", createWebhook)
+	r.With(admin).Get("/accounts/{id}/webhooks/{webhookID}", getWebhook)
+	r.With(admin).Put("/accounts/{id}/webhooks/{webhookID}", updateWebhook)
+	r.With(admin).Delete("/accounts/{id}/webhooks/{webhookID}", deleteWebhook)
+	r.With(all).Get("/merchants", getMerchants)
+	r.With(admin).Post("/merchants", createMerchant)
+	r.With(all).Get("/merchants/{merchantID}", getMerchant)
+	r.With(admin).Put("/merchants/{merchantID}", updateMerchant)
+	r.With(admin).Delete("/merchants/{merchantID}", deleteMerchant)
+	r.With(admin).Get("/merchants/{merchantID}/payouts", getPayouts)
+	r.With(admin).Get("/settlements", getSettlements)
+	r.With(admin).Post("/settlements", createSettlement)
+	r.With(admin).Get("/settlements/{settlementID}", getSettlement)
+	r.With(admin).Get("/settlements/{settlementID}/merchants/{merchantID}", getSettlementReport)
+}
+
 func initLogger() {
 	var (
 		err    error
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+)
+
+func getMandateID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "mandateID"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func getMandates(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account.ListMandates())
+}
+
+func createMandate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MerchantID int    `json:"merchantID"`
+		Limit      string `json:"limit"`
+		Currency   string `json:"currency"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	limit, _, err := apd.NewFromString(req.Limit)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	updateAccountStatus(w, r, http.StatusCreated, func(account *card.Account) (interface{}, error) {
+		return account.AddMandate(req.MerchantID, limit, requestCurrency(account, req.Currency))
+	})
+}
+
+func getMandate(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getMandateID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	m, err := account.Mandate(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+func revokeMandate(w http.ResponseWriter, r *http.Request) {
+	id, err := getMandateID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return account.RevokeMandate(id)
+	})
+}
+
+// pull authorizes and captures a payment under a mandate, returning the
+// captured authorization.
+func pull(w http.ResponseWriter, r *http.Request) {
+	id, err := getMandateID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		requestMetadata
+		Amount string `json:"amount"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	d, _, err := apd.NewFromString(req.Amount)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	opts, err := transactionOptions(r.Header.Get("Idempotency-Key"), req.requestMetadata)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		m, err := account.Mandate(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkMerchant(r, m.MerchantID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return account.Pull(r.Context(), id, d, opts...)
+	})
+}
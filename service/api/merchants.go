@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+var (
+	merchantsFile string
+	merchants     = card.NewMerchantRegistry()
+)
+
+func init() {
+	flag.StringVar(&merchantsFile, "merchants", "./merchants.json", "JSON merchant registry")
+}
+
+func loadMerchants(filename string) (*card.MerchantRegistry, error) {
+	dbFileMu.Lock()
+
+	defer dbFileMu.Unlock()
+
+	r := card.NewMerchantRegistry()
+	f, err := os.Open(filename)
+
+	if os.IsNotExist(err) {
+		f, err = os.Create(filename)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return r, f.Close()
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	data, err := unsealReader(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.NewDecoder(data).Decode(r)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func updateMerchants(w http.ResponseWriter, statusCode int, i interface{}) {
+	err := writeDB(merchantsFile, merchants)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, statusCode, i)
+}
+
+func getMerchantID(w http.ResponseWriter, r *http.Request) (int, error) {
+	idParam := chi.URLParam(r, "merchantID")
+	id, err := strconv.Atoi(idParam)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func decodeMerchant(w http.ResponseWriter, r *http.Request) (card.MerchantInfo, error) {
+	var m card.MerchantInfo
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+	}
+
+	return m, err
+}
+
+func getMerchants(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, merchants.List())
+}
+
+func createMerchant(w http.ResponseWriter, r *http.Request) {
+	m, err := decodeMerchant(w, r)
+
+	if err != nil {
+		return
+	}
+
+	err = merchants.Add(m)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateMerchants(w, http.StatusCreated, m)
+}
+
+func getMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	m, err := merchants.Get(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+func updateMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	m, err := decodeMerchant(w, r)
+
+	if err != nil {
+		return
+	}
+
+	m.ID = id
+	err = merchants.Update(m)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	updateMerchants(w, http.StatusOK, m)
+}
+
+func deleteMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	err = merchants.Delete(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	err = writeDB(merchantsFile, merchants)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getPayouts reports the merchant's captures and refunds across all accounts
+// over the period given by the from and to parameters, with the gross,
+// refunded, fee and net amounts per currency, as JSON or, with format=csv,
+// CSV. The other statement filters are refused: payouts cover every capture
+// and refund of the merchant.
+func getPayouts(w http.ResponseWriter, r *http.Request) {
+	id, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	for _, v := range []string{"merchantID", "type", "minAmount", "maxAmount"} {
+		if r.URL.Query().Get(v) != "" {
+			writeError(w, http.StatusBadRequest, &requestError{errors.Errorf("unsupported payout parameter %q", v)})
+
+			return
+		}
+	}
+
+	filter, err := statementFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, &requestError{errors.Errorf("unsupported payout format %q", format)})
+
+		return
+	}
+
+	m, err := merchants.Get(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	// Published accounts are immutable, so they're read without copies
+	var accounts []*card.Account
+
+	err = store.WalkAccounts(r.Context(), func(a *card.Account) error {
+		accounts = append(accounts, a)
+
+		return nil
+	})
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	payout, err := card.MerchantPayout(accounts, m, filter.From, filter.To)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		err = payout.WriteCSV(w)
+
+		if err != nil {
+			recordError(w, err)
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payout)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+var migrateTo string
+
+func init() {
+	flag.StringVar(&migrateTo, "migrate-to", "", "Copy every account from the store selected by -store to a new store and exit: dir:DIR, file:FILE or journal:JOURNAL,SNAPSHOT")
+}
+
+// storeMigration reports the result of a store migration.
+type storeMigration struct {
+	Accounts int
+	Events   int
+
+	// Checksum is the SHA-256 of the checksums of every account, in
+	// creation order.
+	Checksum string
+}
+
+// parseTarget parses a migration target into its backend and paths.
+func parseTarget(target string) (string, []string, error) {
+	i := strings.IndexByte(target, ':')
+
+	if i < 0 {
+		return "", nil, errors.Errorf("invalid migration target %q", target)
+	}
+
+	backend, paths := target[:i], strings.Split(target[i+1:], ",")
+	n := 1
+
+	switch backend {
+	case "journal":
+		n = 2
+	case "dir", "file":
+	default:
+		return "", nil, errors.Errorf("unknown store %q", backend)
+	}
+
+	if len(paths) != n {
+		return "", nil, errors.Errorf("the %s store requires %d paths", backend, n)
+	}
+
+	for _, v := range paths {
+		if v == "" {
+			return "", nil, errors.Errorf("the %s store requires %d paths", backend, n)
+		}
+	}
+
+	return backend, paths, nil
+}
+
+// openBackend opens the store of the given backend at the given paths. The
+// service hooks aren't attached to its accounts.
+func openBackend(backend string, paths []string, outbox *eventOutbox) (Store, error) {
+	init := func(*card.Account) {}
+
+	switch backend {
+	case "dir":
+		return openDirStore(paths[0], "", outbox, init)
+	case "journal":
+		return openJournalStore(paths[0], paths[1], outbox, init)
+	}
+
+	return openFileStore(paths[0], outbox, init)
+}
+
+// migrateStore copies every account, and the events awaiting publication,
+// from the given store to a new store at the given target, then verifies the
+// copy by reopening the new store and comparing the checksum of every
+// account. The target's files must not exist.
+func migrateStore(ctx context.Context, source Store, target string) (*storeMigration, error) {
+	backend, paths, err := parseTarget(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range paths {
+		_, err = os.Stat(v)
+
+		if err == nil {
+			return nil, errors.Errorf("%s already exists", v)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	var (
+		accounts []*card.Account
+		events   []outboxEvent
+	)
+
+	err = source.Snapshot(ctx, func(a []*card.Account, e []outboxEvent) {
+		accounts, events = a, e
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := accountChecksums(accounts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := openBackend(backend, paths, newEventOutbox())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Restore(ctx, accounts, events)
+
+	if err != nil {
+		s.Close()
+
+		return nil, err
+	}
+
+	err = s.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Reopening the store validates every account
+	outbox := newEventOutbox()
+	s, err = openBackend(backend, paths, outbox)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "verifying")
+	}
+
+	defer s.Close()
+
+	copied, err := s.ListAccounts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCopy(checksums, copied, events, outbox.committed())
+
+	if err != nil {
+		return nil, errors.Wrap(err, "verifying")
+	}
+
+	h := sha256.New()
+
+	for _, v := range checksums {
+		h.Write([]byte(v))
+	}
+
+	return &storeMigration{len(accounts), len(events), hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// accountChecksums returns the SHA-256 checksums of the JSON encoding of the
+// given accounts.
+func accountChecksums(accounts []*card.Account) ([]string, error) {
+	res := make([]string, len(accounts))
+
+	for i, v := range accounts {
+		b, err := json.Marshal(v)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "account %d", v.ID)
+		}
+
+		sum := sha256.Sum256(b)
+		res[i] = hex.EncodeToString(sum[:])
+	}
+
+	return res, nil
+}
+
+// verifyCopy checks the copied accounts and events match the given checksums
+// and events.
+func verifyCopy(checksums []string, accounts []*card.Account, events, copiedEvents []outboxEvent) error {
+	if len(accounts) != len(checksums) {
+		return errors.Errorf("copied %d of %d accounts", len(accounts), len(checksums))
+	}
+
+	copiedChecksums, err := accountChecksums(accounts)
+
+	if err != nil {
+		return err
+	}
+
+	for i, v := range copiedChecksums {
+		if v != checksums[i] {
+			return errors.Errorf("account %d: checksum mismatch", accounts[i].ID)
+		}
+	}
+
+	if len(copiedEvents) != len(events) {
+		return errors.Errorf("copied %d of %d events", len(copiedEvents), len(events))
+	}
+
+	for i, v := range copiedEvents {
+		if v.ID != events[i].ID || v.AccountID != events[i].AccountID {
+			return errors.Errorf("event %d: mismatch", events[i].ID)
+		}
+	}
+
+	return nil
+}
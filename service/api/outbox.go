@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/martingallagher/card"
+	"go.uber.org/zap"
+)
+
+// outbox holds the transaction events awaiting publication. It's persisted
+// with the accounts so events survive a crash between an account mutation
+// and its publication.
+var outbox = newEventOutbox()
+
+// outboxEvent is a transaction event awaiting publication.
+type outboxEvent struct {
+	ID          int              `json:"id"`
+	AccountID   int              `json:"accountID"`
+	Transaction card.Transaction `json:"transaction"`
+}
+
+// eventOutbox is a persistent queue of transaction events. Events recorded
+// by an account mutation are staged, per account, until the mutation is
+// written to the database, then committed for publication; events of
+// mutations that are rolled back are discarded. Events of mutations persisted
+// asynchronously are held, no longer discarded by rollbacks, until the
+// mutation is written. Committed events remain until they're marked sent.
+// It's safe for concurrent use.
+type eventOutbox struct {
+	mu       sync.Mutex
+	lastID   int
+	events   []outboxEvent
+	staged   map[int][]outboxEvent
+	held     map[int][]outboxEvent
+	inFlight map[int]bool
+	dirty    map[int]bool
+	ready    chan struct{}
+}
+
+type eventOutboxJSON struct {
+	LastID int           `json:"lastID"`
+	Events []outboxEvent `json:"events"`
+}
+
+func newEventOutbox() *eventOutbox {
+	return &eventOutbox{
+		staged:   map[int][]outboxEvent{},
+		held:     map[int][]outboxEvent{},
+		inFlight: map[int]bool{},
+		dirty:    map[int]bool{},
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface. Staged and held
+// events are included so they're written with the mutation that recorded
+// them.
+func (o *eventOutbox) MarshalJSON() ([]byte, error) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	events := append([]outboxEvent{}, o.events...)
+
+	for _, v := range o.held {
+		events = append(events, v...)
+	}
+
+	for _, v := range o.staged {
+		events = append(events, v...)
+	}
+
+	sortEvents(events)
+
+	return json.Marshal(eventOutboxJSON{o.lastID, events})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (o *eventOutbox) UnmarshalJSON(data []byte) error {
+	var v eventOutboxJSON
+
+	err := json.Unmarshal(data, &v)
+
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	o.lastID, o.events = v.LastID, v.Events
+	o.staged, o.held = map[int][]outboxEvent{}, map[int][]outboxEvent{}
+	o.mu.Unlock()
+
+	return nil
+}
+
+// restore adds the given persisted events, continuing event IDs after the
+// last of them.
+func (o *eventOutbox) restore(events []outboxEvent) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	o.events = append(o.events, events...)
+	sortEvents(o.events)
+
+	if n := len(o.events); n > 0 && o.events[n-1].ID > o.lastID {
+		o.lastID = o.events[n-1].ID
+	}
+}
+
+// reset replaces the committed events, e.g. with events restored from a
+// backup, dropping held events. Event IDs continue after the last issued or
+// restored.
+func (o *eventOutbox) reset(events []outboxEvent) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	o.events = append([]outboxEvent{}, events...)
+	o.held = map[int][]outboxEvent{}
+	sortEvents(o.events)
+
+	if n := len(o.events); n > 0 && o.events[n-1].ID > o.lastID {
+		o.lastID = o.events[n-1].ID
+	}
+
+	o.signal()
+}
+
+// committed returns the committed events.
+func (o *eventOutbox) committed() []outboxEvent {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	return append([]outboxEvent{}, o.events...)
+}
+
+// staging returns the transactions of the events held and staged for the
+// account, i.e. recorded by mutations not yet written.
+func (o *eventOutbox) staging(accountID int) []card.Transaction {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	var res []card.Transaction
+
+	for _, v := range o.held[accountID] {
+		res = append(res, v.Transaction)
+	}
+
+	for _, v := range o.staged[accountID] {
+		res = append(res, v.Transaction)
+	}
+
+	return res
+}
+
+// pending returns the account's committed, held and staged events awaiting
+// publication.
+func (o *eventOutbox) pending(accountID int) []outboxEvent {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	var res []outboxEvent
+
+	for _, v := range o.events {
+		if v.AccountID == accountID {
+			res = append(res, v)
+		}
+	}
+
+	res = append(res, o.held[accountID]...)
+
+	return append(res, o.staged[accountID]...)
+}
+
+// stage records the account's transaction for publication once the mutation
+// is written.
+func (o *eventOutbox) stage(accountID int, t card.Transaction) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	o.lastID++
+	o.staged[accountID] = append(o.staged[accountID], outboxEvent{o.lastID, accountID, t})
+}
+
+// hold keeps the events staged for the given accounts until they're
+// committed, e.g. once the mutation that staged them is persisted
+// asynchronously.
+func (o *eventOutbox) hold(accountIDs ...int) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	for _, id := range accountIDs {
+		if len(o.staged[id]) > 0 {
+			o.held[id] = append(o.held[id], o.staged[id]...)
+		}
+
+		delete(o.staged, id)
+	}
+}
+
+// commit releases the events held and staged for the given accounts for
+// publication.
+func (o *eventOutbox) commit(accountIDs ...int) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	n := len(o.events)
+
+	for _, id := range accountIDs {
+		o.events = append(o.events, o.held[id]...)
+		o.events = append(o.events, o.staged[id]...)
+		delete(o.held, id)
+		delete(o.staged, id)
+	}
+
+	if len(o.events) == n {
+		return
+	}
+
+	sortEvents(o.events)
+	o.signal()
+}
+
+// discard drops the events staged for the given accounts.
+func (o *eventOutbox) discard(accountIDs ...int) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	for _, id := range accountIDs {
+		delete(o.staged, id)
+	}
+}
+
+// next returns the committed events not already being published, marking
+// them in flight.
+func (o *eventOutbox) next() []outboxEvent {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	var res []outboxEvent
+
+	for _, v := range o.events {
+		if !o.inFlight[v.ID] {
+			o.inFlight[v.ID] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// sent removes the published event.
+func (o *eventOutbox) sent(id int) {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	for i, v := range o.events {
+		if v.ID == id {
+			o.events = append(o.events[:i], o.events[i+1:]...)
+			o.dirty[v.AccountID] = true
+
+			break
+		}
+	}
+
+	delete(o.inFlight, id)
+	o.signal()
+}
+
+// changed returns the IDs of the accounts with events sent since it was last
+// called.
+func (o *eventOutbox) changed() []int {
+	o.mu.Lock()
+
+	defer o.mu.Unlock()
+
+	var res []int
+
+	for id := range o.dirty {
+		res = append(res, id)
+	}
+
+	o.dirty = map[int]bool{}
+
+	return res
+}
+
+// signal wakes the relay. It must be called with the mutex held.
+func (o *eventOutbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// sortEvents sorts the events by ID, i.e. the order they were recorded.
+func sortEvents(events []outboxEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+}
+
+// relayOutbox publishes committed events until the given context is
+// cancelled, persisting the outbox as events are sent. Events still being
+// published when it's cancelled remain in the outbox and are published again
+// on restart.
+func relayOutbox(ctx context.Context) {
+	outbox.mu.Lock()
+	outbox.signal()
+	outbox.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-outbox.ready:
+		}
+
+		changed := outbox.changed()
+
+		if len(changed) > 0 {
+			err := store.SaveOutbox(ctx, changed...)
+
+			if err != nil {
+				logger.Error("Failed to write to database", zap.Error(err))
+			}
+		}
+
+		for _, v := range outbox.next() {
+			publishWebhooks(ctx, v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEventOutbox(t *testing.T) {
+	o := newEventOutbox()
+	load := card.Transaction{ID: 1, Type: card.Load, Amount: apd.New(10, 0), Currency: card.DefaultCurrency}
+
+	// Staged events are discarded by rollbacks
+	o.stage(1, load)
+	o.discard(1)
+
+	require.Empty(t, o.pending(1))
+
+	// Held events aren't
+	o.stage(1, load)
+	o.hold(1)
+	o.discard(1)
+
+	require.Len(t, o.pending(1), 1)
+	require.Empty(t, o.committed())
+
+	o.commit(1)
+
+	events := o.committed()
+
+	require.Len(t, events, 1)
+	require.Equal(t, 1, events[0].AccountID)
+
+	// Events in flight aren't published twice, and remain until sent
+	require.Len(t, o.next(), 1)
+	require.Empty(t, o.next())
+
+	o.sent(events[0].ID)
+
+	require.Empty(t, o.committed())
+	require.Equal(t, []int{1}, o.changed())
+}
+
+func TestOutboxRollback(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	o := newEventOutbox()
+	s, err := openFileStore(filepath.Join(dir, "db.json"), o, stageEvents(o))
+
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateAccount(ctx, card.NewAccount(1)))
+
+	// A rolled back update delivers no event
+	err = s.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		err := a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+
+		if err != nil {
+			return err
+		}
+
+		return errors.New("rollback")
+	})
+
+	require.EqualError(t, err, "rollback")
+	require.Empty(t, o.pending(1))
+	require.Empty(t, o.committed())
+
+	account, err := s.GetAccount(ctx, 1)
+
+	require.NoError(t, err)
+	require.Zero(t, account.Available.Sign())
+
+	// A committed update delivers its event once persisted
+	require.NoError(t, s.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+	}))
+
+	events := o.committed()
+
+	require.Len(t, events, 1)
+	require.Equal(t, card.Load, events[0].Transaction.Type)
+	require.Zero(t, events[0].Transaction.Amount.Cmp(apd.New(10, 0)))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"expvar"
+	"flag"
+	"net/http"
+	"net/http/pprof"
+)
+
+var pprofAddr string
+
+func init() {
+	flag.StringVar(&pprofAddr, "pprof", "", "Profiling address, e.g. 127.0.0.1:6060; profiling is disabled when empty")
+}
+
+// newPprofServer returns a server exposing the runtime profiles and the
+// expvar metrics, kept off the API address so they're never publicly
+// reachable by accident.
+func newPprofServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var reconcileOnStartup bool
+
+func init() {
+	flag.BoolVar(&reconcileOnStartup, "reconcile", false, "Reconcile every account against its transaction log on startup")
+}
+
+// reconciliation reports the stored amounts which don't match the amounts
+// recomputed from the account transaction logs.
+type reconciliation struct {
+	Checked       time.Time          `json:"checked"`
+	Accounts      int                `json:"accounts"`
+	Discrepancies []card.Discrepancy `json:"discrepancies"`
+}
+
+// reconcile recomputes every account's balances, merchant amounts and
+// authorization amounts from its transaction log, logging and returning the
+// stored amounts which don't match.
+func reconcile(ctx context.Context) (*reconciliation, error) {
+	res := &reconciliation{Checked: time.Now().UTC(), Discrepancies: []card.Discrepancy{}}
+	err := store.WalkAccounts(ctx, func(a *card.Account) error {
+		d, err := a.Reconcile()
+
+		if err != nil {
+			return errors.Wrapf(err, "account %d", a.ID)
+		}
+
+		res.Accounts++
+		res.Discrepancies = append(res.Discrepancies, d...)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range res.Discrepancies {
+		fields := []zap.Field{
+			zap.Int("account", v.AccountID),
+			zap.String("currency", v.Currency),
+			zap.String("field", v.Field),
+			zap.String("stored", v.Stored.Text('f')),
+			zap.String("computed", v.Computed.Text('f')),
+		}
+
+		if v.MerchantID != nil {
+			fields = append(fields, zap.Int("merchant", *v.MerchantID))
+		}
+
+		if v.AuthorizationID != nil {
+			fields = append(fields, zap.Int("authorization", *v.AuthorizationID))
+		}
+
+		logger.Warn("Reconciliation discrepancy", fields...)
+	}
+
+	logger.Info("Reconciled accounts",
+		zap.Int("accounts", res.Accounts),
+		zap.Int("discrepancies", len(res.Discrepancies)),
+	)
+
+	return res, nil
+}
+
+func reconcileStore(w http.ResponseWriter, r *http.Request) {
+	res, err := reconcile(r.Context())
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,1026 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// accountRecord is the persisted form of an account held by a recordStore,
+// along with its creation sequence and its events awaiting publication. The
+// records of deleted accounts are kept, without the account, until their
+// events are sent.
+type accountRecord struct {
+	Schema  int           `json:"schema"`
+	Seq     int           `json:"seq"`
+	Account *card.Account `json:"account,omitempty"`
+	Events  []outboxEvent `json:"events,omitempty"`
+}
+
+// empty reports whether the record holds neither an account nor events, i.e.
+// it may be removed.
+func (r *accountRecord) empty() bool {
+	return r.Account == nil && len(r.Events) == 0
+}
+
+// recordLog persists the account records of a recordStore. Records of
+// different accounts may be put concurrently.
+type recordLog interface {
+	// load returns the persisted records by account ID, reporting false if
+	// the log was just created.
+	load() (map[int]*accountRecord, bool, error)
+
+	// put persists the record of the given account, replacing the previous
+	// one; empty records remove it.
+	put(id int, rec *accountRecord) error
+
+	// close persists the final state of the given accounts, in creation
+	// order, along with the event outbox.
+	close(accounts []*card.Account) error
+}
+
+// recordEntry is an account held by a recordStore. Its mutex serializes the
+// account's transactions, so transactions on different accounts proceed
+// concurrently.
+type recordEntry struct {
+	mu  sync.Mutex
+	seq int
+
+	// account is nil once the account is deleted.
+	account *card.Account
+
+	// published holds a *card.Account copy of the account as of its last
+	// completed transaction, nil once deleted. It's never mutated, so reads
+	// load it without holding the mutex.
+	published atomic.Value
+}
+
+// publish publishes a copy of the entry's account for reads. It must be
+// called with the entry's mutex held.
+func (e *recordEntry) publish() {
+	if e.account == nil {
+		e.published.Store((*card.Account)(nil))
+
+		return
+	}
+
+	e.published.Store(e.account.Clone())
+}
+
+// load returns the account published for reads, or nil if it's deleted.
+func (e *recordEntry) load() *card.Account {
+	a, _ := e.published.Load().(*card.Account)
+
+	return a
+}
+
+// accountShards is the number of shards of the account map of a
+// recordStore. Accounts are assigned to shards by ID, so consecutive IDs fall
+// in different shards.
+const accountShards = 256
+
+// shardIndex returns the index of the shard holding the account with the
+// given ID.
+func shardIndex(id int) int {
+	return int(uint(id) % accountShards)
+}
+
+// recordShard holds the entries of the accounts of a recordStore assigned to
+// the shard. Its mutex serializes the creation, deletion and lookup of its
+// accounts, so accounts in different shards are created and looked up
+// concurrently.
+type recordShard struct {
+	mu      sync.RWMutex
+	entries map[int]*recordEntry
+
+	// view holds a map[int]*recordEntry copy of the entries, published for
+	// reads. It's never mutated: adding or removing accounts publishes a new
+	// copy.
+	view atomic.Value
+}
+
+// publish publishes a copy of the shard's entries for reads. It must be
+// called with the mutex held.
+func (h *recordShard) publish() {
+	v := make(map[int]*recordEntry, len(h.entries))
+
+	for id, e := range h.entries {
+		v[id] = e
+	}
+
+	h.view.Store(v)
+}
+
+// recordStore is the Store keeping accounts in memory and persisting the
+// record of each account mutated by a transaction, along with its outbox
+// events, to a recordLog; records of accounts mutated asynchronously are
+// persisted by the next flush. Its account map is sharded, and operations on
+// every account, e.g. snapshots, lock every shard.
+type recordStore struct {
+	log    recordLog
+	outbox *eventOutbox
+	queue  *writeQueue
+	init   func(*card.Account)
+	shards [accountShards]recordShard
+
+	// orderMu guards the creation order and sequence. No other mutex is
+	// acquired while it's held.
+	orderMu sync.Mutex
+	lastSeq int
+	order   []*recordEntry
+
+	// ordered holds the []*recordEntry creation order, published for reads.
+	// Entries are appended beyond its length in place, while removing
+	// entries publishes a new copy.
+	ordered atomic.Value
+}
+
+// openRecordStore loads the accounts in the given log, restoring their
+// events to the given outbox and calling init with each account. A log just
+// created imports the accounts and outbox of the given JSON database, if
+// any.
+func openRecordStore(log recordLog, legacy string, outbox *eventOutbox, init func(*card.Account)) (*recordStore, error) {
+	records, exists, err := log.load()
+
+	if err == nil && !exists && legacy != "" {
+		records, err = importDB(log, legacy)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, events, err := loadRecords(records)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &recordStore{
+		log:    log,
+		outbox: outbox,
+		queue:  newWriteQueue(),
+		init:   init,
+	}
+
+	for i := range s.shards {
+		s.shards[i].entries = map[int]*recordEntry{}
+	}
+
+	for _, rec := range loaded {
+		s.add(rec.Seq, rec.Account).publish()
+	}
+
+	s.publish()
+	outbox.restore(events)
+
+	return s, nil
+}
+
+// loadRecords migrates and validates the accounts of the given records,
+// returning the records holding accounts in creation order and the events of
+// every record.
+func loadRecords(records map[int]*accountRecord) ([]*accountRecord, []outboxEvent, error) {
+	var (
+		res    []*accountRecord
+		events []outboxEvent
+	)
+
+	for id, rec := range records {
+		err := checkSchema(rec.Schema)
+
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "account %d", id)
+		}
+
+		events = append(events, rec.Events...)
+
+		if rec.Account == nil {
+			continue
+		}
+
+		if rec.Account.ID != id {
+			return nil, nil, errors.Errorf("account %d: record holds account %d", id, rec.Account.ID)
+		}
+
+		err = migrateAccount(rec.Account, rec.Schema)
+
+		if err == nil {
+			err = rec.Account.Validate()
+		}
+
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "account %d", id)
+		}
+
+		res = append(res, rec)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Seq < res[j].Seq
+	})
+
+	return res, events, nil
+}
+
+// importDB puts the records of the accounts and outbox of the given JSON
+// database, if it exists, to the log.
+func importDB(log recordLog, filename string) (map[int]*accountRecord, error) {
+	_, err := os.Stat(filename)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	outbox := newEventOutbox()
+	db, err := loadDB(filename, outbox)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "importing %s", filename)
+	}
+
+	records := dbRecords(db.Accounts, outbox.committed())
+
+	for id, rec := range records {
+		err = log.put(id, rec)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Imported accounts", zap.String("database", filename), zap.Int("accounts", len(db.Accounts)))
+
+	return records, nil
+}
+
+// dbRecords returns the records of the given accounts, in creation order,
+// and outbox events of a JSON database, including records of deleted
+// accounts with events.
+func dbRecords(accounts []*card.Account, events []outboxEvent) map[int]*accountRecord {
+	records := make(map[int]*accountRecord, len(accounts))
+
+	for i, v := range accounts {
+		records[v.ID] = &accountRecord{Schema: schemaVersion, Seq: i + 1, Account: v}
+	}
+
+	for _, v := range events {
+		rec, exists := records[v.AccountID]
+
+		if !exists {
+			rec = &accountRecord{Schema: schemaVersion}
+			records[v.AccountID] = rec
+		}
+
+		rec.Events = append(rec.Events, v)
+	}
+
+	return records
+}
+
+// shard returns the shard holding the account with the given ID.
+func (s *recordStore) shard(id int) *recordShard {
+	return &s.shards[shardIndex(id)]
+}
+
+// lockShards locks every shard, waiting for the creation and deletion of
+// accounts and blocking others.
+func (s *recordStore) lockShards() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+}
+
+func (s *recordStore) unlockShards() {
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// lockShardsOf locks the shards of the given accounts in index order, so
+// concurrent callers don't deadlock, returning their indices.
+func (s *recordStore) lockShardsOf(accounts []*card.Account) []int {
+	seen := make(map[int]bool, len(accounts))
+	indices := make([]int, 0, len(accounts))
+
+	for _, v := range accounts {
+		i := shardIndex(v.ID)
+
+		if !seen[i] {
+			seen[i] = true
+			indices = append(indices, i)
+		}
+	}
+
+	sort.Ints(indices)
+
+	for _, i := range indices {
+		s.shards[i].mu.Lock()
+	}
+
+	return indices
+}
+
+// add adds the account with the given creation sequence, calling init with
+// it, returning its entry; it's unpublished, so reads skip it. It must be
+// called with the account's shard mutex and orderMu held.
+func (s *recordStore) add(seq int, a *card.Account) *recordEntry {
+	s.init(a)
+
+	e := &recordEntry{seq: seq, account: a}
+	s.shard(a.ID).entries[a.ID] = e
+	s.order = append(s.order, e)
+
+	if seq > s.lastSeq {
+		s.lastSeq = seq
+	}
+
+	return e
+}
+
+// remove removes the given entries from the creation order, publishing it. It
+// must be called with orderMu held.
+func (s *recordStore) remove(entries ...*recordEntry) {
+	removed := make(map[*recordEntry]bool, len(entries))
+
+	for _, e := range entries {
+		removed[e] = true
+	}
+
+	order := make([]*recordEntry, 0, len(s.order))
+
+	for _, e := range s.order {
+		if !removed[e] {
+			order = append(order, e)
+		}
+	}
+
+	s.order = order
+	s.ordered.Store(order)
+}
+
+// publish publishes every shard and the creation order for reads. It must be
+// called with every shard's mutex held.
+func (s *recordStore) publish() {
+	for i := range s.shards {
+		s.shards[i].publish()
+	}
+
+	s.orderMu.Lock()
+	s.ordered.Store(s.order)
+	s.orderMu.Unlock()
+}
+
+// write persists the record of the given account entry, with its outbox
+// events, committing the events staged by the current transaction once it's
+// written. A nil entry writes the record of a deleted account, which is kept
+// until it has no events left. It must be called with the entry's mutex
+// held, or the account's shard mutex for deleted accounts.
+func (s *recordStore) write(id int, e *recordEntry) error {
+	rec := &accountRecord{Schema: schemaVersion, Events: s.outbox.pending(id)}
+
+	if e != nil {
+		rec.Seq, rec.Account = e.seq, e.account
+	}
+
+	err := s.log.put(id, rec)
+
+	if err != nil {
+		return err
+	}
+
+	s.outbox.commit(id)
+
+	return nil
+}
+
+// persist writes the record of the given account entry like write, unless
+// the given context allows asynchronous durability, in which case the events
+// staged for the account are held and the record is queued. It must be
+// called with the same mutexes held as write.
+func (s *recordStore) persist(ctx context.Context, id int, e *recordEntry) error {
+	if !asyncDurability(ctx) {
+		return s.write(id, e)
+	}
+
+	s.outbox.hold(id)
+	s.queue.add(id)
+
+	return nil
+}
+
+// queued implements the flusher interface.
+func (s *recordStore) queued() <-chan struct{} {
+	return s.queue.ready
+}
+
+// flush implements the flusher interface. Each queued account's record is
+// written once, however many times it was mutated.
+func (s *recordStore) flush() error {
+	ids, _ := s.queue.take()
+
+	for i, id := range ids {
+		err := s.lockedSaveEvents(id)
+
+		if err != nil {
+			s.queue.add(ids[i:]...)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entry returns the entry of the account with the given ID, locked, or
+// errAccountNotFound.
+func (s *recordStore) entry(id int) (*recordEntry, error) {
+	h := s.shard(id)
+
+	h.mu.RLock()
+	e, exists := h.entries[id]
+	h.mu.RUnlock()
+
+	if !exists {
+		return nil, errAccountNotFound
+	}
+
+	e.mu.Lock()
+
+	// The account may have been deleted while waiting
+	if e.account == nil {
+		e.mu.Unlock()
+
+		return nil, errAccountNotFound
+	}
+
+	return e, nil
+}
+
+// GetAccount implements the Store interface. The account is read from its
+// published copy without locking.
+func (s *recordStore) GetAccount(ctx context.Context, id int) (*card.Account, error) {
+	e, exists := s.shard(id).view.Load().(map[int]*recordEntry)[id]
+
+	if !exists {
+		return nil, errAccountNotFound
+	}
+
+	a := e.load()
+
+	if a == nil {
+		return nil, errAccountNotFound
+	}
+
+	return a.Clone(), nil
+}
+
+// ListAccounts implements the Store interface. The accounts are read from
+// their published copies without locking.
+func (s *recordStore) ListAccounts(ctx context.Context) ([]*card.Account, error) {
+	order := s.ordered.Load().([]*recordEntry)
+	res := make([]*card.Account, 0, len(order))
+
+	for _, e := range order {
+		a := e.load()
+
+		if a != nil {
+			res = append(res, a.Clone())
+		}
+	}
+
+	return res, nil
+}
+
+// WalkAccounts implements the Store interface. The accounts are read from
+// their published copies without locking.
+func (s *recordStore) WalkAccounts(ctx context.Context, fn func(*card.Account) error) error {
+	for _, e := range s.ordered.Load().([]*recordEntry) {
+		a := e.load()
+
+		if a == nil {
+			continue
+		}
+
+		err := fn(a)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateAccount implements the Store interface. Copies of the given accounts
+// are stored.
+func (s *recordStore) CreateAccount(ctx context.Context, accounts ...*card.Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	indices := s.lockShardsOf(accounts)
+
+	defer func() {
+		for _, i := range indices {
+			s.shards[i].mu.Unlock()
+		}
+	}()
+
+	seen := make(map[int]bool, len(accounts))
+
+	for _, v := range accounts {
+		_, exists := s.shard(v.ID).entries[v.ID]
+
+		if exists || seen[v.ID] {
+			return errAccountExists
+		}
+
+		seen[v.ID] = true
+	}
+
+	added := make([]*recordEntry, len(accounts))
+
+	s.orderMu.Lock()
+
+	for i, v := range accounts {
+		added[i] = s.add(s.lastSeq+1, v.Clone())
+	}
+
+	s.ordered.Store(s.order)
+	s.orderMu.Unlock()
+
+	for i, e := range added {
+		err := s.persist(ctx, e.account.ID, e)
+
+		if err == nil {
+			continue
+		}
+
+		for _, e := range added[:i+1] {
+			id := e.account.ID
+			s.outbox.discard(id)
+
+			// Restore the record of a deleted account with the same ID, if
+			// any, or remove it
+			s.write(id, nil)
+		}
+
+		for _, e := range added {
+			delete(s.shard(e.account.ID).entries, e.account.ID)
+		}
+
+		s.orderMu.Lock()
+		s.remove(added...)
+		s.orderMu.Unlock()
+
+		return err
+	}
+
+	for _, e := range added {
+		e.publish()
+	}
+
+	for _, i := range indices {
+		s.shards[i].publish()
+	}
+
+	return nil
+}
+
+// SaveAccount implements the Store interface. A copy of the given account is
+// stored.
+func (s *recordStore) SaveAccount(ctx context.Context, a *card.Account) error {
+	e, err := s.entry(a.ID)
+
+	if err != nil {
+		return err
+	}
+
+	defer e.mu.Unlock()
+
+	previous := e.account
+	e.account = a.Clone()
+
+	err = s.persist(ctx, a.ID, e)
+
+	if err != nil {
+		e.account = previous
+		s.outbox.discard(a.ID)
+
+		return err
+	}
+
+	e.publish()
+
+	return nil
+}
+
+// UpdateAccount implements the Store interface.
+func (s *recordStore) UpdateAccount(ctx context.Context, id int, fn func(*card.Account) error) error {
+	e, err := s.entry(id)
+
+	if err != nil {
+		return err
+	}
+
+	defer e.mu.Unlock()
+
+	snapshot := e.account.Snapshot()
+	err = fn(e.account)
+
+	if err == nil {
+		err = e.account.Validate()
+	}
+
+	if err == nil {
+		err = s.persist(ctx, id, e)
+	}
+
+	if err != nil {
+		// Restored accounts share the observers attached by init
+		e.account = card.RestoreAccount(snapshot)
+		s.outbox.discard(id)
+
+		return err
+	}
+
+	e.publish()
+
+	return nil
+}
+
+// DeleteAccount implements the Store interface.
+func (s *recordStore) DeleteAccount(ctx context.Context, id int, fn func(*card.Account) error) error {
+	h := s.shard(id)
+
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	e, exists := h.entries[id]
+
+	if !exists {
+		return errAccountNotFound
+	}
+
+	e.mu.Lock()
+
+	defer e.mu.Unlock()
+
+	if fn != nil {
+		err := fn(e.account.Clone())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.persist(ctx, id, nil)
+
+	if err != nil {
+		return err
+	}
+
+	delete(h.entries, id)
+	e.account = nil
+	e.publish()
+	h.publish()
+
+	s.orderMu.Lock()
+	s.remove(e)
+	s.orderMu.Unlock()
+
+	return nil
+}
+
+// SaveOutbox implements the Store interface. Only the records of the given
+// accounts are written.
+func (s *recordStore) SaveOutbox(ctx context.Context, accountIDs ...int) error {
+	for _, id := range accountIDs {
+		err := s.lockedSaveEvents(id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockedSaveEvents calls saveEvents with the account's shard mutex held.
+func (s *recordStore) lockedSaveEvents(id int) error {
+	h := s.shard(id)
+
+	h.mu.RLock()
+
+	defer h.mu.RUnlock()
+
+	return s.saveEvents(id)
+}
+
+// saveEvents writes the record of the given account, e.g. once its events
+// are sent. It must be called with the account's shard mutex held.
+func (s *recordStore) saveEvents(id int) error {
+	e, exists := s.shard(id).entries[id]
+
+	if !exists {
+		return s.write(id, nil)
+	}
+
+	e.mu.Lock()
+
+	defer e.mu.Unlock()
+
+	return s.write(id, e)
+}
+
+// snapshot calls fn with copies of every account, in creation order, and the
+// committed outbox events while transactions are blocked, i.e. a
+// point-in-time state reflecting every record put.
+func (s *recordStore) snapshot(fn func(accounts []*card.Account, events []outboxEvent)) {
+	s.lockShards()
+
+	defer s.unlockShards()
+
+	accounts := make([]*card.Account, len(s.order))
+
+	for i, e := range s.order {
+		e.mu.Lock()
+
+		defer e.mu.Unlock()
+
+		accounts[i] = e.account.Clone()
+	}
+
+	fn(accounts, s.outbox.committed())
+}
+
+// Snapshot implements the Store interface.
+func (s *recordStore) Snapshot(ctx context.Context, fn func(accounts []*card.Account, events []outboxEvent)) error {
+	s.snapshot(fn)
+
+	return nil
+}
+
+// Restore implements the Store interface. The record of every restored
+// account is put, and those of other accounts removed, before the accounts
+// are replaced; if putting a record fails, the records already put are
+// reverted.
+func (s *recordStore) Restore(ctx context.Context, accounts []*card.Account, events []outboxEvent) error {
+	s.lockShards()
+
+	defer s.unlockShards()
+
+	// Wait for in-flight transactions, blocking others until the accounts
+	// are replaced
+	current := make([]*card.Account, len(s.order))
+
+	for i, e := range s.order {
+		e.mu.Lock()
+
+		defer e.mu.Unlock()
+
+		current[i] = e.account
+	}
+
+	restored := make([]*card.Account, len(accounts))
+
+	for i, v := range accounts {
+		restored[i] = v.Clone()
+	}
+
+	records := dbRecords(restored, events)
+	previous := dbRecords(current, s.outbox.committed())
+
+	for id := range previous {
+		_, exists := records[id]
+
+		if !exists {
+			records[id] = &accountRecord{}
+		}
+	}
+
+	var put []int
+
+	for id, rec := range records {
+		err := s.log.put(id, rec)
+
+		if err == nil {
+			put = append(put, id)
+
+			continue
+		}
+
+		for _, id := range put {
+			rec, exists := previous[id]
+
+			if !exists {
+				rec = &accountRecord{}
+			}
+
+			s.log.put(id, rec)
+		}
+
+		return err
+	}
+
+	loaded := make([]*accountRecord, len(restored))
+
+	for i, a := range restored {
+		loaded[i] = records[a.ID]
+	}
+
+	s.replace(loaded)
+	s.outbox.reset(events)
+
+	return nil
+}
+
+// Reload implements the Store interface.
+func (s *recordStore) Reload(ctx context.Context, check func(current, persisted []*card.Account) error) error {
+	s.lockShards()
+
+	defer s.unlockShards()
+
+	// Wait for in-flight transactions, blocking others until the accounts
+	// are replaced
+	current := make([]*card.Account, len(s.order))
+
+	for i, e := range s.order {
+		e.mu.Lock()
+
+		defer e.mu.Unlock()
+
+		current[i] = e.account
+	}
+
+	records, exists, err := s.log.load()
+
+	if err == nil && !exists {
+		err = errors.New("account store not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	loaded, events, err := loadRecords(records)
+
+	if err != nil {
+		return err
+	}
+
+	persisted := make([]*card.Account, len(loaded))
+
+	for i, rec := range loaded {
+		persisted[i] = rec.Account
+	}
+
+	err = check(current, persisted)
+
+	if err != nil {
+		return err
+	}
+
+	s.replace(loaded)
+	s.outbox.reset(events)
+
+	return nil
+}
+
+// replace replaces the accounts with those of the given records, in creation
+// order, calling init with each. Entries are kept for accounts with the same
+// ID, so transactions waiting for them proceed with the new account. It must
+// be called with every shard's and entry's mutex held.
+func (s *recordStore) replace(records []*accountRecord) {
+	var entries [accountShards]map[int]*recordEntry
+
+	for i := range entries {
+		entries[i] = map[int]*recordEntry{}
+	}
+
+	order := make([]*recordEntry, len(records))
+	lastSeq := 0
+
+	for i, rec := range records {
+		s.init(rec.Account)
+
+		id := rec.Account.ID
+		e, exists := s.shard(id).entries[id]
+
+		if !exists {
+			e = &recordEntry{}
+		}
+
+		e.seq, e.account = rec.Seq, rec.Account
+		e.publish()
+		entries[shardIndex(id)][id], order[i] = e, e
+
+		if rec.Seq > lastSeq {
+			lastSeq = rec.Seq
+		}
+	}
+
+	for i := range s.shards {
+		for id, e := range s.shards[i].entries {
+			_, exists := entries[i][id]
+
+			if !exists {
+				e.account = nil
+				e.publish()
+			}
+		}
+
+		s.shards[i].entries = entries[i]
+	}
+
+	s.orderMu.Lock()
+	s.order, s.lastSeq = order, lastSeq
+	s.orderMu.Unlock()
+
+	s.publish()
+}
+
+// Rewrite rewrites the record of every account, including deleted accounts
+// with events awaiting publication.
+func (s *recordStore) Rewrite(ctx context.Context) error {
+	s.lockShards()
+
+	defer s.unlockShards()
+
+	for i := range s.shards {
+		for id, e := range s.shards[i].entries {
+			e.mu.Lock()
+			err := s.write(id, e)
+			e.mu.Unlock()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	deleted := map[int]bool{}
+
+	for _, v := range s.outbox.committed() {
+		_, exists := s.shard(v.AccountID).entries[v.AccountID]
+
+		if exists || deleted[v.AccountID] {
+			continue
+		}
+
+		deleted[v.AccountID] = true
+		err := s.write(v.AccountID, nil)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close implements the Store interface. Accounts are written by each
+// transaction, or by the next flush, so only the records of accounts mutated
+// asynchronously or with events sent since they were last written remain to
+// be persisted before the log is closed.
+func (s *recordStore) Close() error {
+	s.lockShards()
+
+	defer s.unlockShards()
+
+	// Wait for in-flight transactions
+	for _, e := range s.order {
+		e.mu.Lock()
+		e.mu.Unlock()
+	}
+
+	// Write the records of accounts mutated asynchronously, or with events
+	// sent, since they were last written
+	ids, _ := s.queue.take()
+
+	for _, id := range append(ids, s.outbox.changed()...) {
+		err := s.saveEvents(id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	accounts := make([]*card.Account, len(s.order))
+
+	for i, e := range s.order {
+		accounts[i] = e.account
+	}
+
+	return s.log.close(accounts)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// reloadDiff reports the accounts changed by a reload.
+type reloadDiff struct {
+	Added     []int `json:"added"`
+	Changed   []int `json:"changed"`
+	Removed   []int `json:"removed"`
+	Unchanged int   `json:"unchanged"`
+}
+
+// diffAccounts compares the current and persisted accounts. Unless forced,
+// it fails with errReloadConflict if reloading would lose mutations, i.e. if
+// an account isn't persisted or is persisted with an older version.
+func diffAccounts(current, persisted []*card.Account, force bool) (*reloadDiff, error) {
+	d := &reloadDiff{Added: []int{}, Changed: []int{}, Removed: []int{}}
+	accounts := make(map[int]*card.Account, len(current))
+
+	for _, v := range current {
+		accounts[v.ID] = v
+	}
+
+	for _, v := range persisted {
+		a, exists := accounts[v.ID]
+
+		if !exists {
+			d.Added = append(d.Added, v.ID)
+
+			continue
+		}
+
+		delete(accounts, v.ID)
+
+		if !force && v.Version < a.Version {
+			return nil, errors.Wrapf(errReloadConflict, "account %d: persisted version %d, current version %d", v.ID, v.Version, a.Version)
+		}
+
+		equal, err := equalAccounts(a, v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if equal {
+			d.Unchanged++
+		} else {
+			d.Changed = append(d.Changed, v.ID)
+		}
+	}
+
+	for _, v := range current {
+		_, exists := accounts[v.ID]
+
+		if !exists {
+			continue
+		}
+
+		if !force {
+			return nil, errors.Wrapf(errReloadConflict, "account %d isn't persisted", v.ID)
+		}
+
+		d.Removed = append(d.Removed, v.ID)
+	}
+
+	return d, nil
+}
+
+// equalAccounts reports whether the given accounts have the same JSON
+// encoding.
+func equalAccounts(a, b *card.Account) (bool, error) {
+	x, err := json.Marshal(a)
+
+	if err != nil {
+		return false, err
+	}
+
+	y, err := json.Marshal(b)
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(x, y), nil
+}
+
+// reloadAccounts replaces the accounts in memory with those persisted,
+// returning the accounts changed.
+func reloadAccounts(ctx context.Context, force bool) (*reloadDiff, error) {
+	var d *reloadDiff
+
+	err := store.Reload(ctx, func(current, persisted []*card.Account) error {
+		var err error
+
+		d, err = diffAccounts(current, persisted, force)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Reloaded accounts",
+		zap.Ints("added", d.Added),
+		zap.Ints("changed", d.Changed),
+		zap.Ints("removed", d.Removed),
+		zap.Int("unchanged", d.Unchanged),
+	)
+
+	return d, nil
+}
+
+// reloadOnHangup reloads the accounts on SIGHUP until the given context is
+// cancelled. Reloads losing mutations are refused.
+func reloadOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+
+	signal.Notify(hup, syscall.SIGHUP)
+
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		_, err := reloadAccounts(ctx, false)
+
+		if err != nil {
+			logger.Error("Failed to reload accounts", zap.Error(err))
+		}
+	}
+}
+
+func reloadStore(w http.ResponseWriter, r *http.Request) {
+	d, err := reloadAccounts(r.Context(), r.URL.Query().Get("force") == "true")
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReload(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	previous := store
+
+	defer func() {
+		store = previous
+	}()
+
+	ctx := context.Background()
+	accounts := filepath.Join(dir, "accounts")
+	o := newEventOutbox()
+	s, err := openDirStore(accounts, "", o, stageEvents(o))
+
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	store = s
+
+	mutateStore(t, s)
+
+	// Accounts changed by another process
+	other := newEventOutbox()
+	external, err := openDirStore(accounts, "", other, stageEvents(other))
+
+	require.NoError(t, err)
+	require.NoError(t, external.UpdateAccount(ctx, 2, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(50, 0), card.DefaultCurrency)
+	}))
+	require.NoError(t, external.CreateAccount(ctx, card.NewAccount(4)))
+
+	state := storeState(t, external)
+
+	require.NoError(t, external.Close())
+
+	d, err := reloadAccounts(ctx, false)
+
+	require.NoError(t, err)
+	require.Equal(t, &reloadDiff{Added: []int{4}, Changed: []int{2}, Removed: []int{}, Unchanged: 1}, d)
+	require.Equal(t, state, storeState(t, s))
+
+	// Reloaded accounts are persisted and stage events as before
+	require.NoError(t, s.UpdateAccount(ctx, 4, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+	}))
+	require.NotEmpty(t, o.pending(4))
+
+	state = storeState(t, s)
+	d, err = reloadAccounts(ctx, false)
+
+	require.NoError(t, err)
+	require.Equal(t, 3, d.Unchanged)
+	require.Equal(t, state, storeState(t, s))
+
+	// Reloading would lose an account that isn't persisted
+	require.NoError(t, os.Remove(filepath.Join(accounts, "1.json")))
+
+	_, err = reloadAccounts(ctx, false)
+
+	require.Equal(t, errReloadConflict, errors.Cause(err))
+
+	_, err = store.GetAccount(ctx, 1)
+
+	require.NoError(t, err, "kept by a refused reload")
+
+	d, err = reloadAccounts(ctx, true)
+
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, d.Removed)
+
+	_, err = store.GetAccount(ctx, 1)
+
+	require.Equal(t, errAccountNotFound, errors.Cause(err))
+}
+
+func TestDiffAccounts(t *testing.T) {
+	older, newer := card.NewAccount(1), card.NewAccount(1)
+	newer.Version = 2
+
+	_, err := diffAccounts([]*card.Account{newer}, []*card.Account{older}, false)
+
+	require.Equal(t, errReloadConflict, errors.Cause(err), "older version persisted")
+
+	d, err := diffAccounts([]*card.Account{newer}, []*card.Account{older}, true)
+
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, d.Changed)
+
+	d, err = diffAccounts([]*card.Account{older}, []*card.Account{newer}, false)
+
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, d.Changed)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"go.uber.org/zap"
+)
+
+var scheduleInterval time.Duration
+
+func init() {
+	flag.DurationVar(&scheduleInterval, "schedule-interval", time.Minute, "Recurring load scheduler interval")
+}
+
+// runSchedules periodically records the loads due by recurring load
+// schedules until the given context is cancelled.
+func runSchedules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			loadScheduled(now)
+		}
+	}
+}
+
+// loadScheduled records the loads due at the given time across all accounts,
+// updating only the accounts with loads due.
+func loadScheduled(now time.Time) {
+	ctx := context.Background()
+
+	var due []int
+
+	err := store.WalkAccounts(ctx, func(a *card.Account) error {
+		if a.DueSchedules(now) {
+			due = append(due, a.ID)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error("Failed to list accounts", zap.Error(err))
+
+		return
+	}
+
+	for _, id := range due {
+		var loads []card.Transaction
+
+		err = store.UpdateAccount(ctx, id, func(account *card.Account) error {
+			var err error
+			loads, err = account.RunSchedules(ctx, now)
+
+			return err
+		})
+
+		if err != nil {
+			logger.Error("Failed to run schedules", zap.Int("account", id), zap.Error(err))
+
+			continue
+		}
+
+		for _, t := range loads {
+			logger.Info("Scheduled load",
+				zap.Int("account", id),
+				zap.Int("transaction", t.ID),
+				zap.String("schedule", t.Reference),
+				zap.String("amount", t.Amount.String()),
+				zap.String("currency", t.Currency),
+			)
+		}
+	}
+}
+
+// scheduleRequest is the body of requests creating or updating a schedule.
+type scheduleRequest struct {
+	Amount   string     `json:"amount"`
+	Currency string     `json:"currency"`
+	Cadence  string     `json:"cadence"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end"`
+}
+
+// schedule is a decoded schedule request.
+type schedule struct {
+	amount   *apd.Decimal
+	currency string
+	cadence  card.Cadence
+	start    time.Time
+	end      *time.Time
+}
+
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (*schedule, error) {
+	var req scheduleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return nil, err
+	}
+
+	s := &schedule{currency: req.Currency, start: req.Start, end: req.End}
+	s.amount, _, err = apd.NewFromString(req.Amount)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return nil, err
+	}
+
+	s.cadence, err = card.ParseCadence(req.Cadence)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func getScheduleID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "scheduleID"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func getSchedules(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account.ListSchedules())
+}
+
+func createSchedule(w http.ResponseWriter, r *http.Request) {
+	s, err := decodeSchedule(w, r)
+
+	if err != nil {
+		return
+	}
+
+	updateAccountStatus(w, r, http.StatusCreated, func(account *card.Account) (interface{}, error) {
+		return account.AddSchedule(s.amount, requestCurrency(account, s.currency), s.cadence, s.start, s.end)
+	})
+}
+
+func getSchedule(w http.ResponseWriter, r *http.Request) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getScheduleID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	s, err := account.Schedule(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func updateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := getScheduleID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	s, err := decodeSchedule(w, r)
+
+	if err != nil {
+		return
+	}
+
+	updateAccount(w, r, func(account *card.Account) (interface{}, error) {
+		return account.UpdateSchedule(id, s.amount, requestCurrency(account, s.currency), s.cadence, s.start, s.end)
+	})
+}
+
+func deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := getScheduleID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	accountID, err := accountID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	err = store.UpdateAccount(r.Context(), accountID, func(account *card.Account) error {
+		err := checkIfMatch(r, account)
+
+		if err != nil {
+			return err
+		}
+
+		return account.RemoveSchedule(id)
+	})
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
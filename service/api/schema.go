@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// schemaVersion is the version of the account schema written by the
+// service, recorded in the JSON database, account records and backups. Data
+// written before the schema was versioned has version 0.
+const schemaVersion = 5
+
+// migrations upgrade accounts persisted by earlier versions of the service:
+// migrations[i] upgrades an account from schema version i to i+1. Fields
+// added to the account schema are populated by appending a migration and
+// incrementing schemaVersion.
+var migrations = []func(*card.Account){
+	// 1: accounts and transactions have a currency
+	migrateCurrency,
+
+	// 2: transactions have IDs
+	migrateTransactionIDs,
+
+	// 3: merchant holds are tracked as authorizations
+	migrateAuthorizations,
+
+	// 4: authorizations have a currency
+	migrateAuthorizationCurrency,
+
+	// 5: accounts persist their decimal context
+	migrateDecimalContext,
+}
+
+// checkSchema returns an error if data with the given schema version, e.g.
+// written by a later version of the service, can't be read.
+func checkSchema(version int) error {
+	if version < 0 || version > schemaVersion {
+		return errors.Errorf("unsupported schema version %d (supported up to %d)", version, schemaVersion)
+	}
+
+	return nil
+}
+
+// migrateAccount upgrades the given account persisted with the given schema
+// version to the current schema.
+func migrateAccount(a *card.Account, version int) error {
+	err := checkSchema(version)
+
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range migrations[version:] {
+		fn(a)
+	}
+
+	return nil
+}
+
+// migrateCurrency sets the currency of accounts and transactions persisted
+// before multiple currencies were supported.
+func migrateCurrency(a *card.Account) {
+	if a.Currency == "" {
+		a.Currency = card.DefaultCurrency
+	}
+
+	for i := range a.Transactions {
+		if a.Transactions[i].Currency == "" {
+			a.Transactions[i].Currency = a.Currency
+		}
+	}
+}
+
+// migrateTransactionIDs numbers transactions persisted before they had IDs.
+func migrateTransactionIDs(a *card.Account) {
+	if a.LastTransactionID != 0 {
+		return
+	}
+
+	for i := range a.Transactions {
+		a.Transactions[i].ID = i + 1
+	}
+
+	a.LastTransactionID = len(a.Transactions)
+}
+
+// migrateAuthorizations converts pooled merchant holds into authorizations,
+// keyed by the last authorization transaction for each merchant.
+func migrateAuthorizations(a *card.Account) {
+	if a.Authorizations != nil {
+		return
+	}
+
+	seen := map[int]bool{}
+
+	for i := len(a.Transactions) - 1; i >= 0; i-- {
+		t := a.Transactions[i]
+
+		if t.Type != card.Authorize || t.MerchantID == nil || seen[*t.MerchantID] {
+			continue
+		}
+
+		seen[*t.MerchantID] = true
+		m, exists := a.Merchants[*t.MerchantID]
+
+		if !exists || m.Available.Sign() <= 0 {
+			continue
+		}
+
+		if a.Authorizations == nil {
+			a.Authorizations = map[int]*card.Authorization{}
+		}
+
+		a.Authorizations[t.ID] = &card.Authorization{
+			ID:         t.ID,
+			MerchantID: *t.MerchantID,
+			Amount:     apd.New(0, 0).Set(m.Available),
+			Captured:   apd.New(0, 0),
+			Reversed:   apd.New(0, 0),
+			Refunded:   apd.New(0, 0),
+		}
+	}
+}
+
+// migrateAuthorizationCurrency sets the currency of authorizations persisted
+// before multiple currencies were supported.
+func migrateAuthorizationCurrency(a *card.Account) {
+	for _, au := range a.Authorizations {
+		if au.Currency == "" {
+			au.Currency = a.Currency
+		}
+	}
+}
+
+// migrateDecimalContext upgrades accounts persisted before their decimal
+// context was: they use the service's context, so nothing is populated, but
+// earlier versions, which would drop the context, can't read the upgraded
+// accounts.
+func migrateDecimalContext(a *card.Account) {}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	settlementsFile    string
+	settlementInterval time.Duration
+	settlements        = &settlementRegistry{}
+
+	// settleMu serializes settlement runs, so each captured amount is
+	// recorded in a single batch.
+	settleMu sync.Mutex
+)
+
+func init() {
+	flag.StringVar(&settlementsFile, "settlements", "./settlements.json", "JSON merchant settlement batches")
+	flag.DurationVar(&settlementInterval, "settlement-interval", 0, "Merchant settlement interval; settlement is on demand only when zero")
+}
+
+var errSettlementNotFound = &card.Error{Code: "SETTLEMENT_NOT_FOUND", Message: "settlement batch not found"}
+
+// settlementBatch records the captured amounts settled to merchants by a
+// settlement run. A batch is persisted as pending, with the settled totals
+// of the accounts to settle, before any account is settled; a batch left
+// pending by an interrupted run is completed from the amounts the accounts'
+// settled totals have grown by since.
+type settlementBatch struct {
+	ID       int                       `json:"id"`
+	Created  time.Time                 `json:"created"`
+	Pending  bool                      `json:"pending,omitempty"`
+	Accounts []accountSettlement       `json:"accounts"`
+	Totals   []card.MerchantSettlement `json:"totals"`
+
+	// Before holds the settled totals of the accounts to settle while the
+	// batch is pending.
+	Before []accountSettlement `json:"before,omitempty"`
+}
+
+// accountSettlement is the amounts settled from an account.
+type accountSettlement struct {
+	AccountID   int                       `json:"accountID"`
+	Settlements []card.MerchantSettlement `json:"settlements"`
+}
+
+// settlementReport is a merchant's payout from a settlement batch.
+type settlementReport struct {
+	BatchID    int                       `json:"batchID"`
+	MerchantID int                       `json:"merchantID"`
+	Created    time.Time                 `json:"created"`
+	Totals     []card.MerchantSettlement `json:"totals"`
+	Accounts   []accountSettlement       `json:"accounts"`
+}
+
+// report returns the merchant's payout from the batch.
+func (b *settlementBatch) report(merchantID int) settlementReport {
+	res := settlementReport{
+		BatchID:    b.ID,
+		MerchantID: merchantID,
+		Created:    b.Created,
+		Totals:     []card.MerchantSettlement{},
+		Accounts:   []accountSettlement{},
+	}
+
+	for _, v := range b.Totals {
+		if v.MerchantID == merchantID {
+			res.Totals = append(res.Totals, v)
+		}
+	}
+
+	for _, a := range b.Accounts {
+		var s []card.MerchantSettlement
+
+		for _, v := range a.Settlements {
+			if v.MerchantID == merchantID {
+				s = append(s, v)
+			}
+		}
+
+		if len(s) > 0 {
+			res.Accounts = append(res.Accounts, accountSettlement{a.AccountID, s})
+		}
+	}
+
+	return res
+}
+
+// settlementRegistry holds the settlement batches. It's safe for concurrent
+// use.
+type settlementRegistry struct {
+	mu      sync.RWMutex
+	lastID  int
+	batches []*settlementBatch
+}
+
+type settlementRegistryJSON struct {
+	LastID  int                `json:"lastID"`
+	Batches []*settlementBatch `json:"batches"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *settlementRegistry) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	return json.Marshal(settlementRegistryJSON{r.lastID, r.batches})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *settlementRegistry) UnmarshalJSON(data []byte) error {
+	var v settlementRegistryJSON
+
+	err := json.Unmarshal(data, &v)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastID, r.batches = v.LastID, v.Batches
+	r.mu.Unlock()
+
+	return nil
+}
+
+// list returns the settlement batches in ID order.
+func (r *settlementRegistry) list() []*settlementBatch {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	return append([]*settlementBatch{}, r.batches...)
+}
+
+// get returns the settlement batch with the given ID.
+func (r *settlementRegistry) get(id int) (*settlementBatch, error) {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	for _, v := range r.batches {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+
+	return nil, errors.Wrapf(errSettlementNotFound, "ID: %d", id)
+}
+
+// put persists the registry with the given batch added, assigning it an ID,
+// or replacing the batch with the same ID, and only then records it.
+// Changes are serialized by settleMu.
+func (r *settlementRegistry) put(b settlementBatch) (*settlementBatch, error) {
+	r.mu.RLock()
+	v := settlementRegistryJSON{LastID: r.lastID, Batches: make([]*settlementBatch, 0, len(r.batches)+1)}
+	replaced := false
+
+	for _, x := range r.batches {
+		if x.ID == b.ID {
+			x, replaced = &b, true
+		}
+
+		v.Batches = append(v.Batches, x)
+	}
+
+	r.mu.RUnlock()
+
+	if !replaced {
+		v.LastID++
+		b.ID = v.LastID
+		v.Batches = append(v.Batches, &b)
+	}
+
+	return &b, r.write(v)
+}
+
+// remove persists the registry without the batch with the given ID, and
+// only then removes it.
+func (r *settlementRegistry) remove(id int) error {
+	r.mu.RLock()
+	v := settlementRegistryJSON{LastID: r.lastID}
+
+	for _, x := range r.batches {
+		if x.ID != id {
+			v.Batches = append(v.Batches, x)
+		}
+	}
+
+	r.mu.RUnlock()
+
+	return r.write(v)
+}
+
+// write persists the given batches, then replaces the registry's.
+func (r *settlementRegistry) write(v settlementRegistryJSON) error {
+	err := writeDB(settlementsFile, v)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastID, r.batches = v.LastID, v.Batches
+	r.mu.Unlock()
+
+	return nil
+}
+
+func loadSettlements(filename string) error {
+	dbFileMu.Lock()
+
+	defer dbFileMu.Unlock()
+
+	f, err := os.Open(filename)
+
+	if os.IsNotExist(err) {
+		f, err = os.Create(filename)
+
+		if err != nil {
+			return err
+		}
+
+		return f.Close()
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	r, err := unsealReader(f)
+
+	if err != nil {
+		return err
+	}
+
+	err = json.NewDecoder(r).Decode(settlements)
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// runSettlements periodically settles the merchants' captured amounts until
+// the given context is cancelled.
+func runSettlements(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := settle(ctx)
+
+			if err != nil {
+				logger.Error("Failed to settle merchants", zap.Error(err))
+			}
+		}
+	}
+}
+
+// settle sweeps the captured amounts of every merchant across all accounts
+// into a new settlement batch, updating only the accounts with unsettled
+// captures, once any batch left pending by an interrupted run is completed.
+// It returns nil if nothing was settled.
+func settle(ctx context.Context) (*settlementBatch, error) {
+	settleMu.Lock()
+
+	defer settleMu.Unlock()
+
+	err := completeSettlements(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var before []accountSettlement
+
+	err = store.WalkAccounts(ctx, func(a *card.Account) error {
+		if a.Unsettled() {
+			before = append(before, accountSettlement{a.ID, settledTotals(a)})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(before) == 0 {
+		return nil, nil
+	}
+
+	// No account is settled unless the pending batch is persisted
+	b, err := settlements.put(settlementBatch{Created: time.Now().UTC(), Pending: true, Before: before})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []accountSettlement
+
+	for _, v := range before {
+		var res []card.MerchantSettlement
+
+		err = store.UpdateAccount(ctx, v.AccountID, func(account *card.Account) error {
+			var err error
+			res, err = account.Settle()
+
+			return err
+		})
+
+		if err != nil {
+			logger.Error("Failed to settle account", zap.Int("account", v.AccountID), zap.Error(err))
+
+			continue
+		}
+
+		if len(res) > 0 {
+			accounts = append(accounts, accountSettlement{v.AccountID, res})
+		}
+	}
+
+	return completeSettlement(b, accounts)
+}
+
+// completeSettlement persists the pending batch as complete with the given
+// account settlements, or removes it if nothing was settled.
+func completeSettlement(pending *settlementBatch, accounts []accountSettlement) (*settlementBatch, error) {
+	if len(accounts) == 0 {
+		return nil, settlements.remove(pending.ID)
+	}
+
+	var all []card.MerchantSettlement
+
+	for _, v := range accounts {
+		all = append(all, v.Settlements...)
+	}
+
+	totals, err := card.SettlementTotals(all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := settlements.put(settlementBatch{
+		ID:       pending.ID,
+		Created:  pending.Created,
+		Accounts: accounts,
+		Totals:   totals,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range b.Totals {
+		logger.Info("Merchant settled",
+			zap.Int("batch", b.ID),
+			zap.Int("merchant", v.MerchantID),
+			zap.String("amount", v.Amount.String()),
+			zap.String("currency", v.Currency),
+		)
+	}
+
+	return b, nil
+}
+
+// completeSettlements completes the batches left pending by interrupted
+// settlement runs. The amounts settled from each account are those its
+// settled totals have grown by since the batch was created; only settlement
+// runs, which are serialized, change them. It must be called with settleMu
+// held.
+func completeSettlements(ctx context.Context) error {
+	for _, b := range settlements.list() {
+		if !b.Pending {
+			continue
+		}
+
+		var accounts []accountSettlement
+
+		for _, v := range b.Before {
+			account, err := store.GetAccount(ctx, v.AccountID)
+
+			if errors.Cause(err) == errAccountNotFound {
+				logger.Warn("Settled account not found", zap.Int("batch", b.ID), zap.Int("account", v.AccountID))
+
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			res, err := settledSince(v.Settlements, settledTotals(account))
+
+			if err != nil {
+				return err
+			}
+
+			if len(res) > 0 {
+				accounts = append(accounts, accountSettlement{v.AccountID, res})
+			}
+		}
+
+		_, err := completeSettlement(b, accounts)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Warn("Completed interrupted settlement", zap.Int("batch", b.ID), zap.Int("accounts", len(accounts)))
+	}
+
+	return nil
+}
+
+// settledTotals returns the settled total of each of the account's merchants
+// by currency, omitting those never settled.
+func settledTotals(a *card.Account) []card.MerchantSettlement {
+	res := []card.MerchantSettlement{}
+
+	for _, v := range a.MerchantHoldings() {
+		if v.Settled != nil {
+			res = append(res, card.MerchantSettlement{MerchantID: v.MerchantID, Currency: v.Currency, Amount: v.Settled})
+		}
+	}
+
+	return res
+}
+
+// settledSince returns the amounts the given current settled totals have
+// grown by since the given previous totals, ordered by merchant ID and then
+// by currency.
+func settledSince(previous, current []card.MerchantSettlement) ([]card.MerchantSettlement, error) {
+	all := append([]card.MerchantSettlement{}, current...)
+
+	for _, v := range previous {
+		all = append(all, card.MerchantSettlement{MerchantID: v.MerchantID, Currency: v.Currency, Amount: apd.New(0, 0).Neg(v.Amount)})
+	}
+
+	totals, err := card.SettlementTotals(all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res []card.MerchantSettlement
+
+	for _, v := range totals {
+		if !v.Amount.IsZero() {
+			res = append(res, v)
+		}
+	}
+
+	return res, nil
+}
+
+func getSettlementID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "settlementID"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func getSettlements(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, settlements.list())
+}
+
+// createSettlement settles the merchants' captured amounts on demand,
+// returning the batch, or no content if nothing was captured. The run
+// continues if the client disconnects.
+func createSettlement(w http.ResponseWriter, r *http.Request) {
+	b, err := settle(context.Background())
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	if b == nil {
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func getSettlement(w http.ResponseWriter, r *http.Request) {
+	id, err := getSettlementID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	b, err := settlements.get(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, b)
+}
+
+// getSettlementReport returns a merchant's payout from a settlement batch.
+func getSettlementReport(w http.ResponseWriter, r *http.Request) {
+	id, err := getSettlementID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	merchantID, err := getMerchantID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	b, err := settlements.get(id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, b.report(merchantID))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestSettlements replaces the settlement batches with an empty registry
+// persisted in the given directory, returning a function restoring the
+// previous registry.
+func useTestSettlements(dir string) func() {
+	previous, previousFile := settlements, settlementsFile
+	settlements, settlementsFile = &settlementRegistry{}, filepath.Join(dir, "settlements.json")
+
+	return func() {
+		settlements, settlementsFile = previous, previousFile
+	}
+}
+
+// captureAmount authorizes and captures the given amount for merchant 1.
+func captureAmount(t *testing.T, id int, amount int64) {
+	ctx := context.Background()
+
+	require.NoError(t, store.UpdateAccount(ctx, id, func(a *card.Account) error {
+		err := a.Load(ctx, apd.New(amount, 0), card.DefaultCurrency)
+
+		if err != nil {
+			return err
+		}
+
+		au, err := a.Authorize(ctx, 1, apd.New(amount, 0), card.DefaultCurrency)
+
+		if err != nil {
+			return err
+		}
+
+		return a.Capture(ctx, au.ID, apd.New(amount, 0), card.DefaultCurrency)
+	}))
+}
+
+func TestSettle(t *testing.T) {
+	defer useTestStore(t)()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+	defer useTestSettlements(dir)()
+
+	ctx := context.Background()
+
+	require.NoError(t, store.CreateAccount(ctx, card.NewAccount(1), card.NewAccount(2)))
+	captureAmount(t, 1, 20)
+	captureAmount(t, 2, 30)
+
+	// A failed write of the pending batch settles nothing
+	settlementsFile = filepath.Join(dir, "missing", "settlements.json")
+
+	_, err = settle(ctx)
+
+	require.Error(t, err)
+	require.Empty(t, settlements.list())
+
+	for _, id := range []int{1, 2} {
+		account, err := store.GetAccount(ctx, id)
+
+		require.NoError(t, err)
+		require.True(t, account.Unsettled(), "account %d settled", id)
+	}
+
+	settlementsFile = filepath.Join(dir, "settlements.json")
+
+	// A run interrupted once account 1 is settled
+	var before []accountSettlement
+
+	require.NoError(t, store.WalkAccounts(ctx, func(a *card.Account) error {
+		before = append(before, accountSettlement{a.ID, settledTotals(a)})
+
+		return nil
+	}))
+
+	_, err = settlements.put(settlementBatch{Pending: true, Before: before})
+
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		_, err := a.Settle()
+
+		return err
+	}))
+
+	b, err := settle(ctx)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, b.ID)
+
+	batches := settlements.list()
+
+	require.Len(t, batches, 2)
+
+	for i, v := range []struct {
+		accountID int
+		amount    int64
+	}{{1, 20}, {2, 30}} {
+		require.False(t, batches[i].Pending)
+		require.Nil(t, batches[i].Before)
+		require.Len(t, batches[i].Accounts, 1)
+		require.Equal(t, v.accountID, batches[i].Accounts[0].AccountID)
+		require.Len(t, batches[i].Totals, 1)
+		require.Zero(t, batches[i].Totals[0].Amount.Cmp(apd.New(v.amount, 0)), "batch %d", batches[i].ID)
+	}
+
+	// Persisted
+	previous := settlements
+	settlements = &settlementRegistry{}
+
+	defer func() {
+		settlements = previous
+	}()
+
+	require.NoError(t, loadSettlements(settlementsFile))
+	require.Len(t, settlements.list(), 2)
+
+	b, err = settle(ctx)
+
+	require.NoError(t, err)
+	require.Nil(t, b, "nothing to settle")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+var (
+	// store persists the accounts served by the API.
+	store Store
+
+	storeBackend string
+)
+
+func init() {
+	flag.StringVar(&storeBackend, "store", "dir", "Account store: dir (a JSON file per account), journal (a journal over a JSON database snapshot) or file (a single JSON database)")
+}
+
+// openStore opens the account store selected by the store setting.
+func openStore() (Store, error) {
+	switch storeBackend {
+	case "dir":
+		return openDirStore(dbDir, dbFile, outbox, initAccount)
+	case "journal":
+		return openJournalStore(journalFile, dbFile, outbox, initAccount)
+	case "file":
+		return openFileStore(dbFile, outbox, initAccount)
+	}
+
+	return nil, errors.Errorf("unknown store %q", storeBackend)
+}
+
+// Store is the account persistence backend. Accounts returned by reads are
+// copies, safe to use without further locking; changes to them are only
+// persisted through the transactional methods. Reads don't block on
+// transactions, returning each account as of its last completed transaction.
+//
+// Stores attach the service hooks to every account they load, create or
+// restore, and persist the events staged in the event outbox atomically with
+// the account mutation that staged them. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// GetAccount returns a copy of the account with the given ID, or
+	// errAccountNotFound.
+	GetAccount(ctx context.Context, id int) (*card.Account, error)
+
+	// ListAccounts returns copies of every account in creation order.
+	ListAccounts(ctx context.Context) ([]*card.Account, error)
+
+	// WalkAccounts calls fn with every account in creation order, stopping
+	// at the first error fn returns, without copying the accounts: they're
+	// shared with other reads and must not be modified.
+	WalkAccounts(ctx context.Context, fn func(*card.Account) error) error
+
+	// CreateAccount persists the given new accounts, creating either all or
+	// none of them; it fails with errAccountExists if any ID is taken.
+	CreateAccount(ctx context.Context, accounts ...*card.Account) error
+
+	// SaveAccount replaces the stored state of an existing account.
+	SaveAccount(ctx context.Context, a *card.Account) error
+
+	// UpdateAccount calls fn with the account within a transaction. The
+	// account is validated and persisted if fn succeeds; otherwise, or if
+	// persisting fails, it's restored to its previous state and the error is
+	// returned.
+	UpdateAccount(ctx context.Context, id int, fn func(*card.Account) error) error
+
+	// DeleteAccount removes the account with the given ID. The optional fn is
+	// called with the account within the transaction, aborting the deletion
+	// by returning an error.
+	DeleteAccount(ctx context.Context, id int, fn func(*card.Account) error) error
+
+	// SaveOutbox persists the event outbox, at least the events of the given
+	// accounts, e.g. once they're sent.
+	SaveOutbox(ctx context.Context, accountIDs ...int) error
+
+	// Snapshot calls fn with copies of every account, in creation order, and
+	// the committed outbox events while transactions are blocked, i.e. a
+	// point-in-time state.
+	Snapshot(ctx context.Context, fn func(accounts []*card.Account, events []outboxEvent)) error
+
+	// Restore replaces every account, in creation order, and the committed
+	// outbox events with copies of the given ones once in-flight
+	// transactions complete, either persisting all of them or none.
+	Restore(ctx context.Context, accounts []*card.Account, events []outboxEvent) error
+
+	// Reload replaces every account and the committed outbox events with
+	// those persisted, e.g. after the store's files are replaced, once
+	// in-flight transactions complete. check is called with the current and
+	// persisted accounts, in creation order, while transactions are blocked,
+	// aborting the reload by returning an error.
+	Reload(ctx context.Context, check func(current, persisted []*card.Account) error) error
+
+	// Close waits for in-flight transactions and persists the final state.
+	Close() error
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// benchmarkAccounts is the number of accounts updated concurrently by the
+// store benchmarks.
+const benchmarkAccounts = 64
+
+// benchmarkStores are the stores measured by the store benchmarks.
+var benchmarkStores = []struct {
+	name string
+	open func(dir string) (Store, error)
+}{
+	{"file", func(dir string) (Store, error) {
+		return openFileStore(filepath.Join(dir, "db.json"), newEventOutbox(), func(*card.Account) {})
+	}},
+	{"dir", func(dir string) (Store, error) {
+		return openDirStore(filepath.Join(dir, "accounts"), "", newEventOutbox(), func(*card.Account) {})
+	}},
+	{"journal", func(dir string) (Store, error) {
+		return openJournalStore(filepath.Join(dir, "journal.ndjson"), filepath.Join(dir, "db.json"), newEventOutbox(), func(*card.Account) {})
+	}},
+}
+
+// benchmarkStore runs fn with each benchmarked store, opened in a temporary
+// directory.
+func benchmarkStore(b *testing.B, fn func(b *testing.B, s Store)) {
+	for _, v := range benchmarkStores {
+		open := v.open
+
+		b.Run(v.name, func(b *testing.B) {
+			logger = zap.NewNop()
+
+			dir, err := ioutil.TempDir("", "card")
+
+			require.NoError(b, err)
+
+			defer os.RemoveAll(dir)
+
+			s, err := open(dir)
+
+			require.NoError(b, err)
+
+			defer s.Close()
+
+			fn(b, s)
+		})
+	}
+}
+
+// useTestStore replaces the service store with a file store in a temporary
+// directory, returning a function restoring the previous store.
+func useTestStore(t *testing.T) func() {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	s, err := openFileStore(filepath.Join(dir, "db.json"), newEventOutbox(), func(*card.Account) {})
+
+	require.NoError(t, err)
+
+	previous := store
+	store = s
+
+	return func() {
+		store = previous
+
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// stageEvents returns a store init function staging the transaction events
+// of every account in the given outbox, as initAccount does.
+func stageEvents(o *eventOutbox) func(*card.Account) {
+	return func(a *card.Account) {
+		a.OnTransaction(func(t card.Transaction) {
+			o.stage(a.ID, t)
+		})
+	}
+}
+
+// mutateStore creates accounts 1 to 3, loads accounts 1 and 2, authorizes
+// and captures on account 1 and deletes account 3.
+func mutateStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateAccount(ctx, card.NewAccount(1), card.NewAccount(2), card.NewAccount(3)))
+
+	for _, id := range []int{1, 2} {
+		require.NoError(t, s.UpdateAccount(ctx, id, func(a *card.Account) error {
+			return a.Load(ctx, apd.New(100, 0), card.DefaultCurrency)
+		}))
+	}
+
+	require.NoError(t, s.UpdateAccount(ctx, 1, func(a *card.Account) error {
+		au, err := a.Authorize(ctx, 1, apd.New(30, 0), card.DefaultCurrency)
+
+		if err != nil {
+			return err
+		}
+
+		return a.Capture(ctx, au.ID, apd.New(20, 0), card.DefaultCurrency)
+	}))
+	require.NoError(t, s.DeleteAccount(ctx, 3, nil))
+}
+
+// storeState returns the JSON encoding of the accounts and committed events
+// of the given store, for comparing stores.
+func storeState(t *testing.T, s Store) string {
+	var state struct {
+		Accounts []*card.Account `json:"accounts"`
+		Events   []outboxEvent   `json:"events"`
+	}
+
+	require.NoError(t, s.Snapshot(context.Background(), func(accounts []*card.Account, events []outboxEvent) {
+		state.Accounts, state.Events = accounts, events
+	}))
+
+	b, err := json.Marshal(state)
+
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+// BenchmarkUpdateAccount measures the throughput of concurrent transactions
+// on independent accounts. The file store serializes every transaction on a
+// single mutex, while the dir and journal stores only serialize transactions
+// on the same account.
+func BenchmarkUpdateAccount(b *testing.B) {
+	benchmarkStore(b, benchmarkUpdateAccount)
+}
+
+func benchmarkUpdateAccount(b *testing.B, s Store) {
+	ctx := context.Background()
+	accounts := make([]*card.Account, benchmarkAccounts)
+
+	for i := range accounts {
+		accounts[i] = card.NewAccount(i + 1)
+	}
+
+	require.NoError(b, s.CreateAccount(ctx, accounts...))
+
+	amount := apd.New(1, 0)
+
+	var next int64
+
+	// Run enough goroutines to update every account concurrently
+	b.SetParallelism(benchmarkAccounts)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(atomic.AddInt64(&next, 1)-1)%benchmarkAccounts + 1
+
+		for pb.Next() {
+			err := s.UpdateAccount(ctx, id, func(a *card.Account) error {
+				return a.Load(ctx, amount, a.Currency)
+			})
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkCreateAccount measures the throughput of concurrent account
+// creation. The dir and journal stores only serialize the creation of
+// accounts in the same shard of their account map.
+func BenchmarkCreateAccount(b *testing.B) {
+	benchmarkStore(b, func(b *testing.B, s Store) {
+		ctx := context.Background()
+
+		var next int64
+
+		b.SetParallelism(benchmarkAccounts)
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				err := s.CreateAccount(ctx, card.NewAccount(int(atomic.AddInt64(&next, 1))))
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
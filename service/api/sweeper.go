@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"go.uber.org/zap"
+)
+
+var (
+	sweepInterval time.Duration
+	sweepJitter   time.Duration
+)
+
+func init() {
+	flag.DurationVar(&sweepInterval, "sweep-interval", time.Minute, "Expired authorization sweep interval")
+	flag.DurationVar(&sweepJitter, "sweep-jitter", 5*time.Second, "Maximum random delay added to each sweep interval, spreading the sweeps of API instances sharing a schedule")
+}
+
+// Sweep metrics, published with expvar.
+var (
+	sweeps                = expvar.NewInt("sweeps")
+	sweepErrors           = expvar.NewInt("sweepErrors")
+	expiredAuthorizations = expvar.NewInt("expiredAuthorizations")
+
+	// releasedAmounts is the total amount released by currency.
+	releasedAmounts = expvar.NewMap("releasedAmounts")
+)
+
+// sweepAuthorizations periodically releases expired authorization holds
+// until the given context is cancelled. Each sweep waits the given interval
+// plus a random delay of up to the given jitter.
+func sweepAuthorizations(ctx context.Context, interval, jitter time.Duration) {
+	for {
+		delay := interval
+
+		if jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(jitter)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-time.After(delay):
+			expireAuthorizations(now)
+		}
+	}
+}
+
+// expireAuthorizations releases expired authorization holds across all
+// accounts, walking the accounts without copying them and updating only the
+// accounts holding expired authorizations. Each released hold is reversed,
+// publishing a REVERSE event, logged and counted.
+func expireAuthorizations(now time.Time) {
+	ctx := context.Background()
+
+	var expired []int
+
+	err := store.WalkAccounts(ctx, func(a *card.Account) error {
+		if hasExpiredAuthorizations(a, now) {
+			expired = append(expired, a.ID)
+		}
+
+		return nil
+	})
+
+	sweeps.Add(1)
+
+	if err != nil {
+		sweepErrors.Add(1)
+		logger.Error("Failed to list accounts", zap.Error(err))
+
+		return
+	}
+
+	for _, id := range expired {
+		var (
+			freed    map[string]*apd.Decimal
+			released []card.Transaction
+		)
+
+		err = store.UpdateAccount(ctx, id, func(account *card.Account) error {
+			n := len(account.Transactions)
+
+			var err error
+			freed, err = account.ExpireAuthorizations(now)
+
+			if err != nil {
+				return err
+			}
+
+			// Every transaction recorded reverses an expired authorization
+			released = append([]card.Transaction{}, account.Transactions[n:]...)
+
+			return nil
+		})
+
+		if err != nil {
+			sweepErrors.Add(1)
+			logger.Error("Failed to expire authorizations", zap.Int("account", id), zap.Error(err))
+
+			continue
+		}
+
+		for _, t := range released {
+			releasedHold(id, t)
+		}
+
+		currencies := make([]string, 0, len(freed))
+
+		for currency := range freed {
+			currencies = append(currencies, currency)
+		}
+
+		sort.Strings(currencies)
+
+		for _, currency := range currencies {
+			logger.Info("Released expired authorizations", zap.Int("account", id), zap.Stringer("amount", freed[currency]), zap.String("currency", currency))
+		}
+	}
+}
+
+// releasedHold logs and counts the release of an expired authorization hold
+// by the given reversal.
+func releasedHold(accountID int, t card.Transaction) {
+	fields := []zap.Field{
+		zap.Int("account", accountID),
+		zap.Int("transaction", t.ID),
+		zap.String("amount", t.Amount.String()),
+		zap.String("currency", t.Currency),
+	}
+
+	if t.AuthorizationID != nil {
+		fields = append(fields, zap.Int("authorization", *t.AuthorizationID))
+	}
+
+	logger.Info("Released expired authorization", fields...)
+
+	expiredAuthorizations.Add(1)
+
+	amount, err := t.Amount.Float64()
+
+	if err == nil {
+		releasedAmounts.AddFloat(t.Currency, amount)
+	}
+}
+
+// hasExpiredAuthorizations reports whether the account holds funds for
+// authorizations expired at the given time.
+func hasExpiredAuthorizations(a *card.Account, now time.Time) bool {
+	if a.Status == card.Closed {
+		return false
+	}
+
+	for _, au := range a.Authorizations {
+		if !au.Expired(now) {
+			continue
+		}
+
+		remaining, err := au.Remaining()
+
+		if err != nil || remaining.Sign() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"net"
+	"net/http"
+)
+
+var (
+	tlsCert      string
+	tlsKey       string
+	redirectAddr string
+)
+
+func init() {
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file; HTTPS is served when set")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&redirectAddr, "tls-redirect", "", "HTTP address redirecting to HTTPS, e.g. 0.0.0.0:80")
+}
+
+// tlsEnabled reports whether the API is served over HTTPS.
+func tlsEnabled() bool {
+	return tlsCert != "" || tlsKey != ""
+}
+
+// newTLSConfig returns the server TLS configuration: TLS 1.2 or later with
+// forward secret AEAD cipher suites only.
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		CurvePreferences:         []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+}
+
+// listen serves the API over HTTPS when a certificate is configured and over
+// plain HTTP otherwise.
+func listen(s *http.Server) error {
+	if !tlsEnabled() {
+		return s.ListenAndServe()
+	}
+
+	s.TLSConfig = newTLSConfig()
+
+	return s.ListenAndServeTLS(tlsCert, tlsKey)
+}
+
+// newRedirectServer returns a server permanently redirecting HTTP requests to
+// the HTTPS API address.
+func newRedirectServer(addr, apiAddr string) *http.Server {
+	_, port, _ := net.SplitHostPort(apiAddr)
+
+	return &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+
+			if err != nil {
+				host = r.Host
+			}
+
+			if port != "" && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+}
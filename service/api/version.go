@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+)
+
+// latestVersion is the API version served to unversioned requests without a
+// version preference.
+const latestVersion = "v1"
+
+// apiVersions lists the supported API versions.
+var apiVersions = []string{"v1"}
+
+var errUnsupportedVersion = &card.Error{Code: "UNSUPPORTED_VERSION", Message: "unsupported API version"}
+
+// versioned serves routes mounted under a version prefix.
+func versioned(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveVersion(w, r, next, version)
+		})
+	}
+}
+
+// negotiateVersion serves the deprecated unversioned routes, selecting the
+// version from the Accept-Version header and pointing clients at the
+// versioned path.
+func negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := strings.ToLower(strings.TrimSpace(r.Header.Get("Accept-Version")))
+
+		if version == "" {
+			version = latestVersion
+		}
+
+		if !supportedVersion(version) {
+			writeError(w, errorStatus(errUnsupportedVersion), errors.Wrapf(errUnsupportedVersion, "%q", version))
+
+			return
+		}
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "</"+version+r.URL.Path+`>; rel="successor-version"`)
+		serveVersion(w, r, next, version)
+	})
+}
+
+// serveVersion serves the request with the given API version.
+func serveVersion(w http.ResponseWriter, r *http.Request, next http.Handler, version string) {
+	w.Header().Set("API-Version", version)
+	next.ServeHTTP(w, r)
+}
+
+// supportedVersion reports whether the API version is served.
+func supportedVersion(version string) bool {
+	for _, v := range apiVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mountVersions mounts the API routes under each version prefix and, as
+// deprecated aliases, at the root.
+func mountVersions(r chi.Router, routes func(chi.Router)) {
+	for _, v := range apiVersions {
+		version := v
+
+		r.Route("/"+version, func(r chi.Router) {
+			r.Use(versioned(version))
+			routes(r)
+		})
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(negotiateVersion)
+		routes(r)
+	})
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	webhooksFile    string
+	webhookWorkers  int
+	webhookAttempts int
+	webhookBackoff  time.Duration
+	webhookTimeout  time.Duration
+	webhooks        = &webhookRegistry{}
+	webhookQueue    = make(chan webhookDelivery, 1024)
+)
+
+func init() {
+	flag.StringVar(&webhooksFile, "webhooks", "./webhooks.json", "JSON webhook subscriptions")
+	flag.IntVar(&webhookWorkers, "webhook-workers", 4, "Concurrent webhook deliveries")
+	flag.IntVar(&webhookAttempts, "webhook-attempts", 5, "Maximum webhook delivery attempts")
+	flag.DurationVar(&webhookBackoff, "webhook-backoff", time.Second, "Initial webhook retry delay, doubled after each attempt")
+	flag.DurationVar(&webhookTimeout, "webhook-timeout", 10*time.Second, "Webhook request timeout")
+}
+
+// maxWebhookResponseBytes is the size of the webhook response body read, so
+// the connection may be reused, before it's closed.
+const maxWebhookResponseBytes = 64 << 10
+
+var errWebhookNotFound = &card.Error{Code: "WEBHOOK_NOT_FOUND", Message: "webhook not found"}
+
+// webhook subscribes a URL to an account's transaction events.
+type webhook struct {
+	ID        int              `json:"id"`
+	AccountID int              `json:"accountID"`
+	URL       string           `json:"url"`
+	Events    []card.Operation `json:"events"`
+	Secret    string           `json:"secret"`
+}
+
+// subscribed reports whether the webhook receives events for the operation.
+func (h *webhook) subscribed(op card.Operation) bool {
+	for _, v := range h.Events {
+		if v == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webhookRegistry holds the webhook subscriptions. It's safe for concurrent
+// use.
+type webhookRegistry struct {
+	mu     sync.RWMutex
+	lastID int
+	hooks  []*webhook
+
+	// changeMu serializes changes while they're persisted.
+	changeMu sync.Mutex
+}
+
+type webhookRegistryJSON struct {
+	LastID   int        `json:"lastID"`
+	Webhooks []*webhook `json:"webhooks"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *webhookRegistry) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	return json.Marshal(webhookRegistryJSON{r.lastID, r.hooks})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *webhookRegistry) UnmarshalJSON(data []byte) error {
+	var v webhookRegistryJSON
+
+	err := json.Unmarshal(data, &v)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastID, r.hooks = v.LastID, v.Webhooks
+	r.mu.Unlock()
+
+	return nil
+}
+
+// list returns the account's webhooks.
+func (r *webhookRegistry) list(accountID int) []webhook {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	res := []webhook{}
+
+	for _, v := range r.hooks {
+		if v.AccountID == accountID {
+			res = append(res, *v)
+		}
+	}
+
+	return res
+}
+
+// get returns the account's webhook with the given ID.
+func (r *webhookRegistry) get(accountID, id int) (webhook, error) {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	i := r.index(accountID, id)
+
+	if i < 0 {
+		return webhook{}, errors.Wrapf(errWebhookNotFound, "ID: %d", id)
+	}
+
+	return *r.hooks[i], nil
+}
+
+// change applies fn to a copy of the subscriptions and, if it reports a
+// change, persists the copy and only then replaces the registry's
+// subscriptions, so a failed write leaves them unchanged.
+func (r *webhookRegistry) change(fn func(v *webhookRegistryJSON) (bool, error)) error {
+	r.changeMu.Lock()
+
+	defer r.changeMu.Unlock()
+
+	r.mu.RLock()
+	v := webhookRegistryJSON{LastID: r.lastID, Webhooks: make([]*webhook, len(r.hooks))}
+
+	for i, h := range r.hooks {
+		c := *h
+		v.Webhooks[i] = &c
+	}
+
+	r.mu.RUnlock()
+
+	changed, err := fn(&v)
+
+	if err != nil || !changed {
+		return err
+	}
+
+	err = writeDB(webhooksFile, v)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastID, r.hooks = v.LastID, v.Webhooks
+	r.mu.Unlock()
+
+	return nil
+}
+
+// add registers the webhook, assigning its ID.
+func (r *webhookRegistry) add(h webhook) (webhook, error) {
+	err := r.change(func(v *webhookRegistryJSON) (bool, error) {
+		v.LastID++
+		h.ID = v.LastID
+		v.Webhooks = append(v.Webhooks, &h)
+
+		return true, nil
+	})
+
+	if err != nil {
+		return webhook{}, err
+	}
+
+	return h, nil
+}
+
+// update replaces the URL and events of the account's webhook.
+func (r *webhookRegistry) update(h webhook) (webhook, error) {
+	err := r.change(func(v *webhookRegistryJSON) (bool, error) {
+		i := webhookIndex(v.Webhooks, h.AccountID, h.ID)
+
+		if i < 0 {
+			return false, errors.Wrapf(errWebhookNotFound, "ID: %d", h.ID)
+		}
+
+		v.Webhooks[i].URL = h.URL
+		v.Webhooks[i].Events = h.Events
+		h = *v.Webhooks[i]
+
+		return true, nil
+	})
+
+	if err != nil {
+		return webhook{}, err
+	}
+
+	return h, nil
+}
+
+// remove deletes the account's webhook with the given ID.
+func (r *webhookRegistry) remove(accountID, id int) error {
+	return r.change(func(v *webhookRegistryJSON) (bool, error) {
+		i := webhookIndex(v.Webhooks, accountID, id)
+
+		if i < 0 {
+			return false, errors.Wrapf(errWebhookNotFound, "ID: %d", id)
+		}
+
+		v.Webhooks = append(v.Webhooks[:i], v.Webhooks[i+1:]...)
+
+		return true, nil
+	})
+}
+
+// removeAccount deletes the account's webhooks, reporting whether any were
+// registered.
+func (r *webhookRegistry) removeAccount(accountID int) (bool, error) {
+	var removed bool
+
+	err := r.change(func(v *webhookRegistryJSON) (bool, error) {
+		hooks := v.Webhooks[:0]
+
+		for _, h := range v.Webhooks {
+			if h.AccountID != accountID {
+				hooks = append(hooks, h)
+			}
+		}
+
+		removed = len(hooks) < len(v.Webhooks)
+		v.Webhooks = hooks
+
+		return removed, nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return removed, nil
+}
+
+// subscribers returns the account's webhooks subscribed to the operation.
+func (r *webhookRegistry) subscribers(accountID int, op card.Operation) []webhook {
+	r.mu.RLock()
+
+	defer r.mu.RUnlock()
+
+	var res []webhook
+
+	for _, v := range r.hooks {
+		if v.AccountID == accountID && v.subscribed(op) {
+			res = append(res, *v)
+		}
+	}
+
+	return res
+}
+
+// index returns the index of the account's webhook with the given ID, or -1.
+func (r *webhookRegistry) index(accountID, id int) int {
+	return webhookIndex(r.hooks, accountID, id)
+}
+
+// webhookIndex returns the index of the account's webhook with the given ID
+// in the given webhooks, or -1.
+func webhookIndex(hooks []*webhook, accountID, id int) int {
+	for i, v := range hooks {
+		if v.ID == id && v.AccountID == accountID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func loadWebhooks(filename string) error {
+	dbFileMu.Lock()
+
+	defer dbFileMu.Unlock()
+
+	f, err := os.Open(filename)
+
+	if os.IsNotExist(err) {
+		f, err = os.Create(filename)
+
+		if err != nil {
+			return err
+		}
+
+		return f.Close()
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	r, err := unsealReader(f)
+
+	if err != nil {
+		return err
+	}
+
+	err = json.NewDecoder(r).Decode(webhooks)
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// webhookRequest is the body of webhook create and update requests.
+type webhookRequest struct {
+	URL    string           `json:"url"`
+	Events []card.Operation `json:"events"`
+}
+
+// decodeWebhook decodes and validates a webhook request. Webhooks without
+// events are subscribed to every operation.
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (webhook, error) {
+	var req webhookRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return webhook{}, err
+	}
+
+	u, err := url.Parse(req.URL)
+
+	if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+		err = errors.Errorf("invalid webhook URL %q", req.URL)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return webhook{}, err
+	}
+
+	if len(req.Events) == 0 {
+		req.Events = []card.Operation{card.Load, card.Authorize, card.Capture, card.Reverse, card.Refund, card.Adjustment, card.Chargeback}
+	}
+
+	return webhook{URL: req.URL, Events: req.Events}, nil
+}
+
+// webhookAccount returns the ID of the account named by the request, writing
+// an error if it doesn't exist.
+func webhookAccount(w http.ResponseWriter, r *http.Request) (int, error) {
+	account, err := getAccountValue(w, r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return account.ID, nil
+}
+
+func getWebhookID(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "webhookID"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &requestError{err})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	accountID, err := webhookAccount(w, r)
+
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhooks.list(accountID))
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, err := webhookAccount(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h, err := decodeWebhook(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.AccountID = accountID
+	h.Secret, err = newWebhookSecret()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	h, err = webhooks.add(h)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, h)
+}
+
+func getWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, err := webhookAccount(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getWebhookID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h, err := webhooks.get(accountID, id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h)
+}
+
+func updateWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, err := webhookAccount(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getWebhookID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h, err := decodeWebhook(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.ID, h.AccountID = id, accountID
+	h, err = webhooks.update(h)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, err := webhookAccount(w, r)
+
+	if err != nil {
+		return
+	}
+
+	id, err := getWebhookID(w, r)
+
+	if err != nil {
+		return
+	}
+
+	err = webhooks.remove(accountID, id)
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newWebhookSecret returns a random secret for signing webhook payloads.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// webhookEvent is the payload delivered to webhooks.
+type webhookEvent struct {
+	ID          string           `json:"id"`
+	Type        card.Operation   `json:"type"`
+	AccountID   int              `json:"accountID"`
+	Transaction card.Transaction `json:"transaction"`
+}
+
+// webhookDelivery is a pending webhook request. done is called once the
+// delivery succeeds, exhausts its attempts or is cancelled.
+type webhookDelivery struct {
+	hook  webhook
+	event webhookEvent
+	body  []byte
+	done  func()
+}
+
+// publishWebhooks queues the outbox event for delivery to the account's
+// subscribed webhooks, blocking while the queue is full. The event is marked
+// sent once every delivery has completed; deliveries cancelled by the given
+// context leave it in the outbox.
+func publishWebhooks(ctx context.Context, e outboxEvent) {
+	t := e.Transaction
+	hooks := webhooks.subscribers(e.AccountID, t.Type)
+
+	if len(hooks) == 0 {
+		outbox.sent(e.ID)
+
+		return
+	}
+
+	event := webhookEvent{
+		ID:          strconv.Itoa(e.AccountID) + "-" + strconv.Itoa(t.ID),
+		Type:        t.Type,
+		AccountID:   e.AccountID,
+		Transaction: t,
+	}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		logger.Error("Failed to encode webhook event", zap.String("event", event.ID), zap.Error(err))
+		outbox.sent(e.ID)
+
+		return
+	}
+
+	remaining := int32(len(hooks))
+	done := func() {
+		if ctx.Err() == nil && atomic.AddInt32(&remaining, -1) == 0 {
+			outbox.sent(e.ID)
+		}
+	}
+
+	for _, v := range hooks {
+		select {
+		case <-ctx.Done():
+			return
+		case webhookQueue <- webhookDelivery{v, event, body, done}:
+		}
+	}
+}
+
+// dispatchWebhooks delivers queued webhook events with the configured number
+// of workers until the given context is cancelled.
+func dispatchWebhooks(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	client := &http.Client{Timeout: webhookTimeout}
+
+	for i := 0; i < webhookWorkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-webhookQueue:
+					deliverWebhook(ctx, client, d)
+					d.done()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// deliverWebhook posts the event to the webhook, retrying failures with
+// exponential backoff.
+func deliverWebhook(ctx context.Context, client *http.Client, d webhookDelivery) {
+	delay := webhookBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(ctx, client, d)
+
+		if err == nil {
+			return
+		}
+
+		log := logger.With(
+			zap.Int("webhook", d.hook.ID),
+			zap.String("event", d.event.ID),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+
+		if attempt >= webhookAttempts {
+			log.Error("Webhook delivery failed")
+
+			return
+		}
+
+		log.Warn("Webhook delivery failed, retrying", zap.Duration("delay", delay))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// postWebhook sends the event, signed with an HMAC-SHA256 keyed by the
+// webhook secret of the delivery timestamp, a dot and the body, so receivers
+// can reject replayed deliveries.
+func postWebhook(ctx context.Context, client *http.Client, d webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.hook.URL, bytes.NewReader(d.body))
+
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(d.hook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(d.body)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Card-Event", d.event.Type.String())
+	req.Header.Set("X-Card-Delivery", d.event.ID)
+	req.Header.Set("X-Card-Timestamp", timestamp)
+	req.Header.Set("X-Card-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	res, err := client.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxWebhookResponseBytes))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("unexpected status %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testDelivery returns a delivery of a load event to a webhook posting to
+// the given URL.
+func testDelivery(t *testing.T, url string) webhookDelivery {
+	event := webhookEvent{
+		ID:        "1-1",
+		Type:      card.Load,
+		AccountID: 1,
+		Transaction: card.Transaction{
+			ID:       1,
+			Type:     card.Load,
+			Amount:   apd.New(10, 0),
+			Currency: card.DefaultCurrency,
+		},
+	}
+	body, err := json.Marshal(event)
+
+	require.NoError(t, err)
+
+	return webhookDelivery{
+		hook:  webhook{ID: 1, AccountID: 1, URL: url, Events: []card.Operation{card.Load}, Secret: "secret"},
+		event: event,
+		body:  body,
+		done:  func() {},
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+
+	defer srv.Close()
+
+	d := testDelivery(t, srv.URL)
+
+	require.NoError(t, postWebhook(context.Background(), srv.Client(), d))
+	require.Equal(t, d.body, body)
+	require.Equal(t, "LOAD", header.Get("X-Card-Event"))
+	require.Equal(t, "1-1", header.Get("X-Card-Delivery"))
+
+	timestamp, err := strconv.ParseInt(header.Get("X-Card-Timestamp"), 10, 64)
+
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), time.Minute)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(header.Get("X-Card-Timestamp") + "."))
+	mac.Write(body)
+
+	require.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), header.Get("X-Card-Signature"))
+
+	d.hook.Secret = "other"
+
+	require.NoError(t, postWebhook(context.Background(), srv.Client(), d))
+	require.NotEqual(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), header.Get("X-Card-Signature"), "signed with the webhook's secret")
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	logger = zap.NewNop()
+
+	previousAttempts, previousBackoff := webhookAttempts, webhookBackoff
+	webhookAttempts, webhookBackoff = 3, time.Millisecond
+
+	defer func() {
+		webhookAttempts, webhookBackoff = previousAttempts, previousBackoff
+	}()
+
+	var (
+		requests int32
+		failures int32
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	defer srv.Close()
+
+	ctx := context.Background()
+	d := testDelivery(t, srv.URL)
+
+	// Retried after a failed delivery
+	atomic.StoreInt32(&failures, 1)
+	deliverWebhook(ctx, srv.Client(), d)
+
+	require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	// Abandoned once the attempts are exhausted
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 10)
+	deliverWebhook(ctx, srv.Client(), d)
+
+	require.EqualValues(t, webhookAttempts, atomic.LoadInt32(&requests))
+}
+
+// useTestWebhooks replaces the webhook subscriptions with an empty registry
+// persisted in the given directory, returning a function restoring the
+// previous registry.
+func useTestWebhooks(dir string) func() {
+	previous, previousFile := webhooks, webhooksFile
+	webhooks, webhooksFile = &webhookRegistry{}, filepath.Join(dir, "webhooks.json")
+
+	return func() {
+		webhooks, webhooksFile = previous, previousFile
+	}
+}
+
+func TestWebhookRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+	defer useTestWebhooks(dir)()
+
+	h, err := webhooks.add(webhook{AccountID: 1, URL: "https://example.com/a", Events: []card.Operation{card.Load}})
+
+	require.NoError(t, err)
+	require.Equal(t, 1, h.ID)
+
+	// Failed writes leave the subscriptions unchanged
+	webhooksFile = filepath.Join(dir, "missing", "webhooks.json")
+
+	_, err = webhooks.add(webhook{AccountID: 1, URL: "https://example.com/b", Events: []card.Operation{card.Load}})
+
+	require.Error(t, err)
+
+	_, err = webhooks.update(webhook{ID: 1, AccountID: 1, URL: "https://example.com/c", Events: []card.Operation{card.Capture}})
+
+	require.Error(t, err)
+	require.Error(t, webhooks.remove(1, 1))
+
+	removed, err := webhooks.removeAccount(1)
+
+	require.Error(t, err)
+	require.False(t, removed)
+	require.Equal(t, []webhook{h}, webhooks.list(1))
+
+	// Unknown webhooks aren't written
+	require.Equal(t, errWebhookNotFound, errors.Cause(webhooks.remove(1, 2)))
+
+	webhooksFile = filepath.Join(dir, "webhooks.json")
+
+	h, err = webhooks.update(webhook{ID: 1, AccountID: 1, URL: "https://example.com/c", Events: []card.Operation{card.Capture}})
+
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/c", h.URL)
+
+	// Persisted
+	webhooks = &webhookRegistry{}
+
+	require.NoError(t, loadWebhooks(webhooksFile))
+	require.Equal(t, []webhook{h}, webhooks.list(1))
+
+	removed, err = webhooks.removeAccount(1)
+
+	require.NoError(t, err)
+	require.True(t, removed)
+	require.Empty(t, webhooks.list(1))
+}
+
+func TestPublishWebhooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+	defer useTestWebhooks(dir)()
+
+	previousOutbox := outbox
+	outbox = newEventOutbox()
+
+	defer func() {
+		outbox = previousOutbox
+	}()
+
+	for _, v := range []webhook{
+		{AccountID: 1, URL: "https://example.com/a", Events: []card.Operation{card.Load}},
+		{AccountID: 1, URL: "https://example.com/b", Events: []card.Operation{card.Load}},
+		{AccountID: 1, URL: "https://example.com/c", Events: []card.Operation{card.Capture}},
+	} {
+		_, err := webhooks.add(v)
+
+		require.NoError(t, err)
+	}
+
+	outbox.stage(1, card.Transaction{ID: 1, Type: card.Load, Amount: apd.New(10, 0), Currency: card.DefaultCurrency})
+	outbox.commit(1)
+
+	events := outbox.next()
+
+	require.Len(t, events, 1)
+
+	publishWebhooks(context.Background(), events[0])
+
+	a, b := <-webhookQueue, <-webhookQueue
+
+	require.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, []string{a.hook.URL, b.hook.URL}, "subscribers only")
+	require.Equal(t, "1-1", a.event.ID)
+
+	a.done()
+
+	require.Len(t, outbox.committed(), 1, "sent once every delivery completes")
+
+	b.done()
+
+	require.Empty(t, outbox.committed())
+}
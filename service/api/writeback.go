@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Durability modes.
+const (
+	durabilitySync  = "sync"
+	durabilityAsync = "async"
+)
+
+var (
+	durability    string
+	flushInterval time.Duration
+)
+
+func init() {
+	flag.StringVar(&durability, "durability", durabilitySync, "Durability of account mutations: sync (persisted before responding) or async (persisted in the background in batches; requests may send Durability: sync)")
+	flag.DurationVar(&flushInterval, "flush-interval", 10*time.Millisecond, "Delay batching account mutations persisted asynchronously")
+}
+
+type durabilityKey struct{}
+
+// requestDurability stores the durability requested with the Durability
+// header in the request context.
+func requestDurability(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.Header.Get("Durability")
+
+		if v == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), durabilityKey{}, v)))
+	})
+}
+
+// asyncDurability reports whether mutations made with the given context may
+// be persisted asynchronously: the async durability mode is enabled and
+// synchronous durability wasn't requested.
+func asyncDurability(ctx context.Context) bool {
+	if durability != durabilityAsync {
+		return false
+	}
+
+	v, _ := ctx.Value(durabilityKey{}).(string)
+
+	return v != durabilitySync
+}
+
+// writeQueue holds the IDs of the accounts mutated, but not yet persisted,
+// by a store persisting mutations asynchronously. It's safe for concurrent
+// use.
+type writeQueue struct {
+	mu    sync.Mutex
+	ids   map[int]bool
+	dirty bool
+	ready chan struct{}
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{
+		ids:   map[int]bool{},
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// add queues the given accounts, waking the writer.
+func (q *writeQueue) add(accountIDs ...int) {
+	q.mu.Lock()
+
+	defer q.mu.Unlock()
+
+	for _, id := range accountIDs {
+		q.ids[id] = true
+	}
+
+	q.dirty = true
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the queued accounts, reporting whether any
+// mutations were queued, including those of no account in particular.
+func (q *writeQueue) take() ([]int, bool) {
+	q.mu.Lock()
+
+	defer q.mu.Unlock()
+
+	res := make([]int, 0, len(q.ids))
+
+	for id := range q.ids {
+		res = append(res, id)
+	}
+
+	dirty := q.dirty
+	q.ids, q.dirty = map[int]bool{}, false
+
+	return res, dirty
+}
+
+// flusher is implemented by stores persisting mutations asynchronously.
+type flusher interface {
+	// queued returns a channel signalled when mutations are queued.
+	queued() <-chan struct{}
+
+	// flush persists the queued mutations, committing their events.
+	// Mutations that fail to persist remain queued.
+	flush() error
+}
+
+// flushWrites persists the mutations queued by the store, in batches, until
+// the given context is cancelled. Mutations still queued are persisted when
+// the store is closed.
+func flushWrites(ctx context.Context) {
+	s, ok := store.(flusher)
+
+	if !ok || durability != durabilityAsync {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.queued():
+		}
+
+		// Coalesce the mutations queued meanwhile
+		if flushInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(flushInterval):
+			}
+		}
+
+		err := s.flush()
+
+		if err == nil {
+			continue
+		}
+
+		logger.Error("Failed to write to database", zap.Error(err))
+
+		// Retry no more than once a second
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	"github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAsyncDurability(t *testing.T) {
+	logger = zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "card")
+
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	previous := durability
+	durability = durabilityAsync
+
+	defer func() {
+		durability = previous
+	}()
+
+	ctx := context.Background()
+	s := openTestJournal(t, dir)
+
+	mutateStore(t, s)
+
+	// Mutations are queued, their events held until they're persisted
+	_, size := s.log.position()
+
+	require.Zero(t, size)
+	require.Empty(t, s.outbox.committed())
+	require.NotEmpty(t, s.outbox.pending(1))
+
+	require.NoError(t, s.flush())
+
+	_, size = s.log.position()
+
+	require.NotZero(t, size)
+	require.NotEmpty(t, s.outbox.committed())
+
+	state := storeState(t, s)
+
+	crash(t, s)
+
+	s = openTestJournal(t, dir)
+
+	require.Equal(t, state, storeState(t, s), "flushed mutations persisted")
+
+	// Synchronous durability may be requested
+	_, size = s.log.position()
+
+	require.NoError(t, s.UpdateAccount(context.WithValue(ctx, durabilityKey{}, durabilitySync), 1, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(10, 0), card.DefaultCurrency)
+	}))
+
+	_, synced := s.log.position()
+
+	require.True(t, synced > size)
+
+	// Mutations still queued are persisted on shutdown, committing their
+	// held events
+	require.NoError(t, s.UpdateAccount(ctx, 2, func(a *card.Account) error {
+		return a.Load(ctx, apd.New(50, 0), card.DefaultCurrency)
+	}))
+	require.NoError(t, s.CreateAccount(ctx, card.NewAccount(4)))
+
+	accounts, err := s.ListAccounts(ctx)
+
+	require.NoError(t, err)
+
+	events, err := json.Marshal(s.outbox.pending(2))
+
+	require.NoError(t, err)
+
+	require.NoError(t, s.Close())
+
+	s = openTestJournal(t, dir)
+
+	defer s.Close()
+
+	persisted, err := s.ListAccounts(ctx)
+
+	require.NoError(t, err)
+	require.Equal(t, accountsJSON(t, accounts), accountsJSON(t, persisted), "queued mutations persisted on close")
+
+	committed, err := json.Marshal(s.outbox.pending(2))
+
+	require.NoError(t, err)
+	require.JSONEq(t, string(events), string(committed), "held events committed on close")
+}
+
+// accountsJSON returns the JSON encoding of the given accounts.
+func accountsJSON(t *testing.T, accounts []*card.Account) string {
+	b, err := json.Marshal(accounts)
+
+	require.NoError(t, err)
+
+	return string(b)
+}
@@ -0,0 +1,140 @@
+package card
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/apd"
+)
+
+// MerchantSettlement represents the net amount captured by a merchant in a
+// single currency since it was last settled.
+type MerchantSettlement struct {
+	MerchantID int          `json:"merchantID"`
+	Currency   string       `json:"currency"`
+	Amount     *apd.Decimal `json:"amount"`
+}
+
+// Settle moves the amount captured by each merchant since it was last settled
+// to its settled total, resetting its captured amount, and returns the amounts
+// settled, ordered by merchant ID and then by currency. Refunds after
+// settlement leave the captured amount negative, netted by the next
+// settlement.
+func (a *Account) Settle() ([]MerchantSettlement, error) {
+	var res []MerchantSettlement
+
+	dctx := a.decimalContext()
+
+	for _, currency := range a.Currencies() {
+		p, _ := a.pocket(currency)
+
+		for id, m := range p.Merchants {
+			if m.Captured.IsZero() {
+				continue
+			}
+
+			if m.Settled == nil {
+				m.Settled = apd.New(0, 0)
+			}
+
+			_, err := dctx.Add(m.Settled, m.Settled, m.Captured)
+
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, MerchantSettlement{
+				MerchantID: id,
+				Currency:   currency,
+				Amount:     m.Captured,
+			})
+			m.Captured = apd.New(0, 0)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	// Currencies are already ordered
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].MerchantID < res[j].MerchantID
+	})
+
+	a.bump()
+
+	return res, nil
+}
+
+// Unsettled reports whether any merchant has captured amounts not yet
+// settled. The account isn't modified.
+func (a *Account) Unsettled() bool {
+	if unsettled(a.Merchants) {
+		return true
+	}
+
+	for _, p := range a.Pockets {
+		if unsettled(p.Merchants) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unsettled reports whether any of the given merchants has captured amounts
+// not yet settled.
+func unsettled(merchants map[int]*Merchant) bool {
+	for _, m := range merchants {
+		if !m.Captured.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SettlementTotals returns the given settlements totalled by merchant and
+// currency, ordered by merchant ID and then by currency. Settlements may span
+// accounts, so they're totalled with the context set by SetDecimalContext.
+func SettlementTotals(settlements []MerchantSettlement) ([]MerchantSettlement, error) {
+	type key struct {
+		merchantID int
+		currency   string
+	}
+
+	var res []MerchantSettlement
+
+	index := map[key]int{}
+	dctx := getContext()
+
+	for _, v := range settlements {
+		k := key{v.MerchantID, v.Currency}
+		i, exists := index[k]
+
+		if !exists {
+			i = len(res)
+			index[k] = i
+			res = append(res, MerchantSettlement{
+				MerchantID: v.MerchantID,
+				Currency:   v.Currency,
+				Amount:     apd.New(0, 0),
+			})
+		}
+
+		_, err := dctx.Add(res[i].Amount, res[i].Amount, v.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].MerchantID != res[j].MerchantID {
+			return res[i].MerchantID < res[j].MerchantID
+		}
+
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res, nil
+}
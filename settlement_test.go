@@ -0,0 +1,101 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettle(t *testing.T) {
+	account := NewAccount(0)
+
+	require.False(t, account.Unsettled())
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	res, err := account.Settle()
+
+	require.NoError(t, err)
+	require.Empty(t, res)
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(60, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(50, 0), DefaultCurrency))
+
+	other, err := account.Authorize(ctx, merchantID+1, apd.New(10, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, other.ID, apd.New(10, 0), DefaultCurrency))
+	require.True(t, account.Unsettled())
+
+	res, err = account.Settle()
+
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, merchantID, res[0].MerchantID)
+	require.Equal(t, DefaultCurrency, res[0].Currency)
+	require.Zero(t, res[0].Amount.Cmp(apd.New(50, 0)))
+	require.Zero(t, res[1].Amount.Cmp(apd.New(10, 0)))
+	require.False(t, account.Unsettled())
+
+	m := account.Merchants[merchantID]
+
+	require.True(t, m.Captured.IsZero())
+	require.Zero(t, m.Settled.Cmp(apd.New(50, 0)))
+
+	spent, err := m.Spent()
+
+	require.NoError(t, err)
+	require.Zero(t, spent.Cmp(apd.New(60, 0)), "settled amounts count towards spending")
+
+	t.Run("RefundAfterSettlement", func(t *testing.T) {
+		require.NoError(t, account.Refund(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+		require.NoError(t, account.Validate())
+		require.True(t, account.Unsettled())
+
+		res, err := account.Settle()
+
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		require.Zero(t, res[0].Amount.Cmp(apd.New(-20, 0)), "netted against the next settlement")
+		require.Zero(t, m.Settled.Cmp(apd.New(30, 0)))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(account)
+
+		require.NoError(t, err)
+		require.Contains(t, string(b), `"settled":"30"`)
+
+		var restored Account
+
+		require.NoError(t, json.Unmarshal(b, &restored))
+		require.Zero(t, restored.Merchants[merchantID].Settled.Cmp(apd.New(30, 0)))
+		require.NoError(t, restored.Validate())
+		require.Zero(t, restored.Clone().Merchants[merchantID].Settled.Cmp(apd.New(30, 0)))
+	})
+}
+
+func TestSettlementTotals(t *testing.T) {
+	res, err := SettlementTotals([]MerchantSettlement{
+		{MerchantID: 2, Currency: "USD", Amount: apd.New(5, 0)},
+		{MerchantID: 1, Currency: DefaultCurrency, Amount: apd.New(10, 0)},
+		{MerchantID: 2, Currency: "USD", Amount: apd.New(-1, 0)},
+		{MerchantID: 1, Currency: DefaultCurrency, Amount: apd.New(25, -1)},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, 1, res[0].MerchantID)
+	require.Zero(t, res[0].Amount.Cmp(apd.New(125, -1)))
+	require.Equal(t, "USD", res[1].Currency)
+	require.Zero(t, res[1].Amount.Cmp(apd.New(4, 0)))
+
+	b, err := json.Marshal(res[0])
+
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"amount":"12.5"`)
+}
@@ -0,0 +1,18 @@
+package card
+
+// Snapshot represents an immutable copy of an account's state.
+type Snapshot struct {
+	account *Account
+}
+
+// Snapshot returns a copy of the account's current state which can later be
+// restored, e.g. to roll back operations when persisting them fails.
+func (a *Account) Snapshot() Snapshot {
+	return Snapshot{account: a.Clone()}
+}
+
+// RestoreAccount returns a new account with the state captured by the given
+// snapshot. The snapshot is unaffected and may be restored again.
+func RestoreAccount(s Snapshot) *Account {
+	return s.account.Clone()
+}
@@ -0,0 +1,44 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	snapshot := account.Snapshot()
+
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+	require.NoError(t, account.SetMerchantLimit(merchantID, apd.New(60, 0)))
+
+	restored := RestoreAccount(snapshot)
+
+	require.Len(t, restored.Transactions, 2)
+	require.Zero(t, restored.Available.Cmp(apd.New(50, 0)))
+	require.Zero(t, restored.Blocked.Cmp(apd.New(50, 0)))
+	require.True(t, restored.Merchants[merchantID].Captured.IsZero())
+	require.Nil(t, restored.Merchants[merchantID].Limit)
+	require.True(t, restored.Authorizations[au.ID].Captured.IsZero())
+	require.Equal(t, AuthorizationOpen, restored.Authorizations[au.ID].Status)
+
+	t.Run("Independent", func(t *testing.T) {
+		require.NoError(t, restored.Capture(ctx, au.ID, apd.New(50, 0), DefaultCurrency))
+		require.Zero(t, account.Authorizations[au.ID].Captured.Cmp(apd.New(20, 0)))
+
+		again := RestoreAccount(snapshot)
+
+		require.Len(t, again.Transactions, 2)
+		require.True(t, again.Authorizations[au.ID].Captured.IsZero())
+	})
+}
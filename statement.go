@@ -1,75 +1,205 @@
 package card
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"text/template"
+	"unicode/utf8"
 )
 
-// Statement generates an account statement.
-func (a *Account) Statement() (string, error) {
-	balance, err := a.Balance()
+// timestampFormat is the statement transaction timestamp layout.
+const timestampFormat = "2006-01-02 15:04:05"
 
-	if err != nil {
-		return "", err
+// merchantColumnWidth is the statement merchant column width.
+const merchantColumnWidth = 8
+
+// StatementOption configures statement generation.
+type StatementOption func(*statementOptions)
+
+type statementOptions struct {
+	merchants *MerchantRegistry
+	filter    FilterOptions
+	cursor    int
+	limit     int
+	locale    string
+	template  *template.Template
+	order     SortOrder
+}
+
+// WithMerchantRegistry renders registered merchant names in place of
+// merchant IDs.
+func WithMerchantRegistry(r *MerchantRegistry) StatementOption {
+	return func(o *statementOptions) {
+		o.merchants = r
+	}
+}
+
+func newStatementOptions(opts []StatementOption) *statementOptions {
+	o := &statementOptions{}
+
+	for _, opt := range opts {
+		opt(o)
 	}
 
-	available, err := balance.Available.Float64()
+	return o
+}
 
-	if err != nil {
-		return "", err
+// merchantName returns the statement display value for the given merchant.
+func (o *statementOptions) merchantName(merchantID int) string {
+	if o.merchants != nil {
+		m, err := o.merchants.Get(merchantID)
+
+		if err == nil && m.Name != "" {
+			name := []rune(m.Name)
+
+			if len(name) > merchantColumnWidth {
+				name = name[:merchantColumnWidth]
+			}
+
+			return string(name)
+		}
 	}
 
-	blocked, err := balance.Blocked.Float64()
+	return strconv.Itoa(merchantID)
+}
+
+// Statement generates an account statement, reporting each held currency
+// separately.
+func (a *Account) Statement(opts ...StatementOption) (string, error) {
+	var sb strings.Builder
+
+	err := a.WriteStatement(&sb, opts...)
 
 	if err != nil {
 		return "", err
 	}
 
-	total, err := balance.Total.Float64()
+	return sb.String(), nil
+}
+
+// WriteStatement writes an account statement to the given writer, reporting
+// each held currency separately.
+func (a *Account) WriteStatement(w io.Writer, opts ...StatementOption) error {
+	o := newStatementOptions(opts)
+	data, err := a.statementData(o)
 
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if o.template != nil {
+		err = o.template.Execute(bw, data)
+
+		if err != nil {
+			return err
+		}
+
+		return bw.Flush()
+	}
+
+	for i := range data.Sections {
+		if i > 0 {
+			bw.WriteString("\n\n")
+		}
+
+		writeStatementSection(bw, &data.Sections[i])
 	}
 
+	return bw.Flush()
+}
+
+// Minimum statement column widths.
+const (
+	idColumnWidth     = 6
+	dateColumnWidth   = len(timestampFormat)
+	typeColumnWidth   = 9
+	amountColumnWidth = 9
+)
+
+// writeStatementSection writes a single currency section using the default
+// statement layout. Columns are widened to fit the widest value.
+func writeStatementSection(bw *bufio.Writer, s *StatementSection) {
 	var (
-		sb   strings.Builder
-		line = strings.Repeat("-", 43)
+		idWidth       = idColumnWidth
+		typeWidth     = typeColumnWidth
+		merchantWidth = merchantColumnWidth
+		amountWidth   = amountColumnWidth
+		ids           = make([]string, len(s.Lines))
 	)
 
-	fmt.Fprintf(&sb, `Available: %32.2f
-Blocked: %34.2f
-Total: %36.2f
+	for i, v := range s.Lines {
+		ids[i] = strconv.Itoa(v.Transaction.ID)
+		idWidth = maxWidth(idWidth, ids[i])
+		typeWidth = maxWidth(typeWidth, v.Type)
+		merchantWidth = maxWidth(merchantWidth, v.Merchant)
+		amountWidth = maxWidth(amountWidth, v.Amount)
+	}
+
+	balances := [][2]string{
+		{"Currency:", s.Currency},
+		{"Available:", s.Available},
+		{"Blocked:", s.Blocked},
+		{"Total:", s.Total},
+	}
+
+	if s.OverdraftUsed != "" {
+		balances = append(balances, [2]string{"Overdraft used:", s.OverdraftUsed}, [2]string{"Overdraft headroom:", s.OverdraftHeadroom})
+	}
 
-%[4]s
- ID     | Type      | Merchant | Amount
-%[4]s`, available, blocked, total, line)
+	// Row cells are padded and separated by " | ", plus a trailing column
+	width := 1 + idWidth + 3 + dateColumnWidth + 3 + typeWidth + 3 + merchantWidth + 3 + amountWidth + 1
 
-	if len(a.Transactions) == 0 {
-		sb.WriteString("\n          *** NO TRANSACTIONS ***")
+	for _, v := range balances {
+		width = maxWidth(width, v[0]+" "+v[1])
+	}
 
-		return sb.String(), nil
+	for _, v := range balances {
+		fmt.Fprintf(bw, "%s %*s\n", v[0], width-utf8.RuneCountInString(v[0])-1, v[1])
 	}
 
-	sb.WriteByte('\n')
+	line := strings.Repeat("-", width)
 
-	for i, v := range a.Transactions {
-		var merchant string
+	fmt.Fprintf(bw, `
+%[1]s
+ %-[2]*[3]s | %-[4]*[5]s | %-[6]*[7]s | %-[8]*[9]s | Amount
+%[1]s`, line, idWidth, "ID", dateColumnWidth, "Date", typeWidth, "Type", merchantWidth, "Merchant")
 
-		if v.MerchantID != nil {
-			merchant = strconv.Itoa(*v.MerchantID)
-		}
+	if len(s.Lines) == 0 {
+		bw.WriteString("\n                    *** NO TRANSACTIONS ***")
 
-		f, err := v.Amount.Float64()
+		return
+	}
 
-		if err != nil {
-			return "", err
+	bw.WriteByte('\n')
+
+	for i, v := range s.Lines {
+		t := v.Transaction
+
+		fmt.Fprintf(bw, " %-*s | %-*s | %-*s | %-*s | %*s", idWidth, ids[i], dateColumnWidth, v.Date, typeWidth, v.Type, merchantWidth, v.Merchant, amountWidth, v.Amount)
+
+		if t.OriginalTransactionID != nil {
+			fmt.Fprintf(bw, " | %s of txn %d", v.Type, *t.OriginalTransactionID)
 		}
 
-		fmt.Fprintf(&sb, " %-6d | %-9s | %-8s | %9.2f\n", i, v.Type, merchant, f)
+		bw.WriteByte('\n')
 	}
 
-	sb.WriteString(line)
+	bw.WriteString(line)
+}
 
-	return sb.String(), nil
+// maxWidth returns the greater of the given width and the display width of
+// the given value.
+func maxWidth(width int, v string) int {
+	n := utf8.RuneCountInString(v)
+
+	if n > width {
+		return n
+	}
+
+	return width
 }
@@ -1,7 +1,11 @@
 package card_test
 
 import (
+	"io"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	. "github.com/martingallagher/card"
 	"github.com/stretchr/testify/require"
@@ -9,34 +13,138 @@ import (
 
 func TestStatement(t *testing.T) {
 	account := NewAccount(0)
+	account.Clock = func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}
 
-	require.NoError(t, account.Load(decimalFromString("915.75")))
-	require.NoError(t, account.Authorize(1, decimalFromString("15.00")))
-	require.NoError(t, account.Capture(1, decimalFromString("5")))
-	require.NoError(t, account.Capture(1, decimalFromString("5")))
-	require.NoError(t, account.Reverse(1, decimalFromString("2.5")))
-	require.NoError(t, account.Refund(1, decimalFromString("10")))
-	require.NoError(t, account.Capture(1, decimalFromString("2.5")))
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, 1, decimalFromString("15.00"), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("5"), DefaultCurrency))
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("5"), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, decimalFromString("2.5"), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, decimalFromString("10"), DefaultCurrency))
+	require.NoError(t, account.Capture(ctx, au.ID, decimalFromString("2.5"), DefaultCurrency))
 
 	statement, err := account.Statement()
 
 	require.NoError(t, err)
 
-	const expected = `Available:                           913.25
-Blocked:                               0.00
-Total:                               913.25
-
--------------------------------------------
- ID     | Type      | Merchant | Amount
--------------------------------------------
- 0      | LOAD      |          |    915.75
- 1      | AUTHORIZE | 1        |     15.00
- 2      | CAPTURE   | 1        |      5.00
- 3      | CAPTURE   | 1        |      5.00
- 4      | REVERSE   | 1        |      2.50
- 5      | REFUND    | 1        |     10.00
- 6      | CAPTURE   | 1        |      2.50
--------------------------------------------`
+	const expected = `Currency:                                                     GBP
+Available:                                                 913.25
+Blocked:                                                     0.00
+Total:                                                     913.25
+
+-----------------------------------------------------------------
+ ID     | Date                | Type      | Merchant | Amount
+-----------------------------------------------------------------
+ 1      | 2018-06-01 09:30:00 | LOAD      |          |    915.75
+ 2      | 2018-06-01 09:30:00 | AUTHORIZE | 1        |     15.00
+ 3      | 2018-06-01 09:30:00 | CAPTURE   | 1        |      5.00
+ 4      | 2018-06-01 09:30:00 | CAPTURE   | 1        |      5.00
+ 5      | 2018-06-01 09:30:00 | REVERSE   | 1        |      2.50
+ 6      | 2018-06-01 09:30:00 | REFUND    | 1        |     10.00
+ 7      | 2018-06-01 09:30:00 | CAPTURE   | 1        |      2.50
+-----------------------------------------------------------------`
 
 	require.Equal(t, expected, statement)
 }
+
+func TestStatementPrecision(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("9007199254740993.25"), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, decimalFromString("0.125"), DefaultCurrency))
+
+	statement, err := account.Statement()
+
+	require.NoError(t, err)
+	require.Contains(t, statement, "| 9007199254740993.25\n")
+	require.Contains(t, statement, "|                0.13\n")
+}
+
+func TestStatementColumnWidths(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("123456789.5"), DefaultCurrency))
+
+	_, err := account.Authorize(ctx, 1234567890, decimalFromString("1.5"), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	statement, err := account.Statement()
+
+	require.NoError(t, err)
+
+	lines := strings.Split(statement, "\n")
+	width := utf8.RuneCountInString(lines[0])
+
+	for _, v := range lines {
+		if v == "" || strings.HasSuffix(v, "| Amount") {
+			continue
+		}
+
+		if strings.HasPrefix(v, " ") {
+			// Table rows end before the trailing column
+			require.Equal(t, width-1, utf8.RuneCountInString(v), v)
+
+			continue
+		}
+
+		require.Equal(t, width, utf8.RuneCountInString(v), v)
+	}
+
+	require.Contains(t, statement, " 2      | ")
+	require.Contains(t, statement, " | 1234567890 |         1.50\n")
+}
+
+func TestStatementMerchantNames(t *testing.T) {
+	account := NewAccount(0)
+	account.Clock = func() time.Time {
+		return time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+	}
+	merchants := NewMerchantRegistry(
+		MerchantInfo{ID: 1, Name: "Cafe", MCC: "5814", Country: "GB"},
+		MerchantInfo{ID: 2, Name: "Supermarket", MCC: "5411", Country: "GB"},
+	)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("100"), DefaultCurrency))
+
+	for _, id := range []int{1, 2, 3} {
+		_, err := account.Authorize(ctx, id, decimalFromString("10"), DefaultCurrency)
+
+		require.NoError(t, err)
+	}
+
+	statement, err := account.Statement(WithMerchantRegistry(merchants))
+
+	require.NoError(t, err)
+	require.Contains(t, statement, " 2      | 2018-06-01 09:30:00 | AUTHORIZE | Cafe     |     10.00\n")
+	require.Contains(t, statement, " 3      | 2018-06-01 09:30:00 | AUTHORIZE | Supermar |     10.00\n")
+	require.Contains(t, statement, " 4      | 2018-06-01 09:30:00 | AUTHORIZE | 3        |     10.00\n")
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriteStatement(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("915.75"), DefaultCurrency))
+
+	statement, err := account.Statement()
+
+	require.NoError(t, err)
+
+	var sb strings.Builder
+
+	require.NoError(t, account.WriteStatement(&sb))
+	require.Equal(t, statement, sb.String())
+	require.Equal(t, io.ErrClosedPipe, account.WriteStatement(failingWriter{}))
+}
@@ -0,0 +1,96 @@
+package card
+
+// Account statuses.
+const (
+	Active Status = iota
+	Frozen
+	Closed
+)
+
+// Account status errors.
+var (
+	ErrAccountFrozen = newError("ACCOUNT_FROZEN", "account is frozen")
+	ErrAccountClosed = newError("ACCOUNT_CLOSED", "account is closed")
+)
+
+// Status represents an account lifecycle status.
+type Status uint8
+
+func (s Status) String() string {
+	switch s {
+	case Active:
+		return "ACTIVE"
+	case Frozen:
+		return "FROZEN"
+	case Closed:
+		return "CLOSED"
+	}
+
+	return "UNKNOWN"
+}
+
+// Freeze freezes the account; frozen accounts reject authorizations and
+// captures.
+func (a *Account) Freeze() error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	a.Status = Frozen
+	a.bump()
+
+	return nil
+}
+
+// Unfreeze reactivates a frozen account.
+func (a *Account) Unfreeze() error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	a.Status = Active
+	a.bump()
+
+	return nil
+}
+
+// Close permanently closes the account; closed accounts reject all
+// operations.
+func (a *Account) Close() error {
+	if a.Status == Closed {
+		return ErrAccountClosed
+	}
+
+	a.Status = Closed
+	a.bump()
+
+	return nil
+}
+
+// checkStatus verifies the account status permits the given operation.
+func (a *Account) checkStatus(op Operation) error {
+	switch a.Status {
+	case Closed:
+		return ErrAccountClosed
+	case Frozen:
+		if op == Authorize || op == Capture {
+			return ErrAccountFrozen
+		}
+	}
+
+	return nil
+}
+
+// HasBlockedFunds reports whether any authorization holds funds in any held
+// currency.
+func (a *Account) HasBlockedFunds() bool {
+	for _, currency := range a.Currencies() {
+		p, _ := a.pocket(currency)
+
+		if p.Blocked != nil && p.Blocked.Sign() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, Active, account.Status)
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(50, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+
+	t.Run("Frozen", func(t *testing.T) {
+		require.NoError(t, account.Freeze())
+		require.Equal(t, Frozen, account.Status)
+
+		_, err := account.Authorize(ctx, merchantID, apd.New(1, 0), DefaultCurrency)
+
+		require.Equal(t, ErrAccountFrozen, err)
+		require.Equal(t, ErrAccountFrozen, account.Capture(ctx, au.ID, apd.New(1, 0), DefaultCurrency))
+		require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+
+		_, err = account.Balance(ctx)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Unfrozen", func(t *testing.T) {
+		require.NoError(t, account.Unfreeze())
+		require.Equal(t, Active, account.Status)
+		require.NoError(t, account.Capture(ctx, au.ID, apd.New(1, 0), DefaultCurrency))
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, account.Close())
+		require.Equal(t, Closed, account.Status)
+		require.Equal(t, ErrAccountClosed, account.Load(ctx, apd.New(1, 0), DefaultCurrency))
+		require.Equal(t, ErrAccountClosed, account.Reverse(ctx, au.ID, apd.New(1, 0), DefaultCurrency))
+		require.Equal(t, ErrAccountClosed, account.Refund(ctx, au.ID, apd.New(1, 0), DefaultCurrency))
+		require.Equal(t, ErrAccountClosed, account.Freeze())
+		require.Equal(t, ErrAccountClosed, account.Unfreeze())
+		require.Equal(t, ErrAccountClosed, account.Close())
+
+		_, err := account.Balance(ctx)
+
+		require.Equal(t, ErrAccountClosed, err)
+	})
+
+	require.Len(t, account.Transactions, 5)
+}
+
+func TestHasBlockedFunds(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(10, 0), "EUR"))
+	require.False(t, account.HasBlockedFunds())
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(5, 0), "EUR")
+
+	require.NoError(t, err)
+	require.True(t, account.HasBlockedFunds())
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(5, 0), "EUR"))
+	require.False(t, account.HasBlockedFunds())
+}
@@ -0,0 +1,159 @@
+package card
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Summary represents the aggregated transaction amounts of a calendar month.
+type Summary struct {
+	Month time.Time `json:"month"`
+
+	// Totals per held currency.
+	Totals []SummaryTotals `json:"totals"`
+
+	// Totals per merchant and currency, ordered by merchant ID.
+	Merchants []SummaryTotals `json:"merchants"`
+}
+
+// SummaryTotals represents the transaction amounts of a single currency,
+// either across the account or for a single merchant.
+type SummaryTotals struct {
+	MerchantID *int         `json:"merchantID,omitempty"`
+	Currency   string       `json:"currency"`
+	Loaded     *apd.Decimal `json:"loaded"`
+	Authorized *apd.Decimal `json:"authorized"`
+	Captured   *apd.Decimal `json:"captured"`
+	Reversed   *apd.Decimal `json:"reversed"`
+	Refunded   *apd.Decimal `json:"refunded"`
+	Adjusted   *apd.Decimal `json:"adjusted"`
+
+	// ChargedBack is the net amount of chargebacks: provisional dispute
+	// credits less their re-debits.
+	ChargedBack *apd.Decimal `json:"chargedBack"`
+}
+
+// summaryKey identifies merchant totals.
+type summaryKey struct {
+	merchantID int
+	currency   string
+}
+
+// Summary returns the transaction totals per currency and per merchant for
+// the UTC calendar month containing the given time.
+func (a *Account) Summary(month time.Time) (*Summary, error) {
+	var (
+		y, m, _   = month.UTC().Date()
+		start     = time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+		end       = start.AddDate(0, 1, 0)
+		s         = &Summary{Month: start}
+		dctx      = a.decimalContext()
+		totals    = map[string]*SummaryTotals{}
+		merchants = map[summaryKey]*SummaryTotals{}
+	)
+
+	for _, currency := range a.Currencies() {
+		totals[currency] = newSummaryTotals(nil, currency)
+	}
+
+	for _, v := range a.Transactions {
+		if v.Timestamp.Before(start) || !v.Timestamp.Before(end) {
+			continue
+		}
+
+		t, exists := totals[v.Currency]
+
+		if !exists {
+			continue
+		}
+
+		err := t.add(dctx, v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if v.MerchantID == nil {
+			continue
+		}
+
+		key := summaryKey{*v.MerchantID, v.Currency}
+		mt, exists := merchants[key]
+
+		if !exists {
+			mt = newSummaryTotals(v.MerchantID, v.Currency)
+			merchants[key] = mt
+		}
+
+		err = mt.add(dctx, v)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, currency := range a.Currencies() {
+		s.Totals = append(s.Totals, *totals[currency])
+	}
+
+	s.Merchants = make([]SummaryTotals, 0, len(merchants))
+
+	for _, v := range merchants {
+		s.Merchants = append(s.Merchants, *v)
+	}
+
+	sort.Slice(s.Merchants, func(i, j int) bool {
+		if *s.Merchants[i].MerchantID != *s.Merchants[j].MerchantID {
+			return *s.Merchants[i].MerchantID < *s.Merchants[j].MerchantID
+		}
+
+		return s.Merchants[i].Currency < s.Merchants[j].Currency
+	})
+
+	return s, nil
+}
+
+// newSummaryTotals returns zeroed totals.
+func newSummaryTotals(merchantID *int, currency string) *SummaryTotals {
+	return &SummaryTotals{
+		MerchantID:  copyInt(merchantID),
+		Currency:    currency,
+		Loaded:      apd.New(0, 0),
+		Authorized:  apd.New(0, 0),
+		Captured:    apd.New(0, 0),
+		Reversed:    apd.New(0, 0),
+		Refunded:    apd.New(0, 0),
+		Adjusted:    apd.New(0, 0),
+		ChargedBack: apd.New(0, 0),
+	}
+}
+
+// add adds the given transaction amount to the matching total.
+func (t *SummaryTotals) add(dctx *apd.Context, v Transaction) error {
+	var total *apd.Decimal
+
+	switch v.Type {
+	case Load:
+		total = t.Loaded
+	case Authorize:
+		total = t.Authorized
+	case Capture:
+		total = t.Captured
+	case Reverse:
+		total = t.Reversed
+	case Refund:
+		total = t.Refunded
+	case Adjustment:
+		total = t.Adjusted
+	case Chargeback:
+		total = t.ChargedBack
+	default:
+		return nil
+	}
+
+	_, err := dctx.Add(total, total, v.Amount)
+
+	return err
+}
@@ -0,0 +1,92 @@
+package card_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	now := time.Date(2018, time.May, 31, 23, 0, 0, 0, time.UTC)
+	account := NewAccount(0, WithClock(func() time.Time {
+		return now
+	}))
+
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+
+	now = time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC)
+
+	require.NoError(t, account.Load(ctx, apd.New(50, 0), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(20, 0), "EUR"))
+
+	au, err := account.Authorize(ctx, 2, apd.New(30, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(20, 0), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+
+	_, err = account.Authorize(ctx, 1, apd.New(10, 0), "EUR")
+
+	require.NoError(t, err)
+
+	summary, err := account.Summary(time.Date(2018, time.June, 15, 0, 0, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC), summary.Month)
+	require.Len(t, summary.Totals, 2)
+	require.Len(t, summary.Merchants, 2)
+
+	b, err := json.Marshal(summary)
+
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"month": "2018-06-01T00:00:00Z",
+		"totals": [
+			{"currency": "GBP", "loaded": "50", "authorized": "30", "captured": "20", "reversed": "10", "refunded": "5", "adjusted": "0", "chargedBack": "0"},
+			{"currency": "EUR", "loaded": "20", "authorized": "10", "captured": "0", "reversed": "0", "refunded": "0", "adjusted": "0", "chargedBack": "0"}
+		],
+		"merchants": [
+			{"merchantID": 1, "currency": "EUR", "loaded": "0", "authorized": "10", "captured": "0", "reversed": "0", "refunded": "0", "adjusted": "0", "chargedBack": "0"},
+			{"merchantID": 2, "currency": "GBP", "loaded": "0", "authorized": "30", "captured": "20", "reversed": "10", "refunded": "5", "adjusted": "0", "chargedBack": "0"}
+		]
+	}`, string(b))
+
+	t.Run("Chargebacks", func(t *testing.T) {
+		account := account.Clone()
+		d, err := account.OpenDispute(ctx, au.ID+1, apd.New(5, 0), "not received")
+
+		require.NoError(t, err)
+
+		summary, err := account.Summary(now)
+
+		require.NoError(t, err)
+		require.Equal(t, "5", summary.Totals[0].ChargedBack.Text('f'))
+		require.Equal(t, "5", summary.Merchants[1].ChargedBack.Text('f'))
+		require.True(t, summary.Totals[1].ChargedBack.IsZero())
+
+		// Re-debits are netted against the provisional credit
+		_, err = account.RejectDispute(ctx, d.ID)
+
+		require.NoError(t, err)
+
+		summary, err = account.Summary(now)
+
+		require.NoError(t, err)
+		require.True(t, summary.Totals[0].ChargedBack.IsZero())
+		require.True(t, summary.Merchants[1].ChargedBack.IsZero())
+	})
+
+	t.Run("Previous month", func(t *testing.T) {
+		summary, err := account.Summary(time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+		require.NoError(t, err)
+		require.Zero(t, summary.Totals[0].Loaded.Cmp(apd.New(100, 0)))
+		require.Empty(t, summary.Merchants)
+	})
+}
@@ -0,0 +1,128 @@
+package card
+
+import (
+	"context"
+	"text/template"
+
+	"github.com/cockroachdb/apd"
+)
+
+// StatementData is the data passed to statement templates.
+type StatementData struct {
+	AccountID int
+	Sections  []StatementSection
+}
+
+// StatementSection represents the balance and transactions of a single
+// currency. Amounts are formatted according to the statement options.
+type StatementSection struct {
+	Currency          string
+	Balance           *Balance
+	Available         string
+	Blocked           string
+	Total             string
+	OverdraftUsed     string
+	OverdraftHeadroom string
+	Lines             []StatementLine
+}
+
+// StatementLine represents a statement transaction.
+type StatementLine struct {
+	Transaction Transaction
+	Date        string
+	Type        string
+	Merchant    string
+	Amount      string
+}
+
+// WithTemplate renders the statement using the given template, executed
+// with a StatementData value, in place of the default layout.
+func WithTemplate(t *template.Template) StatementOption {
+	return func(o *statementOptions) {
+		o.template = t
+	}
+}
+
+// statementData returns the statement sections of each held currency.
+func (a *Account) statementData(o *statementOptions) (*StatementData, error) {
+	balances, err := a.Balances(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		data            = &StatementData{AccountID: a.ID}
+		transactions, _ = a.page(o)
+	)
+
+	for _, currency := range a.Currencies() {
+		s, err := o.statementSection(currency, balances[currency], transactions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data.Sections = append(data.Sections, *s)
+	}
+
+	return data, nil
+}
+
+// statementSection returns the balance and the given transactions in a single
+// currency.
+func (o *statementOptions) statementSection(currency string, balance *Balance, transactions []Transaction) (*StatementSection, error) {
+	s := &StatementSection{Currency: currency, Balance: balance}
+	amounts := []struct {
+		dst *string
+		v   *apd.Decimal
+	}{
+		{&s.Available, balance.Available},
+		{&s.Blocked, balance.Blocked},
+		{&s.Total, balance.Total},
+		{&s.OverdraftUsed, balance.OverdraftUsed},
+		{&s.OverdraftHeadroom, balance.OverdraftHeadroom},
+	}
+
+	for _, v := range amounts {
+		if v.v == nil {
+			continue
+		}
+
+		formatted, err := o.formatAmount(v.v, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*v.dst = formatted
+	}
+
+	for _, v := range transactions {
+		if v.Currency != currency {
+			continue
+		}
+
+		var merchant string
+
+		if v.MerchantID != nil {
+			merchant = o.merchantName(*v.MerchantID)
+		}
+
+		amount, err := o.formatAmount(v.Amount, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.Lines = append(s.Lines, StatementLine{
+			Transaction: v,
+			Date:        v.Timestamp.UTC().Format(timestampFormat),
+			Type:        o.operationName(v.Type),
+			Merchant:    merchant,
+			Amount:      amount,
+		})
+	}
+
+	return s, nil
+}
@@ -0,0 +1,40 @@
+package card_test
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementTemplate(t *testing.T) {
+	account := NewAccount(7)
+
+	require.NoError(t, account.Load(ctx, decimalFromString("1234.5"), DefaultCurrency))
+
+	_, err := account.Authorize(ctx, merchantID, apd.New(20, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+
+	tmpl := template.Must(template.New("statement").Parse(`Account {{.AccountID}}
+{{range .Sections}}{{.Currency}} {{.Available}}/{{.Total}}
+{{range .Lines}}{{.Transaction.ID}},{{.Transaction.Type}},{{.Merchant}},{{.Amount}}
+{{end}}{{end}}`))
+	statement, err := account.Statement(WithTemplate(tmpl), WithLocale("en-GB"))
+
+	require.NoError(t, err)
+	require.Equal(t, `Account 7
+GBP £1,214.50/£1,234.50
+1,LOAD,,£1,234.50
+2,AUTHORIZE,1,£20.00
+`, statement)
+
+	t.Run("Execution error", func(t *testing.T) {
+		tmpl := template.Must(template.New("statement").Parse(`{{.Missing}}`))
+		_, err := account.Statement(WithTemplate(tmpl))
+
+		require.Error(t, err)
+	})
+}
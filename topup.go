@@ -0,0 +1,69 @@
+package card
+
+import (
+	"context"
+
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// TopUp represents an automatic top-up rule, loading a fixed amount in the
+// account currency whenever an authorization or capture leaves the available
+// balance below the threshold.
+type TopUp struct {
+	Threshold *apd.Decimal `json:"threshold"`
+	Amount    *apd.Decimal `json:"amount"`
+}
+
+// SetTopUp loads the given amount whenever an authorization or capture leaves
+// the available balance in the account currency below the given threshold. A
+// nil amount removes the top-up.
+func (a *Account) SetTopUp(threshold, amount *apd.Decimal) error {
+	if amount == nil {
+		a.TopUp = nil
+		a.bump()
+
+		return nil
+	}
+
+	if threshold == nil {
+		return ErrInvalidAmount
+	}
+
+	if threshold.Form != apd.Finite {
+		return amountError(ErrInvalidAmount, threshold, nil)
+	}
+
+	if amount.Form != apd.Finite || amount.Sign() <= 0 {
+		return amountError(ErrInvalidAmount, amount, nil)
+	}
+
+	a.TopUp = &TopUp{
+		Threshold: apd.New(0, 0).Set(threshold),
+		Amount:    apd.New(0, 0).Set(amount),
+	}
+	a.bump()
+
+	return nil
+}
+
+// topUp records the top-up load if the available balance has fallen below the
+// top-up threshold. The load is system-originated and referenced as a top-up.
+// Top-ups are best-effort: the operation triggering one has already been
+// applied, so a failed load is reported to the top-up failure observers
+// instead of failing the operation.
+func (a *Account) topUp(ctx context.Context) {
+	if a.TopUp == nil || a.Available.Cmp(a.TopUp.Threshold) >= 0 {
+		return
+	}
+
+	err := a.Load(ctx, a.TopUp.Amount, a.Currency,
+		WithDescription("automatic top-up"),
+		WithReference("top-up"),
+		WithOrigin(OriginSystem),
+	)
+
+	if err != nil {
+		a.notifyTopUpFailure(errors.Wrap(err, "top-up"))
+	}
+}
@@ -0,0 +1,103 @@
+package card_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopUp(t *testing.T) {
+	account := NewAccount(0)
+
+	require.Equal(t, ErrInvalidAmount, errors.Cause(account.SetTopUp(nil, apd.New(1, 0))))
+	require.Equal(t, ErrInvalidAmount, errors.Cause(account.SetTopUp(apd.New(1, 0), apd.New(0, 0))))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.SetTopUp(apd.New(20, 0), apd.New(50, 0)))
+
+	// Above the threshold
+	au, err := account.Authorize(ctx, merchantID, apd.New(70, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Zero(t, account.Available.Cmp(apd.New(30, 0)))
+
+	// Below the threshold
+	_, err = account.Authorize(ctx, merchantID, apd.New(15, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.Zero(t, account.Available.Cmp(apd.New(65, 0)))
+
+	load := account.Transactions[len(account.Transactions)-1]
+
+	require.Equal(t, Load, load.Type)
+	require.Equal(t, OriginSystem, load.Origin)
+	require.Equal(t, "top-up", load.Reference)
+	require.Zero(t, load.Amount.Cmp(apd.New(50, 0)))
+
+	// Captures are evaluated too
+	require.NoError(t, account.SetTopUp(apd.New(70, 0), apd.New(10, 0)))
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(70, 0), DefaultCurrency))
+	require.Zero(t, account.Available.Cmp(apd.New(75, 0)))
+	require.NoError(t, account.Validate())
+
+	b, err := json.Marshal(account.TopUp)
+
+	require.NoError(t, err)
+	require.JSONEq(t, `{"threshold":"70","amount":"10"}`, string(b))
+
+	clone := account.Clone()
+	clone.TopUp.Amount.SetInt64(1)
+
+	require.Zero(t, account.TopUp.Amount.Cmp(apd.New(10, 0)))
+
+	// Removed
+	require.NoError(t, account.SetTopUp(nil, nil))
+	require.Nil(t, account.TopUp)
+
+	_, err = account.Authorize(ctx, merchantID, apd.New(75, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.True(t, account.Available.IsZero())
+}
+
+func TestTopUpFailure(t *testing.T) {
+	account := NewAccount(0)
+
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.SetTopUp(apd.New(50, 0), apd.New(50, 0)))
+
+	var failures []error
+
+	account.OnTopUpFailure(func(err error) {
+		failures = append(failures, err)
+	})
+
+	// Cancelling the request once the operation is recorded fails the top-up
+	cancelled, cancel := context.WithCancel(ctx)
+
+	account.OnTransaction(func(Transaction) {
+		cancel()
+	})
+
+	au, err := account.Authorize(cancelled, merchantID, apd.New(60, 0), DefaultCurrency)
+
+	require.NoError(t, err, "the authorization succeeds")
+	require.NotNil(t, au)
+	require.Len(t, failures, 1)
+	require.Equal(t, context.Canceled, errors.Cause(failures[0]))
+	require.Equal(t, Authorize, account.Transactions[len(account.Transactions)-1].Type, "no top-up recorded")
+	require.Zero(t, account.Available.Cmp(apd.New(40, 0)))
+
+	cancelled, cancel = context.WithCancel(ctx)
+
+	defer cancel()
+
+	require.NoError(t, account.Capture(cancelled, au.ID, apd.New(60, 0), DefaultCurrency))
+	require.Len(t, failures, 2)
+	require.Equal(t, Capture, account.Transactions[len(account.Transactions)-1].Type)
+	require.NoError(t, account.Validate())
+}
@@ -0,0 +1,125 @@
+package card
+
+import (
+	"github.com/cockroachdb/apd"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidState is returned when the account balances are inconsistent.
+var ErrInvalidState = newError("INVALID_STATE", "account state is inconsistent")
+
+// Validate checks the internal consistency of the account: the account
+// currency is a valid ISO 4217 code, the total balance of each currency
+// matches the transaction log, blocked amounts match the merchant holds and no
+// balance is negative beyond the overdraft.
+func (a *Account) Validate() error {
+	if !validCurrency(a.Currency) {
+		return errors.Wrapf(ErrInvalidCurrency, "%q", a.Currency)
+	}
+
+	dctx := a.decimalContext()
+	totals := map[string]*apd.Decimal{}
+
+	for _, v := range a.Transactions {
+		total, exists := totals[v.Currency]
+
+		if !exists {
+			total = apd.New(0, 0)
+			totals[v.Currency] = total
+		}
+
+		var err error
+
+		switch v.Type {
+		case Load, Refund, Adjustment, Chargeback:
+			_, err = dctx.Add(total, total, v.Amount)
+		case Capture:
+			_, err = dctx.Sub(total, total, v.Amount)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, currency := range a.Currencies() {
+		p, _ := a.pocket(currency)
+		err := a.validatePocket(currency, p, totals[currency])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePocket checks the balances held in the given currency against the
+// total implied by the transaction log.
+func (a *Account) validatePocket(currency string, p *Pocket, logged *apd.Decimal) error {
+	if p.Available == nil || p.Blocked == nil {
+		return errors.Wrapf(ErrInvalidState, "%s balance missing", currency)
+	}
+
+	dctx := a.decimalContext()
+	floor := apd.New(0, 0)
+
+	if currency == a.Currency && a.Overdraft != nil {
+		floor.Neg(a.Overdraft)
+	}
+
+	if p.Available.Cmp(floor) < 0 {
+		return errors.Wrapf(ErrInvalidState, "%s available balance %s exceeds overdraft", currency, p.Available)
+	}
+
+	if p.Blocked.Sign() < 0 {
+		return errors.Wrapf(ErrInvalidState, "%s blocked balance %s is negative", currency, p.Blocked)
+	}
+
+	total := apd.New(0, 0)
+	_, err := dctx.Add(total, p.Available, p.Blocked)
+
+	if err != nil {
+		return err
+	}
+
+	if logged == nil {
+		logged = apd.New(0, 0)
+	}
+
+	if total.Cmp(logged) != 0 {
+		return errors.Wrapf(ErrInvalidState, "%s balance %s doesn't match transaction log %s", currency, total, logged)
+	}
+
+	held := apd.New(0, 0)
+
+	for id, m := range p.Merchants {
+		// Refunds may exceed the amount captured since the last settlement
+		captured := m.Captured
+
+		if m.Settled != nil {
+			captured = apd.New(0, 0)
+			_, err = dctx.Add(captured, m.Captured, m.Settled)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if m.Available.Sign() < 0 || captured.Sign() < 0 {
+			return errors.Wrapf(ErrInvalidState, "%s merchant %d balance is negative", currency, id)
+		}
+
+		_, err = dctx.Add(held, held, m.Available)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Blocked.Cmp(held) != 0 {
+		return errors.Wrapf(ErrInvalidState, "%s blocked balance %s doesn't match merchant holds %s", currency, p.Blocked, held)
+	}
+
+	return nil
+}
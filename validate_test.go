@@ -0,0 +1,53 @@
+package card_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	. "github.com/martingallagher/card"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	account := NewAccount(0, WithOverdraft(apd.New(50, 0)))
+
+	require.NoError(t, account.Validate())
+	require.NoError(t, account.AddCurrency("EUR"))
+	require.NoError(t, account.Load(ctx, apd.New(100, 0), DefaultCurrency))
+	require.NoError(t, account.Load(ctx, apd.New(20, 0), "EUR"))
+
+	au, err := account.Authorize(ctx, merchantID, apd.New(120, 0), DefaultCurrency)
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, au.ID, apd.New(60, 0), DefaultCurrency))
+	require.NoError(t, account.Reverse(ctx, au.ID, apd.New(10, 0), DefaultCurrency))
+	require.NoError(t, account.Refund(ctx, au.ID, apd.New(5, 0), DefaultCurrency))
+
+	eur, err := account.Authorize(ctx, merchantID, apd.New(5, 0), "EUR")
+
+	require.NoError(t, err)
+	require.NoError(t, account.Capture(ctx, eur.ID, apd.New(5, 0), "EUR"))
+	require.NoError(t, account.Validate())
+
+	t.Run("Transaction log mismatch", func(t *testing.T) {
+		clone := account.Clone()
+		clone.Available.SetInt64(1000)
+
+		require.Equal(t, ErrInvalidState, errors.Cause(clone.Validate()))
+	})
+
+	t.Run("Merchant holds mismatch", func(t *testing.T) {
+		clone := account.Clone()
+		clone.Merchants[merchantID].Available.SetInt64(1)
+
+		require.Equal(t, ErrInvalidState, errors.Cause(clone.Validate()))
+	})
+
+	t.Run("Negative balance", func(t *testing.T) {
+		clone := account.Clone()
+		clone.Overdraft = nil
+
+		require.Equal(t, ErrInvalidState, errors.Cause(clone.Validate()))
+	})
+}